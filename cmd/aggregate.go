@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/fauzanelka/99tech-order-processor/internal/aggregate"
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/fauzanelka/99tech-order-processor/internal/orderfile"
+)
+
+var (
+	// Flags
+	aggregateTo    string
+	aggregateBy    []string
+	aggregateAll   bool
+	aggregateSince string
+	aggregateUntil string
+
+	// Aggregate command
+	aggregateCmd = &cobra.Command{
+		Use:   "aggregate <input> [output]",
+		Short: "Total orders by symbol and side without requesting them",
+		Long: `Reads orders from the input file, joins any --enrich lookup columns, applies
+the --symbol and --side filters and any --since/--until time range, and
+writes the number of matching orders, their total quantity, their notional
+value (quantity times price), their volume-weighted average price, and their
+average price per symbol and side. No API requests are made. Totals are
+written to the output file as JSON or CSV, inferred from its extension unless
+--to is given, or as JSON to stdout.`,
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			to := aggregateTo
+			if to == "" && len(args) == 2 {
+				to = aggregate.Detect(args[1])
+			}
+			if to == "" {
+				to = aggregate.FormatJSON
+			}
+			if to != aggregate.FormatJSON && to != aggregate.FormatCSV {
+				return fmt.Errorf("unsupported aggregate format %q: must be %s or %s", to, aggregate.FormatJSON, aggregate.FormatCSV)
+			}
+			// Totals written to stdout must not be mixed with log output
+			if len(args) == 1 {
+				logger.SetOutput(os.Stderr)
+			}
+
+			agg, err := aggregate.New(aggregateBy)
+			if err != nil {
+				return err
+			}
+
+			matched, err := readOrders(args[0], aggregateAll, agg.Add)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if len(args) == 2 {
+				f, err := os.Create(args[1])
+				if err != nil {
+					return fmt.Errorf("failed to create output file: %w", err)
+				}
+				defer f.Close()
+				out = f
+			}
+			if err := agg.Write(out, to); err != nil {
+				return fmt.Errorf("failed to write totals: %w", err)
+			}
+			logger.Infof("Aggregated %d orders", matched)
+			return nil
+		},
+	}
+)
+
+func init() {
+	aggregateCmd.Flags().StringVar(&aggregateTo, "to", "", "Output format (json/csv); inferred from the output extension when empty")
+	aggregateCmd.Flags().StringSliceVar(&aggregateBy, "group-by", []string{aggregate.BySymbol, aggregate.BySide}, "Fields to total orders by (symbol, side); none for a single total")
+	aggregateCmd.Flags().BoolVar(&aggregateAll, "all", false, "Aggregate all orders, ignoring the symbol and side filters")
+	aggregateCmd.Flags().StringVar(&aggregateSince, "since", "", "Only aggregate orders timestamped at or after this time (RFC 3339 or a --timestamp-format)")
+	aggregateCmd.Flags().StringVar(&aggregateUntil, "until", "", "Only aggregate orders timestamped before this time (RFC 3339 or a --timestamp-format)")
+
+	rootCmd.AddCommand(aggregateCmd)
+}
+
+// readOrders reads the orders of an input file that pass the --symbol and
+// --side filters, or all of them if all is set, and the --since/--until
+// time range, joins any --enrich lookup columns, and calls fn for each.
+// Invalid records are skipped with a warning. It returns the number of
+// orders read.
+func readOrders(path string, all bool, fn func(models.Order)) (int, error) {
+	from := inputFmt
+	if from == "" {
+		from = orderfile.Detect(path)
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer in.Close()
+
+	return scanOrders(in, from, all, func(order models.Order) error {
+		fn(order)
+		return nil
+	})
+}
+
+// scanOrders reads orders in format from r like readOrders, stopping at the
+// first error returned by fn
+func scanOrders(r io.Reader, format string, all bool, fn func(models.Order) error) (int, error) {
+	opts, err := readerOptions()
+	if err != nil {
+		return 0, err
+	}
+	reader, err := orderfile.NewReader(format, r, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	table, err := enrichTable()
+	if err != nil {
+		return 0, err
+	}
+
+	filter := models.NewFilter(symbol, side)
+	if aggregateSince != "" {
+		if filter.Since, err = models.ParseTimestamp(aggregateSince); err != nil {
+			return 0, fmt.Errorf("invalid --since: %w", err)
+		}
+	}
+	if aggregateUntil != "" {
+		if filter.Until, err = models.ParseTimestamp(aggregateUntil); err != nil {
+			return 0, fmt.Errorf("invalid --until: %w", err)
+		}
+	}
+	matched := 0
+	for {
+		order, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var perr *orderfile.ParseError
+		if errors.As(err, &perr) {
+			logger.Warnf("Line %d is not a valid order: %v", perr.Line, perr.Err)
+			continue
+		}
+		if err != nil {
+			return matched, err
+		}
+
+		table.Apply(&order)
+		// --all skips the symbol and side filters but not the time range
+		if all {
+			filter.Symbols, filter.Sides = []string{order.Symbol}, []string{order.Side}
+		}
+		if !filter.Match(order) {
+			continue
+		}
+		if err := fn(order); err != nil {
+			return matched, err
+		}
+		matched++
+	}
+	return matched, nil
+}
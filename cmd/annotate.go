@@ -0,0 +1,10 @@
+package cmd
+
+var (
+	// Flags
+	githubAnnotations bool
+)
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&githubAnnotations, "github-annotations", false, "Annotate the input lines of rejected records and failed orders with GitHub Actions workflow commands, so they show inline on pull requests")
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/cluster"
+	"github.com/fauzanelka/99tech-order-processor/internal/processor"
+	"github.com/fauzanelka/99tech-order-processor/internal/systemd"
+)
+
+// sourceCoordinator reads orders leased from a coordinator
+const sourceCoordinator = "coordinator"
+
+var (
+	// Flags
+	coordinatorAddr  string
+	coordinatorURL   string
+	coordinatorToken string
+	coordinatorCert  string
+	coordinatorKey   string
+	leaseTimeout     time.Duration
+	workerBatch      int
+)
+
+// runCoordinator reads the input and distributes its orders to workers
+func runCoordinator(proc *processor.Processor) error {
+	if sourceKind != sourceFile {
+		return fmt.Errorf("--coordinator-addr reads a file and cannot be used with --source %s", sourceKind)
+	}
+	if schedule != "" {
+		return fmt.Errorf("--schedule cannot be used with --coordinator-addr")
+	}
+	if ckptFile != "" {
+		return fmt.Errorf("--checkpoint cannot be used with --coordinator-addr")
+	}
+	var config *tls.Config
+	switch {
+	case coordinatorCert != "" || coordinatorKey != "":
+		if coordinatorCert == "" || coordinatorKey == "" {
+			return errors.New("--coordinator-cert and --coordinator-key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(coordinatorCert, coordinatorKey)
+		if err != nil {
+			return fmt.Errorf("failed to load coordinator certificate: %w", err)
+		}
+		config = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	case coordinatorToken != "":
+		if host, _, err := net.SplitHostPort(coordinatorAddr); err != nil || !cluster.Loopback(host) {
+			logger.Warnf("Workers will send --coordinator-token in clear text, since the coordinator is not serving TLS; pass --coordinator-cert and --coordinator-key unless a TLS proxy is in front of it")
+		}
+	}
+	ln, err := net.Listen("tcp", coordinatorAddr)
+	if err != nil {
+		return err
+	}
+	if config != nil {
+		ln = tls.NewListener(ln, config)
+	}
+	return proc.ProcessDistributed(ln, cluster.Options{
+		Token:        coordinatorToken,
+		LeaseTimeout: leaseTimeout,
+		// Keep enough orders queued for every worker to lease a full batch
+		MaxOutstanding: 100 * workerBatch,
+	})
+}
+
+// runWorker requests the orders leased from a coordinator until the run is
+// complete or interrupted
+func runWorker(proc *processor.Processor) error {
+	if coordinatorURL == "" {
+		return fmt.Errorf("--coordinator-url is required with --source %s", sourceCoordinator)
+	}
+	client, err := cluster.NewClient(coordinatorURL, coordinatorToken, defaultConsumerName(), insecure)
+	if err != nil {
+		return err
+	}
+	systemd.Notify("READY=1")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	logger.Infof("Working on orders from %s as %s", coordinatorURL, client.Worker())
+	return proc.ProcessTasks(ctx, client, workerBatch)
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&coordinatorAddr, "coordinator-addr", "", "Distribute the input's orders to workers connecting on this address (host:port) instead of requesting them here")
+	rootCmd.PersistentFlags().StringVar(&coordinatorURL, "coordinator-url", "", "Coordinator to request orders for, with --source coordinator")
+	rootCmd.PersistentFlags().StringVar(&coordinatorToken, "coordinator-token", "", secretEnv(&coordinatorToken, "COORDINATOR_TOKEN", "Shared token workers authenticate to the coordinator with"))
+	rootCmd.PersistentFlags().StringVar(&coordinatorCert, "coordinator-cert", "", "PEM certificate the coordinator serves HTTPS to workers with")
+	rootCmd.PersistentFlags().StringVar(&coordinatorKey, "coordinator-key", "", "PEM private key of --coordinator-cert")
+	rootCmd.PersistentFlags().DurationVar(&leaseTimeout, "lease-timeout", 5*time.Minute, "How long a worker has to return an order before it is handed to another worker")
+	rootCmd.PersistentFlags().IntVar(&workerBatch, "worker-batch", 10, "Orders a worker leases from the coordinator at a time")
+}
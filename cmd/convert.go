@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/fauzanelka/99tech-order-processor/internal/orderfile"
+)
+
+var (
+	// Flags
+	convertTo  string
+	convertAll bool
+
+	// Convert command
+	convertCmd = &cobra.Command{
+		Use:   "convert <input> <output>",
+		Short: "Convert orders between file formats",
+		Long: `Reads orders from the input file, joins any --enrich lookup columns, applies
+the --symbol and --side filters, and writes the matching orders to the output
+file in another format. No API requests are made. Formats are inferred from
+file extensions unless --input-format or --to are given.`,
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			from := inputFmt
+			if from == "" {
+				from = orderfile.Detect(args[0])
+			}
+			to := convertTo
+			if to == "" {
+				to = orderfile.Detect(args[1])
+			}
+			// Checked before the output file is created, so it is not left empty
+			if !orderfile.Writable(to) {
+				return fmt.Errorf("unsupported output format %q", to)
+			}
+
+			in, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open input file: %w", err)
+			}
+			defer in.Close()
+
+			opts, err := readerOptions()
+			if err != nil {
+				return err
+			}
+			reader, err := orderfile.NewReader(from, in, opts)
+			if err != nil {
+				return err
+			}
+
+			out, err := os.Create(args[1])
+			if err != nil {
+				return fmt.Errorf("failed to create output file: %w", err)
+			}
+			defer out.Close()
+
+			writer, err := orderfile.NewWriter(to, out)
+			if err != nil {
+				return err
+			}
+
+			table, err := enrichTable()
+			if err != nil {
+				return err
+			}
+
+			filter := models.NewFilter(symbol, side)
+			written := 0
+			for {
+				order, err := reader.Read()
+				if err == io.EOF {
+					break
+				}
+				var perr *orderfile.ParseError
+				if errors.As(err, &perr) {
+					logger.Warnf("Line %d is not a valid order: %v", perr.Line, perr.Err)
+					continue
+				}
+				if err != nil {
+					return err
+				}
+
+				table.Apply(&order)
+				if !convertAll && !filter.Match(order) {
+					continue
+				}
+				if err := writer.Write(order); err != nil {
+					return err
+				}
+				written++
+			}
+
+			if err := writer.Flush(); err != nil {
+				return fmt.Errorf("failed to write output file: %w", err)
+			}
+			logger.Infof("Converted %d orders from %s to %s", written, from, to)
+			return nil
+		},
+	}
+)
+
+func init() {
+	convertCmd.Flags().StringVar(&convertTo, "to", "", "Output format (jsonl/csv/parquet); inferred from the output extension when empty")
+	convertCmd.Flags().BoolVar(&convertAll, "all", false, "Convert all orders, ignoring the symbol and side filters")
+
+	rootCmd.AddCommand(convertCmd)
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/credential"
+	"github.com/fauzanelka/99tech-order-processor/internal/vault"
+)
+
+var (
+	// Flags
+	credentialField string
+)
+
+// credentialHeaders builds the request headers of each credential in the
+// configuration file, reading auth tokens given as secret references
+func credentialHeaders() (map[string]http.Header, error) {
+	if fileConfig == nil || len(fileConfig.Credentials) == 0 {
+		return nil, errors.New("--credential-field needs a credentials section in the --config file")
+	}
+	ctx := context.Background()
+	creds := make(map[string]http.Header, len(fileConfig.Credentials))
+	for value, c := range fileConfig.Credentials {
+		token := c.AuthToken
+		if vault.IsRef(token) || credential.IsKeyringRef(token) {
+			if vault.IsRef(token) && vaultClient == nil {
+				client, err := newVaultClient()
+				if err != nil {
+					return nil, err
+				}
+				vaultClient = client
+				go renewVaultToken()
+			}
+			secret, err := readSecret(ctx, token)
+			if err != nil {
+				return nil, fmt.Errorf("credentials for %q: %w", value, err)
+			}
+			token = secret
+		}
+		header, err := parseHeaders(c.Header, token)
+		if err != nil {
+			return nil, fmt.Errorf("credentials for %q: %w", value, err)
+		}
+		creds[value] = header
+	}
+	return creds, nil
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&credentialField, "credential-field", "", "Order field (e.g. account) whose value selects the API credentials of each request from the credentials section of the --config file")
+}
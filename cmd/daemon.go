@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/audit"
+	"github.com/fauzanelka/99tech-order-processor/internal/logfile"
+	"github.com/fauzanelka/99tech-order-processor/internal/processor"
+	"github.com/fauzanelka/99tech-order-processor/internal/rejects"
+	"github.com/fauzanelka/99tech-order-processor/internal/systemd"
+)
+
+var (
+	// Flags
+	pidFile string
+	logFile string
+
+	// logOut is the log file, if --log-file is set
+	logOut *logfile.File
+)
+
+// openLogFile sends log output to --log-file, if set
+func openLogFile() error {
+	if logFile == "" {
+		return nil
+	}
+	f, err := logfile.Open(logFile)
+	if err != nil {
+		return err
+	}
+	logOut = f
+	logger.SetOutput(f)
+	return nil
+}
+
+// startDaemon writes the PID file, pings the systemd watchdog, and reopens
+// the log, audit, rejects, and appended output files on SIGHUP, so that they
+// can be rotated. Message sources report readiness to systemd once they are
+// connected; other modes are ready straight away. The returned function
+// tells systemd the service is stopping and removes the PID file.
+func startDaemon(proc *processor.Processor, auditLog *audit.Log, rejectWriter *rejects.Writer) (func(), error) {
+	if pidFile != "" {
+		if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write PID file: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go systemd.Watchdog(ctx)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				reopenFiles(proc, auditLog, rejectWriter)
+			}
+		}
+	}()
+
+	if sourceKind == sourceFile || sourceKind == sourcePostgres {
+		systemd.Notify("READY=1")
+	}
+	return func() {
+		systemd.Notify("STOPPING=1")
+		signal.Stop(hup)
+		cancel()
+		if pidFile != "" {
+			os.Remove(pidFile)
+		}
+	}, nil
+}
+
+// reopenFiles reopens the files written to over the whole run after they
+// have been rotated
+func reopenFiles(proc *processor.Processor, auditLog *audit.Log, rejectWriter *rejects.Writer) {
+	if logOut != nil {
+		if err := logOut.Reopen(); err != nil {
+			logger.Warnf("%v", err)
+		}
+	}
+	if err := auditLog.Reopen(); err != nil {
+		logger.Warnf("%v", err)
+	}
+	if err := rejectWriter.Reopen(); err != nil {
+		logger.Warnf("%v", err)
+	}
+	proc.ReopenOutputs()
+	logger.Infof("Reopened log files")
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&pidFile, "pid-file", "", "File to write the process ID to while running")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Append log output to this file instead of stdout; reopened on SIGHUP")
+}
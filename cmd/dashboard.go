@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/atomicfile"
+	"github.com/fauzanelka/99tech-order-processor/internal/processor"
+	"github.com/fauzanelka/99tech-order-processor/internal/storage"
+	"github.com/fauzanelka/99tech-order-processor/internal/webui"
+)
+
+var (
+	// Flags
+	dashboardAddr string
+)
+
+// serveDashboard serves the web dashboard for this run in the background
+func serveDashboard(proc *processor.Processor) error {
+	ln, err := net.Listen("tcp", dashboardAddr)
+	if err != nil {
+		return err
+	}
+
+	job := &webui.Job{
+		Name:    sourceKind,
+		Input:   sourceKind,
+		Output:  storage.Redact(outputFile),
+		Tracker: proc.Progress,
+		Files:   make(map[string]string),
+	}
+	if sourceKind == sourceFile {
+		job.Name = "file"
+		job.Input = storage.Redact(inputFile)
+	}
+	// Split, templated, and remote outputs have no single local file to offer
+	if splitBy == processor.SplitNone && !processor.IsPathTemplate(outputFile) && !storage.IsRemote(outputFile) {
+		job.Files["output"] = outputFile
+		if !appendOut {
+			job.Files["output-partial"] = outputFile + atomicfile.PartialSuffix
+		}
+	}
+	if rejectFile != "" {
+		job.Files["rejects"] = rejectFile
+	}
+	if auditFile != "" {
+		job.Files["audit-log"] = auditFile
+	}
+
+	logger.Infof("Serving dashboard on http://%s", ln.Addr())
+	go func() {
+		if err := http.Serve(ln, webui.New(job)); err != nil {
+			logger.Warnf("Dashboard stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&dashboardAddr, "dashboard-addr", "", "Serve a web dashboard of the run's progress on this address (host:port)")
+}
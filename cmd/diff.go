@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/fauzanelka/99tech-order-processor/internal/diff"
+)
+
+// Diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff <old-output> <new-output>",
+	Short: "Compare the output files of two runs",
+	Long: `Compares two output files and reports added, removed, and changed responses.
+Responses are matched by order ID when both files were written with
+--output-format envelope, and by line number otherwise. JSON responses are
+compared semantically, so key order and whitespace are ignored.`,
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		report, err := diff.Files(args[0], args[1])
+		if err != nil {
+			return err
+		}
+
+		label := "line"
+		if report.KeyedByOrder {
+			label = "order"
+		}
+		out := cmd.OutOrStdout()
+		for _, k := range report.Removed {
+			fmt.Fprintf(out, "- %s %s\n", label, k)
+		}
+		for _, k := range report.Added {
+			fmt.Fprintf(out, "+ %s %s\n", label, k)
+		}
+		for _, c := range report.Changed {
+			fmt.Fprintf(out, "~ %s %s\n  old: %s\n  new: %s\n", label, c.Key, c.Old, c.New)
+		}
+		fmt.Fprintf(out, "%d added, %d removed, %d changed\n",
+			len(report.Added), len(report.Removed), len(report.Changed))
+
+		if !report.Empty() {
+			return fmt.Errorf("outputs differ")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+}
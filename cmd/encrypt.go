@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/fauzanelka/99tech-order-processor/internal/encrypt"
+)
+
+var (
+	// Flags
+	encryptKey       string
+	encryptRecipient string
+	keygenIdentity   bool
+	decryptIdentity  string
+
+	// Keygen command
+	keygenCmd = &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate a key for encrypting outputs",
+		Long: `Prints a new random key for --encrypt-key. With --identity, prints a new
+private key for decrypting instead, followed by the public key to pass to
+--encrypt-recipient, so that the machines running the processor cannot
+decrypt what they write.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := cmd.OutOrStdout()
+			if !keygenIdentity {
+				key, err := encrypt.GenerateKey()
+				if err != nil {
+					return fmt.Errorf("failed to generate key: %w", err)
+				}
+				fmt.Fprintln(out, key)
+				return nil
+			}
+			identity, recipient, err := encrypt.GenerateIdentity()
+			if err != nil {
+				return fmt.Errorf("failed to generate identity: %w", err)
+			}
+			fmt.Fprintf(out, "# recipient: %s\n%s\n", recipient, identity)
+			return nil
+		},
+	}
+
+	// Decrypt command
+	decryptCmd = &cobra.Command{
+		Use:   "decrypt <file>",
+		Short: "Decrypt an encrypted output or rejects file",
+		Long: `Decrypts a file written with --encrypt-key or --encrypt-recipient to stdout,
+using the same --encrypt-key or the --identity of the recipient. A file left
+incomplete by an interrupted run is decrypted as far as it goes, and an error
+is reported after.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			d, err := encrypt.NewDecrypter(encryptKey, decryptIdentity)
+			if err != nil {
+				return err
+			}
+			in, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open encrypted file: %w", err)
+			}
+			defer in.Close()
+			if err := d.Decrypt(cmd.OutOrStdout(), in); err != nil {
+				return fmt.Errorf("failed to decrypt %s: %w", args[0], err)
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&encryptKey, "encrypt-key", "", secretEnv(&encryptKey, "ENCRYPT_KEY", "Base64 AES-256 key encrypting the output and rejects files (see the keygen command)"))
+	rootCmd.PersistentFlags().StringVar(&encryptRecipient, "encrypt-recipient", "", "Base64 X25519 public key the output and rejects files are encrypted for (see keygen --identity)")
+	keygenCmd.Flags().BoolVar(&keygenIdentity, "identity", false, "Generate a private key and its public key for --encrypt-recipient")
+	decryptCmd.Flags().StringVar(&decryptIdentity, "identity", "", secretEnv(&decryptIdentity, "ENCRYPT_IDENTITY", "Base64 X25519 private key of the recipient the file was encrypted for"))
+	rootCmd.AddCommand(keygenCmd)
+	rootCmd.AddCommand(decryptCmd)
+}
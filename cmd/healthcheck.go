@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/fauzanelka/99tech-order-processor/internal/healthcheck"
+	"github.com/fauzanelka/99tech-order-processor/internal/httpclient"
+)
+
+var (
+	// Flags
+	healthOrder string
+
+	// Healthcheck command
+	healthcheckCmd = &cobra.Command{
+		Use:   "healthcheck",
+		Short: "Check that the API can be reached and authenticated with",
+		Long: `Checks the API at --url step by step with the settings of a run: resolving its
+host, connecting, the TLS handshake, authenticating with --auth-token,
+--header, or --sigv4, and looking up a known order (--order). Each step is
+reported as PASS, FAIL, or SKIP, and the command exits non-zero if any step
+failed, so it can gate a long run:
+
+  order-processor healthcheck --order 123456 && order-processor --file orders.jsonl`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := tlsOptions()
+			if err != nil {
+				return fmt.Errorf("invalid TLS configuration: %w", err)
+			}
+			opts.Timeout = timeout
+			opts.Timeouts = timeouts
+			opts.Insecure = insecure
+			if opts.IPVersion, err = httpclient.ParseIPVersion(ipVersion); err != nil {
+				return fmt.Errorf("invalid IP version configuration: %w", err)
+			}
+			if len(resolve) > 0 {
+				if opts.Resolve, err = httpclient.ParseResolve(resolve); err != nil {
+					return fmt.Errorf("invalid resolve configuration: %w", err)
+				}
+			}
+			socket, apiURL, err := httpclient.SplitUnixURL(baseURL)
+			if err != nil {
+				return fmt.Errorf("invalid URL configuration: %w", err)
+			}
+			opts.Socket = socket
+			header, err := requestHeaders()
+			if err != nil {
+				return fmt.Errorf("invalid header configuration: %w", err)
+			}
+			signer, err := requestSigner(apiURL)
+			if err != nil {
+				return fmt.Errorf("invalid SigV4 configuration: %w", err)
+			}
+
+			checker := &healthcheck.Checker{
+				BaseURL: apiURL,
+				Options: opts,
+				Headers: header,
+				SigV4:   signer,
+				OrderID: healthOrder,
+			}
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Checking %s\n", baseURL)
+			var failed []string
+			for _, check := range checker.Run(context.Background()) {
+				switch {
+				case check.Err != nil:
+					fmt.Fprintf(out, "FAIL %-8s %v\n", check.Name, check.Err)
+					failed = append(failed, check.Name)
+				case check.Skipped:
+					fmt.Fprintf(out, "SKIP %-8s %s\n", check.Name, check.Detail)
+				default:
+					fmt.Fprintf(out, "PASS %-8s %s\n", check.Name, check.Detail)
+				}
+			}
+			if len(failed) > 0 {
+				return fmt.Errorf("healthcheck failed: %s", strings.Join(failed, ", "))
+			}
+			fmt.Fprintln(out, "healthcheck passed")
+			return nil
+		},
+	}
+)
+
+func init() {
+	healthcheckCmd.Flags().StringVar(&healthOrder, "order", "", "Known order ID that must be found; without it, only a made-up order is requested to check authentication")
+
+	rootCmd.AddCommand(healthcheckCmd)
+}
@@ -0,0 +1,14 @@
+package cmd
+
+import (
+	"time"
+)
+
+var (
+	// Flags
+	heartbeat time.Duration
+)
+
+func init() {
+	rootCmd.PersistentFlags().DurationVar(&heartbeat, "heartbeat", 0, "Log a line of progress (processed, failed, rate, ETA) at this interval (e.g. 30s)")
+}
@@ -0,0 +1,10 @@
+package cmd
+
+var (
+	// Flags
+	reportJUnit string
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&reportJUnit, "report-junit", "", "JUnit XML report of each run, in which each order is a test case, for CI systems to gate on (local path, gs:// or az:// URI)")
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/fauzanelka/99tech-order-processor/internal/storage"
+)
+
+// secretFlag matches the names of flags whose values are kept out of the
+// manifest
+var secretFlag = regexp.MustCompile(`token|key|secret|password|dsn|header|credential|identity`)
+
+// runConfig returns the flags set for a run, from the command line or the
+// config file, for its manifest. Secrets are redacted, and flags given as
+// vault: or keyring: references are recorded as the references.
+func runConfig(flags *pflag.FlagSet) map[string]string {
+	config := make(map[string]string)
+	flags.Visit(func(f *pflag.Flag) {
+		value := f.Value.String()
+		if ref, ok := secretRefs[f.Name]; ok {
+			value = ref
+		} else if secretFlag.MatchString(f.Name) {
+			value = "REDACTED"
+		} else if strings.Contains(value, "://") {
+			if u, err := url.Parse(value); err == nil && u.User != nil {
+				value = u.Redacted()
+			}
+			value = storage.Redact(value)
+		}
+		config[f.Name] = value
+	})
+	return config
+}
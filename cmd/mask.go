@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"github.com/fauzanelka/99tech-order-processor/internal/mask"
+)
+
+var (
+	// Flags
+	maskFields   []string
+	maskStrategy string
+	maskKey      string
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringSliceVar(&maskFields, "mask-fields", nil, "Comma-separated field names (e.g. account,client_id) anonymized in the results written")
+	rootCmd.PersistentFlags().StringVar(&maskStrategy, "mask-strategy", mask.StrategyHash, "How masked fields are anonymized: hash (SHA-256, keyed with --mask-key) or fixed (***)")
+	rootCmd.PersistentFlags().StringVar(&maskKey, "mask-key", "", secretEnv(&maskKey, "MASK_KEY", "Secret key for hashing masked fields, so hashes cannot be reversed by guessing values"))
+}
@@ -0,0 +1,16 @@
+package cmd
+
+var (
+	// Flags
+	outlierPercent float64
+	outlierStdDevs float64
+	reviewFile     string
+	holdOutliers   bool
+)
+
+func init() {
+	rootCmd.PersistentFlags().Float64Var(&outlierPercent, "outlier-percent", 0, "Flag orders whose price is more than this percentage from the median price of their symbol in the input (0 disables)")
+	rootCmd.PersistentFlags().Float64Var(&outlierStdDevs, "outlier-stddev", 0, "Flag orders whose price is more than this many standard deviations from the median price of their symbol in the input (0 disables)")
+	rootCmd.PersistentFlags().StringVar(&reviewFile, "outlier-review", "", "JSONL file the orders flagged as outliers are written to for review")
+	rootCmd.PersistentFlags().BoolVar(&holdOutliers, "outlier-hold", false, "Do not process orders flagged as outliers, only write them for review")
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/fauzanelka/99tech-order-processor/internal/mask"
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/fauzanelka/99tech-order-processor/internal/orderfile"
+	"github.com/fauzanelka/99tech-order-processor/internal/processor"
+	"github.com/fauzanelka/99tech-order-processor/internal/rules"
+)
+
+var (
+	// Flags
+	pipeTo  string
+	pipeAll bool
+
+	// Pipe command
+	pipeCmd = &cobra.Command{
+		Use:   "pipe",
+		Short: "Filter and transform orders from stdin to stdout without requesting them",
+		Long: `Reads orders from stdin, joins any --enrich lookup columns, applies the
+--symbol, --side, and --since/--until filters and any --rules, masks the
+--mask-fields, and writes each remaining order to stdout as it is read, so
+the tool can sit in the middle of a shell pipeline. Orders are written as
+JSON lines, as CSV with --to csv, or rendered with --output-template, which
+is given the order with no response. No API requests are made. The input is
+JSON lines unless --input-format is given; logs go to stderr.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Records written to stdout must not be mixed with log output
+			logger.SetOutput(os.Stderr)
+			from := inputFmt
+			if from == "" {
+				from = orderfile.JSONL
+			}
+
+			masker, err := mask.New(maskFields, maskStrategy, maskKey)
+			if err != nil {
+				return fmt.Errorf("invalid mask configuration: %w", err)
+			}
+			var ruleSet *rules.Set
+			if rulesFile != "" {
+				if ruleSet, err = rules.Load(rulesFile); err != nil {
+					return err
+				}
+			}
+
+			out := bufio.NewWriter(cmd.OutOrStdout())
+			var write func(order models.Order) error
+			if outputTmpl != "" {
+				tmpl, err := processor.ParseOutputTemplate(outputTmpl)
+				if err != nil {
+					return fmt.Errorf("invalid output template: %w", err)
+				}
+				write = func(order models.Order) error {
+					var buf bytes.Buffer
+					if err := tmpl.Execute(&buf, processor.TemplateData{Order: order}); err != nil {
+						return fmt.Errorf("failed to render output template: %w", err)
+					}
+					out.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+					return out.WriteByte('\n')
+				}
+			} else {
+				to := pipeTo
+				if to == "" {
+					to = orderfile.JSONL
+				}
+				// A Parquet file is only readable once its footer is written
+				if to == orderfile.Parquet {
+					return fmt.Errorf("Parquet output cannot be streamed; use convert instead")
+				}
+				writer, err := orderfile.NewWriter(to, out)
+				if err != nil {
+					return err
+				}
+				write = func(order models.Order) error {
+					if err := writer.Write(order); err != nil {
+						return err
+					}
+					return writer.Flush()
+				}
+			}
+
+			written, err := scanOrders(cmd.InOrStdin(), from, pipeAll, func(order models.Order) error {
+				if reasons := ruleSet.Check(order, time.Now()); len(reasons) > 0 {
+					logger.Warnf("Skipping order %s: %s", order.OrderID, strings.Join(reasons, "; "))
+					return nil
+				}
+				order.Extra = masker.Map(order.Extra)
+				if err := write(order); err != nil {
+					return err
+				}
+				// Each record is passed on as soon as it is read
+				return out.Flush()
+			})
+			if err != nil {
+				return err
+			}
+			logger.Debugf("Passed on %d orders", written)
+			return nil
+		},
+	}
+)
+
+func init() {
+	pipeCmd.Flags().StringVar(&pipeTo, "to", "", "Output format (jsonl/csv) when no --output-template is given; jsonl when empty")
+	pipeCmd.Flags().BoolVar(&pipeAll, "all", false, "Pass on all orders, ignoring the symbol and side filters")
+	pipeCmd.Flags().StringVar(&aggregateSince, "since", "", "Only pass on orders timestamped at or after this time (RFC 3339 or a --timestamp-format)")
+	pipeCmd.Flags().StringVar(&aggregateUntil, "until", "", "Only pass on orders timestamped before this time (RFC 3339 or a --timestamp-format)")
+
+	rootCmd.AddCommand(pipeCmd)
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"github.com/fauzanelka/99tech-order-processor/internal/processor"
+)
+
+var (
+	// Flags
+	pushGateway  string
+	pushJob      string
+	pushInstance string
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&pushGateway, "push-gateway", "", "Prometheus Pushgateway URL the metrics of each run are pushed to when it ends")
+	rootCmd.PersistentFlags().StringVar(&pushJob, "push-job", "order_processor", "Job label of the metrics pushed to --push-gateway")
+	rootCmd.PersistentFlags().StringVar(&pushInstance, "push-instance", "", "Instance label of the metrics pushed to --push-gateway (default the hostname)")
+}
+
+// pushMetrics pushes the metrics of a run that has ended, failed if err is
+// set, to the Pushgateway. A failed push is logged and does not fail the
+// run.
+func pushMetrics(proc *processor.Processor, err error) {
+	if perr := proc.Metrics.Push(err == nil); perr != nil {
+		logger.Warnf("Failed to push metrics: %v", perr)
+	}
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"github.com/fauzanelka/99tech-order-processor/internal/redact"
+)
+
+var (
+	// Flags
+	redactFields []string
+
+	// redactor masks --redact-fields, or is nil if none are set
+	redactor *redact.Redactor
+)
+
+// setupRedaction masks --redact-fields in log output. It runs before any
+// other log hook is added, so the dashboards only see masked messages.
+func setupRedaction() {
+	redactor = redact.New(redactFields)
+	if redactor != nil {
+		logger.AddHook(redact.Hook{Redactor: redactor})
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringSliceVar(&redactFields, "redact-fields", nil, "Comma-separated field names (e.g. account,client_id) masked in logs, audit logs, and captures; the output keeps them")
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/spf13/cobra"
+	"github.com/fauzanelka/99tech-order-processor/internal/httpclient"
+	"github.com/fauzanelka/99tech-order-processor/internal/replay"
+)
+
+var (
+	// Flags
+	replayTarget string
+	replaySpeed  float64
+
+	// Replay command
+	replayCmd = &cobra.Command{
+		Use:   "replay <capture.har|audit.jsonl>",
+		Short: "Replay recorded requests against a target URL",
+		Long: `Replays the requests recorded in a HAR capture (--capture) or an audit log
+(--audit-log) against another host, preserving each request's path and query.
+--auth-token and --header are sent with every request, replacing the recorded
+values, which a capture redacts. Audit logs do not record request bodies, so
+only their GET requests can be replayed, and requests whose bodies were
+truncated or redacted in a capture are skipped. The command exits non-zero if
+any request is skipped, fails, or returns a status other than the recorded
+one.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := url.Parse(replayTarget)
+			if err != nil || target.Scheme == "" || target.Host == "" {
+				return fmt.Errorf("invalid target URL: %q", replayTarget)
+			}
+
+			requests, err := replay.Load(args[0])
+			if err != nil {
+				return err
+			}
+			logger.Infof("Replaying %d requests against %s", len(requests), target.Host)
+
+			opts, err := tlsOptions()
+			if err != nil {
+				return fmt.Errorf("invalid TLS configuration: %w", err)
+			}
+			opts.Timeout = timeout
+			opts.Timeouts = timeouts
+			if opts.IPVersion, err = httpclient.ParseIPVersion(ipVersion); err != nil {
+				return fmt.Errorf("invalid IP version configuration: %w", err)
+			}
+			opts.Insecure = insecure
+			header, err := requestHeaders()
+			if err != nil {
+				return fmt.Errorf("invalid header configuration: %w", err)
+			}
+
+			r := &replay.Replayer{
+				Target:  target,
+				Speed:   replaySpeed,
+				Headers: header,
+				Client:  httpclient.New(opts),
+				Logger:  logger,
+			}
+			summary := r.Run(requests)
+
+			logger.Infof("Replay completed: %d sent, %d failed, %d status mismatches, %d skipped",
+				summary.Sent, summary.Failed, summary.Mismatch, summary.Skipped)
+			if summary.Failed > 0 || summary.Mismatch > 0 || summary.Skipped > 0 {
+				return fmt.Errorf("replay failed: %d of %d requests failed, %d returned a different status, and %d were skipped",
+					summary.Failed, summary.Sent, summary.Mismatch, summary.Skipped)
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	replayCmd.Flags().StringVar(&replayTarget, "target", "", "Target base URL (scheme and host) to replay against")
+	replayCmd.Flags().Float64Var(&replaySpeed, "speed", 0, "Replay at original pacing divided by this factor (0 sends without delay)")
+	replayCmd.MarkFlagRequired("target")
+
+	rootCmd.AddCommand(replayCmd)
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Flags
+	retryQueueFile string
+
+	// retryOnly is set by the retry command to process only the retry queue
+	retryOnly bool
+
+	// Retry command
+	retryCmd = &cobra.Command{
+		Use:   "retry",
+		Short: "Retry the orders in the retry queue",
+		Long: `Retries the orders that failed after all retries in earlier runs and were
+kept in the retry queue (--retry-queue), without reading any input. Results
+are appended to the output file, and orders that fail again stay queued.`,
+		Args: cobra.NoArgs,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if retryQueueFile == "" {
+				return fmt.Errorf("--retry-queue is required")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			retryOnly = true
+			rootCmd.Run(cmd, args)
+		},
+	}
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&retryQueueFile, "retry-queue", "", "JSONL file keeping orders that failed after all retries; later runs retry them first")
+	rootCmd.AddCommand(retryCmd)
+}
@@ -1,25 +1,137 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/fauzanelka/99tech-order-processor/internal/amqp"
+	"github.com/fauzanelka/99tech-order-processor/internal/annotate"
+	"github.com/fauzanelka/99tech-order-processor/internal/audit"
+	"github.com/fauzanelka/99tech-order-processor/internal/capture"
+	"github.com/fauzanelka/99tech-order-processor/internal/config"
+	"github.com/fauzanelka/99tech-order-processor/internal/encrypt"
+	"github.com/fauzanelka/99tech-order-processor/internal/enrich"
+	"github.com/fauzanelka/99tech-order-processor/internal/httpcache"
+	"github.com/fauzanelka/99tech-order-processor/internal/httpclient"
+	"github.com/fauzanelka/99tech-order-processor/internal/mask"
+	"github.com/fauzanelka/99tech-order-processor/internal/metrics"
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/fauzanelka/99tech-order-processor/internal/orderfile"
+	"github.com/fauzanelka/99tech-order-processor/internal/outlier"
 	"github.com/fauzanelka/99tech-order-processor/internal/processor"
+	"github.com/fauzanelka/99tech-order-processor/internal/progress"
+	"github.com/fauzanelka/99tech-order-processor/internal/ratelimit"
+	"github.com/fauzanelka/99tech-order-processor/internal/rejects"
+	"github.com/fauzanelka/99tech-order-processor/internal/retryqueue"
+	"github.com/fauzanelka/99tech-order-processor/internal/rules"
+	"github.com/fauzanelka/99tech-order-processor/internal/schema"
+	"github.com/fauzanelka/99tech-order-processor/internal/sentry"
+	"github.com/fauzanelka/99tech-order-processor/internal/storage"
+	"github.com/fauzanelka/99tech-order-processor/internal/tracecontext"
+	"github.com/fauzanelka/99tech-order-processor/internal/transform"
+	"github.com/fauzanelka/99tech-order-processor/internal/tui"
+	"github.com/fauzanelka/99tech-order-processor/internal/version"
 )
 
 var (
 	// Flags
 	inputFile  string
 	outputFile string
+	tees       []string
 	symbol     string
 	side       string
+	shard      string
+	sample     string
+	sampleSeed uint64
+	skipOrders int
+	canarySize int
+	canaryRate float64
+	maxOrders  int
 	retries    int
+	retryCap   int
+	retryFirst string
+	onStatus   []string
+	failFast   bool
+	preflight  bool
+	concurrency string
+	perSymbol  int
+	rateLimit  float64
+	adaptive   bool
+	reuseResp  bool
+	paginate   bool
+	nextPath   string
+	cursorParam string
+	protocol   string
+	gqlQuery   string
+	gqlVars    []string
+	soapEnvelope string
+	soapAction   string
+	soapVersion  string
+	cacheDir   string
 	timeout    time.Duration
+	timeouts   httpclient.Timeouts
+	maxBody    int64
 	insecure   bool
+	resolve    []string
+	ipVersion  string
 	verbose    bool
+	quiet      bool
+	logLevel   string
+	logOrders  bool
 	baseURL    string
+	sentryDSN  string
+	traceParent string
+	traceState string
+	maxErrRate string
+	maxP99     time.Duration
+	statsdAddr string
+	statsdPfx  string
+	dogstatsd  bool
+	auditFile  string
+	harFile    string
+	harMaxBody int
+	harRedact  []string
+	outputFmt  string
+	inputFmt   string
+	ckptFile   string
+	ckptEvery  int
+	appendOut  bool
+	force      bool
+	splitBy    string
+	outputBuf  int
+	fsyncEvery int
+	rotateOut  string
+	rotateName string
+	outputTmpl string
+	manifestFile string
+	strictDec  bool
+	tsFormats  []string
+	configFile string
+	profile    string
+	schemaFile string
+	rulesFile  string
+	rejectFile string
+	enrichFile string
+	enrichKey  string
+	xmlElement string
+	sheet      string
+	authToken  string
+	headers    []string
+	userAgent  string
+	tuiMode    bool
+
+	// Configuration file, if any
+	fileConfig *config.Config
 
 	// Logger
 	logger = logrus.New()
@@ -30,23 +142,382 @@ var (
 		Short: "Process trading orders from a file",
 		Long: `A CLI application that processes trading orders from a file.
 It filters orders by symbol and side, then makes API requests for each matching order.`,
-		Run: func(cmd *cobra.Command, args []string) {
+		// Errors are printed by main
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Load configuration file
+			if configFile != "" {
+				var err error
+				fileConfig, err = config.Load(configFile)
+				if err != nil {
+					return err
+				}
+				if profile != "" {
+					if err := fileConfig.UseProfile(profile); err != nil {
+						return fmt.Errorf("invalid config file %s: %w", configFile, err)
+					}
+				}
+				if err := fileConfig.ApplyFlags(cmd.Flags()); err != nil {
+					return fmt.Errorf("invalid config file %s: %w", configFile, err)
+				}
+			} else if profile != "" {
+				return fmt.Errorf("--profile needs a --config file defining the profile")
+			}
+
 			// Configure logger
-			if verbose {
-				logger.SetLevel(logrus.DebugLevel)
-			} else {
-				logger.SetLevel(logrus.InfoLevel)
+			level, err := parseLogLevel()
+			if err != nil {
+				return err
 			}
+			logger.SetLevel(level)
 			logger.SetOutput(os.Stdout)
+			if err := openLogFile(); err != nil {
+				return err
+			}
 			logger.SetFormatter(&logrus.TextFormatter{
 				FullTimestamp: true,
 			})
+			setupRedaction()
 
+			if len(tsFormats) > 0 {
+				models.TimestampFormats = tsFormats
+			}
+			readEnvSecrets()
+			return resolveSecrets(cmd.Flags())
+		},
+		Run: func(cmd *cobra.Command, args []string) {
 			logger.Infof("Starting order processor")
-			logger.Infof("Input file: %s", inputFile)
-			logger.Infof("Output file: %s", outputFile)
+			if retryOnly {
+				logger.Infof("Retry queue: %s", retryQueueFile)
+			} else if sourceKind == sourceFile {
+				logger.Infof("Input file: %s", storage.Redact(inputFile))
+			} else {
+				logger.Infof("Input source: %s", sourceKind)
+			}
+			logger.Infof("Output file: %s (%s)", storage.Redact(outputFile), outputFmt)
+			outputs := map[string]bool{outputFile: true}
+			for _, t := range tees {
+				if outputs[t] {
+					logger.Fatalf("Invalid tee configuration: %s is already written", storage.Redact(t))
+				}
+				outputs[t] = true
+				logger.Infof("Tee output: %s", storage.Redact(t))
+			}
+			if outputFmt != processor.OutputRaw && outputFmt != processor.OutputEnvelope {
+				logger.Fatalf("Invalid output format %q: must be %s or %s", outputFmt, processor.OutputRaw, processor.OutputEnvelope)
+			}
+			if splitBy != processor.SplitNone && splitBy != processor.SplitSymbol && splitBy != processor.SplitSide {
+				logger.Fatalf("Invalid output split %q: must be %s or %s", splitBy, processor.SplitSymbol, processor.SplitSide)
+			}
+			for _, path := range append([]string{outputFile}, tees...) {
+				if !processor.IsPathTemplate(path) {
+					continue
+				}
+				if splitBy != processor.SplitNone {
+					logger.Fatalf("Invalid output configuration: --output-split cannot be used with an output path template; use {{.Symbol}} or {{.Side}} in the path")
+				}
+				if _, err := processor.ParseOutputPath(path); err != nil {
+					logger.Fatalf("Invalid output configuration: %v", err)
+				}
+			}
+			if outputBuf < 0 || fsyncEvery < 0 {
+				logger.Fatalf("Invalid output configuration: --output-buffer and --fsync-every may not be negative")
+			}
 			logger.Infof("Filtering for symbol: %s, side: %s", symbol, side)
+			orderShard, err := models.ParseShard(shard)
+			if err != nil {
+				logger.Fatalf("Invalid shard configuration: %v", err)
+			}
+			if orderShard.Count > 0 {
+				if sourceKind != sourceFile && sourceKind != sourcePostgres {
+					logger.Fatalf("Invalid shard configuration: --shard cannot be used with --source %s", sourceKind)
+				}
+				logger.Infof("Processing shard %s of the orders", orderShard)
+			}
+			orderSample, err := models.ParseSample(sample, sampleSeed)
+			if err != nil {
+				logger.Fatalf("Invalid sample configuration: %v", err)
+			}
+			if orderSample.Percent > 0 {
+				if sourceKind != sourceFile && sourceKind != sourcePostgres {
+					logger.Fatalf("Invalid sample configuration: --sample cannot be used with --source %s", sourceKind)
+				}
+				logger.Infof("Processing a %s sample of the orders, seed: %d", orderSample, orderSample.Seed)
+			}
+			if skipOrders < 0 || maxOrders < 0 {
+				logger.Fatalf("Invalid limit configuration: --skip and --limit may not be negative")
+			}
+			if skipOrders > 0 || maxOrders > 0 {
+				if sourceKind != sourceFile && sourceKind != sourcePostgres {
+					logger.Fatalf("Invalid limit configuration: --skip and --limit cannot be used with --source %s", sourceKind)
+				}
+				logger.Infof("Skipping %d matching orders, limit: %d", skipOrders, maxOrders)
+			}
 			logger.Infof("Retries: %d, Timeout: %s, Insecure: %v", retries, timeout, insecure)
+			if timeout < 0 || timeouts.Dial < 0 || timeouts.TLSHandshake < 0 || timeouts.ResponseHeader < 0 {
+				logger.Fatalf("Invalid timeout configuration: timeouts may not be negative")
+			}
+			if timeouts != (httpclient.Timeouts{}) {
+				logger.Infof("Dial timeout: %s, TLS handshake timeout: %s, response header timeout: %s",
+					orNone(timeouts.Dial, "30s"), orNone(timeouts.TLSHandshake, "none"), orNone(timeouts.ResponseHeader, "none"))
+			}
+			if maxBody < 0 {
+				logger.Fatalf("Invalid response configuration: --max-response-bytes may not be negative")
+			}
+			if retryCap < 0 {
+				logger.Fatalf("Invalid retry configuration: --retry-budget may not be negative")
+			}
+			if retryCap > 0 {
+				if sourceKind != sourceFile && sourceKind != sourcePostgres {
+					logger.Fatalf("Invalid retry configuration: --retry-budget only applies to runs over a file or query")
+				}
+				logger.Infof("Retry budget: %d retries", retryCap)
+			}
+			retryPriority, err := processor.ParseRetryPriority(retryFirst)
+			if err != nil {
+				logger.Fatalf("Invalid retry configuration: %v", err)
+			}
+			if retryPriority != processor.PriorityNone {
+				if (sourceKind != sourceFile && sourceKind != sourcePostgres) || coordinatorAddr != "" {
+					logger.Fatalf("Invalid retry configuration: --retry-priority only applies to runs over a file or query")
+				}
+				logger.Infof("Retry priority: %s first", retryPriority)
+			}
+			var statusActions processor.StatusActions
+			for _, s := range onStatus {
+				rule, err := processor.ParseStatusRule(s)
+				if err != nil {
+					logger.Fatalf("Invalid status action configuration: %v", err)
+				}
+				statusActions = append(statusActions, rule)
+			}
+			if statusActions.Has(processor.ActionAbort) && ((sourceKind != sourceFile && sourceKind != sourcePostgres) || coordinatorAddr != "") {
+				logger.Fatalf("Invalid status action configuration: abort only applies to runs over a file or query")
+			}
+			if len(onStatus) > 0 {
+				logger.Infof("Status actions: %s", strings.Join(onStatus, ", "))
+			}
+			if failFast && ((sourceKind != sourceFile && sourceKind != sourcePostgres) || coordinatorAddr != "") {
+				logger.Fatalf("Invalid fail-fast configuration: --fail-fast only applies to runs over a file or query")
+			}
+			if canarySize < 0 || canaryRate < 0 || canaryRate > 100 {
+				logger.Fatalf("Invalid canary configuration: --canary may not be negative and --canary-threshold must be between 0 and 100")
+			}
+			if canarySize > 0 {
+				if (sourceKind != sourceFile && sourceKind != sourcePostgres) || coordinatorAddr != "" {
+					logger.Fatalf("Invalid canary configuration: --canary only applies to runs over a file or query")
+				}
+				logger.Infof("Canary: %d orders, failure threshold: %g%%", canarySize, canaryRate)
+			}
+			autoConcurrent := concurrency == "auto"
+			concurrent := processor.AutoConcurrency
+			if !autoConcurrent {
+				concurrent, err = strconv.Atoi(concurrency)
+			}
+			if err != nil || concurrent < 1 || perSymbol < 0 {
+				logger.Fatalf("Invalid concurrency configuration: --concurrency must be auto or at least 1 and --max-per-symbol at least 0")
+			}
+			if autoConcurrent {
+				logger.Infof("Concurrency: auto, up to %d, per symbol: %d", concurrent, perSymbol)
+			} else if concurrent > 1 {
+				logger.Infof("Concurrency: %d, per symbol: %d", concurrent, perSymbol)
+			}
+			var limiter *ratelimit.Limiter
+			switch {
+			case rateLimit < 0 || (adaptive && rateLimit == 0):
+				logger.Fatalf("Invalid rate limit configuration: --rate-limit must be positive with --adaptive-rate, and may not be negative")
+			case rateLimit > 0:
+				limiter = ratelimit.New(rateLimit, adaptive)
+				logger.Infof("Rate limit: %g requests/s, adaptive: %v", rateLimit, adaptive)
+			}
+
+			// Configure error reporting
+			var reporter *sentry.Client
+			if sentryDSN != "" {
+				var err error
+				reporter, err = sentry.New(sentryDSN)
+				if err != nil {
+					logger.Fatalf("Invalid Sentry configuration: %v", err)
+				}
+				defer func() {
+					if r := recover(); r != nil {
+						if err := reporter.CapturePanic(r, debug.Stack()); err != nil {
+							logger.Warnf("Failed to report panic to Sentry: %v", err)
+						}
+						panic(r)
+					}
+				}()
+			}
+			var sla processor.SLA
+			if maxErrRate != "" {
+				rate, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(maxErrRate), "%"), 64)
+				if err != nil || rate <= 0 || rate > 100 {
+					logger.Fatalf("Invalid SLA configuration: --max-error-rate %q must be a percentage above 0 and at most 100, such as 2%%", maxErrRate)
+				}
+				sla.MaxErrorRate = rate
+			}
+			if maxP99 < 0 {
+				logger.Fatalf("Invalid SLA configuration: --max-p99 may not be negative")
+			}
+			sla.MaxP99 = maxP99
+			if sla.Enabled() {
+				if (sourceKind != sourceFile && sourceKind != sourcePostgres) || coordinatorAddr != "" {
+					logger.Fatalf("Invalid SLA configuration: --max-error-rate and --max-p99 only apply to runs over a file or query")
+				}
+				logger.Infof("SLA: error rate up to %g%%, p99 latency up to %s", sla.MaxErrorRate, sla.MaxP99)
+			}
+
+			// Configure metrics
+			var stats *metrics.StatsD
+			if statsdAddr != "" {
+				var err error
+				stats, err = metrics.NewStatsD(statsdAddr, statsdPfx, dogstatsd)
+				if err != nil {
+					logger.Fatalf("Invalid StatsD configuration: %v", err)
+				}
+				defer stats.Close()
+			}
+			var gateway *metrics.Pushgateway
+			if pushGateway != "" {
+				var err error
+				gateway, err = metrics.NewPushgateway(pushGateway, pushJob, pushInstance)
+				if err != nil {
+					logger.Fatalf("Invalid Pushgateway configuration: %v", err)
+				}
+			}
+
+			// Configure audit log
+			var auditLog *audit.Log
+			if auditFile != "" {
+				var err error
+				auditLog, err = audit.Open(auditFile)
+				if err != nil {
+					logger.Fatalf("Invalid audit configuration: %v", err)
+				}
+				defer func() {
+					if err := auditLog.Close(); err != nil {
+						logger.Warnf("Failed to close audit log: %v", err)
+					}
+				}()
+			}
+
+			// Configure request capture
+			var recorder *capture.Recorder
+			if harFile != "" {
+				recorder, err = capture.NewRecorder(harFile, harMaxBody, harRedact, redactor)
+				if err != nil {
+					logger.Fatalf("Invalid capture configuration: %v", err)
+				}
+				closeCapture := func() {
+					if err := recorder.Close(); err != nil {
+						logger.Warnf("Failed to write capture: %v", err)
+					}
+				}
+				defer closeCapture()
+				// Failed runs exit with Fatalf, which skips deferred calls,
+				// and are the ones the capture is most needed for
+				logrus.RegisterExitHandler(closeCapture)
+			}
+
+			// Configure output encryption
+			encrypter, err := encrypt.NewEncrypter(encryptKey, encryptRecipient)
+			if err != nil {
+				logger.Fatalf("Invalid encryption configuration: %v", err)
+			}
+
+			// Configure rejects file
+			var rejectWriter *rejects.Writer
+			if rejectFile != "" {
+				var err error
+				rejectWriter, err = rejects.Create(rejectFile, encrypter)
+				if err != nil {
+					logger.Fatalf("Invalid rejects configuration: %v", err)
+				}
+				defer rejectWriter.Close()
+			}
+
+			// Configure outlier detection
+			outliers := outlier.Config{Percent: outlierPercent, StdDevs: outlierStdDevs}
+			if err := outliers.Validate(); err != nil {
+				logger.Fatalf("Invalid outlier configuration: %v", err)
+			}
+			var reviewWriter *rejects.Writer
+			if reviewFile != "" {
+				if !outliers.Enabled() {
+					logger.Fatalf("Invalid outlier configuration: --outlier-review needs --outlier-percent or --outlier-stddev")
+				}
+				reviewWriter, err = rejects.Create(reviewFile, encrypter)
+				if err != nil {
+					logger.Fatalf("Invalid outlier configuration: %v", err)
+				}
+				defer reviewWriter.Close()
+			}
+
+			// Configure credential routing
+			var creds map[string]http.Header
+			if credentialField != "" {
+				creds, err = credentialHeaders()
+				if err != nil {
+					logger.Fatalf("Invalid credentials configuration: %v", err)
+				}
+				logger.Infof("Routing requests by %s to %d credentials", credentialField, len(creds))
+			}
+
+			// Configure business rules
+			var ruleSet *rules.Set
+			if rulesFile != "" {
+				ruleSet, err = rules.Load(rulesFile)
+				if err != nil {
+					logger.Fatalf("Invalid rules configuration: %v", err)
+				}
+				logger.Infof("Loaded %d rules from %s", ruleSet.Len(), rulesFile)
+			}
+
+			// Configure retry queue
+			var requeue *retryqueue.Queue
+			if retryQueueFile != "" {
+				var err error
+				requeue, err = retryqueue.Open(retryQueueFile)
+				if err != nil {
+					logger.Fatalf("Invalid retry queue configuration: %v", err)
+				}
+				defer requeue.Close()
+			}
+
+			// Configure result publishing
+			var publisher *amqp.Publisher
+			if amqpResults != "" || amqpFailures != "" {
+				var err error
+				publisher, err = amqp.NewPublisher(amqpURL, insecure, amqpResults, amqpFailures)
+				if err != nil {
+					logger.Fatalf("Invalid RabbitMQ configuration: %v", err)
+				}
+				defer publisher.Close()
+			}
+
+			// Configure result sink
+			indexer, err := openSink()
+			if err != nil {
+				logger.Fatalf("Invalid sink configuration: %v", err)
+			}
+			defer func() {
+				if err := indexer.Close(); err != nil {
+					logger.Warnf("Failed to index results: %v", err)
+				}
+			}()
+
+			opts, err := readerOptions()
+			if err != nil {
+				logger.Fatalf("Invalid input configuration: %v", err)
+			}
+			table, err := enrichTable()
+			if err != nil {
+				logger.Fatalf("Invalid enrichment configuration: %v", err)
+			}
+			header, err := requestHeaders()
+			if err != nil {
+				logger.Fatalf("Invalid header configuration: %v", err)
+			}
 
 			// Create and run processor
 			proc := processor.NewProcessor(
@@ -60,8 +531,293 @@ It filters orders by symbol and side, then makes API requests for each matching
 				insecure,
 				logger,
 			)
+			proc.Tee = tees
+			proc.Sentry = reporter
+			proc.SLA = sla
+			proc.RetryBudget = retryCap
+			proc.RetryPriority = retryPriority
+			proc.StatusActions = statusActions
+			proc.MaxResponseBytes = maxBody
+			proc.Timeouts = timeouts
+			if stats != nil || gateway != nil {
+				proc.Metrics = &metrics.Sinks{StatsD: stats, Pushgateway: gateway}
+			}
+			proc.Audit = auditLog
+			proc.LogOrders = logOrders
+			proc.Redact = redactor
+			masker, err := mask.New(maskFields, maskStrategy, maskKey)
+			if err != nil {
+				logger.Fatalf("Invalid mask configuration: %v", err)
+			}
+			proc.Mask = masker
+			proc.Transform, err = transform.New(transforms)
+			if err != nil {
+				logger.Fatalf("Invalid transform configuration: %v", err)
+			}
+			if proc.Transform != nil {
+				logger.Infof("Transforming responses with %d steps", proc.Transform.Len())
+			}
+			proc.Encrypt = encrypter
+			proc.Capture = recorder
+			proc.OutputFormat = outputFmt
+			proc.Append = appendOut
+			proc.Force = force
+			proc.OutputSplit = splitBy
+			proc.OutputBuffer = outputBuf
+			proc.FsyncEvery = fsyncEvery
+			if rotateOut != "" {
+				if !appendOut && (sourceKind == sourceFile || sourceKind == sourcePostgres) {
+					logger.Fatalf("Invalid rotation configuration: --output-rotate needs --append or a message source, whose outputs are appended to in place")
+				}
+				if proc.Rotate, err = processor.ParseRotation(rotateOut, rotateName); err != nil {
+					logger.Fatalf("Invalid rotation configuration: %v", err)
+				}
+				logger.Infof("Rotating output files every %s", rotateOut)
+			}
+			proc.StrictDecimals = strictDec
+			proc.FailFast = failFast
+			proc.Rules = ruleSet
+			proc.CredentialField = credentialField
+			proc.Credentials = creds
+			proc.ReaderOptions = opts
+			proc.Rejects = rejectWriter
+			proc.Outliers = outliers
+			proc.Review = reviewWriter
+			proc.HoldOutliers = holdOutliers
+			proc.Manifest = manifestFile
+			if manifestFile != "" {
+				proc.RunConfig = runConfig(cmd.Flags())
+			}
+			if reportJUnit != "" {
+				if sourceKind != sourceFile && sourceKind != sourcePostgres {
+					logger.Fatalf("Invalid JUnit report configuration: --report-junit only applies to runs over a file or query")
+				}
+				proc.JUnit = processor.NewJUnitReport(reportJUnit)
+				logger.Infof("Writing JUnit report to %s", storage.Redact(reportJUnit))
+			}
+			if githubAnnotations {
+				if sourceKind != sourceFile && sourceKind != sourcePostgres {
+					logger.Fatalf("Invalid annotation configuration: --github-annotations only applies to runs over a file or query")
+				}
+				// Only files checked out in the workspace can be annotated
+				annotated := inputFile
+				if sourceKind != sourceFile || storage.IsRemote(inputFile) || storage.IsHTTP(inputFile) {
+					annotated = ""
+				}
+				proc.Annotate = annotate.New(os.Stdout, annotated)
+			}
+			proc.Requeue = requeue
+			proc.Enrich = table
+			proc.Publisher = publisher
+			proc.Indexer = indexer
+			proc.Headers = header
+			if outputTmpl != "" {
+				tmpl, err := processor.ParseOutputTemplate(outputTmpl)
+				if err != nil {
+					logger.Fatalf("Invalid output template: %v", err)
+				}
+				proc.OutputTemplate = tmpl
+			}
+			if inputFmt != "" {
+				proc.InputFormat = inputFmt
+			}
+			proc.Checkpoint = ckptFile
+			proc.CheckpointEvery = ckptEvery
+			proc.Shard = orderShard
+			proc.Sample = orderSample
+			proc.Skip = skipOrders
+			proc.Limit = maxOrders
+			proc.Canary = canarySize
+			proc.CanaryThreshold = canaryRate
+			proc.Concurrency = concurrent
+			proc.AutoConcurrency = autoConcurrent
+			proc.MaxPerSymbol = perSymbol
+			proc.RateLimit = limiter
+			proc.ReuseResponses = reuseResp
+			if paginate {
+				path, err := processor.ParseJSONPath(nextPath)
+				if err != nil {
+					logger.Fatalf("Invalid pagination configuration: %v", err)
+				}
+				if cursorParam == "" {
+					logger.Fatalf("Invalid pagination configuration: --cursor-param may not be empty")
+				}
+				proc.Paginate = &processor.Pagination{NextPath: path, CursorParam: cursorParam}
+				logger.Infof("Following pages of responses by %s", nextPath)
+			}
+			if protocol != processor.ProtocolGraphQL && (gqlQuery != "" || len(gqlVars) > 0) {
+				logger.Fatalf("Invalid GraphQL configuration: --graphql-query and --graphql-var need --protocol graphql")
+			}
+			if protocol != processor.ProtocolSOAP && (soapEnvelope != "" || soapAction != "") {
+				logger.Fatalf("Invalid SOAP configuration: --soap-envelope and --soap-action need --protocol soap")
+			}
+			switch protocol {
+			case processor.ProtocolREST:
+			case processor.ProtocolGraphQL:
+				if gqlQuery == "" {
+					logger.Fatalf("Invalid GraphQL configuration: --protocol graphql needs a --graphql-query file")
+				}
+				if paginate || cacheDir != "" {
+					logger.Fatalf("Invalid GraphQL configuration: --protocol graphql cannot be used with --paginate or --cache-dir")
+				}
+				query, err := os.ReadFile(gqlQuery)
+				if err != nil {
+					logger.Fatalf("Invalid GraphQL configuration: %v", err)
+				}
+				proc.GraphQL, err = processor.ParseGraphQL(string(query), gqlVars)
+				if err != nil {
+					logger.Fatalf("Invalid GraphQL configuration: %v", err)
+				}
+				logger.Infof("Requesting orders with the GraphQL query in %s", gqlQuery)
+			case processor.ProtocolSOAP:
+				if soapEnvelope == "" {
+					logger.Fatalf("Invalid SOAP configuration: --protocol soap needs a --soap-envelope file")
+				}
+				if paginate || cacheDir != "" {
+					logger.Fatalf("Invalid SOAP configuration: --protocol soap cannot be used with --paginate or --cache-dir")
+				}
+				envelope, err := os.ReadFile(soapEnvelope)
+				if err != nil {
+					logger.Fatalf("Invalid SOAP configuration: %v", err)
+				}
+				proc.SOAP, err = processor.ParseSOAP(string(envelope), soapAction, soapVersion)
+				if err != nil {
+					logger.Fatalf("Invalid SOAP configuration: %v", err)
+				}
+				logger.Infof("Requesting orders with the SOAP %s envelope in %s", soapVersion, soapEnvelope)
+			default:
+				logger.Fatalf("Invalid protocol %q: must be %s, %s, or %s", protocol, processor.ProtocolREST, processor.ProtocolGraphQL, processor.ProtocolSOAP)
+			}
+			if cacheDir != "" {
+				cache, err := httpcache.Open(cacheDir)
+				if err != nil {
+					logger.Fatalf("Invalid cache configuration: %v", err)
+				}
+				proc.Cache = cache
+			}
+			if len(resolve) > 0 {
+				pinned, err := httpclient.ParseResolve(resolve)
+				if err != nil {
+					logger.Fatalf("Invalid resolve configuration: %v", err)
+				}
+				proc.Resolve = pinned
+			}
+			proc.IPVersion, err = httpclient.ParseIPVersion(ipVersion)
+			if err != nil {
+				logger.Fatalf("Invalid IP version configuration: %v", err)
+			}
+			if proc.IPVersion != 0 {
+				logger.Infof("Connecting over IPv%d only", proc.IPVersion)
+			}
+			tlsOpts, err := tlsOptions()
+			if err != nil {
+				logger.Fatalf("Invalid TLS configuration: %v", err)
+			}
+			proc.TLSMinVersion = tlsOpts.MinVersion
+			proc.TLSCipherSuites = tlsOpts.CipherSuites
+			socket, apiURL, err := httpclient.SplitUnixURL(baseURL)
+			if err != nil {
+				logger.Fatalf("Invalid URL configuration: %v", err)
+			}
+			proc.BaseURL = apiURL
+			proc.Socket = socket
+			signer, err := requestSigner(apiURL)
+			if err != nil {
+				logger.Fatalf("Invalid SigV4 configuration: %v", err)
+			}
+			proc.SigV4 = signer
+			if traceParent != "" {
+				proc.Trace, err = tracecontext.Parse(traceParent, traceState)
+				if err != nil {
+					logger.Fatalf("Invalid trace context configuration: %v", err)
+				}
+				logger.Infof("Propagating trace %s to API requests", proc.Trace.TraceID())
+			}
+
+			// Check the setup before reading any input
+			if preflight {
+				if coordinatorAddr != "" {
+					logger.Fatalf("Invalid preflight configuration: --preflight cannot be used with --coordinator-addr, whose workers make the requests")
+				}
+				if err := proc.Preflight(context.Background()); err != nil {
+					for _, line := range strings.Split(err.Error(), "\n") {
+						logger.Errorf("Preflight: %s", line)
+					}
+					logger.Fatalf("Preflight failed, not processing any orders")
+				}
+				logger.Infof("Preflight checks passed")
+			}
+
+			// Track progress for the dashboards and heartbeats
+			if heartbeat < 0 {
+				logger.Fatalf("Invalid heartbeat configuration: --heartbeat may not be negative")
+			}
+			if tuiMode || dashboardAddr != "" || heartbeat > 0 {
+				proc.Progress = progress.NewTracker()
+				logger.AddHook(progress.LogHook{Tracker: proc.Progress})
+			}
+			if dashboardAddr != "" {
+				if err := serveDashboard(proc); err != nil {
+					logger.Fatalf("Invalid dashboard configuration: %v", err)
+				}
+			}
 
-			if err := proc.Process(); err != nil {
+			// Show the live dashboard while processing
+			var dashboard *tui.Dashboard
+			if tuiMode {
+				if !tui.IsTerminal(os.Stdout) {
+					logger.Fatalf("Invalid dashboard configuration: --tui requires a terminal")
+				}
+				dashboard = tui.Start(os.Stdout, "Order processor", proc.Progress, logger)
+				if sourceKind == sourceFile || sourceKind == sourcePostgres {
+					exitOnInterrupt(dashboard)
+				}
+			}
+
+			var beat *progress.Heartbeat
+			if heartbeat > 0 {
+				beat = progress.StartHeartbeat(proc.Progress, logger, heartbeat)
+			}
+
+			stopDaemon, err := startDaemon(proc, auditLog, rejectWriter)
+			if err != nil {
+				dashboard.Stop()
+				logger.Fatalf("Invalid daemon configuration: %v", err)
+			}
+
+			switch {
+			case shellMode:
+				err = runShell(proc)
+			case retryOnly:
+				// Retried results are added to the output rather than replacing it
+				proc.Append = true
+				err = proc.ProcessQueued()
+			case coordinatorAddr != "":
+				err = runCoordinator(proc)
+			case schedule != "" && sourceKind == sourceFile:
+				err = runSchedule(proc, (*processor.Processor).Process)
+			case schedule != "" && sourceKind == sourcePostgres:
+				err = runSchedule(proc, runQuery)
+			case schedule != "":
+				err = fmt.Errorf("--schedule cannot be used with --source %s, which runs continuously", sourceKind)
+			case sourceKind == sourceFile:
+				err = proc.Process()
+			case sourceKind == sourcePostgres:
+				err = runQuery(proc)
+			case sourceKind == sourceCoordinator:
+				err = runWorker(proc)
+			default:
+				err = runSource(proc)
+			}
+			stopDaemon()
+			beat.Stop()
+			dashboard.Stop()
+			proc.JUnit.Close()
+			// Scheduled runs push their metrics as each ends
+			if schedule == "" {
+				pushMetrics(proc, err)
+			}
+			if err != nil {
 				logger.Fatalf("Processing failed: %v", err)
 			}
 
@@ -75,15 +831,200 @@ func Execute() error {
 	return rootCmd.Execute()
 }
 
+// readerOptions returns the input decoding options from the configuration
+func readerOptions() (orderfile.Options, error) {
+	opts := orderfile.Options{XMLElement: xmlElement, Sheet: sheet}
+	if fileConfig != nil {
+		opts.FieldMapping = fileConfig.FieldMapping
+	}
+	if schemaFile != "" {
+		s, err := schema.Load(schemaFile)
+		if err != nil {
+			return opts, err
+		}
+		opts.Validate = s.Validate
+	}
+	return opts, nil
+}
+
+// parseLogLevel returns the level logs are written at, from --verbose,
+// --quiet, or --log-level
+func parseLogLevel() (logrus.Level, error) {
+	given := 0
+	for _, set := range []bool{verbose, quiet, logLevel != ""} {
+		if set {
+			given++
+		}
+	}
+	if given > 1 {
+		return 0, fmt.Errorf("only one of --verbose, --quiet, and --log-level may be given")
+	}
+	switch {
+	case verbose:
+		return logrus.DebugLevel, nil
+	case quiet:
+		return logrus.WarnLevel, nil
+	case logLevel != "":
+		switch strings.ToLower(logLevel) {
+		case "debug", "info", "warn", "warning", "error":
+			return logrus.ParseLevel(logLevel)
+		}
+		return 0, fmt.Errorf("invalid --log-level %q: must be debug, info, warn, or error", logLevel)
+	}
+	return logrus.InfoLevel, nil
+}
+
+// orNone formats a duration, or none for one that is not set
+func orNone(d time.Duration, none string) string {
+	if d == 0 {
+		return none
+	}
+	return d.String()
+}
+
+// enrichTable loads the --enrich lookup file, if any
+func enrichTable() (*enrich.Table, error) {
+	if enrichFile == "" {
+		return nil, nil
+	}
+	table, err := enrich.Load(enrichFile, enrichKey)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("Loaded %d lookup rows from %s", table.Len(), enrichFile)
+	return table, nil
+}
+
+// exitOnInterrupt restores the terminal before exiting on SIGINT or SIGTERM.
+// Message sources stop gracefully on these signals instead.
+func exitOnInterrupt(dashboard *tui.Dashboard) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		dashboard.Stop()
+		logger.Warnf("Interrupted")
+		os.Exit(130)
+	}()
+}
+
+// requestHeaders builds the headers sent with API requests and HTTP(S) input
+// downloads from --auth-token, --header, and --user-agent
+func requestHeaders() (http.Header, error) {
+	header, err := parseHeaders(headers, authToken)
+	if err != nil {
+		return nil, err
+	}
+	// A User-Agent given with --header wins
+	if header.Get("User-Agent") == "" && userAgent != "" {
+		header.Set("User-Agent", userAgent)
+	}
+	return header, nil
+}
+
+// parseHeaders builds headers from "Name: value" strings and a bearer token
+func parseHeaders(headers []string, authToken string) (http.Header, error) {
+	header := make(http.Header)
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid header %q: expected \"Name: value\"", h)
+		}
+		header.Add(name, strings.TrimSpace(value))
+	}
+	if authToken != "" {
+		header.Set("Authorization", "Bearer "+authToken)
+	}
+	return header, nil
+}
+
 func init() {
 	// Define flags
-	rootCmd.PersistentFlags().StringVar(&inputFile, "file", "transaction-log.txt", "Input file containing order data")
-	rootCmd.PersistentFlags().StringVar(&outputFile, "output", "output.txt", "Output file for API responses")
-	rootCmd.PersistentFlags().StringVar(&symbol, "symbol", "TSLA", "Symbol to filter orders by")
-	rootCmd.PersistentFlags().StringVar(&side, "side", "sell", "Side to filter orders by (buy/sell)")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "JSON configuration file")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Named profile of the configuration file to use (e.g. staging), overriding its top-level settings")
+	rootCmd.PersistentFlags().StringVar(&inputFile, "file", "transaction-log.txt", "Input file containing order data (local path, http(s):// URL, gs:// or az:// URI)")
+	rootCmd.PersistentFlags().StringVar(&inputFmt, "input-format", "", "Input file format (jsonl/csv/parquet/avro/xml/xlsx/fix); inferred from the file extension when empty")
+	rootCmd.PersistentFlags().StringVar(&xmlElement, "xml-element", "order", "Element holding each order in XML input")
+	rootCmd.PersistentFlags().StringVar(&sheet, "sheet", "", "Worksheet to read from Excel input; the first one when empty")
+	rootCmd.PersistentFlags().StringArrayVar(&tsFormats, "timestamp-format", nil, "Timestamp format to accept, tried in order; repeatable (rfc3339, epoch_ms, epoch_s, or a Go layout)")
+	rootCmd.PersistentFlags().BoolVar(&strictDec, "strict-decimals", false, "Reject orders whose price or quantity uses exponent notation")
+	rootCmd.PersistentFlags().StringVar(&schemaFile, "input-schema", "", "JSON Schema that every input record must satisfy")
+	rootCmd.PersistentFlags().StringVar(&rulesFile, "rules", "", "JSON file of business rules (e.g. quantity > 0, price bands per symbol) orders must satisfy to be processed")
+	rootCmd.PersistentFlags().StringVar(&rejectFile, "rejects", "", "JSONL file recording rejected input records and the reasons")
+	rootCmd.PersistentFlags().StringVar(&enrichFile, "enrich", "", "CSV lookup file whose columns are joined onto each order")
+	rootCmd.PersistentFlags().StringVar(&enrichKey, "enrich-key", "symbol", "Order field matched against the lookup file column of the same name")
+	rootCmd.PersistentFlags().StringVar(&outputFile, "output", "output.txt", "Output file for API responses (local path, gs:// or az:// URI), or a path template such as results/dt={{.Date}}/{{.Symbol}}.jsonl")
+	rootCmd.PersistentFlags().StringArrayVar(&tees, "tee", nil, "Also write the results to this output (local path, gs:// or az:// URI), which fails on its own without failing the run; repeatable")
+	rootCmd.PersistentFlags().BoolVar(&appendOut, "append", false, "Append to the output file in place instead of replacing it on completion")
+	rootCmd.PersistentFlags().BoolVar(&force, "force", false, "Replace output files that already exist and are not empty, which runs otherwise refuse to start over")
+	rootCmd.PersistentFlags().StringVar(&outputFmt, "output-format", processor.OutputRaw, "Output format for API responses (raw/envelope)")
+	rootCmd.PersistentFlags().StringVar(&outputTmpl, "output-template", "", "Go template used to render each output line (overrides --output-format)")
+	rootCmd.PersistentFlags().StringVar(&splitBy, "output-split", processor.SplitNone, "Write a separate output file per symbol or side")
+	rootCmd.PersistentFlags().IntVar(&outputBuf, "output-buffer", 64*1024, "Size in bytes of the buffer in front of each output file (0 writes every result straight through)")
+	rootCmd.PersistentFlags().IntVar(&fsyncEvery, "fsync-every", 0, "Sync the output files to disk every N results (0 only syncs at checkpoints and on completion)")
+	rootCmd.PersistentFlags().StringVar(&rotateOut, "output-rotate", "", "Rotate output files appended to in place once they reach a size (e.g. 500MB) or every interval (e.g. 1h)")
+	rootCmd.PersistentFlags().StringVar(&rotateName, "output-rotate-naming", processor.RotateSequential, "How rotated output files are named: sequential (output-1.jsonl) or timestamp (output-20261016T090000Z.jsonl)")
+	rootCmd.PersistentFlags().StringVar(&manifestFile, "manifest", "", "JSON file describing each run (status, configuration, input checksum, counts) and the SHA-256 checksum and record count of every file it produces (local path, gs:// or az:// URI)")
+	rootCmd.PersistentFlags().StringVar(&symbol, "symbol", "TSLA", "Comma-separated symbols to filter orders by")
+	rootCmd.PersistentFlags().StringVar(&shard, "shard", "", "Only process shard i/n of the orders (e.g. 2/8), chosen by a hash of the order ID")
+	rootCmd.PersistentFlags().StringVar(&sample, "sample", "", "Only process a random percentage of the orders matching the filters (e.g. 5%)")
+	rootCmd.PersistentFlags().Uint64Var(&sampleSeed, "sample-seed", 0, "Seed choosing the orders of --sample; the same seed picks the same orders")
+	rootCmd.PersistentFlags().IntVar(&skipOrders, "skip", 0, "Pass over the first N orders matching the filters")
+	rootCmd.PersistentFlags().IntVar(&maxOrders, "limit", 0, "Stop after processing N orders matching the filters (0 for no limit)")
+	rootCmd.PersistentFlags().StringVar(&side, "side", "sell", "Comma-separated sides to filter orders by (buy/sell)")
 	rootCmd.PersistentFlags().IntVar(&retries, "retry", 3, "Number of retry attempts for failed requests")
-	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 30*time.Second, "Timeout for HTTP requests")
+	rootCmd.PersistentFlags().IntVar(&retryCap, "retry-budget", 0, "Most retries across the whole run, after which failed orders are not retried (0 for no limit)")
+	rootCmd.PersistentFlags().StringVar(&retryFirst, "retry-priority", "", "Retry failed orders by priority: notional (largest first), oldest or newest (by timestamp)")
+	rootCmd.PersistentFlags().StringArrayVar(&onStatus, "on-status", nil, "Action for responses with a status code, range, or class: CODES=retry, skip[:note], dead-letter, abort, or success (e.g. 404=skip:unknown order, 409=success); repeatable, first match wins")
+	rootCmd.PersistentFlags().IntVar(&canarySize, "canary", 0, "Process the first N orders, then stop unless at most --canary-threshold percent of them failed")
+	rootCmd.PersistentFlags().Float64Var(&canaryRate, "canary-threshold", 10, "Highest percentage of --canary orders that may fail for the run to go on")
+	rootCmd.PersistentFlags().BoolVar(&failFast, "fail-fast", false, "Stop the run on the first order that fails after all retries, leaving the output uncommitted")
+	rootCmd.PersistentFlags().BoolVar(&preflight, "preflight", false, "Before reading the input, check that the output can be written, the output template renders, and the API is reachable and accepts the credentials")
+	rootCmd.PersistentFlags().StringVar(&concurrency, "concurrency", "1", "Number of orders processed at once, or auto to tune it by the latency and failures of requests")
+	rootCmd.PersistentFlags().IntVar(&perSymbol, "max-per-symbol", 0, "Most orders of the same symbol processed at once (0 for no limit)")
+	rootCmd.PersistentFlags().BoolVar(&reuseResp, "reuse-responses", false, "Reuse the first successful response for an order ID that appears again in the input instead of requesting it again")
+	rootCmd.PersistentFlags().StringVar(&protocol, "protocol", processor.ProtocolREST, "API protocol: rest to GET each order's URL, graphql to POST a query per order to --url, or soap to POST a SOAP envelope per order to --url")
+	rootCmd.PersistentFlags().StringVar(&gqlQuery, "graphql-query", "", "File with the GraphQL query sent for each order, a Go template executed with the order as .Order")
+	rootCmd.PersistentFlags().StringArrayVar(&gqlVars, "graphql-var", nil, "GraphQL variable bound to an order field, as NAME=FIELD (e.g. id=order_id); repeatable")
+	rootCmd.PersistentFlags().StringVar(&soapEnvelope, "soap-envelope", "", "File with the SOAP envelope sent for each order, a Go template executed with the order as .Order")
+	rootCmd.PersistentFlags().StringVar(&soapAction, "soap-action", "", "SOAP action of the requests, sent as the SOAPAction header (1.1) or the action content type parameter (1.2)")
+	rootCmd.PersistentFlags().StringVar(&soapVersion, "soap-version", "1.1", "SOAP version of the requests: 1.1 or 1.2")
+	rootCmd.PersistentFlags().BoolVar(&paginate, "paginate", false, "Follow the next pages of paginated responses and write them as a JSON array per order")
+	rootCmd.PersistentFlags().StringVar(&nextPath, "next-path", ".next", "Path of the next page URL or cursor in a response body, with --paginate")
+	rootCmd.PersistentFlags().StringVar(&cursorParam, "cursor-param", "cursor", "Query parameter a next page cursor is sent in, with --paginate")
+	rootCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", "", "Directory caching API responses across runs; cached responses are revalidated with If-None-Match")
+	rootCmd.PersistentFlags().Float64Var(&rateLimit, "rate-limit", 0, "Most API requests per second (0 for no limit)")
+	rootCmd.PersistentFlags().BoolVar(&adaptive, "adaptive-rate", false, "Slow down when the API responds 429 or 503 and speed back up to --rate-limit when it recovers")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 30*time.Second, "Timeout for HTTP requests, including reading the response (0 for none)")
+	rootCmd.PersistentFlags().DurationVar(&timeouts.Dial, "dial-timeout", 0, "Timeout for connecting to the API, including DNS resolution (0 for the default of 30s)")
+	rootCmd.PersistentFlags().DurationVar(&timeouts.TLSHandshake, "tls-handshake-timeout", 0, "Timeout for the TLS handshake once connected (0 for none)")
+	rootCmd.PersistentFlags().DurationVar(&timeouts.ResponseHeader, "response-header-timeout", 0, "Timeout for the response headers once the request is sent (0 for none)")
+	rootCmd.PersistentFlags().Int64Var(&maxBody, "max-response-bytes", 0, "Largest API response body to read; orders with larger ones fail without retrying (0 for no limit)")
 	rootCmd.PersistentFlags().BoolVar(&insecure, "insecure", false, "Skip TLS verification")
+	rootCmd.PersistentFlags().StringVar(&ipVersion, "ip-version", "auto", "IP version to connect to the API over: 4, 6, or auto to try both")
+	rootCmd.PersistentFlags().StringArrayVar(&resolve, "resolve", nil, "Connect to address instead of resolving host:port, as host:port:address (e.g. api.example.com:443:10.1.2.3); repeatable")
+	rootCmd.PersistentFlags().BoolVar(&tuiMode, "tui", false, "Show a live dashboard in the terminal instead of log output")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose logging")
-	rootCmd.PersistentFlags().StringVar(&baseURL, "url", "https://example.com/api", "Base URL for the API")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Log only warnings and errors")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "", "Log level: debug, info, warn, or error (default info)")
+	rootCmd.PersistentFlags().BoolVar(&logOrders, "log-orders", false, "Log each order as it is processed and completed, rather than only with --verbose")
+	rootCmd.PersistentFlags().StringVar(&baseURL, "url", "https://example.com/api", "Base URL for the API, or unix:///path/to/api.sock:/api to send requests over a Unix domain socket")
+	rootCmd.PersistentFlags().StringVar(&authToken, "auth-token", "", secretEnv(&authToken, "ORDER_API_TOKEN", "Bearer token sent with API requests and HTTP(S) input downloads"))
+	rootCmd.PersistentFlags().StringArrayVar(&headers, "header", nil, "Extra \"Name: value\" header sent with API requests and HTTP(S) input downloads; repeatable")
+	rootCmd.PersistentFlags().StringVar(&userAgent, "user-agent", version.UserAgent(), "User-Agent sent with API requests and HTTP(S) input downloads (empty for Go's default)")
+	rootCmd.PersistentFlags().StringVar(&ckptFile, "checkpoint", "", "Checkpoint file for resuming an interrupted run")
+	rootCmd.PersistentFlags().IntVar(&ckptEvery, "checkpoint-every", 100, "Save the checkpoint every N input records")
+	rootCmd.PersistentFlags().StringVar(&sentryDSN, "sentry-dsn", "", secretEnv(&sentryDSN, "SENTRY_DSN", "Sentry DSN for reporting panics and failed orders"))
+	rootCmd.PersistentFlags().StringVar(&traceParent, "traceparent", os.Getenv("TRACEPARENT"), "W3C traceparent of the trace API requests are sent in, each as a new span")
+	rootCmd.PersistentFlags().StringVar(&traceState, "tracestate", os.Getenv("TRACESTATE"), "W3C tracestate sent along with --traceparent")
+	rootCmd.PersistentFlags().StringVar(&maxErrRate, "max-error-rate", "", "Fail the run, reporting to Sentry, if more than this percentage of requests failed (e.g. 2%)")
+	rootCmd.PersistentFlags().DurationVar(&maxP99, "max-p99", 0, "Fail the run, reporting to Sentry, if the 99th percentile request latency is above this")
+	rootCmd.PersistentFlags().StringVar(&statsdAddr, "statsd-addr", "", "StatsD agent address (host:port) for emitting metrics")
+	rootCmd.PersistentFlags().StringVar(&statsdPfx, "statsd-prefix", "order_processor", "Prefix for emitted StatsD metric names")
+	rootCmd.PersistentFlags().BoolVar(&dogstatsd, "dogstatsd", false, "Attach DogStatsD tags to emitted metrics")
+	rootCmd.PersistentFlags().StringVar(&auditFile, "audit-log", "", "Append-only JSONL log of every API request")
+	rootCmd.PersistentFlags().StringVar(&harFile, "capture", "", "Record full requests and responses to a HAR file")
+	rootCmd.PersistentFlags().IntVar(&harMaxBody, "capture-max-body", -1, "Truncate captured bodies to this many bytes (0 omits bodies, -1 keeps them whole)")
+	rootCmd.PersistentFlags().StringSliceVar(&harRedact, "capture-redact", []string{"Authorization", "Cookie", "Set-Cookie", "X-Amz-Security-Token"}, "Headers whose values are redacted in the capture")
 } 
\ No newline at end of file
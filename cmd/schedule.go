@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/cron"
+	"github.com/fauzanelka/99tech-order-processor/internal/processor"
+)
+
+// runStamp is the layout of the run time inserted into scheduled outputs
+const runStamp = "20060102T150405"
+
+var (
+	// Flags
+	schedule string
+)
+
+// runSchedule runs the configured input at every firing of the schedule
+// until interrupted. Runs never overlap: firings that pass while a run is in
+// progress are skipped. Each run writes to its own output, named by
+// inserting the run time before the output extension. A failed run is
+// logged and does not stop the schedule.
+func runSchedule(proc *processor.Processor, run func(*processor.Processor) error) error {
+	sched, err := cron.Parse(schedule)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for {
+		next := sched.Next(time.Now())
+		if next.IsZero() {
+			return fmt.Errorf("schedule %q never fires", schedule)
+		}
+		logger.Infof("Next run at %s", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Infof("Stopping: %v", ctx.Err())
+			return nil
+		case <-timer.C:
+		}
+
+		job := *proc
+		refreshSecrets(&job)
+		job.OutputFile = processor.KeyedPath(proc.OutputFile, next.Format(runStamp))
+		logger.Infof("Starting scheduled run, writing to %s", job.OutputFile)
+		start := time.Now()
+		err := run(&job)
+		if err != nil {
+			logger.Errorf("Scheduled run failed: %v", err)
+		} else {
+			logger.Infof("Scheduled run completed in %s", time.Since(start).Round(time.Second))
+		}
+		pushMetrics(&job, err)
+		if missed := sched.Next(next); missed.Before(time.Now()) {
+			logger.Warnf("Run overlapped the next scheduled time %s, which was skipped", missed.Format(time.RFC3339))
+		}
+		if ctx.Err() != nil {
+			logger.Infof("Stopping: %v", ctx.Err())
+			return nil
+		}
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&schedule, "schedule", "", "Cron expression (e.g. \"0 2 * * *\", in local time) to process the input on, running until interrupted")
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+	"github.com/fauzanelka/99tech-order-processor/internal/credential"
+	"github.com/fauzanelka/99tech-order-processor/internal/processor"
+	"github.com/fauzanelka/99tech-order-processor/internal/vault"
+)
+
+var (
+	// Flags
+	credentialHelper string
+
+	// secretFlags is the flag set of the running command
+	secretFlags *pflag.FlagSet
+	// secretRefs maps the names of flags given as vault: or keyring:
+	// references to the references
+	secretRefs map[string]string
+
+	// envSecrets are the secret flags read from the environment when the
+	// command runs, rather than set as their defaults, which help and usage
+	// text would print
+	envSecrets []envSecret
+)
+
+// envSecret is a secret flag that defaults to an environment variable
+type envSecret struct {
+	value *string
+	env   string
+}
+
+// secretEnv makes the flag holding value default to the environment
+// variable env, and returns usage with the variable noted
+func secretEnv(value *string, env, usage string) string {
+	envSecrets = append(envSecrets, envSecret{value: value, env: env})
+	return usage + " (env " + env + ")"
+}
+
+// readEnvSecrets sets the secret flags given neither on the command line nor
+// in the config file from their environment variables
+func readEnvSecrets() {
+	for _, s := range envSecrets {
+		if *s.value == "" {
+			*s.value = os.Getenv(s.env)
+		}
+	}
+}
+
+// resolveSecrets replaces the value of every string flag given as a
+// vault:path#field or keyring:service/account reference with the secret it
+// names, and sets --auth-token from --credential-helper. The Vault token is
+// kept renewed while the command runs.
+func resolveSecrets(flags *pflag.FlagSet) error {
+	refs := make(map[string]string)
+	usesVault := false
+	flags.VisitAll(func(f *pflag.Flag) {
+		value := f.Value.String()
+		if f.Value.Type() == "string" && (vault.IsRef(value) || credential.IsKeyringRef(value)) {
+			refs[f.Name] = value
+			usesVault = usesVault || vault.IsRef(value)
+		}
+	})
+	for _, name := range []string{"vault-addr", "vault-token", "credential-helper"} {
+		if _, ok := refs[name]; ok {
+			return fmt.Errorf("--%s cannot be a secret reference", name)
+		}
+	}
+	if credentialHelper != "" && authToken != "" {
+		return errors.New("--credential-helper and --auth-token both set the API token")
+	}
+	if len(refs) == 0 && credentialHelper == "" {
+		return nil
+	}
+
+	if usesVault {
+		client, err := newVaultClient()
+		if err != nil {
+			return err
+		}
+		vaultClient = client
+	}
+	secretFlags, secretRefs = flags, refs
+	if err := readSecrets(); err != nil {
+		return err
+	}
+	if usesVault {
+		go renewVaultToken()
+	}
+	return nil
+}
+
+// readSecrets sets the flags given as references to their secrets, and
+// --auth-token to the output of --credential-helper
+func readSecrets() error {
+	ctx := context.Background()
+	for name, ref := range secretRefs {
+		secret, err := readSecret(ctx, ref)
+		if err != nil {
+			return err
+		}
+		if err := secretFlags.Set(name, secret); err != nil {
+			return fmt.Errorf("invalid value for --%s from %s: %w", name, ref, err)
+		}
+		logger.Debugf("Read --%s from %s", name, ref)
+	}
+	if credentialHelper != "" {
+		token, err := credential.Helper(ctx, credentialHelper)
+		if err != nil {
+			return err
+		}
+		authToken = token
+		logger.Debugf("Read --auth-token from the credential helper")
+	}
+	return nil
+}
+
+// readSecret reads the secret a vault: or keyring: reference names
+func readSecret(ctx context.Context, ref string) (string, error) {
+	if vault.IsRef(ref) {
+		return vaultClient.Read(ctx, ref)
+	}
+	return credential.Keyring(ctx, ref)
+}
+
+// refreshSecrets reads the secrets again before a scheduled run, so that a
+// rotated --auth-token or routed credential is picked up. Other secrets keep
+// the values read at startup.
+func refreshSecrets(proc *processor.Processor) {
+	if len(secretRefs) == 0 && credentialHelper == "" && credentialField == "" {
+		return
+	}
+	if err := readSecrets(); err != nil {
+		logger.Warnf("Failed to refresh secrets, keeping the previous values: %v", err)
+		return
+	}
+	header, err := requestHeaders()
+	if err != nil {
+		logger.Warnf("Invalid headers, keeping the previous values: %v", err)
+		return
+	}
+	proc.Headers = header
+	if credentialField != "" {
+		creds, err := credentialHeaders()
+		if err != nil {
+			logger.Warnf("Failed to refresh credentials, keeping the previous values: %v", err)
+			return
+		}
+		proc.Credentials = creds
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&credentialHelper, "credential-helper", "", "Shell command printing the API token, run at startup and before each scheduled run; used instead of --auth-token")
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/fauzanelka/99tech-order-processor/internal/orderfile"
+	"github.com/fauzanelka/99tech-order-processor/internal/outlier"
+	"github.com/fauzanelka/99tech-order-processor/internal/processor"
+	"github.com/fauzanelka/99tech-order-processor/internal/shell"
+)
+
+var (
+	// shellMode is set by the shell command to explore the input
+	// interactively instead of processing it
+	shellMode bool
+
+	// Shell command
+	shellCmd = &cobra.Command{
+		Use:   "shell",
+		Short: "Explore the input interactively and process a selection of it",
+		Long: `Loads every valid order of the input file (--file) once and reads commands
+from the terminal: filter narrows the selection with expressions such as
+"symbol=TSLA price>200", show and stats preview and total the matches, and
+process requests the selected orders with the usual settings, appending the
+results to the output file. Type help at the prompt for all commands.`,
+		Args: cobra.NoArgs,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if sourceKind != sourceFile {
+				return fmt.Errorf("the shell cannot be used with --source %s", sourceKind)
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			shellMode = true
+			rootCmd.Run(cmd, args)
+		},
+	}
+)
+
+// runShell loads the input and runs the shell on the terminal, processing
+// the selected orders with proc
+func runShell(proc *processor.Processor) error {
+	var orders []models.Order
+	if _, err := readOrders(inputFile, true, func(order models.Order) {
+		orders = append(orders, order)
+	}); err != nil {
+		return err
+	}
+
+	sh := shell.New(orders, func(selection []models.Order) error {
+		job := *proc
+		job.Input = orderfile.NewSliceReader(selection)
+		// The selection replaces the --symbol, --side, --shard, and --sample
+		// filters, and --skip and --limit
+		job.Symbol, job.Side = distinct(selection)
+		job.Shard, job.Sample = models.Shard{}, models.Sample{}
+		job.Skip, job.Limit = 0, 0
+		// Results of each selection add to the output, and there is no
+		// input position to resume from or to read prices from again
+		job.Append = true
+		job.Checkpoint = ""
+		job.Outliers = outlier.Config{}
+		return job.Process()
+	})
+	return sh.Run(os.Stdin, os.Stdout)
+}
+
+// distinct returns the comma-separated symbols and sides of orders
+func distinct(orders []models.Order) (symbols, sides string) {
+	seenSymbols, seenSides := make(map[string]bool), make(map[string]bool)
+	for _, order := range orders {
+		seenSymbols[order.Symbol] = true
+		seenSides[order.Side] = true
+	}
+	return joinKeys(seenSymbols), joinKeys(seenSides)
+}
+
+func joinKeys(m map[string]bool) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func init() {
+	rootCmd.AddCommand(shellCmd)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/aws"
+)
+
+var (
+	// Flags
+	sigv4        bool
+	sigv4Region  string
+	sigv4Service string
+)
+
+// requestSigner returns the SigV4 signer for API requests, or nil if
+// --sigv4 is not set. Credentials are checked up front, so that missing
+// ones stop the run instead of failing every order.
+func requestSigner(apiURL string) (*aws.RequestSigner, error) {
+	if !sigv4 {
+		return nil, nil
+	}
+	if authToken != "" {
+		return nil, errors.New("--sigv4 and --auth-token both set the Authorization header")
+	}
+	region := sigv4Region
+	if region == "" {
+		region = aws.Region()
+	}
+	if region == "" {
+		// <api-id>.execute-api.<region>.amazonaws.com
+		if u, err := url.Parse(apiURL); err == nil {
+			if parts := strings.Split(u.Hostname(), "."); len(parts) >= 4 && parts[1] == sigv4Service {
+				region = parts[2]
+			}
+		}
+	}
+	if region == "" {
+		return nil, errors.New("cannot determine the AWS region; set --sigv4-region or AWS_REGION")
+	}
+
+	provider := aws.NewProvider()
+	if _, err := provider.Retrieve(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to load AWS credentials: %w", err)
+	}
+	return &aws.RequestSigner{Provider: provider, Region: region, Service: sigv4Service}, nil
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&sigv4, "sigv4", false, "Sign API requests with AWS Signature Version 4, using the standard AWS credential chain")
+	rootCmd.PersistentFlags().StringVar(&sigv4Region, "sigv4-region", "", "AWS region requests are signed for; defaults to AWS_REGION or the region of an execute-api URL")
+	rootCmd.PersistentFlags().StringVar(&sigv4Service, "sigv4-service", "execute-api", "AWS service name requests are signed for")
+}
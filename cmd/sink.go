@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/elastic"
+)
+
+// Result sinks
+const (
+	sinkNone = ""
+	sinkES   = "es"
+)
+
+// esFlushInterval bounds how long results wait to be indexed when orders
+// arrive slowly
+const esFlushInterval = 5 * time.Second
+
+var (
+	// Flags
+	sinkKind    string
+	esURL       string
+	esIndex     string
+	esAPIKey    string
+	esBatchSize int
+)
+
+// openSink creates the configured result sink, or nil when there is none
+func openSink() (*elastic.Indexer, error) {
+	switch sinkKind {
+	case sinkNone:
+		return nil, nil
+	case sinkES:
+		return elastic.New(elastic.Options{
+			URL:           esURL,
+			Index:         esIndex,
+			APIKey:        esAPIKey,
+			BatchSize:     esBatchSize,
+			FlushInterval: esFlushInterval,
+			Timeout:       timeout,
+			Insecure:      insecure,
+		})
+	default:
+		return nil, fmt.Errorf("unknown sink %q: must be %s", sinkKind, sinkES)
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&sinkKind, "sink", sinkNone, "Also send enveloped results to this sink (es)")
+	rootCmd.PersistentFlags().StringVar(&esURL, "es-url", "http://127.0.0.1:9200", "Elasticsearch/OpenSearch URL, with basic auth credentials as user:pass@")
+	rootCmd.PersistentFlags().StringVar(&esIndex, "es-index", "order-results-%{+yyyy.MM.dd}", "Index results are written to; %{+yyyy.MM.dd} is replaced with the UTC date")
+	rootCmd.PersistentFlags().StringVar(&esAPIKey, "es-api-key", "", secretEnv(&esAPIKey, "ES_API_KEY", "Elasticsearch API key, used instead of basic auth"))
+	rootCmd.PersistentFlags().IntVar(&esBatchSize, "es-batch-size", 500, "Results sent per bulk request")
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"errors"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/httpclient"
+)
+
+var (
+	// Flags
+	tlsMinVersion string
+	tlsCiphers    []string
+)
+
+// tlsOptions returns the TLS settings of --tls-min-version and --tls-ciphers
+// as httpclient options
+func tlsOptions() (httpclient.Options, error) {
+	version, err := httpclient.ParseTLSVersion(tlsMinVersion)
+	if err != nil {
+		return httpclient.Options{}, err
+	}
+	var suites []uint16
+	if len(tlsCiphers) > 0 {
+		if version == tls.VersionTLS13 {
+			return httpclient.Options{}, errors.New("--tls-ciphers has no effect with --tls-min-version 1.3, whose cipher suites are not configurable")
+		}
+		if suites, err = httpclient.ParseCipherSuites(tlsCiphers); err != nil {
+			return httpclient.Options{}, err
+		}
+	}
+	return httpclient.Options{MinVersion: version, CipherSuites: suites}, nil
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&tlsMinVersion, "tls-min-version", "", "Lowest TLS version accepted for API requests and HTTP(S) input downloads (1.0 to 1.3; default 1.2)")
+	rootCmd.PersistentFlags().StringSliceVar(&tlsCiphers, "tls-ciphers", nil, "Comma-separated TLS 1.2 cipher suites offered for API requests and HTTP(S) input downloads (e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)")
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/fauzanelka/99tech-order-processor/internal/aggregate"
+)
+
+var (
+	// Flags
+	topTo    string
+	topCount int
+	topBy    []string
+
+	// Top command
+	topCmd = &cobra.Command{
+		Use:   "top <input> [output]",
+		Short: "List the largest orders by notional value without requesting them",
+		Long: `Reads orders from the input file like aggregate, and writes the --count
+orders with the largest notional value (quantity times price) per symbol,
+largest first, to spot outsized fills. No API requests are made. Orders are
+written to the output file as JSON or CSV, inferred from its extension unless
+--to is given, or as JSON to stdout.`,
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			to := topTo
+			if to == "" && len(args) == 2 {
+				to = aggregate.Detect(args[1])
+			}
+			if to == "" {
+				to = aggregate.FormatJSON
+			}
+			if to != aggregate.FormatJSON && to != aggregate.FormatCSV {
+				return fmt.Errorf("unsupported top format %q: must be %s or %s", to, aggregate.FormatJSON, aggregate.FormatCSV)
+			}
+			// Orders written to stdout must not be mixed with log output
+			if len(args) == 1 {
+				logger.SetOutput(os.Stderr)
+			}
+
+			top, err := aggregate.NewTop(topCount, topBy)
+			if err != nil {
+				return err
+			}
+
+			matched, err := readOrders(args[0], aggregateAll, top.Add)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if len(args) == 2 {
+				f, err := os.Create(args[1])
+				if err != nil {
+					return fmt.Errorf("failed to create output file: %w", err)
+				}
+				defer f.Close()
+				out = f
+			}
+			if err := top.Write(out, to); err != nil {
+				return fmt.Errorf("failed to write orders: %w", err)
+			}
+			logger.Infof("Ranked %d orders", matched)
+			return nil
+		},
+	}
+)
+
+func init() {
+	topCmd.Flags().StringVar(&topTo, "to", "", "Output format (json/csv); inferred from the output extension when empty")
+	topCmd.Flags().IntVarP(&topCount, "count", "n", 10, "Number of orders to list per group")
+	topCmd.Flags().StringSliceVar(&topBy, "group-by", []string{aggregate.BySymbol}, "Fields to rank orders within (symbol, side); none for a single ranking")
+	topCmd.Flags().BoolVar(&aggregateAll, "all", false, "Rank all orders, ignoring the symbol and side filters")
+	topCmd.Flags().StringVar(&aggregateSince, "since", "", "Only rank orders timestamped at or after this time (RFC 3339 or a --timestamp-format)")
+	topCmd.Flags().StringVar(&aggregateUntil, "until", "", "Only rank orders timestamped before this time (RFC 3339 or a --timestamp-format)")
+
+	rootCmd.AddCommand(topCmd)
+}
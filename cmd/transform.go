@@ -0,0 +1,10 @@
+package cmd
+
+var (
+	// Flags
+	transforms []string
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringArrayVar(&transforms, "transform", nil, "Step reshaping each JSON response before it is written: a jq-style expression (e.g. '.data | del(.meta) | flatten'), a Go template, or @FILE; repeatable, applied in order")
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/httpclient"
+	"github.com/fauzanelka/99tech-order-processor/internal/vault"
+)
+
+var (
+	// Flags
+	vaultAddr  string
+	vaultToken string
+
+	// vaultClient reads the flags given as Vault references, if any
+	vaultClient *vault.Client
+)
+
+// newVaultClient creates a client from --vault-addr and --vault-token,
+// falling back to the token file written by vault login
+func newVaultClient() (*vault.Client, error) {
+	if vaultAddr == "" {
+		return nil, errors.New("--vault-addr or VAULT_ADDR is required to read vault: flag values")
+	}
+	token := vaultToken
+	if token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if data, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				token = strings.TrimSpace(string(data))
+			}
+		}
+	}
+	opts, err := tlsOptions()
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS configuration: %w", err)
+	}
+	opts.Timeout = 30 * time.Second
+	return vault.New(vaultAddr, token, httpclient.New(opts))
+}
+
+// renewVaultToken renews the Vault token at half of each lease, until it
+// cannot be renewed
+func renewVaultToken() {
+	for {
+		ttl, err := vaultClient.RenewSelf(context.Background())
+		if err != nil {
+			logger.Warnf("%v; secrets cannot be read again once the token expires", err)
+			return
+		}
+		if ttl == 0 {
+			return
+		}
+		logger.Debugf("Renewed Vault token for %s", ttl)
+		time.Sleep(max(ttl/2, time.Second))
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&vaultAddr, "vault-addr", os.Getenv("VAULT_ADDR"), "Vault server address for flag values given as vault:path#field")
+	rootCmd.PersistentFlags().StringVar(&vaultToken, "vault-token", "", secretEnv(&vaultToken, "VAULT_TOKEN", "Vault token; read from ~/.vault-token when empty"))
+}
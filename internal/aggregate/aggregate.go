@@ -0,0 +1,235 @@
+// Package aggregate totals orders by symbol and side, with their average
+// prices, and ranks the largest orders, without requesting them, to size up
+// an input before submitting it.
+package aggregate
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// Supported output formats
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// Fields orders can be grouped by
+const (
+	BySymbol = "symbol"
+	BySide   = "side"
+)
+
+// Total is the total of a group of orders. Symbol and Side are empty when
+// orders are not grouped by them.
+type Total struct {
+	Symbol string `json:"symbol,omitempty"`
+	Side   string `json:"side,omitempty"`
+	Count  int    `json:"count"`
+	// Quantity is the sum of the quantities
+	Quantity models.Decimal `json:"quantity"`
+	// Notional is the sum of quantity times price
+	Notional models.Decimal `json:"notional"`
+	// VWAP is the volume-weighted average price, notional over quantity, or
+	// nil if the quantity is zero
+	VWAP *models.Decimal `json:"vwap"`
+	// AveragePrice is the mean of the prices, not weighted by quantity
+	AveragePrice models.Decimal `json:"average_price"`
+}
+
+// averageDigits is the number of decimal places averages are given with
+// beyond those of the most precise price, since they rarely come out exact
+const averageDigits = 4
+
+type key struct {
+	symbol, side string
+}
+
+type group struct {
+	count    int
+	quantity *big.Rat
+	notional *big.Rat
+	prices   *big.Rat
+}
+
+// Aggregator sums orders into groups. Sums are exact.
+type Aggregator struct {
+	bySymbol bool
+	bySide   bool
+	groups   map[key]*group
+	// priceDigits is the most decimal places of any price
+	priceDigits int
+}
+
+// New creates an aggregator grouping by the given fields, symbol and side.
+// Without fields, all orders are summed into one total.
+func New(by []string) (*Aggregator, error) {
+	bySymbol, bySide, err := parseBy(by)
+	if err != nil {
+		return nil, err
+	}
+	return &Aggregator{bySymbol: bySymbol, bySide: bySide, groups: make(map[key]*group)}, nil
+}
+
+// parseBy parses the fields to group orders by
+func parseBy(by []string) (bySymbol, bySide bool, err error) {
+	for _, field := range by {
+		switch strings.TrimSpace(field) {
+		case BySymbol:
+			bySymbol = true
+		case BySide:
+			bySide = true
+		default:
+			return false, false, fmt.Errorf("cannot group by %q: must be %s or %s", field, BySymbol, BySide)
+		}
+	}
+	return bySymbol, bySide, nil
+}
+
+// keyOf returns the group key of an order
+func keyOf(order models.Order, bySymbol, bySide bool) key {
+	var k key
+	if bySymbol {
+		k.symbol = order.Symbol
+	}
+	if bySide {
+		k.side = order.Side
+	}
+	return k
+}
+
+// Add adds an order to its group. Orders whose quantity or price has no
+// exact value, which parsed orders always have, are left out.
+func (a *Aggregator) Add(order models.Order) {
+	qty, ok := order.Quantity.Rat()
+	if !ok {
+		return
+	}
+	price, ok := order.Price.Rat()
+	if !ok {
+		return
+	}
+	k := keyOf(order, a.bySymbol, a.bySide)
+	g, ok := a.groups[k]
+	if !ok {
+		g = &group{quantity: new(big.Rat), notional: new(big.Rat), prices: new(big.Rat)}
+		a.groups[k] = g
+	}
+	g.count++
+	g.quantity.Add(g.quantity, qty)
+	g.notional.Add(g.notional, new(big.Rat).Mul(qty, price))
+	g.prices.Add(g.prices, price)
+	a.priceDigits = max(a.priceDigits, digits(price))
+}
+
+// Totals returns the totals of the groups, ordered by symbol and side
+func (a *Aggregator) Totals() []Total {
+	prec := a.priceDigits + averageDigits
+	totals := make([]Total, 0, len(a.groups))
+	for k, g := range a.groups {
+		t := Total{
+			Symbol:       k.symbol,
+			Side:         k.side,
+			Count:        g.count,
+			Quantity:     exact(g.quantity),
+			Notional:     exact(g.notional),
+			AveragePrice: rounded(new(big.Rat).Quo(g.prices, big.NewRat(int64(g.count), 1)), prec),
+		}
+		if g.quantity.Sign() != 0 {
+			vwap := rounded(new(big.Rat).Quo(g.notional, g.quantity), prec)
+			t.VWAP = &vwap
+		}
+		totals = append(totals, t)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].Symbol != totals[j].Symbol {
+			return totals[i].Symbol < totals[j].Symbol
+		}
+		return totals[i].Side < totals[j].Side
+	})
+	return totals
+}
+
+// Write writes the totals to w in format
+func (a *Aggregator) Write(w io.Writer, format string) error {
+	totals := a.Totals()
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(totals)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		var header []string
+		if a.bySymbol {
+			header = append(header, "symbol")
+		}
+		if a.bySide {
+			header = append(header, "side")
+		}
+		cw.Write(append(header, "count", "quantity", "notional", "vwap", "average_price"))
+		for _, t := range totals {
+			var row []string
+			if a.bySymbol {
+				row = append(row, t.Symbol)
+			}
+			if a.bySide {
+				row = append(row, t.Side)
+			}
+			vwap := ""
+			if t.VWAP != nil {
+				vwap = t.VWAP.String()
+			}
+			cw.Write(append(row, strconv.Itoa(t.Count), t.Quantity.String(), t.Notional.String(), vwap, t.AveragePrice.String()))
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unsupported aggregate format %q: must be %s or %s", format, FormatJSON, FormatCSV)
+	}
+}
+
+// Detect returns the format for an output path from its extension, JSON
+// unless it ends in .csv
+func Detect(path string) string {
+	if strings.HasSuffix(strings.ToLower(path), ".csv") {
+		return FormatCSV
+	}
+	return FormatJSON
+}
+
+// exact writes r as a decimal with as many fractional digits as it needs.
+// Sums and products of decimals always have a finite expansion.
+func exact(r *big.Rat) models.Decimal {
+	return models.DecimalFromRat(r, digits(r))
+}
+
+// rounded writes r as a decimal rounded to at most prec fractional digits
+func rounded(r *big.Rat, prec int) models.Decimal {
+	s := r.FloatString(prec)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	d, _ := models.NewDecimal(s)
+	return d
+}
+
+// digits returns the number of fractional digits of a decimal r
+func digits(r *big.Rat) int {
+	n := 0
+	scaled := new(big.Rat).Set(r)
+	ten := big.NewRat(10, 1)
+	for !scaled.IsInt() {
+		scaled.Mul(scaled, ten)
+		n++
+	}
+	return n
+}
@@ -0,0 +1,121 @@
+package aggregate
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// Ranked is an order ranked by notional value within its group
+type Ranked struct {
+	// Rank is the position of the order in its group, from 1 for the largest
+	Rank     int            `json:"rank"`
+	Notional models.Decimal `json:"notional"`
+	Order    models.Order   `json:"order"`
+}
+
+type ranked struct {
+	notional *big.Rat
+	order    models.Order
+}
+
+// Top keeps the n orders with the largest notional value (quantity times
+// price) of each group
+type Top struct {
+	n        int
+	bySymbol bool
+	bySide   bool
+	groups   map[key][]ranked
+}
+
+// NewTop creates a ranking of the n largest orders of each group of the
+// given fields, symbol and side. Without fields, orders are ranked in a
+// single group.
+func NewTop(n int, by []string) (*Top, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("invalid count %d: must be at least 1", n)
+	}
+	bySymbol, bySide, err := parseBy(by)
+	if err != nil {
+		return nil, err
+	}
+	return &Top{n: n, bySymbol: bySymbol, bySide: bySide, groups: make(map[key][]ranked)}, nil
+}
+
+// Add ranks an order in its group, dropping the smallest order once the
+// group holds more than n. Orders of equal notional keep their input order,
+// and orders without an exact notional are not ranked.
+func (t *Top) Add(order models.Order) {
+	notional, ok := order.Notional()
+	if !ok {
+		return
+	}
+	k := keyOf(order, t.bySymbol, t.bySide)
+	list := t.groups[k]
+	i := sort.Search(len(list), func(i int) bool { return list[i].notional.Cmp(notional) < 0 })
+	if i >= t.n {
+		return
+	}
+	list = append(list, ranked{})
+	copy(list[i+1:], list[i:])
+	list[i] = ranked{notional: notional, order: order}
+	if len(list) > t.n {
+		list = list[:t.n]
+	}
+	t.groups[k] = list
+}
+
+// Orders returns the ranked orders, ordered by symbol and side, then by rank
+func (t *Top) Orders() []Ranked {
+	keys := make([]key, 0, len(t.groups))
+	for k := range t.groups {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].symbol != keys[j].symbol {
+			return keys[i].symbol < keys[j].symbol
+		}
+		return keys[i].side < keys[j].side
+	})
+	var out []Ranked
+	for _, k := range keys {
+		for i, r := range t.groups[k] {
+			out = append(out, Ranked{Rank: i + 1, Notional: exact(r.notional), Order: r.order})
+		}
+	}
+	return out
+}
+
+// Write writes the ranked orders to w in format. CSV rows hold the order
+// schema fields only.
+func (t *Top) Write(w io.Writer, format string) error {
+	orders := t.Orders()
+	switch format {
+	case FormatJSON:
+		if orders == nil {
+			orders = []Ranked{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(orders)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"rank", "notional", "order_id", "symbol", "side", "quantity", "price", "timestamp"})
+		for _, r := range orders {
+			o := r.Order
+			cw.Write([]string{strconv.Itoa(r.Rank), r.Notional.String(), o.OrderID, o.Symbol, o.Side,
+				o.Quantity.String(), o.Price.String(), o.Timestamp.Format(time.RFC3339Nano)})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unsupported top format %q: must be %s or %s", format, FormatJSON, FormatCSV)
+	}
+}
@@ -0,0 +1,62 @@
+package amqp
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Publisher publishes processing results and failures to exchanges. All
+// methods are safe to call on a nil receiver, which disables publishing.
+type Publisher struct {
+	mu              sync.Mutex
+	conn            *Conn
+	resultExchange  string
+	failureExchange string
+}
+
+// NewPublisher connects to the broker with publisher confirms enabled. An
+// empty exchange name disables that kind of message.
+func NewPublisher(url string, insecure bool, resultExchange, failureExchange string) (*Publisher, error) {
+	conn, err := Dial(url, insecure)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.ConfirmSelect(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Publisher{conn: conn, resultExchange: resultExchange, failureExchange: failureExchange}, nil
+}
+
+// Result publishes a JSON result with the given routing key
+func (p *Publisher) Result(key string, body []byte) error {
+	if p == nil || p.resultExchange == "" {
+		return nil
+	}
+	return p.publish(p.resultExchange, key, body)
+}
+
+// Failure publishes a JSON failure with the given routing key
+func (p *Publisher) Failure(key string, body []byte) error {
+	if p == nil || p.failureExchange == "" {
+		return nil
+	}
+	return p.publish(p.failureExchange, key, body)
+}
+
+func (p *Publisher) publish(exchange, key string, body []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.conn.Publish(exchange, key, "application/json", body); err != nil {
+		return fmt.Errorf("failed to publish to exchange %s: %w", exchange, err)
+	}
+	return nil
+}
+
+// Close closes the connection
+func (p *Publisher) Close() error {
+	if p == nil {
+		return nil
+	}
+	return p.conn.Close()
+}
@@ -0,0 +1,292 @@
+package amqp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Frame types
+const (
+	frameMethod    = 1
+	frameHeader    = 2
+	frameBody      = 3
+	frameHeartbeat = 8
+	frameEnd       = 0xCE
+)
+
+// Class and method IDs used by this client
+const (
+	classConnection = 10
+	classChannel    = 20
+	classBasic      = 60
+	classConfirm    = 85
+
+	methodConnectionStart   = 10
+	methodConnectionStartOk = 11
+	methodConnectionTune    = 30
+	methodConnectionTuneOk  = 31
+	methodConnectionOpen    = 40
+	methodConnectionOpenOk  = 41
+	methodConnectionClose   = 50
+	methodConnectionCloseOk = 51
+
+	methodChannelOpen    = 10
+	methodChannelOpenOk  = 11
+	methodChannelClose   = 40
+	methodChannelCloseOk = 41
+
+	methodBasicQos       = 10
+	methodBasicQosOk     = 11
+	methodBasicConsume   = 20
+	methodBasicConsumeOk = 21
+	methodBasicPublish   = 40
+	methodBasicDeliver   = 60
+	methodBasicAck       = 80
+	methodBasicNack      = 120
+
+	methodConfirmSelect   = 10
+	methodConfirmSelectOk = 11
+)
+
+// frame is a single AMQP frame
+type frame struct {
+	typ     byte
+	channel uint16
+	payload []byte
+}
+
+func readFrame(r *bufio.Reader) (frame, error) {
+	var head [7]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return frame{}, err
+	}
+	f := frame{typ: head[0], channel: binary.BigEndian.Uint16(head[1:3])}
+	size := binary.BigEndian.Uint32(head[3:7])
+	f.payload = make([]byte, size+1)
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		return frame{}, err
+	}
+	if f.payload[size] != frameEnd {
+		return frame{}, fmt.Errorf("malformed frame: missing frame end")
+	}
+	f.payload = f.payload[:size]
+	return f, nil
+}
+
+func (f frame) encode() []byte {
+	buf := make([]byte, 7, 8+len(f.payload))
+	buf[0] = f.typ
+	binary.BigEndian.PutUint16(buf[1:3], f.channel)
+	binary.BigEndian.PutUint32(buf[3:7], uint32(len(f.payload)))
+	buf = append(buf, f.payload...)
+	return append(buf, frameEnd)
+}
+
+// writer encodes method arguments
+type writer struct {
+	bytes.Buffer
+	bits    byte
+	bitsLen int
+}
+
+func newMethod(class, method uint16) *writer {
+	w := &writer{}
+	w.short(class)
+	w.short(method)
+	return w
+}
+
+func (w *writer) flushBits() {
+	if w.bitsLen > 0 {
+		w.WriteByte(w.bits)
+		w.bits, w.bitsLen = 0, 0
+	}
+}
+
+func (w *writer) octet(v byte) {
+	w.flushBits()
+	w.WriteByte(v)
+}
+
+func (w *writer) short(v uint16) {
+	w.flushBits()
+	binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *writer) long(v uint32) {
+	w.flushBits()
+	binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *writer) longlong(v uint64) {
+	w.flushBits()
+	binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *writer) shortstr(s string) {
+	w.flushBits()
+	if len(s) > math.MaxUint8 {
+		s = s[:math.MaxUint8]
+	}
+	w.WriteByte(byte(len(s)))
+	w.WriteString(s)
+}
+
+func (w *writer) longstr(s string) {
+	w.long(uint32(len(s)))
+	w.WriteString(s)
+}
+
+// bit packs consecutive boolean arguments into octets
+func (w *writer) bit(v bool) {
+	if w.bitsLen == 8 {
+		w.flushBits()
+	}
+	if v {
+		w.bits |= 1 << w.bitsLen
+	}
+	w.bitsLen++
+}
+
+// table encodes a field table of strings, booleans, and nested tables
+func (w *writer) table(t map[string]interface{}) {
+	var body writer
+	for k, v := range t {
+		body.shortstr(k)
+		switch v := v.(type) {
+		case string:
+			body.WriteByte('S')
+			body.longstr(v)
+		case bool:
+			body.WriteByte('t')
+			if v {
+				body.WriteByte(1)
+			} else {
+				body.WriteByte(0)
+			}
+		case map[string]interface{}:
+			body.WriteByte('F')
+			body.table(v)
+		}
+	}
+	body.flushBits()
+	w.long(uint32(body.Len()))
+	w.Write(body.Bytes())
+}
+
+func (w *writer) payload() []byte {
+	w.flushBits()
+	return w.Bytes()
+}
+
+// reader decodes method arguments
+type reader struct {
+	data    []byte
+	bits    byte
+	bitsLen int
+	err     error
+}
+
+var errShort = errors.New("malformed method: arguments truncated")
+
+func (r *reader) take(n int) []byte {
+	r.bitsLen = 0
+	if r.err != nil || n > len(r.data) {
+		r.err = errShort
+		return make([]byte, n)
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) octet() byte       { return r.take(1)[0] }
+func (r *reader) short() uint16     { return binary.BigEndian.Uint16(r.take(2)) }
+func (r *reader) long() uint32      { return binary.BigEndian.Uint32(r.take(4)) }
+func (r *reader) longlong() uint64  { return binary.BigEndian.Uint64(r.take(8)) }
+func (r *reader) shortstr() string  { return string(r.take(int(r.octet()))) }
+func (r *reader) longstr() string   { return string(r.take(int(r.long()))) }
+func (r *reader) timestamp() uint64 { return r.longlong() }
+
+func (r *reader) bit() bool {
+	if r.bitsLen == 0 || r.bitsLen == 8 {
+		r.bits = r.octet()
+		r.bitsLen = 0
+	}
+	v := r.bits&(1<<r.bitsLen) != 0
+	r.bitsLen++
+	return v
+}
+
+// table decodes a field table
+func (r *reader) table() map[string]interface{} {
+	sub := &reader{data: r.take(int(r.long()))}
+	if r.err != nil {
+		return nil
+	}
+	t := make(map[string]interface{})
+	for len(sub.data) > 0 && sub.err == nil {
+		key := sub.shortstr()
+		t[key] = sub.value()
+	}
+	if sub.err != nil {
+		r.err = sub.err
+	}
+	return t
+}
+
+// value decodes a typed field value
+func (r *reader) value() interface{} {
+	switch r.octet() {
+	case 't':
+		return r.octet() != 0
+	case 'b':
+		return int64(int8(r.octet()))
+	case 'B':
+		return int64(r.octet())
+	case 's':
+		return int64(int16(r.short()))
+	case 'u':
+		return int64(r.short())
+	case 'I':
+		return int64(int32(r.long()))
+	case 'i':
+		return int64(r.long())
+	case 'l':
+		return int64(r.longlong())
+	case 'f':
+		return float64(math.Float32frombits(r.long()))
+	case 'd':
+		return math.Float64frombits(r.longlong())
+	case 'D':
+		scale := r.octet()
+		return float64(int32(r.long())) / math.Pow10(int(scale))
+	case 'S', 'x':
+		return r.longstr()
+	case 'T':
+		return time.Unix(int64(r.timestamp()), 0)
+	case 'F':
+		return r.table()
+	case 'A':
+		sub := &reader{data: r.take(int(r.long()))}
+		var list []interface{}
+		for len(sub.data) > 0 && sub.err == nil {
+			list = append(list, sub.value())
+		}
+		if sub.err != nil {
+			r.err = sub.err
+		}
+		return list
+	case 'V':
+		return nil
+	default:
+		r.err = fmt.Errorf("malformed field table: unknown value type")
+		return nil
+	}
+}
@@ -0,0 +1,97 @@
+// Package annotate writes GitHub Actions workflow commands that annotate the
+// lines of a file with the problems found in them, so they show inline on
+// pull requests.
+package annotate
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// MaxErrors is the number of error annotations GitHub shows for a step;
+// later ones are only counted
+const MaxErrors = 10
+
+var (
+	// dataEscaper escapes the message of a workflow command
+	dataEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	// propertyEscaper escapes the properties of a workflow command, such as
+	// the file and title
+	propertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// Annotator writes error annotations on a file to w, which GitHub Actions
+// reads workflow commands from. All methods are safe for concurrent use
+// and safe to call on a nil receiver, which writes nothing.
+type Annotator struct {
+	file string
+
+	mu      sync.Mutex
+	w       io.Writer
+	written int
+	dropped int
+}
+
+// New returns an Annotator that writes annotations on file to w. An
+// absolute file is made relative to the workspace, as GitHub expects; an
+// empty file annotates the run rather than a file.
+func New(w io.Writer, file string) *Annotator {
+	return &Annotator{w: w, file: workspacePath(file)}
+}
+
+// Error annotates a line of the file with an error. A line of zero
+// annotates the whole file.
+func (a *Annotator) Error(line int, title, message string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.written >= MaxErrors {
+		a.dropped++
+		return
+	}
+	a.written++
+
+	var props []string
+	if a.file != "" {
+		props = append(props, "file="+propertyEscaper.Replace(a.file))
+		if line > 0 {
+			props = append(props, fmt.Sprintf("line=%d", line))
+		}
+	}
+	props = append(props, "title="+propertyEscaper.Replace(title))
+	fmt.Fprintf(a.w, "::error %s::%s\n", strings.Join(props, ","), dataEscaper.Replace(message))
+}
+
+// End notes how many errors of the run were not annotated, and starts
+// annotating the next run
+func (a *Annotator) End() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.dropped > 0 {
+		fmt.Fprintf(a.w, "::notice title=More problems::%d more problems were not annotated; see the log\n", a.dropped)
+	}
+	a.written, a.dropped = 0, 0
+}
+
+// workspacePath returns path relative to the GitHub workspace, if it is an
+// absolute path within it
+func workspacePath(path string) string {
+	workspace := os.Getenv("GITHUB_WORKSPACE")
+	if workspace == "" || !filepath.IsAbs(path) {
+		return path
+	}
+	rel, err := filepath.Rel(workspace, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,121 @@
+// Package atomicfile writes files so that readers never observe partial
+// content, even if the process crashes mid-write.
+package atomicfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// WriteFile writes data to a temporary file in the same directory as path,
+// syncs it, and renames it over path
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("failed to rename temporary file: %w", err)
+	}
+	return syncDir(dir)
+}
+
+// syncDir flushes a directory entry so a completed rename survives a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory: %w", err)
+	}
+	defer d.Close()
+
+	// Some filesystems do not support syncing directories
+	if err := d.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) {
+		return fmt.Errorf("failed to sync directory: %w", err)
+	}
+	return nil
+}
+
+// PartialSuffix is appended to the path of files that are still being written
+const PartialSuffix = ".partial"
+
+// File is an output file that only appears at its final path once Commit is
+// called. Until then it is written to path + PartialSuffix.
+type File struct {
+	*os.File
+	path    string
+	inPlace bool
+}
+
+// Create opens a partial file for path. When resume is true, an existing
+// partial file left by an interrupted run is appended to instead of truncated.
+func Create(path string, resume bool) (*File, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(path+PartialSuffix, flags, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	return &File{File: f, path: path}, nil
+}
+
+// Append opens path for appending in place; Commit only syncs and closes it
+func Append(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	return &File{File: f, path: path, inPlace: true}, nil
+}
+
+// WriteLocked writes p in a single write while holding an exclusive lock on
+// the file, so that other processes appending to it the same way, such as
+// concurrent runs, never interleave their writes with it
+func (f *File) WriteLocked(p []byte) (int, error) {
+	if err := lock(f.File); err != nil {
+		return 0, fmt.Errorf("failed to lock %s: %w", f.Name(), err)
+	}
+	defer unlock(f.File)
+	return f.File.Write(p)
+}
+
+// Commit syncs and closes the file and moves it to its final path
+func (f *File) Commit() error {
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync %s: %w", f.Name(), err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", f.Name(), err)
+	}
+	if f.inPlace {
+		return nil
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", f.Name(), err)
+	}
+	return syncDir(filepath.Dir(f.path))
+}
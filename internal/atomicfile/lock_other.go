@@ -0,0 +1,16 @@
+//go:build !unix
+
+package atomicfile
+
+import "os"
+
+// lock does nothing where advisory file locks are not supported; appends
+// are still whole writes to a file opened for appending
+func lock(f *os.File) error {
+	return nil
+}
+
+// unlock does nothing where advisory file locks are not supported
+func unlock(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,90 @@
+// Package audit records every outbound API request to an append-only log.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record describes a single outbound request
+type Record struct {
+	Timestamp  time.Time              `json:"timestamp"`
+	OrderID    string                 `json:"order_id"`
+	RequestID  string                 `json:"request_id,omitempty"`
+	URL        string                 `json:"url"`
+	Method     string                 `json:"method"`
+	StatusCode int                    `json:"status_code"`
+	LatencyMs  int64                  `json:"latency_ms"`
+	Attempt    int                    `json:"attempt"`
+	Error      string                 `json:"error,omitempty"`
+	Extra      map[string]interface{} `json:"extra,omitempty"`
+}
+
+// Log appends records to a JSONL file. All methods are safe to call on a nil
+// receiver, which disables auditing.
+type Log struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// Open opens the audit log at path for appending, creating it if needed
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Log{path: path, file: file}, nil
+}
+
+// Write appends a record to the log
+func (l *Log) Write(rec Record) error {
+	if l == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return nil
+}
+
+// Reopen closes the audit log and opens its path again, so that a log
+// rotated by renaming it is continued in a fresh file
+func (l *Log) Reopen() error {
+	if l == nil {
+		return nil
+	}
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to reopen audit log: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.file.Close()
+	l.file = file
+	return nil
+}
+
+// Close flushes and closes the audit log
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	if err := l.file.Sync(); err != nil {
+		l.file.Close()
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+	return l.file.Close()
+}
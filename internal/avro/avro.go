@@ -0,0 +1,375 @@
+// Package avro reads records from Avro object container files, which embed
+// the schema their records were written with.
+package avro
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/snappy"
+)
+
+const (
+	// magic starts every object container file
+	magic = "Obj\x01"
+	// maxBlockSize bounds the size of a single data block
+	maxBlockSize = 64 << 20
+	// maxDepth bounds the nesting of decoded values
+	maxDepth = 32
+)
+
+// Reader reads the records of an object container file in order
+type Reader struct {
+	r      *bufio.Reader
+	schema *schema
+	codec  string
+	sync   []byte
+
+	block     []byte
+	remaining int64
+}
+
+// NewReader reads the header of an object container file
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(br, head); err != nil || string(head) != magic {
+		return nil, fmt.Errorf("not an Avro container file")
+	}
+
+	meta, err := readMetadata(br)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Avro header: %w", err)
+	}
+	s, err := parseSchema(meta["avro.schema"])
+	if err != nil {
+		return nil, err
+	}
+	codec := string(meta["avro.codec"])
+	switch codec {
+	case "":
+		codec = "null"
+	case "null", "deflate", "snappy":
+	default:
+		return nil, fmt.Errorf("unsupported Avro codec %q", codec)
+	}
+
+	sync := make([]byte, 16)
+	if _, err := io.ReadFull(br, sync); err != nil {
+		return nil, fmt.Errorf("invalid Avro header: %w", err)
+	}
+	return &Reader{r: br, schema: s, codec: codec, sync: sync}, nil
+}
+
+// readMetadata reads the header metadata map
+func readMetadata(r *bufio.Reader) (map[string][]byte, error) {
+	meta := make(map[string][]byte)
+	for {
+		count, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return meta, nil
+		}
+		if count < 0 {
+			// Negative counts are followed by the block size
+			count = -count
+			if _, err := binary.ReadVarint(r); err != nil {
+				return nil, err
+			}
+		}
+		for ; count > 0; count-- {
+			key, err := readBytes(r)
+			if err != nil {
+				return nil, err
+			}
+			value, err := readBytes(r)
+			if err != nil {
+				return nil, err
+			}
+			meta[string(key)] = value
+		}
+	}
+}
+
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadVarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n > maxBlockSize {
+		return nil, fmt.Errorf("invalid length %d", n)
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
+
+// Next returns the next record, or io.EOF after the last one. Records are
+// decoded as JSON-compatible values: records and maps become maps, numbers
+// become json.Number, bytes become base64 strings, and enums their symbol
+// names. Logical decimals are exact numbers, timestamps RFC 3339 strings, and
+// dates YYYY-MM-DD strings.
+func (r *Reader) Next() (interface{}, error) {
+	for r.remaining == 0 {
+		if err := r.readBlock(); err != nil {
+			return nil, err
+		}
+	}
+	d := &decoder{buf: r.block}
+	v := d.value(r.schema, 0)
+	if d.err != nil {
+		return nil, fmt.Errorf("corrupt Avro record: %w", d.err)
+	}
+	r.block = r.block[d.pos:]
+	r.remaining--
+	return v, nil
+}
+
+// readBlock reads and decompresses the next data block
+func (r *Reader) readBlock() error {
+	count, err := binary.ReadVarint(r.r)
+	if err == io.EOF {
+		return io.EOF
+	}
+	if err != nil {
+		return fmt.Errorf("corrupt Avro block: %w", err)
+	}
+	size, err := binary.ReadVarint(r.r)
+	if err != nil {
+		return fmt.Errorf("corrupt Avro block: %w", err)
+	}
+	if count < 0 || size < 0 || size > maxBlockSize {
+		return fmt.Errorf("corrupt Avro block: %d records in %d bytes", count, size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return fmt.Errorf("corrupt Avro block: %w", err)
+	}
+	sync := make([]byte, 16)
+	if _, err := io.ReadFull(r.r, sync); err != nil || !bytes.Equal(sync, r.sync) {
+		return fmt.Errorf("corrupt Avro block: sync marker mismatch")
+	}
+
+	switch r.codec {
+	case "deflate":
+		data, err = io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(data)), maxBlockSize+1))
+		if err == nil && len(data) > maxBlockSize {
+			err = fmt.Errorf("block too large")
+		}
+	case "snappy":
+		// The compressed data is followed by the CRC-32 of the original
+		if len(data) < 4 {
+			return fmt.Errorf("corrupt Avro block: truncated snappy data")
+		}
+		sum := binary.BigEndian.Uint32(data[len(data)-4:])
+		if data, err = snappy.Decode(data[:len(data)-4]); err == nil && crc32.ChecksumIEEE(data) != sum {
+			err = fmt.Errorf("checksum mismatch")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decompress Avro block: %w", err)
+	}
+	r.block, r.remaining = data, count
+	return nil
+}
+
+// decoder decodes binary-encoded values from a block
+type decoder struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *decoder) long() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf[d.pos:])
+	if n <= 0 {
+		d.fail(io.ErrUnexpectedEOF)
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+func (d *decoder) bytes(n int64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > int64(len(d.buf)-d.pos) {
+		d.fail(io.ErrUnexpectedEOF)
+		return nil
+	}
+	b := d.buf[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b
+}
+
+func (d *decoder) value(s *schema, depth int) interface{} {
+	if depth > maxDepth {
+		d.fail(fmt.Errorf("values nested too deeply"))
+		return nil
+	}
+	switch s.kind {
+	case "null":
+		return nil
+	case "boolean":
+		b := d.bytes(1)
+		return len(b) == 1 && b[0] != 0
+	case "int", "long":
+		return s.integer(d.long())
+	case "float":
+		b := d.bytes(4)
+		if b == nil {
+			return nil
+		}
+		return float(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), 32)
+	case "double":
+		b := d.bytes(8)
+		if b == nil {
+			return nil
+		}
+		return float(math.Float64frombits(binary.LittleEndian.Uint64(b)), 64)
+	case "bytes", "string":
+		return s.binary(d.bytes(d.long()))
+	case "fixed":
+		return s.binary(d.bytes(int64(s.size)))
+	case "enum":
+		i := d.long()
+		if i < 0 || i >= int64(len(s.symbols)) {
+			d.fail(fmt.Errorf("enum index %d out of range", i))
+			return nil
+		}
+		return s.symbols[i]
+	case "union":
+		i := d.long()
+		if i < 0 || i >= int64(len(s.branches)) {
+			d.fail(fmt.Errorf("union index %d out of range", i))
+			return nil
+		}
+		return d.value(s.branches[i], depth+1)
+	case "record":
+		obj := make(map[string]interface{}, len(s.fields))
+		for _, f := range s.fields {
+			obj[f.name] = d.value(f.schema, depth+1)
+		}
+		return obj
+	case "array":
+		list := []interface{}{}
+		d.blocks(func() {
+			list = append(list, d.value(s.items, depth+1))
+		})
+		return list
+	case "map":
+		obj := make(map[string]interface{})
+		d.blocks(func() {
+			key := string(d.bytes(d.long()))
+			obj[key] = d.value(s.items, depth+1)
+		})
+		return obj
+	default:
+		d.fail(fmt.Errorf("unsupported type %s", s.kind))
+		return nil
+	}
+}
+
+// blocks calls item for every item of an array or map
+func (d *decoder) blocks(item func()) {
+	for d.err == nil {
+		count := d.long()
+		if count == 0 {
+			return
+		}
+		if count < 0 {
+			// Negative counts are followed by the block size
+			count = -count
+			d.long()
+		}
+		// Every item takes at least a byte, except nulls
+		if count > int64(len(d.buf)) {
+			d.fail(fmt.Errorf("invalid item count %d", count))
+			return
+		}
+		for ; count > 0 && d.err == nil; count-- {
+			item()
+		}
+	}
+}
+
+// integer converts an int or long according to its logical type
+func (s *schema) integer(v int64) interface{} {
+	switch s.logical {
+	case "date":
+		return time.Unix(v*86400, 0).UTC().Format("2006-01-02")
+	case "timestamp-millis", "local-timestamp-millis":
+		return time.UnixMilli(v).UTC().Format(time.RFC3339Nano)
+	case "timestamp-micros", "local-timestamp-micros":
+		return time.UnixMicro(v).UTC().Format(time.RFC3339Nano)
+	case "timestamp-nanos", "local-timestamp-nanos":
+		return time.Unix(0, v).UTC().Format(time.RFC3339Nano)
+	default:
+		return json.Number(strconv.FormatInt(v, 10))
+	}
+}
+
+// binary converts bytes, strings, and fixed values. Decimals are big-endian
+// two's complement integers; other non-string bytes are base64 encoded, as
+// they would be in JSON.
+func (s *schema) binary(b []byte) interface{} {
+	switch {
+	case s.logical == "decimal":
+		v := new(big.Int).SetBytes(b)
+		if len(b) > 0 && b[0]&0x80 != 0 {
+			v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+		}
+		return decimal(v, s.scale)
+	case s.kind == "string":
+		return string(b)
+	default:
+		return base64.StdEncoding.EncodeToString(b)
+	}
+}
+
+// float formats a floating point value, mapping NaN and infinities to null
+func float(v float64, bitSize int) interface{} {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return json.Number(strconv.FormatFloat(v, 'f', -1, bitSize))
+}
+
+// decimal formats an unscaled decimal value
+func decimal(unscaled *big.Int, scale int) json.Number {
+	if scale <= 0 {
+		return json.Number(unscaled.String())
+	}
+	digits := new(big.Int).Abs(unscaled).String()
+	if len(digits) <= scale {
+		digits = string(bytes.Repeat([]byte("0"), scale-len(digits)+1)) + digits
+	}
+	s := digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	if unscaled.Sign() < 0 {
+		s = "-" + s
+	}
+	return json.Number(s)
+}
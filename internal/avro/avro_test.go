@@ -0,0 +1,219 @@
+package avro
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// orderSchema is the schema of the fixture files, with an optional
+// timestamp and a union of a string and a number
+const orderSchema = `{
+	"type": "record", "name": "Order", "namespace": "trading",
+	"fields": [
+		{"name": "order_id", "type": "string"},
+		{"name": "quantity", "type": {"type": "bytes", "logicalType": "decimal", "precision": 18, "scale": 2}},
+		{"name": "price", "type": "double"},
+		{"name": "side", "type": {"type": "enum", "name": "Side", "symbols": ["buy", "sell"]}},
+		{"name": "timestamp", "type": ["null", {"type": "long", "logicalType": "timestamp-micros"}]},
+		{"name": "venue", "type": ["null", "string", "long"]},
+		{"name": "tags", "type": {"type": "array", "items": "string"}},
+		{"name": "fees", "type": {"type": "map", "values": "Side"}}
+	]
+}`
+
+// testSync is the sync marker of the fixture files
+var testSync = []byte("0123456789abcdef")
+
+func appendLong(b []byte, v int64) []byte {
+	return binary.AppendVarint(b, v)
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(appendLong(b, int64(len(s))), s...)
+}
+
+// encodeOrder encodes an order record. The timestamp is null when zero,
+// and venue is a string, a long, or nil.
+func encodeOrder(id string, quantity []byte, price float64, side int64, ts time.Time, venue interface{}, tags ...string) []byte {
+	b := appendString(nil, id)
+	b = append(appendLong(b, int64(len(quantity))), quantity...)
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(price))
+	b = appendLong(b, side)
+	if ts.IsZero() {
+		b = appendLong(b, 0)
+	} else {
+		b = appendLong(appendLong(b, 1), ts.UnixMicro())
+	}
+	switch v := venue.(type) {
+	case nil:
+		b = appendLong(b, 0)
+	case string:
+		b = appendString(appendLong(b, 1), v)
+	case int64:
+		b = appendLong(appendLong(b, 2), v)
+	}
+	if len(tags) > 0 {
+		b = appendLong(b, int64(len(tags)))
+		for _, tag := range tags {
+			b = appendString(b, tag)
+		}
+	}
+	b = appendLong(b, 0)
+	// A map block with a negative count, followed by its size
+	entry := appendLong(appendString(nil, "maker"), 1)
+	b = appendLong(appendLong(b, -1), int64(len(entry)))
+	return appendLong(append(b, entry...), 0)
+}
+
+// containerFile writes records to an object container file, in blocks of
+// the given records
+func containerFile(t *testing.T, codec string, blocks ...[][]byte) []byte {
+	t.Helper()
+	file := []byte(magic)
+	meta := map[string]string{"avro.schema": orderSchema, "avro.codec": codec}
+	file = appendLong(file, int64(len(meta)))
+	for k, v := range meta {
+		file = appendString(appendString(file, k), v)
+	}
+	file = append(appendLong(file, 0), testSync...)
+
+	for _, records := range blocks {
+		data := bytes.Join(records, nil)
+		switch codec {
+		case "deflate":
+			var buf bytes.Buffer
+			w, _ := flate.NewWriter(&buf, flate.BestCompression)
+			w.Write(data)
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			data = buf.Bytes()
+		case "snappy":
+			sum := crc32.ChecksumIEEE(data)
+			data = binary.BigEndian.AppendUint32(snappyLiterals(data), sum)
+		}
+		file = appendLong(file, int64(len(records)))
+		file = append(appendLong(file, int64(len(data))), data...)
+		file = append(file, testSync...)
+	}
+	return file
+}
+
+// snappyLiterals encodes data as a Snappy block of literals alone
+func snappyLiterals(data []byte) []byte {
+	out := binary.AppendUvarint(nil, uint64(len(data)))
+	for len(data) > 0 {
+		n := min(len(data), 60)
+		out = append(out, byte(n-1)<<2)
+		out = append(out, data[:n]...)
+		data = data[n:]
+	}
+	return out
+}
+
+// readAll reads every record of a file
+func readAll(data []byte) ([]interface{}, error) {
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var records []interface{}
+	for {
+		v, err := r.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, v)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 9, 30, 0, 123456000, time.UTC)
+	blocks := [][][]byte{
+		{
+			encodeOrder("o1", []byte{0x3a, 0xca}, 180.25, 0, ts, "XNAS", "a", "b"),
+			encodeOrder("o2", []byte{0xfb}, 1e3, 1, time.Time{}, nil),
+		},
+		{
+			encodeOrder("o3", nil, 0.5, 0, ts.Add(time.Second), int64(42)),
+		},
+	}
+	fees := map[string]interface{}{"maker": "sell"}
+	want := []interface{}{
+		map[string]interface{}{
+			"order_id": "o1", "quantity": json.Number("150.50"), "price": json.Number("180.25"), "side": "buy",
+			"timestamp": "2024-03-01T09:30:00.123456Z", "venue": "XNAS", "tags": []interface{}{"a", "b"}, "fees": fees,
+		},
+		map[string]interface{}{
+			"order_id": "o2", "quantity": json.Number("-0.05"), "price": json.Number("1000"), "side": "sell",
+			"timestamp": nil, "venue": nil, "tags": []interface{}{}, "fees": fees,
+		},
+		map[string]interface{}{
+			"order_id": "o3", "quantity": json.Number("0.00"), "price": json.Number("0.5"), "side": "buy",
+			"timestamp": "2024-03-01T09:30:01.123456Z", "venue": json.Number("42"), "tags": []interface{}{}, "fees": fees,
+		},
+	}
+
+	for _, codec := range []string{"null", "deflate", "snappy"} {
+		t.Run(codec, func(t *testing.T) {
+			records, err := readAll(containerFile(t, codec, blocks...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(records, want) {
+				t.Errorf("records = %v\nwant %v", records, want)
+			}
+		})
+	}
+}
+
+func TestReadCorruptFile(t *testing.T) {
+	record := encodeOrder("o1", []byte{1}, 1, 0, time.Time{}, nil)
+	// An order whose timestamp is in a branch the union does not have
+	badUnion := appendLong(appendString(nil, "o1"), 0)
+	badUnion = binary.LittleEndian.AppendUint64(badUnion, math.Float64bits(1))
+	badUnion = appendLong(appendLong(badUnion, 0), 2)
+	tests := []struct {
+		name string
+		file []byte
+		err  string
+	}{
+		{"union index", containerFile(t, "null", [][]byte{badUnion}), "union index 2 out of range"},
+		{"truncated record", containerFile(t, "null", [][]byte{record[:len(record)-3]}), "corrupt Avro record"},
+		{"sync marker", func() []byte {
+			file := containerFile(t, "null", [][]byte{record})
+			file[len(file)-1] ^= 1
+			return file
+		}(), "sync marker mismatch"},
+		{"checksum", func() []byte {
+			file := containerFile(t, "snappy", [][]byte{record})
+			file[len(file)-len(testSync)-1] ^= 1
+			return file
+		}(), "checksum mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readAll(tt.file)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want %s", err, tt.err)
+			}
+		})
+	}
+
+	file := containerFile(t, "zstandard")
+	if _, err := NewReader(bytes.NewReader(file)); err == nil || !strings.Contains(err.Error(), "unsupported Avro codec") {
+		t.Errorf("NewReader() error = %v, want an unsupported codec", err)
+	}
+}
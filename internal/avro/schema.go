@@ -0,0 +1,173 @@
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// schema is a parsed Avro schema
+type schema struct {
+	// kind is a primitive type name, or record, enum, array, map, fixed, or
+	// union
+	kind    string
+	logical string
+	scale   int
+	size    int
+	fields  []field
+	symbols []string
+	// items is the element type of arrays and the value type of maps
+	items    *schema
+	branches []*schema
+}
+
+type field struct {
+	name   string
+	schema *schema
+}
+
+var primitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// schemaParser resolves named types while parsing a schema
+type schemaParser struct {
+	named map[string]*schema
+}
+
+func parseSchema(data []byte) (*schema, error) {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid Avro schema: %w", err)
+	}
+	p := &schemaParser{named: make(map[string]*schema)}
+	s, err := p.parse(raw, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid Avro schema: %w", err)
+	}
+	return s, nil
+}
+
+func (p *schemaParser) parse(raw interface{}, namespace string) (*schema, error) {
+	switch v := raw.(type) {
+	case string:
+		if primitives[v] {
+			return &schema{kind: v}, nil
+		}
+		if s, ok := p.named[fullName(v, namespace)]; ok {
+			return s, nil
+		}
+		if s, ok := p.named[v]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unknown type %q", v)
+
+	case []interface{}:
+		s := &schema{kind: "union"}
+		for _, branch := range v {
+			b, err := p.parse(branch, namespace)
+			if err != nil {
+				return nil, err
+			}
+			s.branches = append(s.branches, b)
+		}
+		return s, nil
+
+	case map[string]interface{}:
+		return p.parseComplex(v, namespace)
+
+	default:
+		return nil, fmt.Errorf("unexpected schema %v", raw)
+	}
+}
+
+func (p *schemaParser) parseComplex(obj map[string]interface{}, namespace string) (*schema, error) {
+	kind, _ := obj["type"].(string)
+	logical, _ := obj["logicalType"].(string)
+
+	// Named types may be referenced by their own fields, so they are
+	// registered before their contents are parsed
+	if kind == "record" || kind == "error" || kind == "enum" || kind == "fixed" {
+		name, _ := obj["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("%s without a name", kind)
+		}
+		if ns, ok := obj["namespace"].(string); ok {
+			namespace = ns
+		}
+		full := fullName(name, namespace)
+		if i := strings.LastIndex(full, "."); i >= 0 {
+			namespace = full[:i]
+		}
+
+		s := &schema{kind: kind, logical: logical}
+		p.named[full] = s
+		switch kind {
+		case "record", "error":
+			s.kind = "record"
+			fields, _ := obj["fields"].([]interface{})
+			for _, f := range fields {
+				fobj, _ := f.(map[string]interface{})
+				fname, _ := fobj["name"].(string)
+				fs, err := p.parse(fobj["type"], namespace)
+				if err != nil {
+					return nil, fmt.Errorf("field %s: %w", fname, err)
+				}
+				s.fields = append(s.fields, field{name: fname, schema: fs})
+			}
+		case "enum":
+			symbols, _ := obj["symbols"].([]interface{})
+			for _, sym := range symbols {
+				str, _ := sym.(string)
+				s.symbols = append(s.symbols, str)
+			}
+		case "fixed":
+			size, _ := obj["size"].(float64)
+			if size < 0 {
+				return nil, fmt.Errorf("fixed %s has a negative size", name)
+			}
+			s.size = int(size)
+			scale, _ := obj["scale"].(float64)
+			s.scale = int(scale)
+		}
+		return s, nil
+	}
+
+	switch kind {
+	case "array":
+		items, err := p.parse(obj["items"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		return &schema{kind: "array", items: items}, nil
+	case "map":
+		values, err := p.parse(obj["values"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		return &schema{kind: "map", items: values}, nil
+	}
+
+	// A primitive, possibly annotated with a logical type
+	s, err := p.parse(obj["type"], namespace)
+	if err != nil {
+		return nil, err
+	}
+	if logical == "" {
+		return s, nil
+	}
+	annotated := *s
+	annotated.logical = logical
+	scale, _ := obj["scale"].(float64)
+	annotated.scale = int(scale)
+	return &annotated, nil
+}
+
+// fullName qualifies a type name with a namespace unless it already is
+func fullName(name, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
@@ -0,0 +1,101 @@
+// Package aws signs requests to AWS services with Signature Version 4.
+package aws
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Credentials are AWS access keys
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// LoadCredentials returns credentials from the environment
+// (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN) or, failing
+// that, from the shared credentials file for AWS_PROFILE
+func LoadCredentials() (Credentials, error) {
+	creds := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID != "" && creds.SecretAccessKey != "" {
+		return creds, nil
+	}
+
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return Credentials{}, fmt.Errorf("no AWS credentials found")
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	return loadSharedCredentials(path, profile)
+}
+
+// loadSharedCredentials reads a profile from an INI credentials file
+func loadSharedCredentials(path, profile string) (Credentials, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return Credentials{}, fmt.Errorf("no AWS credentials found in the environment or %s", path)
+	}
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to read AWS credentials: %w", err)
+	}
+	defer file.Close()
+
+	var creds Credentials
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			creds.SessionToken = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Credentials{}, fmt.Errorf("failed to read AWS credentials: %w", err)
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return Credentials{}, fmt.Errorf("AWS profile %q not found in %s", profile, path)
+	}
+	return creds, nil
+}
+
+// Region returns the region from AWS_REGION or AWS_DEFAULT_REGION
+func Region() string {
+	if r := os.Getenv("AWS_REGION"); r != "" {
+		return r
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
@@ -0,0 +1,207 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// refreshWindow is how long before they expire temporary credentials
+	// are fetched again
+	refreshWindow = 5 * time.Minute
+	// containerEndpoint serves ECS task role credentials at
+	// AWS_CONTAINER_CREDENTIALS_RELATIVE_URI
+	containerEndpoint = "http://169.254.170.2"
+	// instanceEndpoint is the EC2 instance metadata service
+	instanceEndpoint = "http://169.254.169.254"
+	// metadataTimeout bounds each metadata request, so that hosts outside
+	// AWS fail fast
+	metadataTimeout = 2 * time.Second
+)
+
+// Provider returns credentials from the standard chain: the environment, the
+// shared credentials file, the ECS task role, and the EC2 instance role, in
+// that order. Temporary role credentials are cached and fetched again
+// shortly before they expire. It is safe for concurrent use.
+type Provider struct {
+	client *http.Client
+
+	mu    sync.Mutex
+	creds *Credentials
+	// expires is when the cached credentials expire, or zero if they do
+	// not
+	expires time.Time
+}
+
+// NewProvider creates a provider
+func NewProvider() *Provider {
+	return &Provider{client: &http.Client{Timeout: metadataTimeout}}
+}
+
+// Retrieve returns current credentials
+func (p *Provider) Retrieve(ctx context.Context) (Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.creds != nil && (p.expires.IsZero() || time.Until(p.expires) > refreshWindow) {
+		return *p.creds, nil
+	}
+
+	creds, expires, err := p.load(ctx)
+	if err != nil {
+		// Credentials that have not expired yet are still usable
+		if p.creds != nil && time.Now().Before(p.expires) {
+			return *p.creds, nil
+		}
+		return Credentials{}, err
+	}
+	p.creds, p.expires = &creds, expires
+	return creds, nil
+}
+
+// load goes through the credential chain
+func (p *Provider) load(ctx context.Context) (Credentials, time.Time, error) {
+	creds, err := LoadCredentials()
+	if err == nil {
+		return creds, time.Time{}, nil
+	}
+
+	if uri, token := containerCredentialsURI(); uri != "" {
+		header := make(http.Header)
+		if token != "" {
+			header.Set("Authorization", token)
+		}
+		return p.loadRole(ctx, uri, header)
+	}
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return Credentials{}, time.Time{}, err
+	}
+	creds, expires, imdsErr := p.loadInstanceRole(ctx)
+	if imdsErr != nil {
+		return Credentials{}, time.Time{}, fmt.Errorf("%v, and no EC2 instance role: %w", err, imdsErr)
+	}
+	return creds, expires, nil
+}
+
+// containerCredentialsURI returns the ECS credentials endpoint and its
+// authorization token, if running in a task with a role
+func containerCredentialsURI() (string, string) {
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if rel := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); rel != "" {
+		return containerEndpoint + rel, token
+	}
+	return os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"), token
+}
+
+// loadInstanceRole fetches the credentials of the EC2 instance role with
+// IMDSv2
+func (p *Provider) loadInstanceRole(ctx context.Context) (Credentials, time.Time, error) {
+	endpoint := strings.TrimRight(os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT"), "/")
+	if endpoint == "" {
+		endpoint = instanceEndpoint
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return Credentials{}, time.Time{}, err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+	token, err := p.get(req)
+	if err != nil {
+		return Credentials{}, time.Time{}, fmt.Errorf("failed to get instance metadata token: %w", err)
+	}
+
+	rolesURL := endpoint + "/latest/meta-data/iam/security-credentials/"
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, rolesURL, nil)
+	if err != nil {
+		return Credentials{}, time.Time{}, err
+	}
+	header := http.Header{"X-Aws-Ec2-Metadata-Token": {string(token)}}
+	req.Header = header
+	roles, err := p.get(req)
+	if err != nil {
+		return Credentials{}, time.Time{}, fmt.Errorf("failed to get instance role: %w", err)
+	}
+	role, _, _ := strings.Cut(strings.TrimSpace(string(roles)), "\n")
+	if role == "" {
+		return Credentials{}, time.Time{}, fmt.Errorf("instance has no IAM role")
+	}
+	return p.loadRole(ctx, rolesURL+role, header)
+}
+
+// loadRole fetches temporary role credentials from a metadata endpoint,
+// sending header to authorize the request
+func (p *Provider) loadRole(ctx context.Context, uri string, header http.Header) (Credentials, time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return Credentials{}, time.Time{}, err
+	}
+	req.Header = header
+	body, err := p.get(req)
+	if err != nil {
+		return Credentials{}, time.Time{}, fmt.Errorf("failed to get role credentials: %w", err)
+	}
+
+	var role struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.Unmarshal(body, &role); err != nil {
+		return Credentials{}, time.Time{}, fmt.Errorf("invalid role credentials: %w", err)
+	}
+	if role.AccessKeyID == "" || role.SecretAccessKey == "" {
+		return Credentials{}, time.Time{}, fmt.Errorf("invalid role credentials: missing access key")
+	}
+	return Credentials{
+		AccessKeyID:     role.AccessKeyID,
+		SecretAccessKey: role.SecretAccessKey,
+		SessionToken:    role.Token,
+	}, role.Expiration, nil
+}
+
+// get sends a metadata request and returns the response body
+func (p *Provider) get(req *http.Request) ([]byte, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+// RequestSigner signs requests with credentials from a Provider. Sign is
+// safe to call on a nil receiver, which leaves requests unsigned.
+type RequestSigner struct {
+	Provider *Provider
+	Region   string
+	Service  string
+}
+
+// Sign adds SigV4 authentication headers to req, as Signer.Sign does
+func (s *RequestSigner) Sign(ctx context.Context, req *http.Request, body []byte) error {
+	if s == nil {
+		return nil
+	}
+	creds, err := s.Provider.Retrieve(ctx)
+	if err != nil {
+		return err
+	}
+	signer := Signer{Credentials: creds, Region: s.Region, Service: s.Service}
+	signer.Sign(req, body, time.Now())
+	return nil
+}
@@ -0,0 +1,160 @@
+package aws
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm  = "AWS4-HMAC-SHA256"
+	timeFormat = "20060102T150405Z"
+	dateFormat = "20060102"
+)
+
+// Signer signs requests for one service in one region
+type Signer struct {
+	Credentials Credentials
+	Region      string
+	Service     string
+}
+
+// Sign adds SigV4 authentication headers to req. body must be the request
+// body, which is not read from req.
+func (s *Signer) Sign(req *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(timeFormat)
+	date := now.Format(dateFormat)
+	payloadHash := hashHex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.Credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.Credentials.SessionToken)
+	}
+	if s.Service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	headers, signed := canonicalHeaders(req)
+	canonical := strings.Join([]string{
+		req.Method,
+		s.canonicalURI(req.URL),
+		canonicalQuery(req.URL),
+		headers,
+		signed,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, s.Region, s.Service, "aws4_request"}, "/")
+	toSign := strings.Join([]string{algorithm, amzDate, scope, hashHex([]byte(canonical))}, "\n")
+
+	key := signingKey(s.Credentials.SecretAccessKey, date, s.Region, s.Service)
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, s.Credentials.AccessKeyID, scope, signed, signature))
+}
+
+// signingKey derives the key signing requests to a service on a date
+func signingKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// canonicalURI encodes each path segment, twice for services other than S3
+func (s *Signer) canonicalURI(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if unescaped, err := url.PathUnescape(seg); err == nil {
+			seg = unescaped
+		}
+		seg = uriEncode(seg)
+		if s.Service != "s3" {
+			seg = uriEncode(seg)
+		}
+		segments[i] = seg
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery sorts and encodes the query parameters
+func canonicalQuery(u *url.URL) string {
+	var pairs []string
+	for key, values := range u.Query() {
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(key)+"="+uriEncode(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// canonicalHeaders returns the canonical header block and the signed header
+// list. The host, content type, and x-amz-* headers are signed.
+func canonicalHeaders(req *http.Request) (string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values := map[string]string{"host": host}
+	for name, vals := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			trimmed := make([]string, len(vals))
+			for i, v := range vals {
+				trimmed[i] = strings.Join(strings.Fields(v), " ")
+			}
+			values[lower] = strings.Join(trimmed, ",")
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + ":" + values[name] + "\n")
+	}
+	return b.String(), strings.Join(names, ";")
+}
+
+// uriEncode percent-encodes everything except unreserved characters
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,315 @@
+// Package capture records outbound requests and their responses in HAR format.
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/redact"
+	"github.com/fauzanelka/99tech-order-processor/internal/version"
+)
+
+// Redacted replaces the values of redacted headers
+const Redacted = "REDACTED"
+
+// HAR is the top-level HAR 1.2 document
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+// Log holds the capture metadata and recorded entries
+type Log struct {
+	Version string  `json:"version"`
+	Creator Creator `json:"creator"`
+	Entries []Entry `json:"entries"`
+}
+
+// Creator identifies the application that produced the capture
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Entry is a single request/response exchange
+type Entry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	Time            float64   `json:"time"`
+	Request         Request   `json:"request"`
+	Response        Response  `json:"response"`
+	Cache           struct{}  `json:"cache"`
+	Timings         Timings   `json:"timings"`
+	Comment         string    `json:"comment,omitempty"`
+}
+
+// Request describes the outbound request
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	Cookies     []NameValue `json:"cookies"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+	PostData    *PostData   `json:"postData,omitempty"`
+}
+
+// PostData holds the request body. Truncated and Redacted mark a body that
+// was cut at the size limit or had sensitive fields masked, which is not
+// the body that was sent.
+type PostData struct {
+	MimeType  string `json:"mimeType"`
+	Text      string `json:"text"`
+	Comment   string `json:"comment,omitempty"`
+	Truncated bool   `json:"_truncated,omitempty"`
+	Redacted  bool   `json:"_redacted,omitempty"`
+}
+
+// Response describes the response received for a request
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []NameValue `json:"headers"`
+	Cookies     []NameValue `json:"cookies"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+// Content holds the response body
+type Content struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// Timings breaks down the time spent on a request
+type Timings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// NameValue is a header, cookie, or query parameter
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Recorder writes entries to a HAR file as they are recorded, so a long
+// run is not held in memory, and ends the document on Close. All methods
+// are safe to call on a nil receiver, which disables capturing.
+type Recorder struct {
+	maxBody       int
+	redactHeaders map[string]bool
+	redactFields  *redact.Redactor
+
+	mu      sync.Mutex
+	file    *os.File
+	entries int
+	err     error
+}
+
+// NewRecorder creates the HAR file at path and a recorder writing to it.
+// Bodies longer than maxBody bytes are truncated; a negative maxBody keeps
+// bodies whole and zero omits them. Values of the named headers are
+// redacted, as are values of the fields of redactFields in URLs, query
+// strings, and bodies.
+func NewRecorder(path string, maxBody int, redactHeaders []string, redactFields *redact.Redactor) (*Recorder, error) {
+	headers := make(map[string]bool, len(redactHeaders))
+	for _, h := range redactHeaders {
+		if h = strings.TrimSpace(h); h != "" {
+			headers[http.CanonicalHeaderKey(h)] = true
+		}
+	}
+
+	// The document is written around the entries, which follow as they are
+	// recorded
+	creator, err := json.Marshal(Creator{Name: "order-processor", Version: version.String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode capture: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create capture file: %w", err)
+	}
+	if _, err := fmt.Fprintf(file, "{\n  \"log\": {\n    \"version\": \"1.2\",\n    \"creator\": %s,\n    \"entries\": [", creator); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write capture file: %w", err)
+	}
+	return &Recorder{maxBody: maxBody, redactHeaders: headers, redactFields: redactFields, file: file}, nil
+}
+
+// Record adds an exchange to the capture. resp is nil when the request failed
+// before a response was received, in which case err describes the failure.
+func (r *Recorder) Record(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte, start time.Time, elapsed time.Duration, err error) {
+	if r == nil {
+		return
+	}
+
+	ms := float64(elapsed.Microseconds()) / 1000
+	entry := Entry{
+		StartedDateTime: start,
+		Time:            ms,
+		Request: Request{
+			Method:      req.Method,
+			URL:         r.redactFields.String(req.URL.String()),
+			HTTPVersion: "HTTP/1.1",
+			Headers:     r.headers(req.Header),
+			QueryString: r.queryString(req),
+			Cookies:     []NameValue{},
+			HeadersSize: -1,
+			BodySize:    len(reqBody),
+		},
+		Timings: Timings{Send: 0, Wait: ms, Receive: 0},
+	}
+	if len(reqBody) > 0 {
+		b := r.body(reqBody)
+		entry.Request.PostData = &PostData{
+			MimeType:  req.Header.Get("Content-Type"),
+			Text:      b.text,
+			Comment:   b.comment,
+			Truncated: b.truncated,
+			Redacted:  b.redacted,
+		}
+	}
+
+	if resp != nil {
+		b := r.body(respBody)
+		entry.Response = Response{
+			Status:      resp.StatusCode,
+			StatusText:  http.StatusText(resp.StatusCode),
+			HTTPVersion: resp.Proto,
+			Headers:     r.headers(resp.Header),
+			Cookies:     []NameValue{},
+			Content: Content{
+				Size:     len(respBody),
+				MimeType: resp.Header.Get("Content-Type"),
+				Text:     b.text,
+				Comment:  b.comment,
+			},
+			HeadersSize: -1,
+			BodySize:    len(respBody),
+		}
+	} else {
+		entry.Response = Response{Headers: []NameValue{}, Cookies: []NameValue{}, HeadersSize: -1, BodySize: -1}
+	}
+	if err != nil {
+		entry.Comment = r.redactFields.String(err.Error())
+	}
+
+	data, jerr := json.MarshalIndent(entry, "      ", "  ")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil || r.err != nil {
+		return
+	}
+	if jerr != nil {
+		r.err = fmt.Errorf("failed to encode capture: %w", jerr)
+		return
+	}
+	sep := ",\n      "
+	if r.entries == 0 {
+		sep = "\n      "
+	}
+	// The first error is kept for Close, which reports it
+	if _, err := r.file.Write(append([]byte(sep), data...)); err != nil {
+		r.err = fmt.Errorf("failed to write capture file: %w", err)
+		return
+	}
+	r.entries++
+}
+
+// Close ends the HAR document and closes the file, reporting any error
+// writing entries. Only the first call has any effect.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	file := r.file
+	r.file = nil
+
+	end := "\n    ]\n  }\n}\n"
+	if r.entries == 0 {
+		end = "]\n  }\n}\n"
+	}
+	if _, err := file.WriteString(end); err != nil && r.err == nil {
+		r.err = fmt.Errorf("failed to write capture file: %w", err)
+	}
+	if err := file.Close(); err != nil && r.err == nil {
+		r.err = fmt.Errorf("failed to write capture file: %w", err)
+	}
+	return r.err
+}
+
+// headers converts headers to HAR form, redacting configured values
+func (r *Recorder) headers(h http.Header) []NameValue {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := []NameValue{}
+	for _, name := range names {
+		for _, v := range h[name] {
+			if r.redactHeaders[name] {
+				v = Redacted
+			}
+			out = append(out, NameValue{Name: name, Value: v})
+		}
+	}
+	return out
+}
+
+// storedBody is a body as stored in the capture
+type storedBody struct {
+	text string
+	// comment describes any truncation
+	comment   string
+	truncated bool
+	redacted  bool
+}
+
+// body masks sensitive fields and applies the body size limit
+func (r *Recorder) body(b []byte) storedBody {
+	text := r.redactFields.String(string(b))
+	stored := storedBody{text: text, redacted: text != string(b)}
+	switch {
+	case r.maxBody < 0 || len(text) <= r.maxBody:
+	case r.maxBody == 0:
+		stored.text, stored.comment, stored.truncated = "", "body omitted", true
+	default:
+		stored.text, stored.comment, stored.truncated = text[:r.maxBody], fmt.Sprintf("body truncated from %d bytes", len(b)), true
+	}
+	return stored
+}
+
+// queryString extracts the query parameters of a request
+func (r *Recorder) queryString(req *http.Request) []NameValue {
+	out := []NameValue{}
+	for name, values := range req.URL.Query() {
+		for _, v := range values {
+			if r.redactFields.Sensitive(name) {
+				v = redact.Mask
+			}
+			out = append(out, NameValue{Name: name, Value: v})
+		}
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+package capture
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/redact"
+)
+
+func TestRecorderStreamsEntries(t *testing.T) {
+	for _, n := range []int{0, 1, 3} {
+		path := filepath.Join(t.TempDir(), "capture.har")
+		r, err := NewRecorder(path, -1, []string{"Authorization"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			req := httptest.NewRequest(http.MethodGet, "http://api.example.com/orders/a1", nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			resp := &http.Response{StatusCode: http.StatusOK, Proto: "HTTP/1.1", Header: http.Header{}}
+			r.Record(req, nil, resp, []byte(`{"ok":true}`), time.Now(), time.Millisecond, nil)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+		// Closing again, as the exit handler and deferred call both do, is
+		// harmless
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var har HAR
+		if err := json.Unmarshal(data, &har); err != nil {
+			t.Fatalf("%d entries: invalid HAR: %v\n%s", n, err, data)
+		}
+		if len(har.Log.Entries) != n {
+			t.Fatalf("entries = %d, want %d", len(har.Log.Entries), n)
+		}
+		if har.Log.Version != "1.2" || har.Log.Creator.Name != "order-processor" {
+			t.Errorf("log = %+v", har.Log)
+		}
+		for _, e := range har.Log.Entries {
+			if h := e.Request.Headers[0]; h.Name != "Authorization" || h.Value != Redacted {
+				t.Errorf("header = %+v, want redacted", h)
+			}
+		}
+	}
+}
+
+func TestRecorderMarksAlteredRequestBodies(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxBody   int
+		body      string
+		text      string
+		comment   string
+		truncated bool
+		redacted  bool
+	}{
+		{"whole", -1, `{"id":"a1"}`, `{"id":"a1"}`, "", false, false},
+		{"truncated", 5, `{"id":"a1"}`, `{"id"`, "body truncated from 11 bytes", true, false},
+		{"omitted", 0, `{"id":"a1"}`, "", "body omitted", true, false},
+		{"redacted", -1, `{"account":"ACCT-1"}`, `{"account":"REDACTED"}`, "", false, true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "capture.har")
+		r, err := NewRecorder(path, tt.maxBody, nil, redact.New([]string{"account"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "http://api.example.com/graphql", strings.NewReader(tt.body))
+		resp := &http.Response{StatusCode: http.StatusOK, Proto: "HTTP/1.1", Header: http.Header{}}
+		r.Record(req, []byte(tt.body), resp, []byte(`{"ok":true}`), time.Now(), time.Millisecond, nil)
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var har HAR
+		if err := json.Unmarshal(data, &har); err != nil {
+			t.Fatalf("%s: invalid HAR: %v", tt.name, err)
+		}
+		got := har.Log.Entries[0].Request.PostData
+		want := PostData{Text: tt.text, Comment: tt.comment, Truncated: tt.truncated, Redacted: tt.redacted}
+		if got == nil || *got != want {
+			t.Errorf("%s: postData = %+v, want %+v", tt.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Package checkpoint persists run progress so an interrupted run can resume.
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/atomicfile"
+	"github.com/fauzanelka/99tech-order-processor/internal/lifecycle"
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// Version is the current checkpoint format version. Checkpoints written with
+// a different version are rejected rather than guessed at.
+const Version = 1
+
+// State is the persisted progress of a run
+type State struct {
+	Version int `json:"version"`
+	// Input is the input file the checkpoint belongs to
+	Input string `json:"input"`
+	// Records is the number of input records that have been fully handled
+	Records int `json:"records"`
+	// RetryQueue holds orders that failed and are awaiting retry
+	RetryQueue []models.Order `json:"retry_queue,omitempty"`
+	// Matched is the number of those records that matched the filters,
+	// which runs bounded to a slice of the matching orders count from
+	Matched int `json:"matched,omitempty"`
+	// States counts the orders handled so far by lifecycle state. Only the
+	// final states carry over to a resumed run; orders awaiting retry are
+	// in RetryQueue.
+	States map[lifecycle.State]int `json:"states,omitempty"`
+	// StartedAt is when the run started, which a resumed run keeps so
+	// output paths expanded from it stay the same
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Load reads the checkpoint at path. It returns nil without an error when no
+// checkpoint exists.
+func Load(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("checkpoint %s is corrupt: %w", path, err)
+	}
+	if st.Version != Version {
+		return nil, fmt.Errorf("checkpoint %s has unsupported version %d (expected %d)", path, st.Version, Version)
+	}
+	return &st, nil
+}
+
+// Save atomically replaces the checkpoint at path with st
+func Save(path string, st State) error {
+	st.Version = Version
+	st.UpdatedAt = time.Now().UTC()
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	if err := atomicfile.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes the checkpoint at path, if any
+func Remove(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove checkpoint: %w", err)
+	}
+	return nil
+}
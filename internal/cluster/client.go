@@ -0,0 +1,139 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/httpclient"
+)
+
+// ErrDone is returned by Lease once the coordinator's run is complete
+var ErrDone = errors.New("run is complete")
+
+// ErrNotLeased is returned by Complete when the task's lease ran out and it
+// was handed to another worker
+var ErrNotLeased = errors.New("task is no longer leased to this worker")
+
+// ErrUnauthorized is returned when the coordinator refuses the token
+var ErrUnauthorized = errors.New("coordinator refused the token")
+
+// Client is a worker's connection to a coordinator
+type Client struct {
+	url    string
+	token  string
+	worker string
+	client *http.Client
+}
+
+// NewClient creates a client for the coordinator at rawURL, identifying
+// itself as worker. A token is only sent in clear text to a coordinator on
+// the same host.
+func NewClient(rawURL, token, worker string, insecure bool) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid coordinator URL: %q", rawURL)
+	}
+	if token != "" && u.Scheme == "http" && !Loopback(u.Hostname()) {
+		return nil, fmt.Errorf("refusing to send the coordinator token in clear text to %s; use an https:// coordinator URL", u.Host)
+	}
+	return &Client{
+		url:    strings.TrimRight(rawURL, "/"),
+		token:  token,
+		worker: worker,
+		client: httpclient.New(httpclient.Options{Timeout: leaseWait + 30*time.Second, Insecure: insecure}),
+	}, nil
+}
+
+// Loopback reports whether host, a name or IP address, is this host's
+// loopback interface
+func Loopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Worker returns the name the client identifies itself with
+func (c *Client) Worker() string {
+	return c.worker
+}
+
+// Lease waits briefly for up to max tasks. It returns no tasks if none
+// were available, and ErrDone once the run is complete.
+func (c *Client) Lease(ctx context.Context, max int) ([]Task, error) {
+	resp, err := c.post(ctx, "/lease", leaseRequest{Worker: c.worker, Max: max})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var lr leaseResponse
+		if err := json.NewDecoder(resp.Body).Decode(&lr); err != nil {
+			return nil, fmt.Errorf("invalid lease response: %w", err)
+		}
+		return lr.Tasks, nil
+	case http.StatusNoContent:
+		return nil, nil
+	case http.StatusGone:
+		return nil, ErrDone
+	case http.StatusUnauthorized:
+		return nil, ErrUnauthorized
+	default:
+		return nil, statusError(resp)
+	}
+}
+
+// Complete returns the result of a task to the coordinator
+func (c *Client) Complete(ctx context.Context, res Result) error {
+	res.Worker = c.worker
+	resp, err := c.post(ctx, "/complete", res)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusConflict:
+		return ErrNotLeased
+	default:
+		return statusError(resp)
+	}
+}
+
+func (c *Client) post(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach coordinator: %w", err)
+	}
+	return resp, nil
+}
+
+// statusError describes an unexpected coordinator response
+func statusError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("coordinator returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+}
@@ -0,0 +1,25 @@
+package cluster
+
+import "testing"
+
+func TestNewClientRefusesCleartextToken(t *testing.T) {
+	tests := []struct {
+		url   string
+		token string
+		ok    bool
+	}{
+		{"http://coordinator:7070", "", true},
+		{"http://coordinator:7070", "secret", false},
+		{"http://10.0.0.5:7070", "secret", false},
+		{"https://coordinator:7070", "secret", true},
+		{"http://localhost:7070", "secret", true},
+		{"http://127.0.0.1:7070", "secret", true},
+		{"http://[::1]:7070", "secret", true},
+	}
+	for _, tt := range tests {
+		_, err := NewClient(tt.url, tt.token, "worker", false)
+		if (err == nil) != tt.ok {
+			t.Errorf("NewClient(%q, %q) = %v, want ok %v", tt.url, tt.token, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+// Package cluster distributes the orders of one run between worker
+// processes. A coordinator reads the input and leases orders to workers over
+// HTTP; workers make the API requests and send the responses back, so
+// results and failures are still written in one place.
+//
+// The protocol is JSON over HTTP rather than gRPC, which would add a code
+// generator and a large dependency tree for two calls. Leases shard the
+// input dynamically, so a slow or lost worker holds back only the orders it
+// leased rather than a fixed range of the input.
+package cluster
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+const (
+	// leaseWait is how long a lease request waits for tasks before
+	// returning none
+	leaseWait = 10 * time.Second
+	// DoneGrace is how long a finished coordinator should keep serving, so
+	// that idle workers learn the run is complete before it goes away
+	DoneGrace = 2 * time.Second
+)
+
+// Task is an order leased to a worker
+type Task struct {
+	ID    uint64       `json:"id"`
+	Order models.Order `json:"order"`
+	// RequestID is the ID the order's requests are sent with
+	RequestID string `json:"request_id,omitempty"`
+	// Attempt counts the times the order has been processed before
+	Attempt int `json:"attempt"`
+}
+
+// Result is a worker's outcome for a task
+type Result struct {
+	ID     uint64 `json:"id"`
+	Worker string `json:"worker"`
+	// StatusCode and Body are the API response, if one was received
+	StatusCode int    `json:"status_code,omitempty"`
+	Body       []byte `json:"body,omitempty"`
+	// Error is set when the order failed
+	Error string `json:"error,omitempty"`
+	// Released hands back a task the worker did not process, such as when
+	// it is shutting down
+	Released bool `json:"released,omitempty"`
+}
+
+// leaseRequest is the body of a lease request
+type leaseRequest struct {
+	Worker string `json:"worker"`
+	Max    int    `json:"max"`
+}
+
+// leaseResponse is the body of a lease response
+type leaseResponse struct {
+	Tasks []Task `json:"tasks"`
+}
+
+// Options configures a Coordinator
+type Options struct {
+	// Token, if set, must be sent by workers as a bearer token
+	Token string
+	// LeaseTimeout is how long a worker has to return a task before it is
+	// leased to another worker
+	LeaseTimeout time.Duration
+	// MaxOutstanding bounds the tasks submitted but not yet settled, so a
+	// large input is not read into memory ahead of the workers
+	MaxOutstanding int
+}
+
+// Settle handles a worker's result for a task and reports whether the task
+// should be retried
+type Settle func(task Task, result Result) (retry bool)
+
+// lease is a task leased to a worker
+type lease struct {
+	task     Task
+	worker   string
+	deadline time.Time
+}
+
+// Coordinator hands out submitted orders to workers and settles their
+// results. It is an http.Handler serving the worker protocol.
+type Coordinator struct {
+	opts   Options
+	settle Settle
+	// settleMu serializes calls to settle
+	settleMu sync.Mutex
+
+	mu          sync.Mutex
+	nextID      uint64
+	queue       []Task
+	leased      map[uint64]*lease
+	outstanding int
+	closed      bool
+	// changed is closed and replaced whenever the queue or the number of
+	// outstanding tasks changes
+	changed chan struct{}
+	done    chan struct{}
+	mux     *http.ServeMux
+}
+
+// NewCoordinator creates a coordinator that passes results to settle
+func NewCoordinator(opts Options, settle Settle) *Coordinator {
+	if opts.MaxOutstanding < 1 {
+		opts.MaxOutstanding = 1
+	}
+	c := &Coordinator{
+		opts:    opts,
+		settle:  settle,
+		leased:  make(map[uint64]*lease),
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+		mux:     http.NewServeMux(),
+	}
+	c.mux.HandleFunc("/lease", c.handleLease)
+	c.mux.HandleFunc("/complete", c.handleComplete)
+	return c
+}
+
+func (c *Coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c.opts.Token != "" {
+		want := "Bearer " + c.opts.Token
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c.mux.ServeHTTP(w, r)
+}
+
+// Submit queues an order for the workers, to be requested with requestID,
+// waiting while too many tasks are outstanding
+func (c *Coordinator) Submit(order models.Order, requestID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.outstanding >= c.opts.MaxOutstanding {
+		changed := c.changed
+		c.mu.Unlock()
+		<-changed
+		c.mu.Lock()
+	}
+	c.nextID++
+	c.queue = append(c.queue, Task{ID: c.nextID, Order: order, RequestID: requestID})
+	c.outstanding++
+	c.notify()
+}
+
+// Close marks the end of the submitted orders. Done is closed once all of
+// them have been settled.
+func (c *Coordinator) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	c.notify()
+}
+
+// Done returns a channel that is closed once the coordinator is closed and
+// every task has been settled
+func (c *Coordinator) Done() <-chan struct{} {
+	return c.done
+}
+
+// Leased returns the number of tasks currently leased to workers
+func (c *Coordinator) Leased() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.leased)
+}
+
+// notify wakes everything waiting for a change. It must be called with mu
+// held.
+func (c *Coordinator) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+	if c.closed && c.outstanding == 0 {
+		select {
+		case <-c.done:
+		default:
+			close(c.done)
+		}
+	}
+}
+
+// expire returns tasks whose lease has run out to the queue. It must be
+// called with mu held.
+func (c *Coordinator) expire(now time.Time) {
+	for id, l := range c.leased {
+		if now.After(l.deadline) {
+			delete(c.leased, id)
+			c.queue = append(c.queue, l.task)
+		}
+	}
+}
+
+// handleLease leases up to the requested number of tasks, waiting briefly
+// for some to be queued. It responds 204 if none were, and 410 once the run
+// is complete.
+func (c *Coordinator) handleLease(w http.ResponseWriter, r *http.Request) {
+	var req leaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Max < 1 {
+		http.Error(w, "invalid lease request", http.StatusBadRequest)
+		return
+	}
+
+	timer := time.NewTimer(leaseWait)
+	defer timer.Stop()
+	for {
+		c.mu.Lock()
+		now := time.Now()
+		c.expire(now)
+		if n := min(req.Max, len(c.queue)); n > 0 {
+			tasks := append([]Task(nil), c.queue[:n]...)
+			c.queue = c.queue[n:]
+			for _, t := range tasks {
+				c.leased[t.ID] = &lease{task: t, worker: req.Worker, deadline: now.Add(c.opts.LeaseTimeout)}
+			}
+			c.mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(leaseResponse{Tasks: tasks})
+			return
+		}
+		if c.closed && c.outstanding == 0 {
+			c.mu.Unlock()
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		changed := c.changed
+		c.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handleComplete settles the result of a leased task. Results for tasks
+// that are not leased to the worker returning them, because the lease ran
+// out and the task went to another worker, are refused with 409.
+func (c *Coordinator) handleComplete(w http.ResponseWriter, r *http.Request) {
+	var res Result
+	if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+		http.Error(w, "invalid result", http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	l, ok := c.leased[res.ID]
+	ok = ok && l.worker == res.Worker
+	if ok {
+		delete(c.leased, res.ID)
+	}
+	c.mu.Unlock()
+	if !ok {
+		http.Error(w, "task is not leased to this worker", http.StatusConflict)
+		return
+	}
+
+	task := l.task
+	retry := res.Released
+	if !res.Released {
+		c.settleMu.Lock()
+		retry = c.settle(task, res)
+		c.settleMu.Unlock()
+		task.Attempt++
+	}
+
+	c.mu.Lock()
+	if retry {
+		c.queue = append(c.queue, task)
+	} else {
+		c.outstanding--
+	}
+	c.notify()
+	c.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,59 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+func TestCompleteRequiresLeaseHolder(t *testing.T) {
+	var settled []Result
+	c := NewCoordinator(Options{LeaseTimeout: time.Nanosecond}, func(task Task, res Result) bool {
+		settled = append(settled, res)
+		return false
+	})
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+	a, _ := NewClient(srv.URL, "", "a", false)
+	b, _ := NewClient(srv.URL, "", "b", false)
+	ctx := context.Background()
+
+	c.Submit(models.Order{OrderID: "o1"}, "")
+	c.Close()
+	tasks, err := a.Lease(ctx, 1)
+	if err != nil || len(tasks) != 1 {
+		t.Fatalf("Lease() = %v, %v, want a task", tasks, err)
+	}
+	// The lease runs out and the task goes to b
+	time.Sleep(time.Millisecond)
+	if tasks, err = b.Lease(ctx, 1); err != nil || len(tasks) != 1 {
+		t.Fatalf("Lease() = %v, %v, want the expired task", tasks, err)
+	}
+
+	// a can neither settle nor release b's task
+	if err := a.Complete(ctx, Result{ID: tasks[0].ID, StatusCode: 200}); !errors.Is(err, ErrNotLeased) {
+		t.Errorf("Complete() by a = %v, want ErrNotLeased", err)
+	}
+	if err := a.Complete(ctx, Result{ID: tasks[0].ID, Released: true}); !errors.Is(err, ErrNotLeased) {
+		t.Errorf("release by a = %v, want ErrNotLeased", err)
+	}
+	if c.Leased() != 1 {
+		t.Errorf("Leased() = %d, want b's lease kept", c.Leased())
+	}
+
+	if err := b.Complete(ctx, Result{ID: tasks[0].ID, StatusCode: 201}); err != nil {
+		t.Fatal(err)
+	}
+	if len(settled) != 1 || settled[0].Worker != "b" || settled[0].StatusCode != 201 {
+		t.Errorf("settled = %+v, want b's result alone", settled)
+	}
+	select {
+	case <-c.Done():
+	default:
+		t.Error("coordinator is not done")
+	}
+}
@@ -0,0 +1,157 @@
+// Package config loads the optional JSON configuration file.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// Config is the contents of a configuration file. Any top-level key that is
+// not a named section sets the default of the command-line flag with the
+// same name; flags given on the command line take precedence.
+type Config struct {
+	// FieldMapping maps input field names to Order field names, for inputs
+	// whose schema differs from the default one
+	FieldMapping map[string]string `json:"field_mapping"`
+
+	// Credentials maps values of the --credential-field order field to the
+	// API credentials orders with that value are requested with; "*"
+	// matches any other value
+	Credentials map[string]Credential `json:"credentials"`
+
+	// Flags holds the flag defaults
+	Flags map[string]interface{} `json:"-"`
+
+	// Profiles holds named sets of flag defaults, such as the URL, auth,
+	// TLS, and rate limit of an environment, which override the top-level
+	// ones when selected
+	Profiles map[string]map[string]interface{} `json:"-"`
+}
+
+// sections are the top-level keys that do not correspond to flags
+var sections = map[string]bool{
+	"field_mapping": true,
+	"profiles":      true,
+	"credentials":   true,
+}
+
+// Credential is a set of API credentials, given like the flags of the same
+// names; the auth token may be a vault: or keyring: reference
+type Credential struct {
+	AuthToken string   `json:"auth-token"`
+	Header    []string `json:"header"`
+}
+
+// Load reads the configuration file at path
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	var raw map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	cfg.Flags = make(map[string]interface{})
+	for k, v := range raw {
+		if !sections[k] {
+			cfg.Flags[k] = v
+		}
+	}
+
+	if raw["profiles"] != nil {
+		profiles, ok := raw["profiles"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid config file %s: profiles must be an object", path)
+		}
+		cfg.Profiles = make(map[string]map[string]interface{}, len(profiles))
+		for name, v := range profiles {
+			profile, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid config file %s: profile %q must be an object", path, name)
+			}
+			cfg.Profiles[name] = profile
+		}
+	}
+	return &cfg, nil
+}
+
+// UseProfile selects a named profile, whose keys override the top-level
+// flag defaults
+func (c *Config) UseProfile(name string) error {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(c.Profiles))
+		for n := range c.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("unknown profile %q: the config file has no profiles", name)
+		}
+		return fmt.Errorf("unknown profile %q: must be one of %s", name, strings.Join(names, ", "))
+	}
+	for k, v := range profile {
+		if sections[k] {
+			return fmt.Errorf("profile %q cannot set %q", name, k)
+		}
+		c.Flags[k] = v
+	}
+	return nil
+}
+
+// ApplyFlags sets every flag named in the configuration that was not given
+// on the command line
+func (c *Config) ApplyFlags(flags *pflag.FlagSet) error {
+	for name, value := range c.Flags {
+		flag := flags.Lookup(name)
+		if flag == nil {
+			return fmt.Errorf("unknown config key %q", name)
+		}
+		if flag.Changed {
+			continue
+		}
+
+		values := toStrings(value)
+		if sv, ok := flag.Value.(pflag.SliceValue); ok {
+			if err := sv.Replace(values); err != nil {
+				return fmt.Errorf("invalid value for config key %q: %w", name, err)
+			}
+			continue
+		}
+		if err := flag.Value.Set(strings.Join(values, ",")); err != nil {
+			return fmt.Errorf("invalid value for config key %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// toStrings converts a JSON value to flag strings
+func toStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			out = append(out, fmt.Sprint(item))
+		}
+		return out
+	case nil:
+		return []string{""}
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
@@ -0,0 +1,86 @@
+// Package credential reads secrets from external credential helper programs
+// and the operating system keyring, so that they need not be passed in flags,
+// environment variables, or configuration files.
+package credential
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// KeyringPrefix marks a flag value as a reference to a keyring entry
+const KeyringPrefix = "keyring:"
+
+// helperTimeout bounds a credential helper or keyring lookup
+const helperTimeout = 30 * time.Second
+
+// IsKeyringRef reports whether value is a reference to a keyring entry
+func IsKeyringRef(value string) bool {
+	return strings.HasPrefix(value, KeyringPrefix)
+}
+
+// Helper runs command with the shell and returns what it prints to stdout,
+// without surrounding whitespace
+func Helper(ctx context.Context, command string) (string, error) {
+	secret, err := run(ctx, "sh", "-c", command)
+	if err != nil {
+		return "", fmt.Errorf("credential helper failed: %w", err)
+	}
+	if secret == "" {
+		return "", errors.New("credential helper printed nothing")
+	}
+	return secret, nil
+}
+
+// Keyring returns the secret named by ref, of the form keyring:service/account,
+// from the macOS keychain or, on Linux, the Secret Service (GNOME Keyring,
+// KWallet) through secret-tool
+func Keyring(ctx context.Context, ref string) (string, error) {
+	service, account, ok := strings.Cut(strings.TrimPrefix(ref, KeyringPrefix), "/")
+	if !ok || service == "" || account == "" {
+		return "", fmt.Errorf("invalid keyring reference %q: expected keyring:service/account", ref)
+	}
+
+	var secret string
+	var err error
+	switch runtime.GOOS {
+	case "darwin":
+		secret, err = run(ctx, "security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "linux", "freebsd", "openbsd", "netbsd":
+		secret, err = run(ctx, "secret-tool", "lookup", "service", service, "account", account)
+	default:
+		return "", fmt.Errorf("keyring references are not supported on %s", runtime.GOOS)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s/%s from the keyring: %w", service, account, err)
+	}
+	if secret == "" {
+		return "", fmt.Errorf("keyring has no secret for %s/%s", service, account)
+	}
+	return secret, nil
+}
+
+// run runs a program and returns its trimmed output. Errors include what it
+// printed to stderr.
+func run(ctx context.Context, name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, helperTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,175 @@
+// Package diff compares the output files of two runs.
+package diff
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// Change describes a response present in both outputs with different content
+type Change struct {
+	Key string
+	Old string
+	New string
+}
+
+// Report lists the differences between two outputs
+type Report struct {
+	// KeyedByOrder is true when both outputs used the envelope format and
+	// responses were matched by order ID rather than by line number
+	KeyedByOrder bool
+	Added        []string
+	Removed      []string
+	Changed      []Change
+}
+
+// Empty reports whether the outputs were identical
+func (r Report) Empty() bool {
+	return len(r.Added) == 0 && len(r.Removed) == 0 && len(r.Changed) == 0
+}
+
+// line is a single non-empty line of an output file
+type line struct {
+	value   string
+	orderID string
+}
+
+// index maps keys to normalized values, preserving file order
+type index struct {
+	keys   []string
+	values map[string]string
+}
+
+// Files compares the output files at oldPath and newPath. Responses are
+// matched by order ID when both files use the envelope format, and by line
+// number otherwise.
+func Files(oldPath, newPath string) (Report, error) {
+	a, err := parse(oldPath)
+	if err != nil {
+		return Report{}, err
+	}
+	b, err := parse(newPath)
+	if err != nil {
+		return Report{}, err
+	}
+
+	keyed := enveloped(a) && enveloped(b)
+	ia, ib := build(a, keyed), build(b, keyed)
+
+	report := Report{KeyedByOrder: keyed}
+	for _, k := range ia.keys {
+		nv, ok := ib.values[k]
+		switch {
+		case !ok:
+			report.Removed = append(report.Removed, k)
+		case nv != ia.values[k]:
+			report.Changed = append(report.Changed, Change{Key: k, Old: ia.values[k], New: nv})
+		}
+	}
+	for _, k := range ib.keys {
+		if _, ok := ia.values[k]; !ok {
+			report.Added = append(report.Added, k)
+		}
+	}
+	return report, nil
+}
+
+// parse reads the non-empty lines of an output file
+func parse(path string) ([]line, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output file: %w", err)
+	}
+
+	var lines []line
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		var result models.Result
+		if decode(raw, &result) != nil {
+			result.OrderID = ""
+		}
+		lines = append(lines, line{value: normalize(raw, result.OrderID != ""), orderID: result.OrderID})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading output file %s: %w", path, err)
+	}
+	return lines, nil
+}
+
+// enveloped reports whether every line is a result envelope
+func enveloped(lines []line) bool {
+	for _, l := range lines {
+		if l.orderID == "" {
+			return false
+		}
+	}
+	return len(lines) > 0
+}
+
+// build indexes lines by order ID or by line number. Repeated order IDs are
+// matched by occurrence.
+func build(lines []line, keyed bool) index {
+	idx := index{values: make(map[string]string, len(lines))}
+	seen := make(map[string]int)
+	for i, l := range lines {
+		key := strconv.Itoa(i + 1)
+		if keyed {
+			key = l.orderID
+			if n := seen[l.orderID]; n > 0 {
+				key = fmt.Sprintf("%s#%d", l.orderID, n+1)
+			}
+			seen[l.orderID]++
+		}
+		idx.keys = append(idx.keys, key)
+		idx.values[key] = l.value
+	}
+	return idx
+}
+
+// decode decodes a JSON value, keeping numbers as json.Number so that large
+// IDs and amounts are compared as written rather than rounded to a float
+func decode(raw []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
+
+// perRun lists the envelope fields that differ between runs of the same
+// orders, which are left out of the comparison
+var perRun = []string{"run_id", "request_id"}
+
+// normalize re-encodes JSON values with sorted keys and no extra whitespace,
+// leaving out the per-run fields of envelopes; other lines are compared
+// verbatim
+func normalize(raw []byte, envelope bool) string {
+	var v interface{}
+	if err := decode(raw, &v); err != nil {
+		return string(raw)
+	}
+	if m, ok := v.(map[string]interface{}); ok && envelope {
+		for _, field := range perRun {
+			delete(m, field)
+		}
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,70 @@
+package diff
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeOutput writes the lines of an output file
+func writeOutput(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFilesIgnoresPerRunFields(t *testing.T) {
+	oldPath := writeOutput(t, "old.txt",
+		`{"order_id":"a1","symbol":"TSLA","side":"sell","status_code":200,"response":{"ok":true},"run_id":"run-1","request_id":"req-1"}`+"\n"+
+			`{"order_id":"a2","symbol":"TSLA","side":"sell","status_code":200,"response":{"ok":true},"run_id":"run-1","request_id":"req-2"}`+"\n")
+	newPath := writeOutput(t, "new.txt",
+		`{"order_id":"a1","symbol":"TSLA","side":"sell","status_code":200,"response":{"ok":true},"run_id":"run-2","request_id":"req-3"}`+"\n"+
+			`{"order_id":"a2","symbol":"TSLA","side":"sell","status_code":500,"response":{"ok":false},"run_id":"run-2","request_id":"req-4"}`+"\n")
+
+	report, err := Files(oldPath, newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.KeyedByOrder {
+		t.Error("envelope outputs were not matched by order ID")
+	}
+	if len(report.Added) != 0 || len(report.Removed) != 0 {
+		t.Errorf("added %v, removed %v; want none", report.Added, report.Removed)
+	}
+	if len(report.Changed) != 1 || report.Changed[0].Key != "a2" {
+		t.Fatalf("changed %+v; want only a2", report.Changed)
+	}
+}
+
+func TestFilesComparesRawResponsesInFull(t *testing.T) {
+	oldPath := writeOutput(t, "old.txt", `{"request_id":"req-1","ok":true}`+"\n")
+	newPath := writeOutput(t, "new.txt", `{"request_id":"req-2","ok":true}`+"\n")
+
+	report, err := Files(oldPath, newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Changed) != 1 {
+		t.Errorf("changed %+v; want the response whose request_id changed", report.Changed)
+	}
+}
+
+func TestFilesComparesLargeNumbersExactly(t *testing.T) {
+	oldPath := writeOutput(t, "old.txt", `{"id":9007199254740993,"amount":12345678901234567.891}`+"\n")
+	newPath := writeOutput(t, "new.txt", `{"id":9007199254740992,"amount":12345678901234567.891}`+"\n")
+
+	report, err := Files(oldPath, newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Changed) != 1 {
+		t.Fatalf("changed %+v; want the response whose id changed", report.Changed)
+	}
+	if !strings.Contains(report.Changed[0].Old, "9007199254740993") || !strings.Contains(report.Changed[0].New, "9007199254740992") {
+		t.Errorf("change %+v does not show the numbers as written", report.Changed[0])
+	}
+}
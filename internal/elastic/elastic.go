@@ -0,0 +1,237 @@
+// Package elastic bulk-indexes documents into Elasticsearch or OpenSearch.
+package elastic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/httpclient"
+)
+
+// Options configures an Indexer
+type Options struct {
+	// URL is the cluster URL, with basic auth credentials as user:pass@
+	URL string
+	// Index names the target index. %{+pattern} is replaced with the
+	// document time formatted with a Joda-style pattern such as yyyy.MM.dd,
+	// as in Logstash.
+	Index string
+	// APIKey, if set, is sent as an ApiKey authorization
+	APIKey string
+	// BatchSize is the number of documents sent per bulk request
+	BatchSize int
+	// FlushInterval is the longest a document is buffered before it is sent
+	// along with the next one
+	FlushInterval time.Duration
+	Timeout       time.Duration
+	Insecure      bool
+}
+
+// Indexer buffers documents and sends them with the _bulk API. All methods
+// are safe to call on a nil receiver, which disables indexing.
+type Indexer struct {
+	mu       sync.Mutex
+	opts     Options
+	endpoint string
+	user     *url.Userinfo
+	client   *http.Client
+	buf      bytes.Buffer
+	pending  int
+	oldest   time.Time
+}
+
+// New creates an Indexer for the cluster at opts.URL
+func New(opts Options) (*Indexer, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid Elasticsearch URL: %q", opts.URL)
+	}
+	if opts.Index == "" {
+		return nil, fmt.Errorf("Elasticsearch index is required")
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = 1
+	}
+	user := u.User
+	u.User = nil
+	u.Path = strings.TrimRight(u.Path, "/") + "/_bulk"
+	return &Indexer{
+		opts:     opts,
+		endpoint: u.String(),
+		user:     user,
+		client:   httpclient.New(httpclient.Options{Timeout: opts.Timeout, Insecure: opts.Insecure}),
+	}, nil
+}
+
+// Add buffers a JSON document for the index of time t, sending the batch
+// once it is full or its oldest document is due
+func (x *Indexer) Add(t time.Time, doc []byte) error {
+	if x == nil {
+		return nil
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	action, _ := json.Marshal(map[string]interface{}{
+		"index": map[string]string{"_index": indexName(x.opts.Index, t)},
+	})
+	x.buf.Write(action)
+	x.buf.WriteByte('\n')
+	x.buf.Write(doc)
+	x.buf.WriteByte('\n')
+	if x.pending == 0 {
+		x.oldest = time.Now()
+	}
+	x.pending++
+
+	if x.pending >= x.opts.BatchSize || (x.opts.FlushInterval > 0 && time.Since(x.oldest) >= x.opts.FlushInterval) {
+		return x.flush()
+	}
+	return nil
+}
+
+// Flush sends any buffered documents
+func (x *Indexer) Flush() error {
+	if x == nil {
+		return nil
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.flush()
+}
+
+// Close sends any buffered documents
+func (x *Indexer) Close() error {
+	return x.Flush()
+}
+
+// flush sends the buffered documents in one bulk request. The buffer is
+// cleared even if the request fails, so one bad batch does not block the
+// ones after it.
+func (x *Indexer) flush() error {
+	if x.pending == 0 {
+		return nil
+	}
+	count := x.pending
+	body := append([]byte(nil), x.buf.Bytes()...)
+	x.buf.Reset()
+	x.pending = 0
+
+	req, err := http.NewRequest(http.MethodPost, x.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if x.opts.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+x.opts.APIKey)
+	} else if x.user != nil {
+		pass, _ := x.user.Password()
+		req.SetBasicAuth(x.user.Username(), pass)
+	}
+
+	resp, err := x.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to index %d documents: %w", count, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read bulk response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to index %d documents: Elasticsearch returned status %d: %s", count, resp.StatusCode, bytes.TrimSpace(data))
+	}
+	return bulkError(data)
+}
+
+// bulkError reports the documents of a bulk response that failed to index
+func bulkError(data []byte) error {
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("invalid bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+
+	failed := 0
+	var first json.RawMessage
+	for _, item := range result.Items {
+		for _, op := range item {
+			if op.Status >= 300 {
+				failed++
+				if first == nil {
+					first = op.Error
+				}
+			}
+		}
+	}
+	return fmt.Errorf("%d of %d documents failed to index: %s", failed, len(result.Items), first)
+}
+
+// jodaLayouts maps Joda-style date pattern letters to Go layouts
+var jodaLayouts = []struct{ joda, layout string }{
+	{"yyyy", "2006"},
+	{"yy", "06"},
+	{"MM", "01"},
+	{"dd", "02"},
+	{"HH", "15"},
+	{"mm", "04"},
+	{"ss", "05"},
+}
+
+// indexName expands the %{+pattern} dates of an index name for time t, in
+// UTC
+func indexName(index string, t time.Time) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(index, "%{+")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(index[start:], '}')
+		if end < 0 {
+			break
+		}
+		b.WriteString(index[:start])
+		b.WriteString(formatDate(index[start+3:start+end], t.UTC()))
+		index = index[start+end+1:]
+	}
+	b.WriteString(index)
+	return b.String()
+}
+
+// formatDate formats t with a Joda-style pattern. Letters without a
+// mapping are kept as they are.
+func formatDate(pattern string, t time.Time) string {
+	var b strings.Builder
+	for pattern != "" {
+		matched := false
+		for _, j := range jodaLayouts {
+			if strings.HasPrefix(pattern, j.joda) {
+				b.WriteString(t.Format(j.layout))
+				pattern = pattern[len(j.joda):]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			b.WriteByte(pattern[0])
+			pattern = pattern[1:]
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,421 @@
+// Package encrypt encrypts output files with AES-256-GCM, either with a
+// shared key or for the holder of an X25519 private key.
+//
+// An encrypted file is one or more streams, so that runs appending to a file
+// each add their own. A stream is a header followed by chunks:
+//
+//	header: Magic, a mode byte ('k' for a shared key, 'x' for a recipient),
+//	        for 'x' the 32-byte ephemeral X25519 public key, and a 32-byte
+//	        random salt
+//	chunk:  a 4-byte big-endian ciphertext length, with the top bit set on
+//	        the last chunk of the stream, and the AES-GCM ciphertext
+//
+// Each stream is encrypted with a key derived by HKDF-SHA256 from the shared
+// key, or the X25519 shared secret, and the salt. Chunks use their index as
+// the nonce and are authenticated together with the header and whether they
+// are the last chunk, so reordered, modified, or truncated streams are
+// detected.
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Magic starts every stream
+const Magic = "order-processor-encrypted/v1\n"
+
+const (
+	modeKey       = 'k'
+	modeRecipient = 'x'
+	saltSize      = 32
+	// chunkSize is the most plaintext in one chunk
+	chunkSize = 64 * 1024
+	// finalFlag marks the length of the last chunk of a stream
+	finalFlag = 1 << 31
+)
+
+// ErrTruncated reports a stream that ends without its last chunk, as left by
+// an interrupted run
+var ErrTruncated = errors.New("encrypted stream ends without its last chunk")
+
+// ParseKey parses a base64-encoded 32-byte shared key
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("invalid key: must be 32 bytes, base64-encoded")
+	}
+	return key, nil
+}
+
+// ParseRecipient parses a base64-encoded X25519 public key
+func ParseRecipient(s string) (*ecdh.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, errors.New("invalid recipient: must be a base64-encoded X25519 public key")
+	}
+	pub, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	return pub, nil
+}
+
+// ParseIdentity parses a base64-encoded X25519 private key
+func ParseIdentity(s string) (*ecdh.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, errors.New("invalid identity: must be a base64-encoded X25519 private key")
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	return priv, nil
+}
+
+// GenerateKey returns a new base64-encoded shared key
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// GenerateIdentity returns a new base64-encoded X25519 private key and the
+// public key to encrypt for it
+func GenerateIdentity() (identity, recipient string, err error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(priv.Bytes()),
+		base64.StdEncoding.EncodeToString(priv.PublicKey().Bytes()), nil
+}
+
+// Encrypter starts encrypted streams with a shared key or for a recipient
+type Encrypter struct {
+	key       []byte
+	recipient *ecdh.PublicKey
+}
+
+// NewEncrypter creates an encrypter for a base64 shared key or recipient
+// public key, of which exactly one must be set. It returns nil if neither
+// is.
+func NewEncrypter(key, recipient string) (*Encrypter, error) {
+	switch {
+	case key == "" && recipient == "":
+		return nil, nil
+	case key != "" && recipient != "":
+		return nil, errors.New("a key and a recipient cannot both be set")
+	case key != "":
+		k, err := ParseKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return &Encrypter{key: k}, nil
+	default:
+		pub, err := ParseRecipient(recipient)
+		if err != nil {
+			return nil, err
+		}
+		return &Encrypter{recipient: pub}, nil
+	}
+}
+
+// Writer encrypts a stream written to an underlying writer. Data is sealed
+// in chunks as they fill up, on Flush, and on Close, which ends the stream.
+type Writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	buf    []byte
+	index  uint64
+	closed bool
+}
+
+// NewWriter starts a stream on w, writing its header
+func (e *Encrypter) NewWriter(w io.Writer) (*Writer, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	header := []byte(Magic)
+	var secret []byte
+	if e.recipient != nil {
+		ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if secret, err = ephemeral.ECDH(e.recipient); err != nil {
+			return nil, err
+		}
+		header = append(header, modeRecipient)
+		header = append(header, ephemeral.PublicKey().Bytes()...)
+	} else {
+		secret = e.key
+		header = append(header, modeKey)
+	}
+	header = append(header, salt...)
+
+	aead, err := newAEAD(secret, header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, aead: aead, header: header}, nil
+}
+
+// Write buffers p, sealing full chunks
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to closed encrypted stream")
+	}
+	n := len(p)
+	for len(p) > 0 {
+		take := min(chunkSize-len(w.buf), len(p))
+		w.buf = append(w.buf, p[:take]...)
+		p = p[take:]
+		if len(w.buf) == chunkSize {
+			if err := w.seal(false); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Flush seals any buffered data, so that it reaches the underlying writer
+func (w *Writer) Flush() error {
+	if w.closed || len(w.buf) == 0 {
+		return nil
+	}
+	return w.seal(false)
+}
+
+// Close seals the last chunk, ending the stream. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.seal(true)
+}
+
+// seal encrypts and writes the buffered data as one chunk
+func (w *Writer) seal(final bool) error {
+	ciphertext := w.aead.Seal(nil, nonce(w.index), w.buf, additionalData(w.header, final))
+	length := uint32(len(ciphertext))
+	if final {
+		length |= finalFlag
+	}
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], length)
+	if _, err := w.w.Write(append(prefix[:], ciphertext...)); err != nil {
+		return err
+	}
+	w.index++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Decrypter decrypts streams with a shared key or a recipient's private key
+type Decrypter struct {
+	key      []byte
+	identity *ecdh.PrivateKey
+}
+
+// NewDecrypter creates a decrypter for a base64 shared key or identity
+// private key, of which exactly one must be set
+func NewDecrypter(key, identity string) (*Decrypter, error) {
+	switch {
+	case key == "" && identity == "":
+		return nil, errors.New("a key or an identity is required")
+	case key != "" && identity != "":
+		return nil, errors.New("a key and an identity cannot both be set")
+	case key != "":
+		k, err := ParseKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return &Decrypter{key: k}, nil
+	default:
+		priv, err := ParseIdentity(identity)
+		if err != nil {
+			return nil, err
+		}
+		return &Decrypter{identity: priv}, nil
+	}
+}
+
+// Decrypt writes the plaintext of the streams in src to dst. A stream cut
+// short by an interrupted run is decrypted as far as it goes, and Decrypt
+// then returns ErrTruncated, whether or not other streams follow it.
+func (d *Decrypter) Decrypt(dst io.Writer, src io.Reader) error {
+	r := bufio.NewReaderSize(src, chunkSize+128)
+	for stream := 1; ; stream++ {
+		if _, err := r.Peek(1); err == io.EOF {
+			if stream == 1 {
+				return errors.New("file is empty")
+			}
+			return nil
+		}
+		header, aead, err := d.readHeader(r)
+		if err != nil {
+			return fmt.Errorf("stream %d: %w", stream, err)
+		}
+		if err := decryptChunks(dst, r, header, aead); err != nil {
+			return fmt.Errorf("stream %d: %w", stream, err)
+		}
+	}
+}
+
+// readHeader reads a stream header and derives the stream's cipher
+func (d *Decrypter) readHeader(r *bufio.Reader) ([]byte, cipher.AEAD, error) {
+	header := make([]byte, len(Magic)+1)
+	n, err := io.ReadFull(r, header)
+	if !strings.HasPrefix(Magic, string(header[:min(n, len(Magic))])) {
+		return nil, nil, errors.New("not an encrypted stream")
+	}
+	if err != nil {
+		return nil, nil, errors.New("truncated header")
+	}
+
+	var secret []byte
+	switch header[len(Magic)] {
+	case modeKey:
+		if d.key == nil {
+			return nil, nil, errors.New("encrypted with a shared key, not for a recipient")
+		}
+		secret = d.key
+	case modeRecipient:
+		if d.identity == nil {
+			return nil, nil, errors.New("encrypted for a recipient, not with a shared key")
+		}
+		raw := make([]byte, 32)
+		if _, err := io.ReadFull(r, raw); err != nil {
+			return nil, nil, errors.New("truncated header")
+		}
+		header = append(header, raw...)
+		ephemeral, err := ecdh.X25519().NewPublicKey(raw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid header: %w", err)
+		}
+		if secret, err = d.identity.ECDH(ephemeral); err != nil {
+			return nil, nil, fmt.Errorf("invalid header: %w", err)
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown encryption mode %q", header[len(Magic)])
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return nil, nil, errors.New("truncated header")
+	}
+	header = append(header, salt...)
+	aead, err := newAEAD(secret, header)
+	return header, aead, err
+}
+
+// decryptChunks decrypts the chunks of one stream, up to its last chunk
+func decryptChunks(dst io.Writer, r *bufio.Reader, header []byte, aead cipher.AEAD) error {
+	for index := uint64(0); ; index++ {
+		prefix, _ := r.Peek(4)
+		if len(prefix) == 0 {
+			return ErrTruncated
+		}
+		length := uint32(0)
+		if len(prefix) == 4 {
+			length = binary.BigEndian.Uint32(prefix)
+		}
+		final := length&finalFlag != 0
+		length &^= finalFlag
+		if length > chunkSize+uint32(aead.Overhead()) {
+			length = 0
+		}
+
+		// A chunk cut short by an interrupted run is followed by the next
+		// stream, which starts with Magic
+		size := 4 + int(length)
+		chunk, _ := r.Peek(size + len(Magic))
+		if i := bytes.Index(chunk, []byte(Magic)); i >= 0 && i < size {
+			r.Discard(i)
+			return ErrTruncated
+		}
+		if len(prefix) < 4 || len(chunk) < size {
+			r.Discard(len(chunk))
+			return ErrTruncated
+		}
+		if length == 0 {
+			return errors.New("corrupt chunk length")
+		}
+		r.Discard(4)
+		ciphertext := make([]byte, length)
+		if _, err := io.ReadFull(r, ciphertext); err != nil {
+			return ErrTruncated
+		}
+		plaintext, err := aead.Open(nil, nonce(index), ciphertext, additionalData(header, final))
+		if err != nil {
+			return errors.New("wrong key, or the file was modified")
+		}
+		if _, err := dst.Write(plaintext); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// newAEAD derives the AES-256-GCM cipher of a stream
+func newAEAD(secret, header []byte) (cipher.AEAD, error) {
+	salt := header[len(header)-saltSize:]
+	// HKDF-SHA256: one block of output is the 32-byte key
+	prk := hmacSHA256(salt, secret)
+	key := hmacSHA256(prk, append([]byte(Magic), 1))
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// nonce returns the nonce of a chunk
+func nonce(index uint64) []byte {
+	n := make([]byte, 12)
+	binary.BigEndian.PutUint64(n[4:], index)
+	return n
+}
+
+// additionalData authenticates a chunk together with its stream header and
+// whether it is the last chunk
+func additionalData(header []byte, final bool) []byte {
+	ad := append([]byte(nil), header...)
+	if final {
+		return append(ad, 1)
+	}
+	return append(ad, 0)
+}
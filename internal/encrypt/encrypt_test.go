@@ -0,0 +1,181 @@
+package encrypt
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// encryptStreams encrypts each plaintext as a stream of its own, as runs
+// appending to a file do, leaving the last one unclosed if unfinished
+func encryptStreams(t *testing.T, e *Encrypter, unfinished bool, plaintexts ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	for i, p := range plaintexts {
+		w, err := e.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(p)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if unfinished && i == len(plaintexts)-1 {
+			break
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func newKeyPair(t *testing.T) (*Encrypter, *Decrypter) {
+	t.Helper()
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewEncrypter(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDecrypter(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, d
+}
+
+func TestRoundTrip(t *testing.T) {
+	identity, recipient, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewEncrypter("", recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDecrypter("", identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyE, keyD := newKeyPair(t)
+
+	// A stream of several chunks, an empty one, and a short one
+	large := strings.Repeat("0123456789abcdef", chunkSize/8)
+	for name, pair := range map[string]struct {
+		e *Encrypter
+		d *Decrypter
+	}{"recipient": {e, d}, "key": {keyE, keyD}} {
+		data := encryptStreams(t, pair.e, false, large, "", "tail\n")
+		var out bytes.Buffer
+		if err := pair.d.Decrypt(&out, bytes.NewReader(data)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if out.String() != large+"tail\n" {
+			t.Errorf("%s: decrypted %d bytes, want %d", name, out.Len(), len(large)+5)
+		}
+	}
+}
+
+func TestDecryptDetectsTampering(t *testing.T) {
+	e, d := newKeyPair(t)
+	data := encryptStreams(t, e, false, "order 1\n", "order 2\n")
+
+	// Flip a bit in every byte after the first header in turn
+	for i := len(Magic) + 1 + saltSize; i < len(data); i++ {
+		tampered := append([]byte(nil), data...)
+		tampered[i] ^= 1
+		if err := d.Decrypt(&bytes.Buffer{}, bytes.NewReader(tampered)); err == nil {
+			t.Fatalf("byte %d modified without an error", i)
+		}
+	}
+
+	// Chunks swapped within a stream are detected
+	var buf bytes.Buffer
+	w, _ := e.NewWriter(&buf)
+	header := buf.Len()
+	w.Write([]byte("a"))
+	w.Flush()
+	first := buf.Len()
+	w.Write([]byte("b"))
+	w.Close()
+	data = buf.Bytes()
+	swapped := append(append(append([]byte(nil), data[:header]...), data[first:]...), data[header:first]...)
+	if err := d.Decrypt(&bytes.Buffer{}, bytes.NewReader(swapped)); err == nil {
+		t.Error("reordered chunks decrypted without an error")
+	}
+}
+
+func TestDecryptTruncated(t *testing.T) {
+	e, d := newKeyPair(t)
+
+	// The last stream of the file is unfinished
+	data := encryptStreams(t, e, true, "order 1\n", "order 2\n")
+	var out bytes.Buffer
+	err := d.Decrypt(&out, bytes.NewReader(data))
+	if !errors.Is(err, ErrTruncated) {
+		t.Fatalf("Decrypt() error = %v, want ErrTruncated", err)
+	}
+	if out.String() != "order 1\norder 2\n" {
+		t.Errorf("decrypted %q, want what was sealed", out.String())
+	}
+
+	// An unfinished stream followed by another fails too
+	data = append(encryptStreams(t, e, true, "order 1\n"), encryptStreams(t, e, false, "order 2\n")...)
+	out.Reset()
+	err = d.Decrypt(&out, bytes.NewReader(data))
+	if !errors.Is(err, ErrTruncated) || !strings.HasPrefix(err.Error(), "stream 1:") {
+		t.Fatalf("Decrypt() error = %v, want ErrTruncated in stream 1", err)
+	}
+	if strings.Contains(out.String(), "order 2") {
+		t.Errorf("decrypted %q past the unfinished stream", out.String())
+	}
+
+	// Cutting the file anywhere inside a stream is detected. A file cut
+	// between streams is a valid file of fewer streams.
+	first := len(encryptStreams(t, e, false, "order 1\n"))
+	data = encryptStreams(t, e, false, "order 1\n", "order 2\n")
+	for n := 1; n < len(data); n++ {
+		if n == first {
+			continue
+		}
+		if err := d.Decrypt(&bytes.Buffer{}, bytes.NewReader(data[:n])); err == nil {
+			t.Fatalf("file cut to %d of %d bytes decrypted without an error", n, len(data))
+		}
+	}
+}
+
+func TestDecryptWrongKey(t *testing.T) {
+	e, _ := newKeyPair(t)
+	_, other := newKeyPair(t)
+	data := encryptStreams(t, e, false, "order 1\n")
+
+	var out bytes.Buffer
+	err := other.Decrypt(&out, bytes.NewReader(data))
+	if err == nil || !strings.Contains(err.Error(), "wrong key") {
+		t.Errorf("Decrypt() error = %v, want a wrong key error", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("decrypted %q with the wrong key", out.String())
+	}
+
+	// A file encrypted for a recipient needs an identity, not a key
+	identity, recipient, _ := GenerateIdentity()
+	forRecipient, _ := NewEncrypter("", recipient)
+	data = encryptStreams(t, forRecipient, false, "order 1\n")
+	if err := other.Decrypt(&bytes.Buffer{}, bytes.NewReader(data)); err == nil {
+		t.Error("decrypted a file for a recipient with a shared key")
+	}
+	_, otherRecipient, _ := GenerateIdentity()
+	wrong, _ := NewDecrypter("", identity)
+	forOther, _ := NewEncrypter("", otherRecipient)
+	data = encryptStreams(t, forOther, false, "order 1\n")
+	if err := wrong.Decrypt(&bytes.Buffer{}, bytes.NewReader(data)); err == nil {
+		t.Error("decrypted a file for another recipient")
+	}
+}
@@ -0,0 +1,113 @@
+// Package enrich joins columns from a lookup file onto orders.
+package enrich
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// Table maps key values to the columns to add to matching orders. All methods
+// are safe to call on a nil receiver, which disables enrichment.
+type Table struct {
+	key  string
+	rows map[string]map[string]string
+}
+
+// Load reads a CSV lookup file with a header row. The key column is matched
+// against the order field of the same name; every other column is added to
+// matching orders as an extra field.
+func Load(path, key string) (*Table, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lookup file: %w", err)
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lookup header: %w", err)
+	}
+
+	keyCol := -1
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		header[i] = name
+		switch {
+		case name == key:
+			keyCol = i
+		case models.IsOrderField(name):
+			return nil, fmt.Errorf("lookup column %q conflicts with an order field", name)
+		}
+	}
+	if keyCol < 0 {
+		return nil, fmt.Errorf("lookup file has no %q column", key)
+	}
+
+	t := &Table{key: key, rows: make(map[string]map[string]string)}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read lookup file: %w", err)
+		}
+		if keyCol >= len(record) {
+			continue
+		}
+		k := strings.TrimSpace(record[keyCol])
+		if _, dup := t.rows[k]; dup {
+			return nil, fmt.Errorf("duplicate lookup key %q", k)
+		}
+		row := make(map[string]string, len(header)-1)
+		for i, v := range record {
+			if i != keyCol && i < len(header) {
+				row[header[i]] = strings.TrimSpace(v)
+			}
+		}
+		t.rows[k] = row
+	}
+	return t, nil
+}
+
+// Len returns the number of lookup rows
+func (t *Table) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.rows)
+}
+
+// Apply adds the lookup columns for the order's key to its extra fields.
+// Fields already present on the order are kept. It reports whether a lookup
+// row matched.
+func (t *Table) Apply(order *models.Order) bool {
+	if t == nil {
+		return false
+	}
+	k, ok := order.Field(t.key)
+	if !ok {
+		return false
+	}
+	row, ok := t.rows[k]
+	if !ok {
+		return false
+	}
+	for name, v := range row {
+		if _, exists := order.Extra[name]; exists {
+			continue
+		}
+		if order.Extra == nil {
+			order.Extra = make(map[string]interface{}, len(row))
+		}
+		order.Extra[name] = v
+	}
+	return true
+}
@@ -0,0 +1,222 @@
+// Package gcp obtains OAuth access tokens from Google Application Default
+// Credentials.
+package gcp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTokenURL = "https://oauth2.googleapis.com/token"
+	metadataHost    = "metadata.google.internal"
+	// expiryMargin renews tokens this long before they expire
+	expiryMargin = time.Minute
+)
+
+// TokenSource returns cached access tokens, refreshing them before expiry
+type TokenSource struct {
+	client *http.Client
+	fetch  func(ctx context.Context) (string, time.Duration, error)
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// credentialsFile is the subset of service account and authorized user
+// credential files that is used
+type credentialsFile struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// DefaultTokenSource finds Application Default Credentials for scope: the
+// file named by GOOGLE_APPLICATION_CREDENTIALS, the gcloud default
+// credentials file, or the metadata server when running on Google Cloud
+func DefaultTokenSource(client *http.Client, scope string) (*TokenSource, error) {
+	ts := &TokenSource{client: client}
+
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			candidate := filepath.Join(dir, "gcloud", "application_default_credentials.json")
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+			}
+		}
+	}
+	if path == "" {
+		ts.fetch = ts.metadataToken
+		return ts, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Google credentials: %w", err)
+	}
+	var creds credentialsFile
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("invalid Google credentials %s: %w", path, err)
+	}
+
+	switch creds.Type {
+	case "service_account":
+		key, err := parsePrivateKey(creds.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Google credentials %s: %w", path, err)
+		}
+		ts.fetch = func(ctx context.Context) (string, time.Duration, error) {
+			return ts.serviceAccountToken(ctx, creds, key, scope)
+		}
+	case "authorized_user":
+		ts.fetch = func(ctx context.Context) (string, time.Duration, error) {
+			return ts.exchange(ctx, defaultTokenURL, url.Values{
+				"grant_type":    {"refresh_token"},
+				"client_id":     {creds.ClientID},
+				"client_secret": {creds.ClientSecret},
+				"refresh_token": {creds.RefreshToken},
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Google credentials type %q in %s", creds.Type, path)
+	}
+	return ts, nil
+}
+
+// Token returns a valid access token
+func (t *TokenSource) Token(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Now().Before(t.expiry) {
+		return t.token, nil
+	}
+
+	token, ttl, err := t.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	t.token = token
+	t.expiry = time.Now().Add(ttl - expiryMargin)
+	return token, nil
+}
+
+// serviceAccountToken exchanges a signed JWT assertion for an access token
+func (t *TokenSource) serviceAccountToken(ctx context.Context, creds credentialsFile, key *rsa.PrivateKey, scope string) (string, time.Duration, error) {
+	tokenURL := creds.TokenURI
+	if tokenURL == "" {
+		tokenURL = defaultTokenURL
+	}
+	now := time.Now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   creds.ClientEmail,
+		"scope": scope,
+		"aud":   tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to sign Google token request: %w", err)
+	}
+
+	return t.exchange(ctx, tokenURL, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + base64.RawURLEncoding.EncodeToString(sig)},
+	})
+}
+
+// metadataToken fetches the token of the instance's service account
+func (t *TokenSource) metadataToken(ctx context.Context) (string, time.Duration, error) {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = metadataHost
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("no Google credentials found and the metadata server is unavailable: %w", err)
+	}
+	return decodeToken(resp)
+}
+
+// exchange posts a token request to an OAuth token endpoint
+func (t *TokenSource) exchange(ctx context.Context, tokenURL string, form url.Values) (string, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to obtain Google access token: %w", err)
+	}
+	return decodeToken(resp)
+}
+
+func decodeToken(resp *http.Response) (string, time.Duration, error) {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read Google token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("failed to obtain Google access token: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil || token.AccessToken == "" {
+		return "", 0, fmt.Errorf("invalid Google token response")
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
+
+// parsePrivateKey parses a PEM-encoded PKCS#8 or PKCS#1 RSA key
+func parsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM-encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an RSA key")
+	}
+	return key, nil
+}
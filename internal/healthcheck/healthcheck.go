@@ -0,0 +1,272 @@
+// Package healthcheck checks, step by step, that the order API can be
+// reached and authenticated with, so a broken setup is diagnosed before a
+// long run rather than by its failed orders.
+package healthcheck
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/aws"
+	"github.com/fauzanelka/99tech-order-processor/internal/httpclient"
+)
+
+// defaultDial is the time allowed to resolve and connect when
+// Options.Timeouts.Dial is not set, as for API requests
+const defaultDial = 30 * time.Second
+
+// Check is the outcome of one step of a health check
+type Check struct {
+	Name string
+	// Err is why the step failed, or nil if it passed or was skipped
+	Err error
+	// Skipped is set for steps that do not apply, or that were not run
+	// after an earlier step failed
+	Skipped bool
+	// Detail describes what the step found
+	Detail string
+}
+
+// Checker checks the API at BaseURL with the client settings of a run
+type Checker struct {
+	// BaseURL is the API URL orders are requested under, an HTTP URL even
+	// when Options.Socket is set
+	BaseURL string
+	Options httpclient.Options
+	Headers http.Header
+	SigV4   *aws.RequestSigner
+	// OrderID, if set, is a known order that must be found
+	OrderID string
+}
+
+// Run runs the steps of the check in order: dns, connect, tls, auth, and
+// lookup. A step is only run once the ones before it have passed.
+func (c *Checker) Run(ctx context.Context) []Check {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil || u.Host == "" {
+		return []Check{{Name: "dns", Err: fmt.Errorf("invalid base URL %q", c.BaseURL)}}
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	steps := []struct {
+		name string
+		run  func(context.Context) Check
+	}{
+		{"dns", func(ctx context.Context) Check { return c.resolve(ctx, u.Hostname(), addr) }},
+		{"connect", func(ctx context.Context) Check { return c.connect(ctx, addr) }},
+		{"tls", func(ctx context.Context) Check { return c.handshake(ctx, u, addr) }},
+	}
+	var checks []Check
+	for i, step := range steps {
+		check := step.run(ctx)
+		check.Name = step.name
+		checks = append(checks, check)
+		if check.Err != nil {
+			for _, rest := range steps[i+1:] {
+				checks = append(checks, notRun(rest.name))
+			}
+			return append(checks, notRun("auth"), notRun("lookup"))
+		}
+	}
+	return append(checks, c.request(ctx)...)
+}
+
+// notRun returns a step skipped after an earlier one failed
+func notRun(name string) Check {
+	return Check{Name: name, Skipped: true, Detail: "not run after an earlier failure"}
+}
+
+// resolve looks up the addresses of the API host
+func (c *Checker) resolve(ctx context.Context, host, addr string) Check {
+	switch {
+	case c.Options.Socket != "":
+		return Check{Skipped: true, Detail: "requests go over the Unix socket " + c.Options.Socket}
+	case c.Options.Resolve[addr] != "":
+		return Check{Skipped: true, Detail: fmt.Sprintf("%s is pinned to %s by --resolve", addr, c.Options.Resolve[addr])}
+	case net.ParseIP(host) != nil:
+		return Check{Skipped: true, Detail: host + " is an IP address"}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.dialTimeout())
+	defer cancel()
+	network := "ip"
+	if c.Options.IPVersion != 0 {
+		network = fmt.Sprintf("ip%d", c.Options.IPVersion)
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, host)
+	if err != nil {
+		return Check{Err: fmt.Errorf("failed to resolve %s: %w", host, err)}
+	}
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = ip.String()
+	}
+	return Check{Detail: fmt.Sprintf("%s resolved to %s", host, strings.Join(addrs, ", "))}
+}
+
+// connect opens a connection to the API, as requests do
+func (c *Checker) connect(ctx context.Context, addr string) Check {
+	start := time.Now()
+	conn, err := c.dial(ctx, addr)
+	if err != nil {
+		return Check{Err: err}
+	}
+	defer conn.Close()
+	to := conn.RemoteAddr().String()
+	if c.Options.Socket != "" {
+		to = c.Options.Socket
+	}
+	return Check{Detail: fmt.Sprintf("connected to %s in %s", to, time.Since(start).Round(10*time.Microsecond))}
+}
+
+// handshake makes a TLS handshake with the API, checking its certificate
+func (c *Checker) handshake(ctx context.Context, u *url.URL, addr string) Check {
+	if u.Scheme != "https" {
+		return Check{Skipped: true, Detail: "the API is not served over HTTPS"}
+	}
+	conn, err := c.dial(ctx, addr)
+	if err != nil {
+		return Check{Err: err}
+	}
+	defer conn.Close()
+
+	timeout := c.Options.Timeouts.TLSHandshake
+	if timeout == 0 {
+		timeout = c.dialTimeout()
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: c.Options.Insecure,
+		MinVersion:         c.Options.MinVersion,
+		CipherSuites:       c.Options.CipherSuites,
+	})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return Check{Err: fmt.Errorf("TLS handshake failed: %w", err)}
+	}
+
+	state := tlsConn.ConnectionState()
+	detail := tls.VersionName(state.Version)
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		days := int(time.Until(cert.NotAfter).Hours() / 24)
+		detail += fmt.Sprintf(", certificate for %s expires %s (%d days), issued by %s",
+			cert.Subject.CommonName, cert.NotAfter.UTC().Format("2006-01-02"), days, cert.Issuer.CommonName)
+	}
+	if c.Options.Insecure {
+		detail += ", not verified (--insecure)"
+	}
+	return Check{Detail: detail}
+}
+
+// request requests an order to check that the credentials are accepted
+// and, with OrderID, that the order is found. Without OrderID, a made-up
+// order is requested, which the API should answer with a 404.
+func (c *Checker) request(ctx context.Context) []Check {
+	orderID := c.OrderID
+	if orderID == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		orderID = "healthcheck-" + hex.EncodeToString(b)
+	}
+	target := strings.TrimRight(c.BaseURL, "/") + "/" + orderID
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return []Check{{Name: "auth", Err: fmt.Errorf("failed to create request: %w", err)}, notRun("lookup")}
+	}
+	for k, v := range c.Headers {
+		req.Header[k] = v
+	}
+	if err := c.SigV4.Sign(ctx, req, nil); err != nil {
+		return []Check{{Name: "auth", Err: fmt.Errorf("failed to sign request: %w", err)}, notRun("lookup")}
+	}
+
+	start := time.Now()
+	resp, err := httpclient.New(c.Options).Do(req)
+	if err != nil {
+		return []Check{{Name: "auth", Err: fmt.Errorf("request failed: %w", err)}, notRun("lookup")}
+	}
+	defer resp.Body.Close()
+	n, _ := io.Copy(io.Discard, resp.Body)
+	latency := time.Since(start).Round(10 * time.Microsecond)
+
+	auth := Check{Name: "auth"}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		auth.Err = fmt.Errorf("credentials rejected with HTTP %d; check --auth-token, --header, or --sigv4", resp.StatusCode)
+	case resp.StatusCode >= 500:
+		auth.Err = fmt.Errorf("API responded HTTP %d", resp.StatusCode)
+	default:
+		auth.Detail = fmt.Sprintf("credentials accepted (HTTP %d)", resp.StatusCode)
+	}
+	if auth.Err != nil {
+		return []Check{auth, notRun("lookup")}
+	}
+
+	lookup := Check{Name: "lookup"}
+	switch {
+	case c.OrderID == "":
+		lookup.Skipped = true
+		lookup.Detail = "no known order given (--order)"
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			auth.Detail += fmt.Sprintf("; note that the made-up order %s was found", orderID)
+		}
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		lookup.Detail = fmt.Sprintf("order %s found: HTTP %d, %d bytes in %s", orderID, resp.StatusCode, n, latency)
+	case resp.StatusCode == http.StatusNotFound:
+		lookup.Err = fmt.Errorf("order %s not found (HTTP 404); check --url", orderID)
+	default:
+		lookup.Err = fmt.Errorf("order %s: API responded HTTP %d", orderID, resp.StatusCode)
+	}
+	return []Check{auth, lookup}
+}
+
+// dial connects to the API as requests do, honouring Socket, Resolve, and
+// IPVersion
+func (c *Checker) dial(ctx context.Context, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: c.dialTimeout()}
+	if c.Options.Socket != "" {
+		conn, err := dialer.DialContext(ctx, "unix", c.Options.Socket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to %s: %w", c.Options.Socket, err)
+		}
+		return conn, nil
+	}
+	if to, ok := c.Options.Resolve[addr]; ok {
+		addr = to
+	}
+	network := "tcp"
+	if c.Options.IPVersion != 0 {
+		network = fmt.Sprintf("tcp%d", c.Options.IPVersion)
+	}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	return conn, nil
+}
+
+// dialTimeout returns the time allowed to resolve and connect
+func (c *Checker) dialTimeout() time.Duration {
+	if c.Options.Timeouts.Dial > 0 {
+		return c.Options.Timeouts.Dial
+	}
+	return defaultDial
+}
@@ -0,0 +1,134 @@
+// Package histogram summarizes durations, such as request latencies, in
+// fixed memory. Durations are counted in logarithmic buckets of whole
+// microseconds, sixteen per power of two, so quantiles are accurate to
+// within about 3% however many durations are recorded.
+package histogram
+
+import (
+	"fmt"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+const (
+	// subBits is the number of bits of precision kept below the highest
+	// set bit of a duration
+	subBits  = 4
+	subCount = 1 << subBits
+	// buckets covers durations up to 2^63 microseconds
+	buckets = subCount + (64-subBits)*subCount
+)
+
+// Histogram counts durations. All methods are safe for concurrent use and
+// safe to call on a nil receiver, which records nothing.
+type Histogram struct {
+	mu     sync.Mutex
+	counts [buckets]uint64
+	count  uint64
+	max    time.Duration
+}
+
+// New creates an empty histogram
+func New() *Histogram {
+	return &Histogram{}
+}
+
+// Observe records a duration
+func (h *Histogram) Observe(d time.Duration) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[bucket(d)]++
+	h.count++
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// Count returns the number of durations recorded
+func (h *Histogram) Count() uint64 {
+	if h == nil {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// Max returns the longest duration recorded
+func (h *Histogram) Max() time.Duration {
+	if h == nil {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.max
+}
+
+// Quantile returns the duration below which a fraction q of the recorded
+// durations fall, such as 0.99 for the 99th percentile, or 0 if none have
+// been recorded
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h == nil {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(q*float64(h.count) + 0.5)
+	rank = max(rank, 1)
+	var seen uint64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			return min(value(i), h.max)
+		}
+	}
+	return h.max
+}
+
+// Summary formats the count and the 50th, 90th, and 99th percentiles and
+// maximum of the recorded durations
+func (h *Histogram) Summary() string {
+	return fmt.Sprintf("%d requests, p50 %s, p90 %s, p99 %s, max %s",
+		h.Count(), round(h.Quantile(0.5)), round(h.Quantile(0.9)), round(h.Quantile(0.99)), round(h.Max()))
+}
+
+// bucket returns the bucket of a duration
+func bucket(d time.Duration) int {
+	us := uint64(max(d.Microseconds(), 0))
+	if us < subCount {
+		return int(us)
+	}
+	exp := bits.Len64(us) - 1 - subBits
+	sub := (us >> exp) & (subCount - 1)
+	return subCount + exp*subCount + int(sub)
+}
+
+// value returns the duration in the middle of a bucket
+func value(i int) time.Duration {
+	if i < subCount {
+		return time.Duration(i) * time.Microsecond
+	}
+	exp := (i - subCount) / subCount
+	sub := uint64((i-subCount)%subCount) + subCount
+	low := sub << exp
+	width := uint64(1) << exp
+	return time.Duration(low+width/2) * time.Microsecond
+}
+
+// round rounds a duration for display to a tenth of its unit, such as
+// 12.3ms
+func round(d time.Duration) time.Duration {
+	for _, unit := range []time.Duration{time.Second, time.Millisecond, time.Microsecond} {
+		if d >= unit {
+			return d.Round(unit / 10)
+		}
+	}
+	return d
+}
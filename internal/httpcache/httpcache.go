@@ -0,0 +1,112 @@
+// Package httpcache keeps API responses on disk so that later runs can make
+// conditional requests and reuse the cached body when it has not changed.
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/atomicfile"
+)
+
+// Entry is a cached response
+type Entry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	StatusCode   int       `json:"status_code"`
+	Body         []byte    `json:"body"`
+	Stored       time.Time `json:"stored"`
+}
+
+// Cache is a directory of cached responses, one file per URL. All methods
+// are safe for concurrent use and safe to call on a nil receiver, which
+// caches nothing.
+type Cache struct {
+	dir string
+}
+
+// Open opens the cache in dir, creating the directory if needed
+func Open(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// path returns the file caching url
+func (c *Cache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Get returns the cached response for url, or nil if there is none
+func (c *Cache) Get(url string) (*Entry, error) {
+	if c == nil {
+		return nil, nil
+	}
+	data, err := os.ReadFile(c.path(url))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("invalid cache entry for %s: %w", url, err)
+	}
+	// A hash collision would otherwise return another URL's response
+	if e.URL != url {
+		return nil, nil
+	}
+	return &e, nil
+}
+
+// SetConditional adds the validators of a cached response to req, so the
+// server can answer 304 Not Modified if it has not changed
+func SetConditional(req *http.Request, e *Entry) {
+	if e == nil {
+		return
+	}
+	if e.ETag != "" {
+		req.Header.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		req.Header.Set("If-Modified-Since", e.LastModified)
+	}
+}
+
+// Put caches a successful response to url. Responses without an ETag or
+// Last-Modified header cannot be revalidated and are not cached.
+func (c *Cache) Put(url string, resp *http.Response, body []byte) error {
+	if c == nil {
+		return nil
+	}
+	e := Entry{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		StatusCode:   resp.StatusCode,
+		Body:         body,
+		Stored:       time.Now().UTC(),
+	}
+	if e.ETag == "" && e.LastModified == "" {
+		return nil
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+	if err := atomicfile.WriteFile(c.path(url), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
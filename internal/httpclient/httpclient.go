@@ -0,0 +1,190 @@
+// Package httpclient builds the HTTP clients used to talk to the order API.
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options configures the HTTP client
+type Options struct {
+	// Timeout limits a whole request, including reading the response body,
+	// or 0 for no limit
+	Timeout time.Duration
+	// Timeouts limits the phases of a request
+	Timeouts Timeouts
+	Insecure bool
+	// MinVersion is the lowest TLS version accepted, or 0 for the Go
+	// default of TLS 1.2
+	MinVersion uint16
+	// CipherSuites restricts the TLS 1.2 cipher suites offered, or nil for
+	// the Go defaults. TLS 1.3 suites are not configurable.
+	CipherSuites []uint16
+	// Resolve maps host:port addresses to the addresses connected to
+	// instead. The URL, Host header, and TLS server name are unchanged.
+	Resolve map[string]string
+	// Socket, if set, is the path of a Unix domain socket every request
+	// is sent over, whatever the host of its URL
+	Socket string
+	// IPVersion, if 4 or 6, connects over that IP version only, rather than
+	// trying both
+	IPVersion int
+}
+
+// Timeouts limits the phases of a request separately from Options.Timeout.
+// A zero timeout is not limited, except for Dial, which defaults to 30
+// seconds.
+type Timeouts struct {
+	// Dial limits connecting, including resolving the host
+	Dial time.Duration
+	// TLSHandshake limits the TLS handshake once connected
+	TLSHandshake time.Duration
+	// ResponseHeader limits waiting for the response headers once the
+	// request has been sent
+	ResponseHeader time.Duration
+}
+
+// New creates an HTTP client with the given options
+func New(opts Options) *http.Client {
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: opts.Insecure,
+			MinVersion:         opts.MinVersion,
+			CipherSuites:       opts.CipherSuites,
+		},
+		TLSHandshakeTimeout:   opts.Timeouts.TLSHandshake,
+		ResponseHeaderTimeout: opts.Timeouts.ResponseHeader,
+	}
+	dial := opts.Timeouts.Dial
+	if dial == 0 {
+		dial = 30 * time.Second
+	}
+	dialer := &net.Dialer{Timeout: dial, KeepAlive: 30 * time.Second}
+	switch {
+	case opts.Socket != "":
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", opts.Socket)
+		}
+	default:
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if to, ok := opts.Resolve[addr]; ok {
+				addr = to
+			}
+			if network == "tcp" && opts.IPVersion != 0 {
+				network = fmt.Sprintf("tcp%d", opts.IPVersion)
+			}
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+	return &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: transport,
+	}
+}
+
+// ParseResolve parses curl-style host:port:address entries, such as
+// api.example.com:443:10.1.2.3, into a map for Options.Resolve. IPv6
+// addresses are written in brackets.
+func ParseResolve(entries []string) (map[string]string, error) {
+	resolve := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		host, rest, ok := strings.Cut(entry, ":")
+		port, addr, ok2 := strings.Cut(rest, ":")
+		addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+		if !ok || !ok2 || host == "" {
+			return nil, fmt.Errorf("invalid resolve entry %q: must be host:port:address", entry)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid port in resolve entry %q", entry)
+		}
+		if net.ParseIP(addr) == nil {
+			return nil, fmt.Errorf("invalid address in resolve entry %q: must be an IP address", entry)
+		}
+		resolve[net.JoinHostPort(host, port)] = net.JoinHostPort(addr, port)
+	}
+	return resolve, nil
+}
+
+// ParseIPVersion parses an IP version of 4, 6, or auto for
+// Options.IPVersion. auto, or an empty version, returns 0.
+func ParseIPVersion(version string) (int, error) {
+	switch version {
+	case "", "auto":
+		return 0, nil
+	case "4":
+		return 4, nil
+	case "6":
+		return 6, nil
+	}
+	return 0, fmt.Errorf("unknown IP version %q: must be 4, 6, or auto", version)
+}
+
+// tlsVersions maps the names accepted by ParseTLSVersion to versions
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion parses a TLS version such as 1.3 for Options.MinVersion.
+// An empty version returns 0.
+func ParseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	v, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(version), "tls")]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q: must be 1.0, 1.1, 1.2, or 1.3", version)
+	}
+	return v, nil
+}
+
+// ParseCipherSuites parses cipher suite names, as in
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, for Options.CipherSuites. Only the
+// suites Go considers secure are accepted.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := cipherSuite(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func cipherSuite(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
+
+// SplitUnixURL splits a URL of the form unix:///path/to/api.sock:/api into
+// the socket path and an HTTP URL with the path after the colon, here
+// http://localhost/api, for Options.Socket. Other URLs are returned
+// unchanged with an empty socket path.
+func SplitUnixURL(raw string) (socket, url string, err error) {
+	rest, ok := strings.CutPrefix(raw, "unix://")
+	if !ok {
+		return "", raw, nil
+	}
+	socket, path, ok := strings.Cut(rest, ":/")
+	if !strings.HasPrefix(socket, "/") {
+		return "", "", fmt.Errorf("invalid unix URL %q: socket path must be absolute", raw)
+	}
+	if !ok {
+		return socket, "http://localhost", nil
+	}
+	return socket, "http://localhost/" + path, nil
+}
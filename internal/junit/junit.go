@@ -0,0 +1,266 @@
+// Package junit writes the outcomes of a run as a JUnit XML report, so CI
+// systems can show failed orders as failed tests and gate on them.
+package junit
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/atomicfile"
+	"github.com/fauzanelka/99tech-order-processor/internal/storage"
+)
+
+// testCase is a test case of the report
+type testCase struct {
+	XMLName   xml.Name `xml:"testcase"`
+	Name      string   `xml:"name,attr"`
+	ClassName string   `xml:"classname,attr"`
+	Failure   *result  `xml:"failure,omitempty"`
+	Error     *result  `xml:"error,omitempty"`
+	Skipped   *result  `xml:"skipped,omitempty"`
+}
+
+// result is the failure, error, or reason for skipping of a test case
+type result struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Details string `xml:",cdata"`
+}
+
+// suite is a test suite whose test cases are spooled to a temporary file
+// until the report is written, so a run of millions of orders is not held
+// in memory
+type suite struct {
+	name     string
+	spool    *os.File
+	size     int64
+	tests    int
+	failures int
+	errors   int
+	skipped  int
+}
+
+// Report collects the test cases of a run and writes them as a JUnit XML
+// report when it ends. All methods are safe for concurrent use and safe to
+// call on a nil receiver, which collects nothing.
+type Report struct {
+	path string
+
+	mu     sync.Mutex
+	suites []*suite
+}
+
+// New returns a report written to path, a local path or a remote URI, with
+// the named suites, which are written even if they have no test cases.
+// Test cases of other suites add them in the order they are first seen.
+func New(path string, suites ...string) *Report {
+	r := &Report{path: path}
+	for _, name := range suites {
+		r.suites = append(r.suites, &suite{name: name})
+	}
+	return r
+}
+
+// Path returns the path the report is written to
+func (r *Report) Path() string {
+	return r.path
+}
+
+// Pass records a test case that passed
+func (r *Report) Pass(suite, class, name string) error {
+	return r.add(suite, testCase{Name: name, ClassName: class})
+}
+
+// Fail records a test case that failed, with a message, the type of
+// failure, and details such as the record that failed
+func (r *Report) Fail(suite, class, name, kind, message, details string) error {
+	return r.add(suite, testCase{Name: name, ClassName: class, Failure: &result{Message: message, Type: kind, Details: details}})
+}
+
+// Error records a test case that could not be run to an outcome, such as a
+// run that stopped before processing its orders
+func (r *Report) Error(suite, class, name, message string) error {
+	return r.add(suite, testCase{Name: name, ClassName: class, Error: &result{Message: message}})
+}
+
+// Skip records a test case that was skipped, and why
+func (r *Report) Skip(suite, class, name, message string) error {
+	return r.add(suite, testCase{Name: name, ClassName: class, Skipped: &result{Message: message}})
+}
+
+// add spools a test case to its suite
+func (r *Report) add(name string, tc testCase) error {
+	if r == nil {
+		return nil
+	}
+	data, err := xml.MarshalIndent(tc, "    ", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode test case: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.suite(name)
+	if s.spool == nil {
+		if s.spool, err = os.CreateTemp("", "junit-*.xml"); err != nil {
+			return fmt.Errorf("failed to create JUnit spool file: %w", err)
+		}
+	}
+	n, err := s.spool.Write(append(data, '\n'))
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write test case: %w", err)
+	}
+	s.tests++
+	switch {
+	case tc.Failure != nil:
+		s.failures++
+	case tc.Error != nil:
+		s.errors++
+	case tc.Skipped != nil:
+		s.skipped++
+	}
+	return nil
+}
+
+// suite returns the suite with a name, adding it if there is none
+func (r *Report) suite(name string) *suite {
+	for _, s := range r.suites {
+		if s.name == name {
+			return s
+		}
+	}
+	s := &suite{name: name}
+	r.suites = append(r.suites, s)
+	return s
+}
+
+// Write writes the report of the test cases recorded since the last one,
+// for a run named name that started at started, and starts the next
+// report
+func (r *Report) Write(name string, started time.Time) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !storage.IsRemote(r.path) {
+		f, err := atomicfile.Create(r.path, false)
+		if err != nil {
+			return fmt.Errorf("failed to create JUnit report: %w", err)
+		}
+		if err := r.write(f, name, started); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return err
+		}
+		if err := f.Commit(); err != nil {
+			return fmt.Errorf("failed to write JUnit report: %w", err)
+		}
+		return r.reset()
+	}
+
+	local := storage.StagingPath(r.path)
+	if err := os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+		return fmt.Errorf("failed to create JUnit report: %w", err)
+	}
+	f, err := os.Create(local)
+	if err != nil {
+		return fmt.Errorf("failed to create JUnit report: %w", err)
+	}
+	defer os.Remove(local)
+	if err := r.write(f, name, started); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	if err := storage.Upload(context.Background(), local, r.path); err != nil {
+		return fmt.Errorf("failed to upload JUnit report: %w", err)
+	}
+	return r.reset()
+}
+
+// write writes the report to w
+func (r *Report) write(w io.Writer, name string, started time.Time) error {
+	elapsed := fmt.Sprintf("%.3f", time.Since(started).Seconds())
+	var tests, failures, errors, skipped int
+	for _, s := range r.suites {
+		tests, failures, errors, skipped = tests+s.tests, failures+s.failures, errors+s.errors, skipped+s.skipped
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	fmt.Fprintf(&buf, `<testsuites name="%s" tests="%d" failures="%d" errors="%d" skipped="%d" time="%s">`+"\n",
+		escape(name), tests, failures, errors, skipped, elapsed)
+	for _, s := range r.suites {
+		fmt.Fprintf(&buf, `  <testsuite name="%s" tests="%d" failures="%d" errors="%d" skipped="%d" time="%s" timestamp="%s">`+"\n",
+			escape(s.name), s.tests, s.failures, s.errors, s.skipped, elapsed, started.UTC().Format("2006-01-02T15:04:05"))
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return fmt.Errorf("failed to write JUnit report: %w", err)
+		}
+		buf.Reset()
+		if s.spool != nil {
+			if _, err := io.Copy(w, io.NewSectionReader(s.spool, 0, s.size)); err != nil {
+				return fmt.Errorf("failed to write JUnit report: %w", err)
+			}
+		}
+		buf.WriteString("  </testsuite>\n")
+	}
+	buf.WriteString("</testsuites>\n")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	return nil
+}
+
+// reset empties the suites for the next report
+func (r *Report) reset() error {
+	for _, s := range r.suites {
+		s.size, s.tests, s.failures, s.errors, s.skipped = 0, 0, 0, 0, 0
+		if s.spool == nil {
+			continue
+		}
+		if err := s.spool.Truncate(0); err != nil {
+			return fmt.Errorf("failed to reset JUnit spool file: %w", err)
+		}
+		if _, err := s.spool.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to reset JUnit spool file: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close removes the spool files of the report
+func (r *Report) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.suites {
+		if s.spool == nil {
+			continue
+		}
+		s.spool.Close()
+		os.Remove(s.spool.Name())
+		s.spool = nil
+	}
+	return nil
+}
+
+// escape escapes s for an XML attribute
+func escape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
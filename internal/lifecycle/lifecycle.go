@@ -0,0 +1,160 @@
+// Package lifecycle tracks the state of each order through a run:
+//
+//	pending → requested → succeeded or skipped
+//	              ↓  ↑
+//	           retrying → failed or dead_lettered
+//
+// An order is pending once it matches the filters and waits for its request,
+// requested while a request for it is in flight, and retrying while it waits
+// for another attempt after a failed one. It ends succeeded, skipped, when
+// its response was mapped to being skipped, failed, or dead_lettered, when
+// its failure was kept in the retry queue for a later run. Orders resumed from a checkpoint or redelivered by a message source
+// start out retrying.
+package lifecycle
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// State is the state of an order
+type State string
+
+// States
+const (
+	Pending      State = "pending"
+	Requested    State = "requested"
+	Retrying     State = "retrying"
+	Succeeded    State = "succeeded"
+	Skipped      State = "skipped"
+	Failed       State = "failed"
+	DeadLettered State = "dead_lettered"
+)
+
+// States lists all states in lifecycle order
+var States = []State{Pending, Requested, Retrying, Succeeded, Skipped, Failed, DeadLettered}
+
+// transitions lists the states each state can move to
+var transitions = map[State][]State{
+	Pending:   {Requested},
+	Requested: {Succeeded, Skipped, Retrying, Failed, DeadLettered},
+	Retrying:  {Requested, Failed, DeadLettered},
+}
+
+// Terminal reports whether s is a final state
+func (s State) Terminal() bool {
+	return s == Succeeded || s == Skipped || s == Failed || s == DeadLettered
+}
+
+// Tracker holds the state of the orders of a run and counts the orders in
+// each state. Orders are only held until they reach a final state, after
+// which they are only counted. All methods are safe for concurrent use and
+// safe to call on a nil receiver, which tracks nothing.
+type Tracker struct {
+	mu     sync.Mutex
+	orders map[string]State
+	counts map[State]int
+}
+
+// NewTracker creates a tracker. counts, such as those saved in a
+// checkpoint, carries over the orders that reached a final state in an
+// earlier part of the run; other states are ignored.
+func NewTracker(counts map[State]int) *Tracker {
+	t := &Tracker{orders: make(map[string]State), counts: make(map[State]int)}
+	for s, n := range counts {
+		if s.Terminal() {
+			t.counts[s] = n
+		}
+	}
+	return t
+}
+
+// Start records an order entering the run as pending, or as retrying when
+// it was resumed or redelivered. An order ID that is still being tracked
+// starts over.
+func (t *Tracker) Start(orderID string, s State) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if prev, ok := t.orders[orderID]; ok {
+		t.counts[prev]--
+	}
+	t.orders[orderID] = s
+	t.counts[s]++
+}
+
+// Move moves an order to state to and returns the state it was in. The move
+// is recorded even if it is not a valid transition, which is reported as an
+// error, so that the counts stay consistent when an order ID repeats.
+func (t *Tracker) Move(orderID string, to State) (State, error) {
+	if t == nil {
+		return "", nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	from, ok := t.orders[orderID]
+	if ok {
+		t.counts[from]--
+	}
+	if to.Terminal() {
+		delete(t.orders, orderID)
+	} else {
+		t.orders[orderID] = to
+	}
+	t.counts[to]++
+
+	if !ok {
+		return "", fmt.Errorf("order %s is not being tracked", orderID)
+	}
+	for _, s := range transitions[from] {
+		if s == to {
+			return from, nil
+		}
+	}
+	return from, fmt.Errorf("order %s cannot move from %s to %s", orderID, from, to)
+}
+
+// Reopen moves an order that ended in final state from back to retrying,
+// such as a failed order kept in a checkpoint to be retried on resuming
+func (t *Tracker) Reopen(orderID string, from State) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.counts[from]--
+	t.orders[orderID] = Retrying
+	t.counts[Retrying]++
+}
+
+// Counts returns the number of orders in each state
+func (t *Tracker) Counts() map[State]int {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counts := make(map[State]int, len(States))
+	for _, s := range States {
+		counts[s] = t.counts[s]
+	}
+	return counts
+}
+
+// Format describes counts as "7 succeeded, 1 dead_lettered", listing the
+// states with orders in lifecycle order
+func Format(counts map[State]int) string {
+	var parts []string
+	for _, s := range States {
+		if n := counts[s]; n != 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, s))
+		}
+	}
+	if len(parts) == 0 {
+		return "no orders"
+	}
+	return strings.Join(parts, ", ")
+}
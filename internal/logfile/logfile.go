@@ -0,0 +1,52 @@
+// Package logfile provides log files that can be reopened after rotation.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// File appends to a file at a fixed path. Reopen switches to a new file at
+// the same path, so that a log rotated by renaming it is continued in a
+// fresh file. It is safe for concurrent use.
+type File struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// Open opens path for appending, creating it if needed
+func Open(path string) (*File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	return &File{path: path, file: file}, nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Write(p)
+}
+
+// Reopen closes the file and opens path again
+func (f *File) Reopen() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to reopen log file: %w", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.file.Close()
+	f.file = file
+	return nil
+}
+
+// Close closes the file
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
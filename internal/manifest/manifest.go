@@ -0,0 +1,141 @@
+// Package manifest describes a run and the files it produced with their
+// checksums and record counts, so that jobs transferring them can verify
+// they arrived intact and orchestration can decide whether to proceed.
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/atomicfile"
+	"github.com/fauzanelka/99tech-order-processor/internal/storage"
+)
+
+// Artifact kinds
+const (
+	KindOutput     = "output"
+	KindRejects    = "rejects"
+	KindRetryQueue = "retry_queue"
+	KindReview     = "review"
+	KindInput      = "input"
+)
+
+// Run statuses
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Artifact describes one file produced by a run
+type Artifact struct {
+	Kind string `json:"kind"`
+	// Path is where the file was written, a local path or a remote URI
+	Path   string `json:"path"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+	// Records is the number of lines, or nil for encrypted files
+	Records *int `json:"records,omitempty"`
+}
+
+// Counts are the outcomes of the orders of a run
+type Counts struct {
+	// Matched is the number of orders that matched the filters
+	Matched  int `json:"matched"`
+	Rejected int `json:"rejected"`
+	// States counts orders by the lifecycle state they ended in
+	States map[string]int `json:"states"`
+	// FailuresByClass and FailuresByCode count failed orders by failure
+	// class and error code
+	FailuresByClass map[string]int `json:"failures_by_class,omitempty"`
+	FailuresByCode  map[string]int `json:"failures_by_code,omitempty"`
+}
+
+// Manifest describes a run and lists its artifacts
+type Manifest struct {
+	CreatedAt time.Time `json:"created_at"`
+	RunID     string    `json:"run_id,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	// Status is StatusSucceeded or StatusFailed, with the error the run
+	// failed with
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	// Config is the settings the run was given, with secrets redacted
+	Config map[string]string `json:"config,omitempty"`
+	// Input is the input file, if it was read from a file and could be
+	// checksummed
+	Input     *Artifact  `json:"input,omitempty"`
+	Counts    Counts     `json:"counts"`
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// Describe checksums the file at local, which is recorded as path. Lines
+// are counted unless the file is encrypted.
+func Describe(kind, local, path string, encrypted bool) (Artifact, error) {
+	f, err := os.Open(local)
+	if err != nil {
+		return Artifact{}, fmt.Errorf("failed to open %s: %w", local, err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	lines := 0
+	buf := make([]byte, 64*1024)
+	var size int64
+	for {
+		n, err := f.Read(buf)
+		hash.Write(buf[:n])
+		lines += bytes.Count(buf[:n], []byte{'\n'})
+		size += int64(n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Artifact{}, fmt.Errorf("failed to read %s: %w", local, err)
+		}
+	}
+
+	a := Artifact{Kind: kind, Path: path, Bytes: size, SHA256: hex.EncodeToString(hash.Sum(nil))}
+	if !encrypted {
+		a.Records = &lines
+	}
+	return a, nil
+}
+
+// Write writes the manifest to path, a local path or a remote URI
+func (m *Manifest) Write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	data = append(data, '\n')
+
+	if !storage.IsRemote(path) {
+		if err := atomicfile.WriteFile(path, data, 0o644); err != nil {
+			return fmt.Errorf("failed to write manifest: %w", err)
+		}
+		return nil
+	}
+
+	local := storage.StagingPath(path)
+	if err := os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := os.WriteFile(local, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	defer os.Remove(local)
+	if err := storage.Upload(context.Background(), local, path); err != nil {
+		return fmt.Errorf("failed to upload manifest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Package mask anonymizes fields of output records, so that result files
+// can be shared without the personal data they carry.
+package mask
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Strategies
+const (
+	// StrategyHash replaces values with their SHA-256 hash, keyed with
+	// HMAC when a key is set. Equal values get equal hashes, so masked
+	// records can still be joined and counted.
+	StrategyHash = "hash"
+	// StrategyFixed replaces values with Fixed
+	StrategyFixed = "fixed"
+)
+
+// Fixed replaces values with the fixed strategy
+const Fixed = "***"
+
+// Masker masks the values of a set of field names, matched without regard to
+// case, at any depth. All methods are safe to call on a nil receiver, which
+// masks nothing.
+type Masker struct {
+	fields   map[string]bool
+	strategy string
+	key      []byte
+}
+
+// New creates a masker for fields with strategy, or returns nil if there are
+// no fields. key keys the hash strategy and is ignored by the fixed one.
+func New(fields []string, strategy, key string) (*Masker, error) {
+	m := &Masker{fields: make(map[string]bool), strategy: strategy, key: []byte(key)}
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			m.fields[strings.ToLower(f)] = true
+		}
+	}
+	switch strategy {
+	case StrategyHash, StrategyFixed:
+	default:
+		return nil, fmt.Errorf("unknown mask strategy %q: must be %s or %s", strategy, StrategyHash, StrategyFixed)
+	}
+	if len(m.fields) == 0 {
+		return nil, nil
+	}
+	return m, nil
+}
+
+// Map returns a copy of fields with the masked fields replaced
+func (m *Masker) Map(fields map[string]interface{}) map[string]interface{} {
+	if m == nil || fields == nil {
+		return fields
+	}
+	masked, _ := m.walk(fields)
+	return masked.(map[string]interface{})
+}
+
+// JSON returns body with the masked fields replaced. Bodies that are not
+// JSON, or have none of the fields, are returned unchanged.
+func (m *Masker) JSON(body []byte) []byte {
+	if m == nil {
+		return body
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return body
+	}
+	masked, changed := m.walk(v)
+	if !changed {
+		return body
+	}
+	out, err := json.Marshal(masked)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+// walk returns v with the masked fields of any object in it replaced, and
+// whether any were
+func (m *Masker) walk(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		changed := false
+		for k, val := range v {
+			if m.fields[strings.ToLower(k)] {
+				out[k] = m.value(val)
+				changed = true
+				continue
+			}
+			var c bool
+			out[k], c = m.walk(val)
+			changed = changed || c
+		}
+		return out, changed
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		changed := false
+		for i, val := range v {
+			var c bool
+			out[i], c = m.walk(val)
+			changed = changed || c
+		}
+		return out, changed
+	default:
+		return v, false
+	}
+}
+
+// value masks a single value. Nulls stay null, so missing values are not
+// mistaken for masked ones.
+func (m *Masker) value(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if m.strategy == StrategyFixed {
+		return Fixed
+	}
+	var text string
+	if s, ok := v.(string); ok {
+		text = s
+	} else {
+		b, _ := json.Marshal(v)
+		text = string(b)
+	}
+	if len(m.key) > 0 {
+		mac := hmac.New(sha256.New, m.key)
+		mac.Write([]byte(text))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,216 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// namespace prefixes the names of metrics pushed to a Pushgateway
+const namespace = "order_processor"
+
+// labelEscaper escapes label values for the Prometheus text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// series is a metric name and its labels, formatted as the key of a sample
+type series struct {
+	name   string
+	labels string
+}
+
+// summary is the count and sum in seconds of timings
+type summary struct {
+	count int64
+	sum   float64
+}
+
+// Pushgateway collects metrics during a run and pushes them to a Prometheus
+// Pushgateway when it ends, since batch runs end before Prometheus can
+// scrape them. Counters and timings add up over the runs of a process;
+// gauges keep their last value. All methods are safe for concurrent use and
+// safe to call on a nil receiver, which collects nothing.
+type Pushgateway struct {
+	url        string
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	counters map[series]int64
+	gauges   map[series]int64
+	timings  map[series]*summary
+}
+
+// NewPushgateway returns a Pushgateway that pushes to the group of job and
+// instance at addr. An empty instance is the hostname.
+func NewPushgateway(addr, job, instance string) (*Pushgateway, error) {
+	u, err := url.Parse(addr)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Pushgateway URL %q: want http(s)://host:port", addr)
+	}
+	if job == "" {
+		return nil, errors.New("the Pushgateway job may not be empty")
+	}
+	if instance == "" {
+		if instance, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("failed to get hostname for the Pushgateway instance: %w", err)
+		}
+	}
+	return &Pushgateway{
+		url:        strings.TrimSuffix(u.String(), "/") + "/metrics/" + groupLabel("job", job) + "/" + groupLabel("instance", instance),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		counters:   make(map[series]int64),
+		gauges:     make(map[series]int64),
+		timings:    make(map[series]*summary),
+	}, nil
+}
+
+// Incr increments a counter by one
+func (g *Pushgateway) Incr(name string, tags map[string]string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.counters[newSeries(name+"_total", tags)]++
+}
+
+// Gauge sets a gauge to value
+func (g *Pushgateway) Gauge(name string, value int64, tags map[string]string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.gauges[newSeries(name, tags)] = value
+}
+
+// Timing records a duration in a summary in seconds
+func (g *Pushgateway) Timing(name string, d time.Duration, tags map[string]string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	key := newSeries(name+"_seconds", tags)
+	s, ok := g.timings[key]
+	if !ok {
+		s = &summary{}
+		g.timings[key] = s
+	}
+	s.count++
+	s.sum += d.Seconds()
+}
+
+// Push replaces the metrics of the group with those collected, along with
+// when the run ended and whether it succeeded
+func (g *Pushgateway) Push(success bool) error {
+	if g == nil {
+		return nil
+	}
+	ok := int64(0)
+	if success {
+		ok = 1
+	}
+	g.Gauge("last_run_timestamp_seconds", time.Now().Unix(), nil)
+	g.Gauge("last_run_success", ok, nil)
+
+	req, err := http.NewRequest(http.MethodPut, g.url, bytes.NewReader(g.format()))
+	if err != nil {
+		return fmt.Errorf("failed to create Pushgateway request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("the Pushgateway returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// format writes the metrics in the Prometheus text format, sorted by name
+func (g *Pushgateway) format() []byte {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	samples := make(map[string][]string)
+	types := make(map[string]string)
+	add := func(kind string, s series, suffix, value string) {
+		types[s.name] = kind
+		samples[s.name] = append(samples[s.name], s.name+suffix+s.labels+" "+value)
+	}
+	for s, v := range g.counters {
+		add("counter", s, "", strconv.FormatInt(v, 10))
+	}
+	for s, v := range g.gauges {
+		add("gauge", s, "", strconv.FormatInt(v, 10))
+	}
+	for s, v := range g.timings {
+		add("summary", s, "_sum", strconv.FormatFloat(v.sum, 'g', -1, 64))
+		add("summary", s, "_count", strconv.FormatInt(v.count, 10))
+	}
+
+	names := make([]string, 0, len(samples))
+	for name := range samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", name, types[name])
+		lines := samples[name]
+		sort.Strings(lines)
+		for _, line := range lines {
+			buf.WriteString(line + "\n")
+		}
+	}
+	return buf.Bytes()
+}
+
+// groupLabel formats a label of the grouping key in a Pushgateway URL, in
+// base64 if the value has a slash
+func groupLabel(name, value string) string {
+	if strings.Contains(value, "/") {
+		return name + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return name + "/" + url.PathEscape(value)
+}
+
+// newSeries returns the Prometheus series of a metric, such as
+// order_processor_orders_failed_total{class="4xx"} for orders.failed
+func newSeries(name string, tags map[string]string) series {
+	s := series{name: promName(namespace + "_" + name)}
+	if len(tags) == 0 {
+		return s
+	}
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, promName(k)+`="`+labelEscaper.Replace(v)+`"`)
+	}
+	sort.Strings(pairs)
+	s.labels = "{" + strings.Join(pairs, ",") + "}"
+	return s
+}
+
+// promName replaces the characters Prometheus names may not have, such as
+// the dots of StatsD names, with underscores
+func promName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, s)
+}
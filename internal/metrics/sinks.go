@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"time"
+)
+
+// Sinks sends metrics to each system that is set. All methods are safe to
+// call on a nil receiver, which disables emission.
+type Sinks struct {
+	StatsD      *StatsD
+	Pushgateway *Pushgateway
+}
+
+// Incr increments a counter by one
+func (s *Sinks) Incr(name string, tags map[string]string) {
+	if s == nil {
+		return
+	}
+	s.StatsD.Incr(name, tags)
+	s.Pushgateway.Incr(name, tags)
+}
+
+// Gauge sets a gauge to value
+func (s *Sinks) Gauge(name string, value int64, tags map[string]string) {
+	if s == nil {
+		return
+	}
+	s.StatsD.Gauge(name, value, tags)
+	s.Pushgateway.Gauge(name, value, tags)
+}
+
+// Timing records a duration
+func (s *Sinks) Timing(name string, d time.Duration, tags map[string]string) {
+	if s == nil {
+		return
+	}
+	s.StatsD.Timing(name, d, tags)
+	s.Pushgateway.Timing(name, d, tags)
+}
+
+// Push pushes the metrics of a run that has ended to the Pushgateway, if
+// there is one
+func (s *Sinks) Push(success bool) error {
+	if s == nil {
+		return nil
+	}
+	return s.Pushgateway.Push(success)
+}
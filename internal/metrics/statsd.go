@@ -0,0 +1,73 @@
+// Package metrics emits run metrics to external monitoring systems.
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StatsD sends counters, gauges, and timings to a StatsD or DogStatsD agent over UDP.
+// All methods are safe to call on a nil receiver, which disables emission.
+type StatsD struct {
+	conn   net.Conn
+	prefix string
+	tags   bool
+}
+
+// NewStatsD connects to the agent at addr. When dogstatsd is true, metric
+// tags are sent using the DogStatsD extension.
+func NewStatsD(addr, prefix string, dogstatsd bool) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to statsd at %s: %w", addr, err)
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return &StatsD{conn: conn, prefix: prefix, tags: dogstatsd}, nil
+}
+
+// Incr increments a counter by one
+func (s *StatsD) Incr(name string, tags map[string]string) {
+	s.send(name, "1|c", tags)
+}
+
+// Gauge sets a gauge to value
+func (s *StatsD) Gauge(name string, value int64, tags map[string]string) {
+	s.send(name, fmt.Sprintf("%d|g", value), tags)
+}
+
+// Timing records a duration in milliseconds
+func (s *StatsD) Timing(name string, d time.Duration, tags map[string]string) {
+	s.send(name, fmt.Sprintf("%d|ms", d.Milliseconds()), tags)
+}
+
+// Close closes the underlying connection
+func (s *StatsD) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// send writes a single metric line; delivery errors are ignored as UDP
+// metrics are best-effort
+func (s *StatsD) send(name, value string, tags map[string]string) {
+	if s == nil {
+		return
+	}
+
+	line := s.prefix + name + ":" + value
+	if s.tags && len(tags) > 0 {
+		pairs := make([]string, 0, len(tags))
+		for k, v := range tags {
+			pairs = append(pairs, k+":"+v)
+		}
+		sort.Strings(pairs)
+		line += "|#" + strings.Join(pairs, ",")
+	}
+	s.conn.Write([]byte(line))
+}
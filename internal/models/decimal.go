@@ -0,0 +1,103 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+)
+
+// maxExponent bounds the exponent a decimal is written with, far beyond any
+// price or quantity, so its exact value is cheap to compute. Go cannot
+// compute exact values for exponents much larger.
+const maxExponent = 1000
+
+var (
+	// numberPattern is the JSON number grammar
+	numberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+	// plainPattern matches decimals written without an exponent
+	plainPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?$`)
+)
+
+// Decimal is an exact decimal number that preserves the representation it
+// was read with, so prices like 123.4567891 are never rounded through a
+// float. It accepts JSON numbers as well as numeric JSON strings.
+type Decimal struct {
+	text string
+}
+
+// NewDecimal parses a decimal from its textual representation
+func NewDecimal(s string) (Decimal, error) {
+	m := numberPattern.FindStringSubmatch(s)
+	if m == nil {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	if m[3] != "" {
+		exp, err := strconv.Atoi(m[3][1:])
+		if err != nil || exp > maxExponent || exp < -maxExponent {
+			return Decimal{}, fmt.Errorf("invalid decimal %q: exponent is out of range", s)
+		}
+	}
+	return Decimal{text: s}, nil
+}
+
+// DecimalFromRat converts an exact rational to a decimal with the given
+// number of fractional digits
+func DecimalFromRat(r *big.Rat, prec int) Decimal {
+	return Decimal{text: r.FloatString(prec)}
+}
+
+// String returns the original representation of the decimal
+func (d Decimal) String() string {
+	if d.text == "" {
+		return "0"
+	}
+	return d.text
+}
+
+// Float64 returns the nearest float to the decimal, for display and
+// approximate calculations only
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// Rat returns the exact value of the decimal, or false if it has none,
+// which decimals from NewDecimal always have
+func (d Decimal) Rat() (*big.Rat, bool) {
+	return new(big.Rat).SetString(d.String())
+}
+
+// Plain reports whether the decimal was written without an exponent
+func (d Decimal) Plain() bool {
+	return plainPattern.MatchString(d.String())
+}
+
+// MarshalJSON encodes the decimal as a JSON number in its original form
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON decodes a JSON number or numeric string without rounding
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*d = Decimal{}
+		return nil
+	}
+
+	s := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := NewDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestNewDecimalExponent(t *testing.T) {
+	tests := []struct {
+		text string
+		want string // exact value, or empty if rejected
+	}{
+		{"150.50", "301/2"},
+		{"1.5e2", "150"},
+		{"1E-3", "1/1000"},
+		{"1e1000", "1" + strings.Repeat("0", 1000)},
+		{"1e-1000", "1/1" + strings.Repeat("0", 1000)},
+		{"1e1001", ""},
+		{"1e-1001", ""},
+		{"1e100000000", ""},
+		{"1e99999999999999999999", ""},
+	}
+	for _, tt := range tests {
+		d, err := NewDecimal(tt.text)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("NewDecimal(%q) = %v, want an error", tt.text, d)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewDecimal(%q): %v", tt.text, err)
+			continue
+		}
+		r, ok := d.Rat()
+		if !ok {
+			t.Errorf("NewDecimal(%q).Rat() has no exact value", tt.text)
+			continue
+		}
+		if want, _ := new(big.Rat).SetString(tt.want); r.Cmp(want) != 0 {
+			t.Errorf("NewDecimal(%q).Rat() = %s, want %s", tt.text, r.RatString(), tt.want)
+		}
+	}
+}
+
+func TestOrderHugeExponent(t *testing.T) {
+	var order Order
+	err := json.Unmarshal([]byte(`{"order_id":"a1","symbol":"TSLA","side":"sell","quantity":1e100000000,"price":2}`), &order)
+	if err == nil {
+		t.Fatalf("order with a huge exponent was parsed: %+v", order)
+	}
+	if !strings.Contains(err.Error(), "exponent is out of range") {
+		t.Errorf("error = %v, want the exponent out of range", err)
+	}
+
+	if _, ok := (Decimal{text: "1e100000000"}).Rat(); ok {
+		t.Error("Rat of a huge exponent reported an exact value")
+	}
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter selects the orders to process
+type Filter struct {
+	Symbols []string
+	Sides   []string
+	Shard   Shard
+	Sample  Sample
+	// Since and Until, when set, limit orders to those timestamped at or
+	// after Since and before Until
+	Since time.Time
+	Until time.Time
+}
+
+// NewFilter creates a filter from comma-separated lists of symbols and sides
+func NewFilter(symbols, sides string) Filter {
+	return Filter{Symbols: splitList(symbols), Sides: splitList(sides)}
+}
+
+// Match reports whether an order passes the filter
+func (f Filter) Match(order Order) bool {
+	return contains(f.Symbols, order.Symbol) && contains(f.Sides, order.Side) && f.Shard.Match(order) && f.Sample.Match(order) &&
+		(f.Since.IsZero() || !order.Timestamp.Before(f.Since)) &&
+		(f.Until.IsZero() || order.Timestamp.Before(f.Until))
+}
+
+// Shard selects a deterministic slice of the orders by the hash of their
+// ID, so that independent runs can split an input between them. The zero
+// Shard selects every order.
+type Shard struct {
+	// Index is the shard number, from 1 to Count
+	Index int
+	Count int
+}
+
+// ParseShard parses a shard written as "index/count", such as "2/8". An
+// empty string is the zero Shard.
+func ParseShard(s string) (Shard, error) {
+	if s == "" {
+		return Shard{}, nil
+	}
+	indexText, countText, ok := strings.Cut(s, "/")
+	index, ierr := strconv.Atoi(indexText)
+	count, cerr := strconv.Atoi(countText)
+	if !ok || ierr != nil || cerr != nil || count < 1 || index < 1 || index > count {
+		return Shard{}, fmt.Errorf("invalid shard %q: must be index/count with 1 <= index <= count", s)
+	}
+	return Shard{Index: index, Count: count}, nil
+}
+
+// Match reports whether an order belongs to the shard
+func (s Shard) Match(order Order) bool {
+	if s.Count <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(order.OrderID))
+	return int(h.Sum32()%uint32(s.Count)) == s.Index-1
+}
+
+func (s Shard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+// Sample selects a random but reproducible percentage of the orders by the
+// hash of their ID and a seed, so that the same seed picks the same orders
+// from any input. The zero Sample selects every order.
+type Sample struct {
+	Percent float64
+	Seed    uint64
+}
+
+// sampleScale is the resolution of sample percentages
+const sampleScale = 1_000_000
+
+// ParseSample parses a sample percentage written as "5%" or "5", between 0
+// and 100. An empty string is the zero Sample.
+func ParseSample(s string, seed uint64) (Sample, error) {
+	if s == "" {
+		return Sample{}, nil
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || percent <= 0 || percent > 100 {
+		return Sample{}, fmt.Errorf("invalid sample %q: must be a percentage above 0 and at most 100, such as 5%%", s)
+	}
+	return Sample{Percent: percent, Seed: seed}, nil
+}
+
+// Match reports whether an order is in the sample
+func (s Sample) Match(order Order) bool {
+	if s.Percent <= 0 || s.Percent >= 100 {
+		return true
+	}
+	h := fnv.New64a()
+	binary.Write(h, binary.BigEndian, s.Seed)
+	h.Write([]byte(order.OrderID))
+	return float64(h.Sum64()%sampleScale) < s.Percent*sampleScale/100
+}
+
+func (s Sample) String() string {
+	return strconv.FormatFloat(s.Percent, 'f', -1, 64) + "%"
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -1,13 +1,181 @@
 package models
 
-import "time"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
 
 // Order represents a trading order from the input file
 type Order struct {
 	OrderID   string    `json:"order_id"`
 	Symbol    string    `json:"symbol"`
-	Quantity  float64   `json:"quantity"`
-	Price     float64   `json:"price"`
+	Quantity  Decimal   `json:"quantity"`
+	Price     Decimal   `json:"price"`
 	Side      string    `json:"side"`
 	Timestamp time.Time `json:"timestamp"`
-} 
\ No newline at end of file
+
+	// Extra holds input fields that are not part of the order schema, such
+	// as venue or account, so they can be carried through to the output.
+	// JSON numbers are kept as json.Number.
+	Extra map[string]interface{} `json:"-"`
+
+	// Line is the line of the input the order was read from, for formats
+	// with a record per line, or zero
+	Line int `json:"-"`
+}
+
+// orderFields are the JSON names of the Order schema fields
+var orderFields = map[string]bool{
+	"order_id":  true,
+	"symbol":    true,
+	"quantity":  true,
+	"price":     true,
+	"side":      true,
+	"timestamp": true,
+}
+
+// IsOrderField reports whether name is the JSON name of an Order field
+func IsOrderField(name string) bool {
+	return orderFields[name]
+}
+
+// UnmarshalJSON decodes an order, accepting any timestamp format listed in
+// TimestampFormats. Timestamps may be JSON strings or numbers. Fields outside
+// the order schema are collected in Extra.
+func (o *Order) UnmarshalJSON(data []byte) error {
+	type plain Order
+	aux := struct {
+		*plain
+		Timestamp json.RawMessage `json:"timestamp"`
+	}{plain: (*plain)(o)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	if err := o.unmarshalExtra(data); err != nil {
+		return err
+	}
+
+	o.Timestamp = time.Time{}
+	raw := strings.TrimSpace(string(aux.Timestamp))
+	if raw == "" || raw == "null" {
+		return nil
+	}
+	if strings.HasPrefix(raw, `"`) {
+		if err := json.Unmarshal(aux.Timestamp, &raw); err != nil {
+			return err
+		}
+	}
+
+	t, err := ParseTimestamp(raw)
+	if err != nil {
+		return err
+	}
+	o.Timestamp = t
+	return nil
+}
+
+// unmarshalExtra collects the fields of data that are not order fields
+func (o *Order) unmarshalExtra(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	o.Extra = nil
+	for name, raw := range fields {
+		if orderFields[name] {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		if o.Extra == nil {
+			o.Extra = make(map[string]interface{})
+		}
+		o.Extra[name] = v
+	}
+	return nil
+}
+
+// MarshalJSON encodes an order, including any extra fields after the schema
+// fields
+func (o Order) MarshalJSON() ([]byte, error) {
+	type plain Order
+	data, err := json.Marshal(plain(o))
+	if err != nil || len(o.Extra) == 0 {
+		return data, err
+	}
+
+	names := make([]string, 0, len(o.Extra))
+	for name := range o.Extra {
+		if !orderFields[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.Write(data[:len(data)-1])
+	for _, name := range names {
+		key, _ := json.Marshal(name)
+		value, err := json.Marshal(o.Extra[name])
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(',')
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Notional returns the exact quantity times price of the order, or false if
+// either has no exact value
+func (o Order) Notional() (*big.Rat, bool) {
+	qty, ok := o.Quantity.Rat()
+	if !ok {
+		return nil, false
+	}
+	price, ok := o.Price.Rat()
+	if !ok {
+		return nil, false
+	}
+	return new(big.Rat).Mul(qty, price), true
+}
+
+// Field returns the value of the named order or extra field as a string
+func (o Order) Field(name string) (string, bool) {
+	switch name {
+	case "order_id":
+		return o.OrderID, true
+	case "symbol":
+		return o.Symbol, true
+	case "quantity":
+		return o.Quantity.String(), true
+	case "price":
+		return o.Price.String(), true
+	case "side":
+		return o.Side, true
+	case "timestamp":
+		return o.Timestamp.Format(time.RFC3339Nano), true
+	}
+	v, ok := o.Extra[name]
+	if !ok || v == nil {
+		return "", false
+	}
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+	return fmt.Sprint(v), true
+}
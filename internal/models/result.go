@@ -0,0 +1,46 @@
+package models
+
+import "encoding/json"
+
+// Result is the enveloped output record written for a processed order.
+// RunID and RequestID identify the run and the API request it came from.
+type Result struct {
+	OrderID    string                 `json:"order_id"`
+	Symbol     string                 `json:"symbol"`
+	Side       string                 `json:"side"`
+	StatusCode int                    `json:"status_code"`
+	Response   json.RawMessage        `json:"response"`
+	Extra      map[string]interface{} `json:"extra,omitempty"`
+	RunID      string                 `json:"run_id,omitempty"`
+	RequestID  string                 `json:"request_id,omitempty"`
+}
+
+// NewResult wraps an API response body for the given order. Bodies that are
+// not valid JSON are embedded as JSON strings.
+func NewResult(order Order, statusCode int, body []byte) Result {
+	response := json.RawMessage(body)
+	if !json.Valid(body) {
+		response, _ = json.Marshal(string(body))
+	}
+	return Result{
+		OrderID:    order.OrderID,
+		Symbol:     order.Symbol,
+		Side:       order.Side,
+		StatusCode: statusCode,
+		Response:   response,
+		Extra:      order.Extra,
+	}
+}
+
+// Failure describes an order that could not be processed after all retries.
+// Class is the kind of failure, such as network, timeout, 5xx or 4xx, Code
+// is a stable code finer than its class, such as E_HTTP_AUTH, and
+// RequestID is the ID its requests were sent with.
+type Failure struct {
+	Order     Order  `json:"order"`
+	RequestID string `json:"request_id,omitempty"`
+	Error     string `json:"error"`
+	Class     string `json:"class,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Attempts  int    `json:"attempts"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Special timestamp formats accepted alongside Go time layouts
+const (
+	FormatRFC3339 = "rfc3339"
+	FormatEpochMs = "epoch_ms"
+	FormatEpochS  = "epoch_s"
+)
+
+// TimestampFormats are tried in order when parsing order timestamps. Each
+// entry is either one of the special formats above or a Go time layout;
+// layouts without a zone are interpreted as UTC.
+var TimestampFormats = []string{FormatRFC3339, "2006-01-02 15:04:05", FormatEpochMs}
+
+// ParseTimestamp parses a timestamp using the first matching format in
+// TimestampFormats. RFC 3339 is always accepted as a last resort since it is
+// the format orders are written back out in.
+func ParseTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, format := range TimestampFormats {
+		if t, ok := parseWith(format, s); ok {
+			return t, nil
+		}
+	}
+	if t, ok := parseWith(FormatRFC3339, s); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("timestamp %q does not match any of the formats %s", s, strings.Join(TimestampFormats, ", "))
+}
+
+// parseWith parses s using a single format
+func parseWith(format, s string) (time.Time, bool) {
+	switch format {
+	case FormatRFC3339:
+		t, err := time.Parse(time.RFC3339Nano, s)
+		return t, err == nil
+	case FormatEpochMs, FormatEpochS:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		t := time.Unix(n, 0).UTC()
+		if format == FormatEpochMs {
+			t = time.UnixMilli(n).UTC()
+		}
+		return t, t.Year() >= 0 && t.Year() <= 9999
+	default:
+		t, err := time.Parse(format, s)
+		return t, err == nil
+	}
+}
@@ -0,0 +1,59 @@
+package orderfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/avro"
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// avroReader reads orders from the records of an Avro container file. Record
+// fields are matched by name like JSON fields, and records are numbered from
+// 1 in parse errors.
+type avroReader struct {
+	r      *avro.Reader
+	record int
+	opts   Options
+}
+
+func newAvroReader(r io.Reader, opts Options) (*avroReader, error) {
+	ar, err := avro.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &avroReader{r: ar, opts: opts}, nil
+}
+
+func (r *avroReader) Read() (models.Order, error) {
+	value, err := r.r.Next()
+	if err == io.EOF {
+		return models.Order{}, io.EOF
+	}
+	if err != nil {
+		return models.Order{}, fmt.Errorf("error reading input: %w", err)
+	}
+	r.record++
+
+	record, ok := value.(map[string]interface{})
+	if !ok {
+		return models.Order{}, &ParseError{Line: r.record, Err: fmt.Errorf("Avro value is not a record")}
+	}
+	// Null fields count as missing
+	for name, v := range record {
+		if v == nil {
+			delete(record, name)
+		}
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return models.Order{}, &ParseError{Line: r.record, Err: err}
+	}
+	order, err := Decode(line, r.opts)
+	if err != nil {
+		return models.Order{}, &ParseError{Line: r.record, Raw: string(line), Err: err}
+	}
+	return order, nil
+}
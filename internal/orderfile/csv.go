@@ -0,0 +1,224 @@
+package orderfile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// csvColumns are the CSV header names, matching the JSON field names
+var csvColumns = []string{"order_id", "symbol", "quantity", "price", "side", "timestamp"}
+
+// csvReader reads orders from CSV with a header row. Columns are matched by
+// name, so their order does not matter. Unknown columns become extra fields.
+type csvReader struct {
+	r       *csv.Reader
+	columns columns
+	opts    Options
+}
+
+func newCSVReader(r io.Reader, opts Options) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return &csvReader{r: cr}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	return &csvReader{r: cr, columns: newColumns(header, opts.FieldMapping), opts: opts}, nil
+}
+
+func (r *csvReader) Read() (models.Order, error) {
+	if r.columns == nil {
+		return models.Order{}, io.EOF
+	}
+
+	record, err := r.r.Read()
+	if err == io.EOF {
+		return models.Order{}, io.EOF
+	}
+	if err != nil {
+		if perr, ok := err.(*csv.ParseError); ok {
+			return models.Order{}, &ParseError{Line: perr.Line, Raw: strings.Join(record, ","), Err: perr.Err}
+		}
+		return models.Order{}, fmt.Errorf("error reading input: %w", err)
+	}
+	line, _ := r.r.FieldPos(0)
+
+	if r.opts.Validate != nil {
+		if err := r.opts.Validate(r.columns.record(record)); err != nil {
+			return models.Order{}, &ParseError{Line: line, Raw: strings.Join(record, ","), Err: err}
+		}
+	}
+
+	order, err := r.columns.decode(record)
+	if err != nil {
+		return models.Order{}, &ParseError{Line: line, Raw: strings.Join(record, ","), Err: err}
+	}
+	order.Line = line
+	return order, nil
+}
+
+// numericColumns are the Order fields that are JSON numbers
+var numericColumns = map[string]bool{"quantity": true, "price": true}
+
+// columns maps order field names to the index of the column holding them in
+// tabular input
+type columns map[string]int
+
+// newColumns matches header names to order fields, case-insensitively and
+// after field mapping. Mapped columns take precedence over columns already
+// using the target name.
+func newColumns(header []string, mapping map[string]string) columns {
+	c := make(columns, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if _, ok := mapping[name]; !ok {
+			c[strings.ToLower(name)] = i
+		}
+	}
+	for i, name := range header {
+		if target, ok := mapping[strings.TrimSpace(name)]; ok {
+			c[target] = i
+		}
+	}
+	return c
+}
+
+// record converts a tabular record to a generic JSON object for validation,
+// typed as the equivalent JSON order would be. Empty cells are omitted.
+func (c columns) record(record []string) map[string]interface{} {
+	obj := make(map[string]interface{}, len(c))
+	for name, i := range c {
+		if i >= len(record) {
+			continue
+		}
+		v := strings.TrimSpace(record[i])
+		switch {
+		case v == "":
+		case numericColumns[name] && isNumber(v):
+			obj[name] = json.Number(v)
+		default:
+			obj[name] = v
+		}
+	}
+	return obj
+}
+
+// isNumber reports whether a cell is a JSON number
+func isNumber(v string) bool {
+	_, err := models.NewDecimal(v)
+	return err == nil
+}
+
+// decode converts a tabular record to an order
+func (c columns) decode(record []string) (models.Order, error) {
+	field := func(name string) string {
+		if i, ok := c[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	order := models.Order{
+		OrderID: field("order_id"),
+		Symbol:  field("symbol"),
+		Side:    field("side"),
+	}
+
+	// Columns outside the order schema are kept as extra string fields
+	for name, i := range c {
+		if models.IsOrderField(name) || i >= len(record) {
+			continue
+		}
+		if v := strings.TrimSpace(record[i]); v != "" {
+			if order.Extra == nil {
+				order.Extra = make(map[string]interface{})
+			}
+			order.Extra[name] = v
+		}
+	}
+
+	var err error
+	if v := field("quantity"); v != "" {
+		if order.Quantity, err = models.NewDecimal(v); err != nil {
+			return order, fmt.Errorf("invalid quantity %q", v)
+		}
+	}
+	if v := field("price"); v != "" {
+		if order.Price, err = models.NewDecimal(v); err != nil {
+			return order, fmt.Errorf("invalid price %q", v)
+		}
+	}
+	if v := field("timestamp"); v != "" {
+		if order.Timestamp, err = models.ParseTimestamp(v); err != nil {
+			return order, err
+		}
+	}
+	return order, nil
+}
+
+// csvWriter writes orders as CSV with a header row. Extra fields follow the
+// order columns, sorted by name. Orders are held until the first Flush so
+// the header covers the extra fields of all of them; extra fields first seen
+// after that are dropped.
+type csvWriter struct {
+	w             *csv.Writer
+	spool         spool
+	extra         []string
+	headerWritten bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (w *csvWriter) Write(order models.Order) error {
+	if !w.headerWritten {
+		return w.spool.add(order)
+	}
+	return w.write(order)
+}
+
+func (w *csvWriter) write(order models.Order) error {
+	record := []string{
+		order.OrderID,
+		order.Symbol,
+		order.Quantity.String(),
+		order.Price.String(),
+		order.Side,
+		order.Timestamp.Format(time.RFC3339Nano),
+	}
+	for _, name := range w.extra {
+		record = append(record, extraValue(order.Extra[name]))
+	}
+	if err := w.w.Write(record); err != nil {
+		return fmt.Errorf("failed to write order %s: %w", order.OrderID, err)
+	}
+	return nil
+}
+
+func (w *csvWriter) Flush() error {
+	if !w.headerWritten {
+		w.extra = w.spool.extraColumns()
+		header := append(append([]string{}, csvColumns...), w.extra...)
+		if err := w.w.Write(header); err != nil {
+			return fmt.Errorf("failed to write CSV header: %w", err)
+		}
+		w.headerWritten = true
+		if err := w.spool.each(w.write); err != nil {
+			return err
+		}
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
@@ -0,0 +1,145 @@
+package orderfile
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// fixTags maps the tags of an execution report to order fields. The field
+// mapping, keyed by tag number, can add tags or replace the tag read for a
+// field.
+var fixTags = map[string]string{
+	"11": "order_id",  // ClOrdID
+	"55": "symbol",    // Symbol
+	"38": "quantity",  // OrderQty
+	"44": "price",     // Price
+	"54": "side",      // Side
+	"60": "timestamp", // TransactTime
+}
+
+// fixSides maps FIX Side codes to order sides; short sales are sells
+var fixSides = map[string]string{
+	"1": "buy",
+	"2": "sell",
+	"3": "buy",  // Buy minus
+	"4": "sell", // Sell plus
+	"5": "sell", // Sell short
+	"6": "sell", // Sell short exempt
+}
+
+// fixTimeLayouts are the FIX UTCTimestamp formats
+var fixTimeLayouts = []string{
+	"20060102-15:04:05.999999999",
+	"20060102-15:04:05",
+}
+
+// fixReader reads orders from the execution reports (35=8) in a FIX message
+// log. Each line holds at most one message, which starts at its 8=FIX tag so
+// log prefixes are ignored; fields are separated by SOH or |. Other message
+// types and lines without a message are skipped.
+type fixReader struct {
+	scanner *bufio.Scanner
+	lineNum int
+	tags    map[string]string
+	opts    Options
+}
+
+func newFIXReader(r io.Reader, opts Options) *fixReader {
+	tags := make(map[string]string, len(fixTags)+len(opts.FieldMapping))
+	for tag, field := range fixTags {
+		tags[tag] = field
+	}
+	for _, field := range opts.FieldMapping {
+		for t, f := range fixTags {
+			if f == field {
+				delete(tags, t)
+			}
+		}
+	}
+	for tag, field := range opts.FieldMapping {
+		tags[tag] = field
+	}
+	return &fixReader{scanner: bufio.NewScanner(r), tags: tags, opts: opts}
+}
+
+func (r *fixReader) Read() (models.Order, error) {
+	for r.scanner.Scan() {
+		r.lineNum++
+		line := r.scanner.Text()
+
+		start := strings.Index(line, "8=FIX")
+		if start < 0 {
+			continue
+		}
+		msg := line[start:]
+		sep := "\x01"
+		if !strings.Contains(msg, sep) {
+			sep = "|"
+		}
+
+		// Repeating groups reuse tags, so the first occurrence wins
+		fields := make(map[string]string)
+		for _, field := range strings.Split(msg, sep) {
+			tag, value, ok := strings.Cut(field, "=")
+			if _, seen := fields[tag]; ok && !seen {
+				fields[tag] = value
+			}
+		}
+		if fields["35"] != "8" {
+			continue
+		}
+
+		order, err := r.decode(fields)
+		if err != nil {
+			return models.Order{}, &ParseError{Line: r.lineNum, Raw: line, Err: err}
+		}
+		order.Line = r.lineNum
+		return order, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return models.Order{}, fmt.Errorf("error reading input: %w", err)
+	}
+	return models.Order{}, io.EOF
+}
+
+// decode converts the mapped tags of a message to an order
+func (r *fixReader) decode(fields map[string]string) (models.Order, error) {
+	record := make(map[string]interface{}, len(r.tags))
+	for tag, name := range r.tags {
+		v, ok := fields[tag]
+		if !ok || v == "" {
+			continue
+		}
+		switch {
+		case tag == "54":
+			if side, ok := fixSides[v]; ok {
+				v = side
+			}
+		case name == "timestamp":
+			for _, layout := range fixTimeLayouts {
+				if t, err := time.Parse(layout, v); err == nil {
+					v = t.Format(time.RFC3339Nano)
+					break
+				}
+			}
+		}
+		if numericColumns[name] && isNumber(v) {
+			record[name] = json.Number(v)
+		} else {
+			record[name] = v
+		}
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return models.Order{}, err
+	}
+	return Decode(data, Options{Validate: r.opts.Validate})
+}
@@ -0,0 +1,120 @@
+package orderfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// jsonlReader reads one JSON order per line
+type jsonlReader struct {
+	scanner *bufio.Scanner
+	lineNum int
+	opts    Options
+}
+
+func newJSONLReader(r io.Reader, opts Options) *jsonlReader {
+	return &jsonlReader{scanner: bufio.NewScanner(r), opts: opts}
+}
+
+func (r *jsonlReader) Read() (models.Order, error) {
+	for r.scanner.Scan() {
+		r.lineNum++
+		line := r.scanner.Text()
+
+		// Skip empty lines
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		order, err := Decode([]byte(line), r.opts)
+		if err != nil {
+			return models.Order{}, &ParseError{Line: r.lineNum, Raw: line, Err: err}
+		}
+		order.Line = r.lineNum
+		return order, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return models.Order{}, fmt.Errorf("error reading input: %w", err)
+	}
+	return models.Order{}, io.EOF
+}
+
+// Decode unmarshals a JSON record into an order, renaming mapped fields and
+// validating the record first
+func Decode(line []byte, opts Options) (models.Order, error) {
+	var order models.Order
+	if len(opts.FieldMapping) > 0 {
+		var err error
+		if line, err = mapFields(line, opts.FieldMapping); err != nil {
+			return order, err
+		}
+	}
+
+	if opts.Validate != nil {
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		var record interface{}
+		if err := dec.Decode(&record); err != nil {
+			return order, err
+		}
+		if err := opts.Validate(record); err != nil {
+			return order, err
+		}
+	}
+
+	err := json.Unmarshal(line, &order)
+	return order, err
+}
+
+// mapFields renames the mapped fields of a JSON object
+func mapFields(line []byte, mapping map[string]string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return nil, err
+	}
+	mapped := make(map[string]json.RawMessage, len(fields))
+	for name, value := range fields {
+		if _, ok := mapping[name]; ok {
+			continue
+		}
+		mapped[name] = value
+	}
+	// Mapped fields take precedence over fields already using the target name
+	for name, value := range fields {
+		if target, ok := mapping[name]; ok {
+			mapped[target] = value
+		}
+	}
+	return json.Marshal(mapped)
+}
+
+// jsonlWriter writes one JSON order per line
+type jsonlWriter struct {
+	w *bufio.Writer
+}
+
+func newJSONLWriter(w io.Writer) *jsonlWriter {
+	return &jsonlWriter{w: bufio.NewWriter(w)}
+}
+
+func (w *jsonlWriter) Write(order models.Order) error {
+	line, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("failed to encode order %s: %w", order.OrderID, err)
+	}
+	if _, err := w.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write order %s: %w", order.OrderID, err)
+	}
+	return nil
+}
+
+func (w *jsonlWriter) Flush() error {
+	return w.w.Flush()
+}
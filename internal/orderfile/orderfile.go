@@ -0,0 +1,162 @@
+// Package orderfile reads and writes orders in the supported file formats.
+package orderfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// Supported formats
+const (
+	JSONL   = "jsonl"
+	CSV     = "csv"
+	Parquet = "parquet"
+	Avro    = "avro"
+	XML     = "xml"
+	XLSX    = "xlsx"
+	FIX     = "fix"
+)
+
+// Reader reads orders one at a time. Read returns io.EOF once the input is
+// exhausted and a *ParseError for records that could not be decoded, after
+// which reading may continue.
+type Reader interface {
+	Read() (models.Order, error)
+}
+
+// Writer writes orders one at a time. Flush must be called once all orders
+// have been written.
+type Writer interface {
+	Write(order models.Order) error
+	Flush() error
+}
+
+// ParseError reports a record that could not be decoded into an order
+type ParseError struct {
+	Line int
+	// Raw is the text of the offending record
+	Raw string
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Detect infers the format of a file from its extension, defaulting to JSONL
+func Detect(path string) string {
+	// Ignore the query string of URLs, such as SAS tokens
+	if i := strings.Index(path, "?"); i >= 0 && strings.Contains(path, "://") {
+		path = path[:i]
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return CSV
+	case ".parquet":
+		return Parquet
+	case ".avro":
+		return Avro
+	case ".xml":
+		return XML
+	case ".xlsx":
+		return XLSX
+	case ".fix":
+		return FIX
+	default:
+		return JSONL
+	}
+}
+
+// Options configures how records are decoded into orders
+type Options struct {
+	// FieldMapping renames input fields (or CSV columns) to Order field
+	// names, e.g. "ticker" to "symbol"
+	FieldMapping map[string]string
+
+	// XMLElement names the element holding each order in XML input,
+	// "order" by default
+	XMLElement string
+
+	// Sheet names the worksheet read from Excel input, the first one by
+	// default
+	Sheet string
+
+	// Validate, if set, is called with each record after field mapping,
+	// decoded as generic JSON with numbers as json.Number. Records it
+	// returns an error for are reported as a *ParseError.
+	Validate func(record interface{}) error
+}
+
+// NewReader creates a reader for the given format
+func NewReader(format string, r io.Reader, opts Options) (Reader, error) {
+	switch format {
+	case JSONL:
+		return newJSONLReader(r, opts), nil
+	case CSV:
+		return newCSVReader(r, opts)
+	case Parquet:
+		return newParquetReader(r, opts)
+	case Avro:
+		return newAvroReader(r, opts)
+	case XML:
+		return newXMLReader(r, opts), nil
+	case XLSX:
+		return newXLSXReader(r, opts)
+	case FIX:
+		return newFIXReader(r, opts), nil
+	default:
+		return nil, fmt.Errorf("unsupported input format %q", format)
+	}
+}
+
+// Writable reports whether orders can be written in the given format
+func Writable(format string) bool {
+	switch format {
+	case JSONL, CSV, Parquet:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewWriter creates a writer for the given format
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case JSONL:
+		return newJSONLWriter(w), nil
+	case CSV:
+		return newCSVWriter(w), nil
+	case Parquet:
+		return newParquetWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unsupported output format %q", format)
+	}
+}
+
+// readerAt provides random access to an input, for formats that cannot be
+// read sequentially. Local files are read in place; anything else is
+// buffered in memory.
+func readerAt(r io.Reader) (io.ReaderAt, int64, error) {
+	if f, ok := r.(*os.File); ok {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, 0, err
+		}
+		return f, info.Size(), nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(data), int64(len(data)), nil
+}
@@ -0,0 +1,179 @@
+package orderfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// testOrders are orders with extra fields that not every order has
+const testOrders = `{"order_id":"o1","symbol":"TSLA","quantity":"150.50","price":"180.1234567891","side":"buy","timestamp":"2024-03-01T09:30:00.123456Z","venue":"XNAS","lot":12345678901234567890}
+{"order_id":"o2","symbol":"AAPL","quantity":"5","price":"1e3","side":"sell","timestamp":"2024-03-01T09:30:01Z","account":"acc-7","tags":["a","b"],"active":true}
+{"order_id":"o3","symbol":"MSFT","quantity":"1","price":"2","side":"buy","venue":"XNYS"}
+`
+
+// roundTrip writes the test orders in a format and reads them back
+func roundTrip(t *testing.T, format string) []models.Order {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newJSONLReader(strings.NewReader(testOrders), Options{})
+	for {
+		order, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Write(order); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewReader(format, &buf, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var orders []models.Order
+	for {
+		order, err := reader.Read()
+		if err == io.EOF {
+			return orders
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		orders = append(orders, order)
+	}
+}
+
+// checkRoundTrip checks the orders read back keep every field, with extra
+// fields as text
+func checkRoundTrip(t *testing.T, orders []models.Order) {
+	t.Helper()
+	if len(orders) != 3 {
+		t.Fatalf("read %d orders, want 3", len(orders))
+	}
+
+	o := orders[0]
+	if o.OrderID != "o1" || o.Quantity.String() != "150.50" || o.Price.String() != "180.1234567891" {
+		t.Errorf("order 1 = %s %s %s, want o1 150.50 180.1234567891", o.OrderID, o.Quantity, o.Price)
+	}
+	if want := time.Date(2024, 3, 1, 9, 30, 0, 123456000, time.UTC); !o.Timestamp.Equal(want) {
+		t.Errorf("order 1 timestamp = %v, want %v", o.Timestamp, want)
+	}
+	if o.Extra["venue"] != "XNAS" || o.Extra["lot"] != "12345678901234567890" {
+		t.Errorf("order 1 extra = %v, want venue XNAS and lot 12345678901234567890", o.Extra)
+	}
+	if _, ok := o.Extra["account"]; ok {
+		t.Errorf("order 1 extra = %v, want no account", o.Extra)
+	}
+
+	o = orders[1]
+	if o.Price.String() != "1e3" {
+		t.Errorf("order 2 price = %s, want 1e3", o.Price)
+	}
+	want := map[string]interface{}{"account": "acc-7", "tags": `["a","b"]`, "active": "true"}
+	got, _ := json.Marshal(o.Extra)
+	if wantJSON, _ := json.Marshal(want); string(got) != string(wantJSON) {
+		t.Errorf("order 2 extra = %s, want %s", got, wantJSON)
+	}
+
+	if !orders[2].Timestamp.IsZero() {
+		t.Errorf("order 3 timestamp = %v, want none", orders[2].Timestamp)
+	}
+}
+
+func TestCSVRoundTripKeepsExtraFields(t *testing.T) {
+	checkRoundTrip(t, roundTrip(t, CSV))
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	checkRoundTrip(t, roundTrip(t, Parquet))
+}
+
+func TestParquetNanosecondTimestamps(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(Parquet, &buf)
+	ts := time.Date(2024, 3, 1, 9, 30, 0, 123456789, time.FixedZone("", 3600))
+	if err := w.Write(models.Order{OrderID: "o1", Timestamp: ts}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(Parquet, &buf, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !order.Timestamp.Equal(ts) {
+		t.Errorf("timestamp = %v, want %v", order.Timestamp, ts)
+	}
+}
+
+func TestParquetEmptyOutput(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(Parquet, &buf)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(Parquet, &buf, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("Read() error = %v, want io.EOF", err)
+	}
+}
+
+func TestWritable(t *testing.T) {
+	for format, want := range map[string]bool{JSONL: true, CSV: true, Parquet: true, Avro: false, XLSX: false} {
+		if got := Writable(format); got != want {
+			t.Errorf("Writable(%q) = %v, want %v", format, got, want)
+		}
+		if _, err := NewWriter(format, io.Discard); (err == nil) != want {
+			t.Errorf("NewWriter(%q) error = %v", format, err)
+		}
+	}
+}
+
+func TestCSVFlushedPerOrderWritesOneHeader(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(CSV, &buf)
+	for _, order := range []models.Order{
+		{OrderID: "o1", Extra: map[string]interface{}{"venue": "XNAS"}},
+		{OrderID: "o2", Extra: map[string]interface{}{"venue": "XNYS", "account": "acc-7"}},
+	} {
+		if err := w.Write(order); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || lines[0] != "order_id,symbol,quantity,price,side,timestamp,venue" {
+		t.Fatalf("output = %q, want a header with venue and two orders", buf.String())
+	}
+	if !strings.HasSuffix(lines[2], ",XNYS") {
+		t.Errorf("order 2 = %q, want venue XNYS", lines[2])
+	}
+}
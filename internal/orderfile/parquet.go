@@ -0,0 +1,124 @@
+package orderfile
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/fauzanelka/99tech-order-processor/internal/parquet"
+)
+
+// newParquetReader reads orders from the rows of a Parquet file
+func newParquetReader(r io.Reader, opts Options) (Reader, error) {
+	// The metadata is at the end of the file, so it needs random access
+	ra, size, err := readerAt(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Parquet input: %w", err)
+	}
+
+	file, err := parquet.Open(ra, size)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecordReader(file, opts), nil
+}
+
+// parquetRowGroup is the number of orders in each row group of Parquet output
+const parquetRowGroup = 1 << 16
+
+// parquetWriter writes orders as a Parquet file with a string column for
+// every field, so quantities and prices stay exact, except the timestamp.
+// Timestamps are stored in UTC, in nanoseconds if any order needs them and
+// microseconds otherwise. Extra fields follow the order columns, sorted by
+// name, so orders are held until Flush to learn them all.
+type parquetWriter struct {
+	w      io.Writer
+	spool  spool
+	nanos  bool
+	closed bool
+}
+
+func newParquetWriter(w io.Writer) *parquetWriter {
+	return &parquetWriter{w: w}
+}
+
+func (w *parquetWriter) Write(order models.Order) error {
+	if w.closed {
+		return fmt.Errorf("cannot write order %s: the Parquet file is already complete", order.OrderID)
+	}
+	if order.Timestamp.Nanosecond()%1000 != 0 {
+		w.nanos = true
+	}
+	return w.spool.add(order)
+}
+
+func (w *parquetWriter) Flush() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	unit := time.Microsecond
+	if w.nanos {
+		unit = time.Nanosecond
+	}
+	extra := w.spool.extraColumns()
+	columns := []parquet.Column{
+		{Name: "order_id"},
+		{Name: "symbol"},
+		{Name: "quantity"},
+		{Name: "price"},
+		{Name: "side"},
+		{Name: "timestamp", Unit: unit},
+	}
+	for _, name := range extra {
+		columns = append(columns, parquet.Column{Name: name})
+	}
+
+	pw := parquet.NewWriter(w.w, columns)
+	var rows [][]interface{}
+	err := w.spool.each(func(order models.Order) error {
+		row := []interface{}{
+			nullable(order.OrderID),
+			nullable(order.Symbol),
+			order.Quantity.String(),
+			order.Price.String(),
+			nullable(order.Side),
+			nil,
+		}
+		if !order.Timestamp.IsZero() {
+			row[5] = order.Timestamp
+		}
+		for _, name := range extra {
+			if v, ok := order.Extra[name]; ok && v != nil {
+				row = append(row, extraValue(v))
+			} else {
+				row = append(row, nil)
+			}
+		}
+
+		rows = append(rows, row)
+		if len(rows) < parquetRowGroup {
+			return nil
+		}
+		err := pw.WriteRows(rows)
+		rows = rows[:0]
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := pw.WriteRows(rows); err != nil {
+		return err
+	}
+	return pw.Close()
+}
+
+// nullable maps empty strings to null
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,50 @@
+package orderfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// Records is a source of rows keyed by column name, such as a Parquet file
+// or the results of a database query. Next returns io.EOF after the last row.
+type Records interface {
+	Next() (map[string]interface{}, error)
+}
+
+// recordReader reads orders from rows. Columns are matched by name like
+// JSON fields, so the field mapping applies to them, and rows are numbered
+// from 1 in parse errors.
+type recordReader struct {
+	records Records
+	row     int
+	opts    Options
+}
+
+// NewRecordReader creates a reader for orders held in rows
+func NewRecordReader(records Records, opts Options) Reader {
+	return &recordReader{records: records, opts: opts}
+}
+
+func (r *recordReader) Read() (models.Order, error) {
+	row, err := r.records.Next()
+	if err == io.EOF {
+		return models.Order{}, io.EOF
+	}
+	if err != nil {
+		return models.Order{}, fmt.Errorf("error reading input: %w", err)
+	}
+	r.row++
+
+	line, err := json.Marshal(row)
+	if err != nil {
+		return models.Order{}, &ParseError{Line: r.row, Err: err}
+	}
+	order, err := Decode(line, r.opts)
+	if err != nil {
+		return models.Order{}, &ParseError{Line: r.row, Raw: string(line), Err: err}
+	}
+	return order, nil
+}
@@ -0,0 +1,25 @@
+package orderfile
+
+import (
+	"io"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+type sliceReader struct {
+	orders []models.Order
+}
+
+// NewSliceReader creates a reader for orders already in memory
+func NewSliceReader(orders []models.Order) Reader {
+	return &sliceReader{orders: orders}
+}
+
+func (r *sliceReader) Read() (models.Order, error) {
+	if len(r.orders) == 0 {
+		return models.Order{}, io.EOF
+	}
+	order := r.orders[0]
+	r.orders = r.orders[1:]
+	return order, nil
+}
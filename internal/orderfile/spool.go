@@ -0,0 +1,107 @@
+package orderfile
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// spool holds written orders in a temporary file, for formats that need the
+// extra fields of every order before they can write the first one
+type spool struct {
+	file  *os.File
+	w     *bufio.Writer
+	extra map[string]bool
+}
+
+// add appends an order to the spool
+func (s *spool) add(order models.Order) error {
+	if s.file == nil {
+		file, err := os.CreateTemp("", "order-processor-spool-*.jsonl")
+		if err != nil {
+			return fmt.Errorf("failed to create spool file: %w", err)
+		}
+		s.file, s.w = file, bufio.NewWriter(file)
+		s.extra = make(map[string]bool)
+	}
+
+	line, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("failed to encode order %s: %w", order.OrderID, err)
+	}
+	if _, err := s.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write order %s: %w", order.OrderID, err)
+	}
+	for name := range order.Extra {
+		if !models.IsOrderField(name) {
+			s.extra[name] = true
+		}
+	}
+	return nil
+}
+
+// extraColumns returns the names of the extra fields of the spooled orders,
+// sorted
+func (s *spool) extraColumns() []string {
+	names := make([]string, 0, len(s.extra))
+	for name := range s.extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// each calls fn with every spooled order in the order they were added, then
+// removes the spool file
+func (s *spool) each(fn func(models.Order) error) error {
+	if s.file == nil {
+		return nil
+	}
+	defer func() {
+		s.file.Close()
+		os.Remove(s.file.Name())
+		s.file = nil
+	}()
+
+	if err := s.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write spool file: %w", err)
+	}
+	if _, err := s.file.Seek(0, 0); err != nil {
+		return fmt.Errorf("failed to read spool file: %w", err)
+	}
+	dec := json.NewDecoder(bufio.NewReader(s.file))
+	for {
+		var order models.Order
+		err := dec.Decode(&order)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read spool file: %w", err)
+		}
+		if err := fn(order); err != nil {
+			return err
+		}
+	}
+}
+
+// extraValue formats an extra field as text: strings as they are, numbers
+// as written, and anything else as JSON. Missing fields are empty.
+func extraValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
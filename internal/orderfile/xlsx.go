@@ -0,0 +1,406 @@
+package orderfile
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// xlsxReader reads orders from one worksheet of an Excel workbook. The first
+// non-empty row is the header, matched to order fields like a CSV header,
+// and parse errors report spreadsheet row numbers. Cells formatted as dates
+// are read as RFC 3339 timestamps.
+type xlsxReader struct {
+	dec      *xml.Decoder
+	sheet    io.Closer
+	strings  []string
+	dates    []bool
+	date1904 bool
+	columns  columns
+	opts     Options
+}
+
+// xlsxWorkbook is the subset of xl/workbook.xml that is used
+type xlsxWorkbook struct {
+	Properties struct {
+		Date1904 bool `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		// The relationship id attribute is namespaced
+		ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+// xlsxRelationships is the content of xl/_rels/workbook.xml.rels
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxStyles is the subset of xl/styles.xml that identifies date formats
+type xlsxStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+// xlsxCell is a cell of a worksheet row
+type xlsxCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Style  int    `xml:"s,attr"`
+	Value  string `xml:"v"`
+	Inline struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"is"`
+}
+
+func newXLSXReader(r io.Reader, opts Options) (*xlsxReader, error) {
+	ra, size, err := readerAt(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Excel input: %w", err)
+	}
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, fmt.Errorf("not an Excel workbook: %w", err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var workbook xlsxWorkbook
+	if err := decodeXMLPart(files, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	var rels xlsxRelationships
+	if err := decodeXMLPart(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+
+	// Find the worksheet, the first one unless a sheet is named
+	id := ""
+	var names []string
+	for _, s := range workbook.Sheets {
+		names = append(names, s.Name)
+		if (opts.Sheet == "" && id == "") || s.Name == opts.Sheet {
+			id = s.ID
+		}
+	}
+	if id == "" {
+		if opts.Sheet == "" {
+			return nil, fmt.Errorf("workbook has no sheets")
+		}
+		return nil, fmt.Errorf("workbook has no sheet %q (sheets: %s)", opts.Sheet, strings.Join(names, ", "))
+	}
+	target := ""
+	for _, rel := range rels.Relationships {
+		if rel.ID == id {
+			target = rel.Target
+		}
+	}
+	// Targets are relative to xl/, or absolute within the package
+	if strings.HasPrefix(target, "/") {
+		target = strings.TrimPrefix(target, "/")
+	} else {
+		target = path.Join("xl", target)
+	}
+	sheet, ok := files[target]
+	if target == "" || !ok {
+		return nil, fmt.Errorf("invalid Excel workbook: missing worksheet %s", target)
+	}
+
+	xr := &xlsxReader{date1904: workbook.Properties.Date1904, opts: opts}
+	if xr.strings, err = readSharedStrings(files); err != nil {
+		return nil, err
+	}
+	if xr.dates, err = readDateStyles(files); err != nil {
+		return nil, err
+	}
+
+	rc, err := sheet.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read worksheet: %w", err)
+	}
+	xr.sheet = rc
+	xr.dec = xml.NewDecoder(rc)
+	return xr, nil
+}
+
+// decodeXMLPart unmarshals a required part of the workbook package
+func decodeXMLPart(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("not an Excel workbook: missing %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("invalid Excel workbook: %s: %w", name, err)
+	}
+	return nil
+}
+
+// readSharedStrings loads the shared string table, which cells of type s
+// index into
+func readSharedStrings(files map[string]*zip.File) ([]string, error) {
+	if _, ok := files["xl/sharedStrings.xml"]; !ok {
+		return nil, nil
+	}
+	var table struct {
+		Items []struct {
+			Text string `xml:"t"`
+			Runs []struct {
+				Text string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	if err := decodeXMLPart(files, "xl/sharedStrings.xml", &table); err != nil {
+		return nil, err
+	}
+	values := make([]string, len(table.Items))
+	for i, item := range table.Items {
+		// Rich text is split into runs
+		text := item.Text
+		for _, run := range item.Runs {
+			text += run.Text
+		}
+		values[i] = text
+	}
+	return values, nil
+}
+
+// readDateStyles reports, for each cell style, whether it formats numbers
+// as dates
+func readDateStyles(files map[string]*zip.File) ([]bool, error) {
+	if _, ok := files["xl/styles.xml"]; !ok {
+		return nil, nil
+	}
+	var styles xlsxStyles
+	if err := decodeXMLPart(files, "xl/styles.xml", &styles); err != nil {
+		return nil, err
+	}
+	custom := make(map[int]bool)
+	for _, f := range styles.NumFmts {
+		custom[f.ID] = isDateFormat(f.Code)
+	}
+	dates := make([]bool, len(styles.CellXfs))
+	for i, xf := range styles.CellXfs {
+		id := xf.NumFmtID
+		if isDate, ok := custom[id]; ok {
+			dates[i] = isDate
+		} else {
+			// Built-in date and time formats
+			dates[i] = (id >= 14 && id <= 22) || (id >= 45 && id <= 47)
+		}
+	}
+	return dates, nil
+}
+
+// isDateFormat reports whether a custom number format displays a date,
+// ignoring quoted text, escapes, and bracketed colors or conditions
+func isDateFormat(code string) bool {
+	quoted, bracket := false, false
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '\\':
+			i++
+		case c == '[':
+			bracket = true
+		case c == ']':
+			bracket = false
+		case bracket:
+		case strings.IndexByte("dmyhsDMYHS", c) >= 0:
+			return true
+		}
+	}
+	return false
+}
+
+func (r *xlsxReader) Read() (models.Order, error) {
+	for {
+		line, cells, err := r.row()
+		if err == io.EOF {
+			r.sheet.Close()
+			return models.Order{}, io.EOF
+		}
+		if err != nil {
+			return models.Order{}, fmt.Errorf("error reading input: %w", err)
+		}
+		if isBlank(cells) {
+			continue
+		}
+		if r.columns == nil {
+			r.columns = newColumns(cells, r.opts.FieldMapping)
+			continue
+		}
+
+		if r.opts.Validate != nil {
+			if err := r.opts.Validate(r.columns.record(cells)); err != nil {
+				return models.Order{}, &ParseError{Line: line, Raw: strings.Join(cells, ","), Err: err}
+			}
+		}
+		order, err := r.columns.decode(cells)
+		if err != nil {
+			return models.Order{}, &ParseError{Line: line, Raw: strings.Join(cells, ","), Err: err}
+		}
+		return order, nil
+	}
+}
+
+// row reads the next row of the worksheet, returning its row number and
+// the text of its cells by column
+func (r *xlsxReader) row() (int, []string, error) {
+	for {
+		tok, err := r.dec.Token()
+		if err != nil {
+			return 0, nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		line := 0
+		for _, a := range start.Attr {
+			if a.Name.Local == "r" {
+				line, _ = strconv.Atoi(a.Value)
+			}
+		}
+
+		var cells []string
+		for {
+			tok, err := r.dec.Token()
+			if err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return 0, nil, err
+			}
+			if end, ok := tok.(xml.EndElement); ok && end.Name.Local == "row" {
+				return line, cells, nil
+			}
+			start, ok := tok.(xml.StartElement)
+			if !ok || start.Name.Local != "c" {
+				continue
+			}
+			var cell xlsxCell
+			if err := r.dec.DecodeElement(&cell, &start); err != nil {
+				return 0, nil, err
+			}
+
+			// Cells without a reference follow the previous one
+			col := len(cells)
+			if cell.Ref != "" {
+				if col, err = columnIndex(cell.Ref); err != nil {
+					return 0, nil, err
+				}
+			}
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+			cells[col] = r.text(cell)
+		}
+	}
+}
+
+// text returns the value of a cell as it would appear in a CSV export
+func (r *xlsxReader) text(c xlsxCell) string {
+	switch c.Type {
+	case "s":
+		i, err := strconv.Atoi(c.Value)
+		if err != nil || i < 0 || i >= len(r.strings) {
+			return ""
+		}
+		return r.strings[i]
+	case "inlineStr":
+		text := c.Inline.Text
+		for _, run := range c.Inline.Runs {
+			text += run.Text
+		}
+		return text
+	case "b":
+		if c.Value == "1" {
+			return "true"
+		}
+		return "false"
+	case "", "n":
+		if c.Style >= 0 && c.Style < len(r.dates) && r.dates[c.Style] {
+			if serial, err := strconv.ParseFloat(c.Value, 64); err == nil {
+				return excelTime(serial, r.date1904).Format(time.RFC3339Nano)
+			}
+		}
+		return c.Value
+	default:
+		// Formula strings (str), errors (e), and ISO dates (d)
+		return c.Value
+	}
+}
+
+// excelTime converts a serial date, in days since the workbook's epoch, to
+// a UTC time rounded to the millisecond
+func excelTime(serial float64, date1904 bool) time.Time {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	ms := math.Round(serial * 24 * 60 * 60 * 1000)
+	return epoch.Add(time.Duration(ms) * time.Millisecond)
+}
+
+// columnIndex returns the zero-based column of a cell reference such as AB12
+func columnIndex(ref string) (int, error) {
+	col := 0
+	for i := 0; i < len(ref); i++ {
+		c := ref[i]
+		if c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		if c < 'A' || c > 'Z' {
+			if i == 0 {
+				break
+			}
+			return col - 1, nil
+		}
+		col = col*26 + int(c-'A') + 1
+		// Worksheets have at most 16384 columns (XFD)
+		if col > 16384 {
+			break
+		}
+	}
+	return 0, fmt.Errorf("invalid cell reference %q", ref)
+}
+
+// isBlank reports whether every cell of a row is empty
+func isBlank(cells []string) bool {
+	for _, c := range cells {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
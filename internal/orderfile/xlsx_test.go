@@ -0,0 +1,184 @@
+package orderfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testWorkbook has a Notes sheet followed by an Orders sheet whose cells
+// mix shared strings, rich text, inline strings, numbers, and dates
+var testWorkbook = map[string]string{
+	"[Content_Types].xml": `<?xml version="1.0" encoding="UTF-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`,
+	"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Notes" sheetId="1" r:id="rId1"/><sheet name="Orders" sheetId="2" r:id="rId2"/></sheets>
+</workbook>`,
+	"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet2.xml"/>
+<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/>
+</Relationships>`,
+	"xl/sharedStrings.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="8" uniqueCount="8">
+<si><t>order_id</t></si>
+<si><t>Symbol</t></si>
+<si><t>price</t></si>
+<si><t>side</t></si>
+<si><t>timestamp</t></si>
+<si><t>venue</t></si>
+<si><r><rPr><b/></rPr><t>TS</t></r><r><t>LA</t></r></si>
+<si><t xml:space="preserve">XNAS </t></si>
+</sst>`,
+	// Style 1 uses a built-in date format, style 2 a custom one, and style 3
+	// a custom number format whose quoted text holds date letters
+	"xl/styles.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="2"><numFmt numFmtId="164" formatCode="yyyy\-mm\-dd\ hh:mm:ss"/><numFmt numFmtId="165" formatCode="0.00&quot; shares&quot;"/></numFmts>
+<cellXfs count="4"><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="164"/><xf numFmtId="165"/></cellXfs>
+</styleSheet>`,
+	"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="inlineStr"><is><t>order_id</t></is></c></row>
+<row r="2"><c r="A2" t="inlineStr"><is><t>note</t></is></c></row>
+</sheetData></worksheet>`,
+	"xl/worksheets/sheet2.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="2"><c r="A2" t="s"><v>0</v></c><c r="B2" t="s"><v>1</v></c><c r="C2" t="inlineStr"><is><t>Quantity</t></is></c><c r="D2" t="s"><v>2</v></c><c r="E2" t="s"><v>3</v></c><c r="F2" t="s"><v>4</v></c><c r="G2" t="s"><v>5</v></c></row>
+<row r="3"><c r="A3" t="inlineStr"><is><r><t>o</t></r><r><t>1</t></r></is></c><c r="B3" t="s"><v>6</v></c><c r="C3" s="3"><v>150.5</v></c><c r="D3" t="n"><v>180.1234567891</v></c><c r="E3" t="inlineStr"><is><t>buy</t></is></c><c r="F3" s="2"><v>45352.395833333336</v></c><c r="G3" t="s"><v>7</v></c></row>
+<row r="4"><c r="A4" t="s"/></row>
+<row r="5"><c r="A5" t="inlineStr"><is><t>o2</t></is></c><c r="C5"><v>1000</v></c><c><v>2.5E-2</v></c><c t="inlineStr"><is><t>sell</t></is></c><c r="F5" s="1"><v>45353</v></c></row>
+<row r="6"><c r="A6" t="inlineStr"><is><t>o3</t></is></c><c r="C6" t="str"><v>lots</v></c></row>
+</sheetData></worksheet>`,
+}
+
+// buildWorkbook zips the parts of a workbook
+func buildWorkbook(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestXLSXReadsCells(t *testing.T) {
+	r, err := NewReader(XLSX, bytes.NewReader(buildWorkbook(t, testWorkbook)), Options{Sheet: "Orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Shared strings, rich text, inline strings, and a number shown with a
+	// custom format
+	o, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.OrderID != "o1" || o.Symbol != "TSLA" || o.Side != "buy" {
+		t.Errorf("order 1 = %s %s %s, want o1 TSLA buy", o.OrderID, o.Symbol, o.Side)
+	}
+	if o.Quantity.String() != "150.5" || o.Price.String() != "180.1234567891" {
+		t.Errorf("order 1 quantity and price = %s %s, want 150.5 180.1234567891", o.Quantity, o.Price)
+	}
+	if want := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC); !o.Timestamp.Equal(want) {
+		t.Errorf("order 1 timestamp = %v, want %v", o.Timestamp, want)
+	}
+	if o.Extra["venue"] != "XNAS" {
+		t.Errorf("order 1 extra = %v, want venue XNAS", o.Extra)
+	}
+
+	// The blank row is skipped, and cells without a reference follow the
+	// one before them
+	o, err = r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.OrderID != "o2" || o.Symbol != "" || o.Side != "sell" {
+		t.Errorf("order 2 = %s %q %s, want o2 without a symbol, sell", o.OrderID, o.Symbol, o.Side)
+	}
+	if o.Quantity.String() != "1000" || o.Price.String() != "2.5E-2" {
+		t.Errorf("order 2 quantity and price = %s %s, want 1000 2.5E-2", o.Quantity, o.Price)
+	}
+	if want := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC); !o.Timestamp.Equal(want) {
+		t.Errorf("order 2 timestamp = %v, want %v", o.Timestamp, want)
+	}
+
+	// Errors report the spreadsheet row
+	_, err = r.Read()
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Line != 6 || !strings.Contains(perr.Error(), `invalid quantity "lots"`) {
+		t.Errorf("Read() error = %v, want an invalid quantity on line 6", err)
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("Read() error = %v, want io.EOF", err)
+	}
+}
+
+func TestXLSXSheets(t *testing.T) {
+	data := buildWorkbook(t, testWorkbook)
+
+	// The first sheet is read by default
+	r, err := NewReader(XLSX, bytes.NewReader(data), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o, err := r.Read(); err != nil || o.OrderID != "note" {
+		t.Errorf("Read() = %q, %v, want the order of the first sheet", o.OrderID, err)
+	}
+
+	_, err = NewReader(XLSX, bytes.NewReader(data), Options{Sheet: "Fills"})
+	if err == nil || !strings.Contains(err.Error(), `no sheet "Fills" (sheets: Notes, Orders)`) {
+		t.Errorf("NewReader() error = %v, want the sheet names", err)
+	}
+}
+
+func TestXLSXDate1904(t *testing.T) {
+	parts := make(map[string]string, len(testWorkbook))
+	for name, content := range testWorkbook {
+		parts[name] = content
+	}
+	parts["xl/workbook.xml"] = strings.Replace(parts["xl/workbook.xml"], "<sheets>", `<workbookPr date1904="1"/><sheets>`, 1)
+
+	r, err := NewReader(XLSX, bytes.NewReader(buildWorkbook(t, parts)), Options{Sheet: "Orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2028, 3, 2, 9, 30, 0, 0, time.UTC); !o.Timestamp.Equal(want) {
+		t.Errorf("timestamp = %v, want %v", o.Timestamp, want)
+	}
+}
+
+func TestIsDateFormat(t *testing.T) {
+	for code, want := range map[string]bool{
+		"yyyy-mm-dd":         true,
+		`[$-409]h:mm\ AM/PM`: true,
+		"0.00":               false,
+		`0.00" days"`:        false,
+		`[Red]#,##0;\d0`:     false,
+		`#,##0.00 [$USD]`:    false,
+		`[h]:mm:ss`:          true,
+		`"Year" 0;"Month"`:   false,
+	} {
+		if got := isDateFormat(code); got != want {
+			t.Errorf("isDateFormat(%q) = %v, want %v", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package orderfile
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// defaultXMLElement is the element holding each order when none is configured
+const defaultXMLElement = "order"
+
+// xmlReader reads orders from every element named Options.XMLElement,
+// wherever it appears in the document. Fields are taken from the element's
+// attributes and the text of its child elements; deeper elements are named
+// by their path, such as instrument/ticker, and attributes of child elements
+// as instrument/@code. Values are strings, typed like CSV cells.
+type xmlReader struct {
+	dec     *xml.Decoder
+	element string
+	opts    Options
+}
+
+func newXMLReader(r io.Reader, opts Options) *xmlReader {
+	element := opts.XMLElement
+	if element == "" {
+		element = defaultXMLElement
+	}
+	return &xmlReader{dec: xml.NewDecoder(r), element: element, opts: opts}
+}
+
+func (r *xmlReader) Read() (models.Order, error) {
+	for {
+		tok, err := r.dec.Token()
+		if err == io.EOF {
+			return models.Order{}, io.EOF
+		}
+		if err != nil {
+			return models.Order{}, fmt.Errorf("error reading input: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != r.element {
+			continue
+		}
+		line, _ := r.dec.InputPos()
+
+		fields := make(map[string]string)
+		for _, a := range start.Attr {
+			fields[a.Name.Local] = strings.TrimSpace(a.Value)
+		}
+		if _, err := r.collect(fields, ""); err != nil {
+			return models.Order{}, fmt.Errorf("error reading input: %w", err)
+		}
+		return r.decode(fields, line)
+	}
+}
+
+// collect reads up to the end of the current element, recording its child
+// elements in fields under prefix, and returns the element's own text
+func (r *xmlReader) collect(fields map[string]string, prefix string) (string, error) {
+	var text strings.Builder
+	for {
+		tok, err := r.dec.Token()
+		if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			path := prefix + t.Name.Local
+			for _, a := range t.Attr {
+				fields[path+"/@"+a.Name.Local] = strings.TrimSpace(a.Value)
+			}
+			child, err := r.collect(fields, path+"/")
+			if err != nil {
+				return "", err
+			}
+			if child = strings.TrimSpace(child); child != "" {
+				fields[path] = child
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			return text.String(), nil
+		}
+	}
+}
+
+// decode maps the fields of an order element and decodes them like a JSON
+// record
+func (r *xmlReader) decode(fields map[string]string, line int) (models.Order, error) {
+	// Mapped fields take precedence over fields already using the target name
+	record := make(map[string]interface{}, len(fields))
+	set := func(name, v string) {
+		switch {
+		case v == "":
+		case numericColumns[name] && isNumber(v):
+			record[name] = json.Number(v)
+		default:
+			record[name] = v
+		}
+	}
+	for name, v := range fields {
+		if _, ok := r.opts.FieldMapping[name]; !ok {
+			set(name, v)
+		}
+	}
+	for name, v := range fields {
+		if target, ok := r.opts.FieldMapping[name]; ok {
+			set(target, v)
+		}
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return models.Order{}, &ParseError{Line: line, Err: err}
+	}
+	order, err := Decode(data, Options{Validate: r.opts.Validate})
+	if err != nil {
+		return models.Order{}, &ParseError{Line: line, Raw: string(data), Err: err}
+	}
+	return order, nil
+}
@@ -0,0 +1,127 @@
+// Package outlier flags orders whose price is far from the median price of
+// their symbol in the input, such as a price with a misplaced decimal point,
+// so they can be reviewed before they are submitted.
+package outlier
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// Config sets how far a price may be from the median of its symbol. A price
+// beyond either limit is an outlier.
+type Config struct {
+	// Percent, if positive, is the largest deviation as a percentage of the
+	// median
+	Percent float64
+	// StdDevs, if positive, is the largest deviation in standard deviations
+	// of the prices of the symbol
+	StdDevs float64
+}
+
+// Enabled reports whether any limit is set
+func (c Config) Enabled() bool {
+	return c.Percent > 0 || c.StdDevs > 0
+}
+
+// Validate checks that the limits are not negative
+func (c Config) Validate() error {
+	if c.Percent < 0 || c.StdDevs < 0 {
+		return fmt.Errorf("outlier limits must not be negative")
+	}
+	return nil
+}
+
+type stats struct {
+	median float64
+	stddev float64
+}
+
+// Detector compares order prices with the prices of all orders of the same
+// symbol. Orders are first added to compute the median and standard
+// deviation of each symbol, then checked. All methods are safe to call on a
+// nil receiver, which flags nothing.
+type Detector struct {
+	cfg    Config
+	prices map[string][]float64
+	stats  map[string]stats
+}
+
+// NewDetector creates a detector, or returns nil if no limit is set
+func NewDetector(cfg Config) *Detector {
+	if !cfg.Enabled() {
+		return nil
+	}
+	return &Detector{cfg: cfg, prices: make(map[string][]float64)}
+}
+
+// Add adds the price of an order to the prices of its symbol. Orders must
+// all be added before any is checked; later orders are ignored.
+func (d *Detector) Add(order models.Order) {
+	if d == nil || d.stats != nil {
+		return
+	}
+	d.prices[order.Symbol] = append(d.prices[order.Symbol], order.Price.Float64())
+}
+
+// Symbols returns the number of symbols with prices
+func (d *Detector) Symbols() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.prices)
+}
+
+// Check reports whether the price of an order is an outlier, and why
+func (d *Detector) Check(order models.Order) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+	if d.stats == nil {
+		d.compute()
+	}
+	s, ok := d.stats[order.Symbol]
+	if !ok {
+		return "", false
+	}
+	price := order.Price.Float64()
+	deviation := math.Abs(price - s.median)
+	if d.cfg.Percent > 0 && s.median != 0 {
+		if pct := deviation / math.Abs(s.median) * 100; pct > d.cfg.Percent {
+			return fmt.Sprintf("price %s is %.1f%% from the %s median of %g", order.Price, pct, order.Symbol, s.median), true
+		}
+	}
+	if d.cfg.StdDevs > 0 && s.stddev > 0 {
+		if n := deviation / s.stddev; n > d.cfg.StdDevs {
+			return fmt.Sprintf("price %s is %.1f standard deviations from the %s median of %g", order.Price, n, order.Symbol, s.median), true
+		}
+	}
+	return "", false
+}
+
+// compute computes the median and population standard deviation of the
+// prices of each symbol, and drops the prices
+func (d *Detector) compute() {
+	d.stats = make(map[string]stats, len(d.prices))
+	for symbol, prices := range d.prices {
+		sort.Float64s(prices)
+		n := len(prices)
+		median := prices[n/2]
+		if n%2 == 0 {
+			median = (prices[n/2-1] + prices[n/2]) / 2
+		}
+		var sum, squares float64
+		for _, p := range prices {
+			sum += p
+		}
+		mean := sum / float64(n)
+		for _, p := range prices {
+			squares += (p - mean) * (p - mean)
+		}
+		d.stats[symbol] = stats{median: median, stddev: math.Sqrt(squares / float64(n))}
+	}
+	d.prices = nil
+}
@@ -0,0 +1,109 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/snappy"
+)
+
+// Compression codecs
+const (
+	codecUncompressed = 0
+	codecSnappy       = 1
+	codecGzip         = 2
+)
+
+var codecNames = map[int64]string{
+	3: "LZO",
+	4: "BROTLI",
+	5: "LZ4",
+	6: "ZSTD",
+	7: "LZ4_RAW",
+}
+
+// decompress decompresses a page whose uncompressed size is size
+func decompress(codec int64, data []byte, size int) ([]byte, error) {
+	var out []byte
+	var err error
+	switch codec {
+	case codecUncompressed:
+		return data, nil
+	case codecSnappy:
+		out, err = snappy.Decode(data)
+	case codecGzip:
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			out, err = io.ReadAll(io.LimitReader(zr, int64(size)+1))
+		}
+	default:
+		name := codecNames[codec]
+		if name == "" {
+			name = fmt.Sprint(codec)
+		}
+		return nil, fmt.Errorf("unsupported compression codec %s", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress page: %w", err)
+	}
+	if len(out) != size {
+		return nil, fmt.Errorf("failed to decompress page: expected %d bytes, got %d", size, len(out))
+	}
+	return out, nil
+}
+
+// decodeHybrid decodes n values of the RLE/bit-packing hybrid encoding used
+// for levels and dictionary indices
+func decodeHybrid(data []byte, bitWidth, n int) ([]int32, error) {
+	// Runs hold any number of values, so n is not bounded by the data
+	out := make([]int32, 0, min(n, 1<<16))
+	byteWidth := (bitWidth + 7) / 8
+	pos := 0
+	for len(out) < n {
+		header, k := binary.Uvarint(data[pos:])
+		if k <= 0 {
+			return nil, fmt.Errorf("truncated RLE data")
+		}
+		pos += k
+
+		if header&1 == 0 {
+			// Run of one repeated value
+			count := int(header >> 1)
+			if count == 0 || byteWidth > len(data)-pos {
+				return nil, fmt.Errorf("corrupt RLE data")
+			}
+			var v int32
+			for i := 0; i < byteWidth; i++ {
+				v |= int32(data[pos+i]) << (8 * i)
+			}
+			pos += byteWidth
+			for i := 0; i < count && len(out) < n; i++ {
+				out = append(out, v)
+			}
+			continue
+		}
+
+		// Groups of 8 bit-packed values, least significant bit first
+		groups := int(header >> 1)
+		if groups == 0 || groups > len(data)-pos || groups*bitWidth > len(data)-pos {
+			return nil, fmt.Errorf("corrupt RLE data")
+		}
+		size := groups * bitWidth
+		packed := data[pos : pos+size]
+		pos += size
+		for i := 0; i < groups*8 && len(out) < n; i++ {
+			var v int32
+			for b := 0; b < bitWidth; b++ {
+				bit := i*bitWidth + b
+				if packed[bit/8]>>(bit%8)&1 == 1 {
+					v |= 1 << b
+				}
+			}
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
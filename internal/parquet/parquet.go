@@ -0,0 +1,576 @@
+// Package parquet reads and writes the rows of flat Parquet files.
+//
+// Only what order logs need is supported: top-level primitive columns,
+// PLAIN and dictionary encodings, and uncompressed, Snappy, or gzip pages.
+// Nested and repeated columns are skipped. Files are written with optional
+// string and timestamp columns, PLAIN encoded and uncompressed.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"time"
+)
+
+// magic starts and ends every Parquet file
+const magic = "PAR1"
+
+// Physical types
+const (
+	typeBoolean   = 0
+	typeInt32     = 1
+	typeInt64     = 2
+	typeInt96     = 3
+	typeFloat     = 4
+	typeDouble    = 5
+	typeByteArray = 6
+	typeFixed     = 7
+)
+
+// Converted types, the legacy form of logical types
+const (
+	convertedUTF8            = 0
+	convertedDecimal         = 5
+	convertedDate            = 6
+	convertedTimestampMillis = 9
+	convertedTimestampMicros = 10
+)
+
+// Page types
+const (
+	pageData       = 0
+	pageDictionary = 2
+	pageDataV2     = 3
+)
+
+// Encodings
+const (
+	encodingPlain           = 0
+	encodingPlainDictionary = 2
+	encodingRLE             = 3
+	encodingRLEDictionary   = 8
+)
+
+// maxPageSize bounds the uncompressed size of a page
+const maxPageSize = 1 << 30
+
+// Repetition types
+const (
+	repetitionRequired = 0
+	repetitionOptional = 1
+)
+
+// column is a readable top-level column
+type column struct {
+	name       string
+	index      int
+	typ        int64
+	typeLength int
+	optional   bool
+	decimal    bool
+	scale      int
+	date       bool
+	// unit is the timestamp unit, or zero if the column is not a timestamp
+	unit time.Duration
+}
+
+// File reads the rows of a Parquet file one row group at a time
+type File struct {
+	r         io.ReaderAt
+	size      int64
+	columns   []column
+	rowGroups []tstruct
+
+	group  int
+	values [][]interface{}
+	rows   int
+	row    int
+}
+
+// Open reads the metadata of a Parquet file
+func Open(r io.ReaderAt, size int64) (*File, error) {
+	if size < 12 {
+		return nil, fmt.Errorf("not a Parquet file")
+	}
+	tail := make([]byte, 8)
+	if _, err := r.ReadAt(tail, size-8); err != nil {
+		return nil, fmt.Errorf("failed to read Parquet footer: %w", err)
+	}
+	head := make([]byte, 4)
+	if _, err := r.ReadAt(head, 0); err != nil {
+		return nil, fmt.Errorf("failed to read Parquet header: %w", err)
+	}
+	if string(tail[4:]) != magic || string(head) != magic {
+		return nil, fmt.Errorf("not a Parquet file")
+	}
+	length := int64(binary.LittleEndian.Uint32(tail))
+	if length <= 0 || length > size-12 {
+		return nil, fmt.Errorf("invalid Parquet footer length %d", length)
+	}
+	footer := make([]byte, length)
+	if _, err := r.ReadAt(footer, size-8-length); err != nil {
+		return nil, fmt.Errorf("failed to read Parquet footer: %w", err)
+	}
+	meta, _, err := decodeStruct(footer)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{r: r, size: size}
+	for _, rg := range meta.list(4) {
+		if s, ok := rg.(tstruct); ok {
+			f.rowGroups = append(f.rowGroups, s)
+		}
+	}
+
+	// The schema is a depth-first list of elements, starting with the root
+	schema := meta.list(2)
+	if len(schema) == 0 {
+		return nil, fmt.Errorf("Parquet file has no schema")
+	}
+	i, leaf := 1, 0
+	root, _ := schema[0].(tstruct)
+	for n := root.int(5); n > 0 && i < len(schema); n-- {
+		el, _ := schema[i].(tstruct)
+		if el.int(5) > 0 {
+			// Skip the whole group
+			i = skipGroup(schema, i, &leaf)
+			continue
+		}
+		i++
+		if el.int(3) > 1 {
+			// Repeated primitive
+			leaf++
+			continue
+		}
+		f.columns = append(f.columns, newColumn(el, leaf))
+		leaf++
+	}
+	return f, nil
+}
+
+// skipGroup skips the schema element at i and all its descendants, counting
+// the leaf columns passed
+func skipGroup(schema []interface{}, i int, leaf *int) int {
+	el, _ := schema[i].(tstruct)
+	i++
+	children := el.int(5)
+	if children == 0 {
+		*leaf++
+		return i
+	}
+	for ; children > 0 && i < len(schema); children-- {
+		i = skipGroup(schema, i, leaf)
+	}
+	return i
+}
+
+func newColumn(el tstruct, index int) column {
+	c := column{
+		name:       el.str(4),
+		index:      index,
+		typ:        el.int(1),
+		typeLength: int(el.int(2)),
+		optional:   el.int(3) != repetitionRequired,
+		scale:      int(el.int(7)),
+	}
+
+	switch el.int(6) {
+	case convertedDecimal:
+		c.decimal = true
+	case convertedDate:
+		c.date = true
+	case convertedTimestampMillis:
+		c.unit = time.Millisecond
+	case convertedTimestampMicros:
+		c.unit = time.Microsecond
+	}
+
+	// Logical types supersede converted types
+	logical := el.sub(10)
+	if d := logical.sub(5); d != nil {
+		c.decimal = true
+		c.scale = int(d.int(1))
+	}
+	if logical.has(6) {
+		c.date = true
+	}
+	if ts := logical.sub(8); ts != nil {
+		switch unit := ts.sub(2); {
+		case unit.has(1):
+			c.unit = time.Millisecond
+		case unit.has(2):
+			c.unit = time.Microsecond
+		case unit.has(3):
+			c.unit = time.Nanosecond
+		}
+	}
+	return c
+}
+
+// Columns returns the names of the columns that are read
+func (f *File) Columns() []string {
+	names := make([]string, len(f.columns))
+	for i, c := range f.columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+// Next returns the next row as a map from column name to value, or io.EOF
+// after the last row. Values are bool, string, or json.Number; null values
+// are omitted. Timestamps are formatted as RFC 3339 and dates as YYYY-MM-DD.
+func (f *File) Next() (map[string]interface{}, error) {
+	for f.row >= f.rows {
+		if f.group >= len(f.rowGroups) {
+			return nil, io.EOF
+		}
+		if err := f.readRowGroup(f.rowGroups[f.group]); err != nil {
+			return nil, fmt.Errorf("row group %d: %w", f.group, err)
+		}
+		f.group++
+	}
+
+	row := make(map[string]interface{}, len(f.columns))
+	for i, c := range f.columns {
+		if v := f.values[i][f.row]; v != nil {
+			row[c.name] = v
+		}
+	}
+	f.row++
+	return row, nil
+}
+
+// readRowGroup decodes every column of a row group
+func (f *File) readRowGroup(rg tstruct) error {
+	rows := int(rg.int(3))
+	if rows < 0 {
+		return fmt.Errorf("invalid row count %d", rows)
+	}
+	chunks := rg.list(1)
+	values := make([][]interface{}, len(f.columns))
+	for i, c := range f.columns {
+		if c.index >= len(chunks) {
+			return fmt.Errorf("missing column chunk for %s", c.name)
+		}
+		chunk, _ := chunks[c.index].(tstruct)
+		v, err := f.readChunk(c, chunk, rows)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", c.name, err)
+		}
+		values[i] = v
+	}
+	f.values, f.rows, f.row = values, rows, 0
+	return nil
+}
+
+// readChunk decodes the values of one column in a row group
+func (f *File) readChunk(c column, chunk tstruct, rows int) ([]interface{}, error) {
+	if chunk.str(1) != "" {
+		return nil, fmt.Errorf("column chunks in external files are not supported")
+	}
+	md := chunk.sub(3)
+	codec := md.int(4)
+	start := md.int(9)
+	if off := md.int(11); off > 0 && off < start {
+		start = off
+	}
+	length := md.int(7)
+	if start < 4 || length <= 0 || start > f.size || length > f.size-start {
+		return nil, fmt.Errorf("invalid column chunk location")
+	}
+	buf := make([]byte, length)
+	if _, err := f.r.ReadAt(buf, start); err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, 0, min(rows, 1<<16))
+	var dict []interface{}
+	maxDef := 0
+	if c.optional {
+		maxDef = 1
+	}
+	for pos := 0; len(values) < rows; {
+		if pos >= len(buf) {
+			return nil, fmt.Errorf("expected %d values, found %d", rows, len(values))
+		}
+		header, n, err := decodeStruct(buf[pos:])
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+		size := int(header.int(3))
+		if size < 0 || size > len(buf)-pos {
+			return nil, fmt.Errorf("page extends past the column chunk")
+		}
+		page := buf[pos : pos+size]
+		pos += size
+		uncompressed := int(header.int(2))
+		if uncompressed < 0 || uncompressed > maxPageSize {
+			return nil, fmt.Errorf("invalid page size %d", uncompressed)
+		}
+
+		var count int
+		var levels []int32
+		var data []byte
+		var encoding int64
+		switch header.int(1) {
+		case pageDictionary:
+			data, err := decompress(codec, page, uncompressed)
+			if err != nil {
+				return nil, err
+			}
+			n := int(header.sub(7).int(1))
+			if n < 0 || n > len(data)*8 {
+				return nil, fmt.Errorf("invalid dictionary size %d", n)
+			}
+			if dict, err = c.decodePlain(data, n); err != nil {
+				return nil, fmt.Errorf("dictionary page: %w", err)
+			}
+			continue
+
+		case pageData:
+			if data, err = decompress(codec, page, uncompressed); err != nil {
+				return nil, err
+			}
+			dh := header.sub(5)
+			count, encoding = int(dh.int(1)), dh.int(2)
+			if count < 0 || count > rows-len(values) {
+				return nil, fmt.Errorf("page has %d values, expected at most %d", count, rows-len(values))
+			}
+			if maxDef > 0 {
+				if dh.int(3) != encodingRLE {
+					return nil, fmt.Errorf("unsupported definition level encoding %d", dh.int(3))
+				}
+				if len(data) < 4 {
+					return nil, fmt.Errorf("truncated data page")
+				}
+				n := int(binary.LittleEndian.Uint32(data))
+				if n < 0 || 4+n > len(data) {
+					return nil, fmt.Errorf("truncated data page")
+				}
+				if levels, err = decodeHybrid(data[4:4+n], bits.Len(uint(maxDef)), count); err != nil {
+					return nil, err
+				}
+				data = data[4+n:]
+			}
+
+		case pageDataV2:
+			dh := header.sub(8)
+			count, encoding = int(dh.int(1)), dh.int(4)
+			if count < 0 || count > rows-len(values) {
+				return nil, fmt.Errorf("page has %d values, expected at most %d", count, rows-len(values))
+			}
+			defLen, repLen := int(dh.int(5)), int(dh.int(6))
+			if repLen < 0 || defLen < 0 || repLen > len(page) || defLen > len(page)-repLen {
+				return nil, fmt.Errorf("truncated data page")
+			}
+			if maxDef > 0 {
+				if levels, err = decodeHybrid(page[repLen:repLen+defLen], bits.Len(uint(maxDef)), count); err != nil {
+					return nil, err
+				}
+			}
+			data = page[repLen+defLen:]
+			if dh.bool(7, true) {
+				if data, err = decompress(codec, data, uncompressed-repLen-defLen); err != nil {
+					return nil, err
+				}
+			}
+
+		default:
+			continue
+		}
+
+		present := count
+		if levels != nil {
+			present = 0
+			for _, l := range levels {
+				if int(l) == maxDef {
+					present++
+				}
+			}
+		}
+
+		var decoded []interface{}
+		switch encoding {
+		case encodingPlain:
+			decoded, err = c.decodePlain(data, present)
+		case encodingPlainDictionary, encodingRLEDictionary:
+			decoded, err = decodeDictionary(data, dict, present)
+		default:
+			err = fmt.Errorf("unsupported encoding %d", encoding)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Interleave the nulls
+		j := 0
+		for i := 0; i < count; i++ {
+			if levels != nil && int(levels[i]) != maxDef {
+				values = append(values, nil)
+				continue
+			}
+			values = append(values, decoded[j])
+			j++
+		}
+	}
+	return values[:rows], nil
+}
+
+// decodeDictionary looks up n dictionary indices
+func decodeDictionary(data []byte, dict []interface{}, n int) ([]interface{}, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("truncated dictionary indices")
+	}
+	if data[0] > 32 {
+		return nil, fmt.Errorf("invalid dictionary index bit width %d", data[0])
+	}
+	indices, err := decodeHybrid(data[1:], int(data[0]), n)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, n)
+	for i, idx := range indices {
+		if idx < 0 || int(idx) >= len(dict) {
+			return nil, fmt.Errorf("dictionary index %d out of range", idx)
+		}
+		values[i] = dict[idx]
+	}
+	return values, nil
+}
+
+// decodePlain decodes n PLAIN-encoded values
+func (c column) decodePlain(data []byte, n int) ([]interface{}, error) {
+	truncated := fmt.Errorf("truncated page data")
+	// Every value takes at least a bit
+	if n > len(data)*8 {
+		return nil, truncated
+	}
+	values := make([]interface{}, 0, n)
+	pos := 0
+	for i := 0; i < n; i++ {
+		switch c.typ {
+		case typeBoolean:
+			if i/8 >= len(data) {
+				return nil, truncated
+			}
+			values = append(values, data[i/8]>>(i%8)&1 == 1)
+		case typeInt32:
+			if pos+4 > len(data) {
+				return nil, truncated
+			}
+			values = append(values, c.integer(int64(int32(binary.LittleEndian.Uint32(data[pos:])))))
+			pos += 4
+		case typeInt64:
+			if pos+8 > len(data) {
+				return nil, truncated
+			}
+			values = append(values, c.integer(int64(binary.LittleEndian.Uint64(data[pos:]))))
+			pos += 8
+		case typeInt96:
+			if pos+12 > len(data) {
+				return nil, truncated
+			}
+			// Nanoseconds of the day followed by the Julian day
+			nanos := int64(binary.LittleEndian.Uint64(data[pos:]))
+			day := int64(binary.LittleEndian.Uint32(data[pos+8:]))
+			values = append(values, time.Unix((day-2440588)*86400, nanos).UTC().Format(time.RFC3339Nano))
+			pos += 12
+		case typeFloat:
+			if pos+4 > len(data) {
+				return nil, truncated
+			}
+			values = append(values, float(float64(math.Float32frombits(binary.LittleEndian.Uint32(data[pos:]))), 32))
+			pos += 4
+		case typeDouble:
+			if pos+8 > len(data) {
+				return nil, truncated
+			}
+			values = append(values, float(math.Float64frombits(binary.LittleEndian.Uint64(data[pos:])), 64))
+			pos += 8
+		case typeByteArray, typeFixed:
+			length := c.typeLength
+			if c.typ == typeByteArray {
+				if pos+4 > len(data) {
+					return nil, truncated
+				}
+				length = int(binary.LittleEndian.Uint32(data[pos:]))
+				pos += 4
+			}
+			if length < 0 || length > len(data)-pos {
+				return nil, truncated
+			}
+			values = append(values, c.binary(data[pos:pos+length]))
+			pos += length
+		default:
+			return nil, fmt.Errorf("unsupported physical type %d", c.typ)
+		}
+	}
+	return values, nil
+}
+
+// integer converts an integer value according to the column's logical type
+func (c column) integer(v int64) interface{} {
+	switch {
+	case c.decimal:
+		return decimal(big.NewInt(v), c.scale)
+	case c.date:
+		return time.Unix(v*86400, 0).UTC().Format("2006-01-02")
+	case c.unit == time.Millisecond:
+		return time.UnixMilli(v).UTC().Format(time.RFC3339Nano)
+	case c.unit == time.Microsecond:
+		return time.UnixMicro(v).UTC().Format(time.RFC3339Nano)
+	case c.unit == time.Nanosecond:
+		return time.Unix(0, v).UTC().Format(time.RFC3339Nano)
+	default:
+		return json.Number(strconv.FormatInt(v, 10))
+	}
+}
+
+// binary converts a byte array value, which is a string unless the column
+// holds big-endian two's complement decimals
+func (c column) binary(b []byte) interface{} {
+	if !c.decimal {
+		return string(b)
+	}
+	v := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+	return decimal(v, c.scale)
+}
+
+// float formats a floating point value, mapping NaN and infinities to null
+func float(v float64, bitSize int) interface{} {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return json.Number(strconv.FormatFloat(v, 'f', -1, bitSize))
+}
+
+// decimal formats an unscaled decimal value
+func decimal(unscaled *big.Int, scale int) json.Number {
+	if scale <= 0 {
+		return json.Number(unscaled.String())
+	}
+	digits := new(big.Int).Abs(unscaled).String()
+	if len(digits) <= scale {
+		digits = string(bytes.Repeat([]byte("0"), scale-len(digits)+1)) + digits
+	}
+	s := digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	if unscaled.Sign() < 0 {
+		s = "-" + s
+	}
+	return json.Number(s)
+}
@@ -0,0 +1,386 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixtureColumn is a column of a fixture file: its schema element and the
+// pages of its chunk
+type fixtureColumn struct {
+	element []tfield
+	pages   [][]byte
+	// size overrides the chunk size recorded in the metadata
+	size int64
+}
+
+// buildFile builds a Parquet file of one row group holding the columns
+func buildFile(codec int32, rows int64, columns ...fixtureColumn) []byte {
+	file := []byte(magic)
+	schema := []interface{}{[]tfield{{4, "schema"}, {5, int32(len(columns))}}}
+	var chunks []interface{}
+	for _, c := range columns {
+		offset := int64(len(file))
+		for _, p := range c.pages {
+			file = append(file, p...)
+		}
+		size := int64(len(file)) - offset
+		if c.size != 0 {
+			size = c.size
+		}
+		schema = append(schema, c.element)
+		chunks = append(chunks, []tfield{
+			{2, offset},
+			{3, []tfield{
+				{1, c.element[0].value},
+				{2, []interface{}{int32(encodingPlain), int32(encodingRLE)}},
+				{3, []interface{}{c.element[2].value}},
+				{4, codec},
+				{5, rows},
+				{6, size},
+				{7, size},
+				{9, offset},
+			}},
+		})
+	}
+	footer := encodeStruct([]tfield{
+		{1, int32(1)},
+		{2, schema},
+		{3, rows},
+		{4, []interface{}{[]tfield{{1, chunks}, {2, int64(len(file) - 4)}, {3, rows}}}},
+	})
+	file = append(file, footer...)
+	file = binary.LittleEndian.AppendUint32(file, uint32(len(footer)))
+	return append(file, magic...)
+}
+
+// element describes a column in the schema
+func element(name string, typ, repetition int32, extra ...tfield) []tfield {
+	return append([]tfield{{1, typ}, {3, repetition}, {4, name}}, extra...)
+}
+
+// compress compresses page data with a codec of the fixture files
+func compress(codec int32, data []byte) []byte {
+	if codec != codecSnappy {
+		return data
+	}
+	return snappyLiterals(data)
+}
+
+// snappyLiterals encodes data as a Snappy block of literals alone
+func snappyLiterals(data []byte) []byte {
+	out := binary.AppendUvarint(nil, uint64(len(data)))
+	for len(data) > 0 {
+		n := min(len(data), 60)
+		out = append(out, byte(n-1)<<2)
+		out = append(out, data[:n]...)
+		data = data[n:]
+	}
+	return out
+}
+
+// dataPage builds a version 1 data page of count values from its
+// uncompressed body: the length-prefixed definition levels of optional
+// columns, then the values
+func dataPage(codec int32, count int, encoding int32, body []byte) []byte {
+	data := compress(codec, body)
+	header := encodeStruct([]tfield{
+		{1, int32(pageData)},
+		{2, int32(len(body))},
+		{3, int32(len(data))},
+		{5, []tfield{
+			{1, int32(count)},
+			{2, encoding},
+			{3, int32(encodingRLE)},
+			{4, int32(encodingRLE)},
+		}},
+	})
+	return append(header, data...)
+}
+
+// dataPageV2 builds a version 2 data page, whose definition levels are
+// stored uncompressed ahead of the values
+func dataPageV2(codec int32, count, nulls int, levels, values []byte) []byte {
+	data := append(append([]byte(nil), levels...), compress(codec, values)...)
+	header := encodeStruct([]tfield{
+		{1, int32(pageDataV2)},
+		{2, int32(len(levels) + len(values))},
+		{3, int32(len(data))},
+		{8, []tfield{
+			{1, int32(count)},
+			{2, int32(nulls)},
+			{3, int32(count)},
+			{4, int32(encodingPlain)},
+			{5, int32(len(levels))},
+			{6, int32(0)},
+		}},
+	})
+	return append(header, data...)
+}
+
+// dictionaryPage builds a dictionary page of n PLAIN values
+func dictionaryPage(codec int32, n int, values []byte) []byte {
+	data := compress(codec, values)
+	header := encodeStruct([]tfield{
+		{1, int32(pageDictionary)},
+		{2, int32(len(values))},
+		{3, int32(len(data))},
+		{7, []tfield{{1, int32(n)}, {2, int32(encodingPlain)}}},
+	})
+	return append(header, data...)
+}
+
+// bitPacked encodes values of one bit as a single bit-packed run of the
+// RLE/bit-packing hybrid encoding
+func bitPacked(bits ...int) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, b := range bits {
+		packed[i/8] |= byte(b) << (i % 8)
+	}
+	return append([]byte{byte(len(packed))<<1 | 1}, packed...)
+}
+
+// levels prefixes the definition levels of a version 1 page with their length
+func levels(bits ...int) []byte {
+	hybrid := bitPacked(bits...)
+	return append(binary.LittleEndian.AppendUint32(nil, uint32(len(hybrid))), hybrid...)
+}
+
+func plainStrings(values ...string) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(v)))
+		b = append(b, v...)
+	}
+	return b
+}
+
+func plainInt64s(values ...int64) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.LittleEndian.AppendUint64(b, uint64(v))
+	}
+	return b
+}
+
+// ordersFile is a fixture of three orders: ids split over two PLAIN pages,
+// dictionary encoded symbols, a decimal quantity with a null in a version 1
+// page, a timestamp with a null in a version 2 page, and booleans
+func ordersFile(codec int32) []byte {
+	placed := time.Date(2024, 3, 1, 9, 30, 0, 123456000, time.UTC).UnixMicro()
+	return buildFile(codec, 3,
+		fixtureColumn{
+			element: element("order_id", typeByteArray, repetitionRequired, tfield{6, int32(convertedUTF8)}),
+			pages: [][]byte{
+				dataPage(codec, 2, encodingPlain, plainStrings("o1", "o2")),
+				dataPage(codec, 1, encodingPlain, plainStrings("o3")),
+			},
+		},
+		fixtureColumn{
+			element: element("symbol", typeByteArray, repetitionRequired, tfield{6, int32(convertedUTF8)}),
+			pages: [][]byte{
+				dictionaryPage(codec, 2, plainStrings("TSLA", "AAPL")),
+				dataPage(codec, 3, encodingRLEDictionary, append([]byte{1}, bitPacked(0, 1, 0)...)),
+			},
+		},
+		fixtureColumn{
+			element: element("quantity", typeInt64, repetitionOptional,
+				tfield{6, int32(convertedDecimal)}, tfield{7, int32(2)}, tfield{8, int32(18)}),
+			pages: [][]byte{
+				dataPage(codec, 3, encodingPlain, append(levels(1, 0, 1), plainInt64s(15050, -5)...)),
+			},
+		},
+		fixtureColumn{
+			element: element("timestamp", typeInt64, repetitionOptional, tfield{6, int32(convertedTimestampMicros)}),
+			pages: [][]byte{
+				dataPageV2(codec, 3, 1, bitPacked(1, 0, 1), plainInt64s(placed, placed+876544)),
+			},
+		},
+		fixtureColumn{
+			element: element("active", typeBoolean, repetitionRequired),
+			pages:   [][]byte{dataPage(codec, 3, encodingPlain, []byte{0b101})},
+		},
+	)
+}
+
+// readAll reads every row of a file
+func readAll(data []byte) ([]map[string]interface{}, error) {
+	f, err := Open(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var rows []map[string]interface{}
+	for {
+		row, err := f.Next()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+func TestReadPages(t *testing.T) {
+	want := []map[string]interface{}{
+		{"order_id": "o1", "symbol": "TSLA", "quantity": json.Number("150.50"), "timestamp": "2024-03-01T09:30:00.123456Z", "active": true},
+		{"order_id": "o2", "symbol": "AAPL", "active": false},
+		{"order_id": "o3", "symbol": "TSLA", "quantity": json.Number("-0.05"), "timestamp": "2024-03-01T09:30:01Z", "active": true},
+	}
+	for name, codec := range map[string]int32{"plain": codecUncompressed, "snappy": codecSnappy} {
+		t.Run(name, func(t *testing.T) {
+			rows, err := readAll(ordersFile(codec))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rows, want) {
+				t.Errorf("rows = %v\nwant %v", rows, want)
+			}
+		})
+	}
+}
+
+func TestOpenSkipsNestedColumns(t *testing.T) {
+	data := buildFile(codecUncompressed, 1,
+		fixtureColumn{
+			element: element("order_id", typeByteArray, repetitionRequired),
+			pages:   [][]byte{dataPage(codecUncompressed, 1, encodingPlain, plainStrings("o1"))},
+		},
+		fixtureColumn{
+			element: element("tags", typeByteArray, 2),
+			pages:   [][]byte{dataPage(codecUncompressed, 0, encodingPlain, nil)},
+		},
+		fixtureColumn{
+			element: element("price", typeDouble, repetitionRequired),
+			pages:   [][]byte{dataPage(codecUncompressed, 1, encodingPlain, binary.LittleEndian.AppendUint64(nil, math.Float64bits(180.5)))},
+		},
+	)
+	f, err := Open(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(f.Columns(), ","); got != "order_id,price" {
+		t.Errorf("columns = %s, want order_id,price", got)
+	}
+	row, err := f.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row["order_id"] != "o1" || row["price"] != json.Number("180.5") {
+		t.Errorf("row = %v, want order o1 at 180.5", row)
+	}
+}
+
+// Lengths read from a file are checked before they are used, however large
+func TestReadCorruptLengths(t *testing.T) {
+	const huge = math.MaxInt64
+	id := element("order_id", typeByteArray, repetitionRequired)
+	tests := []struct {
+		name   string
+		column fixtureColumn
+	}{
+		{"chunk size", fixtureColumn{element: id, size: huge,
+			pages: [][]byte{dataPage(codecUncompressed, 1, encodingPlain, plainStrings("o1"))}}},
+		{"page size", fixtureColumn{element: id, pages: [][]byte{append(encodeStruct([]tfield{
+			{1, int32(pageData)},
+			{2, int64(huge)},
+			{3, int64(huge)},
+			{5, []tfield{{1, int32(1)}, {2, int32(encodingPlain)}}},
+		}), plainStrings("o1")...)}}},
+		{"uncompressed page size", fixtureColumn{element: id, pages: [][]byte{append(encodeStruct([]tfield{
+			{1, int32(pageData)},
+			{2, int64(huge)},
+			{3, int32(6)},
+			{5, []tfield{{1, int32(1)}, {2, int32(encodingPlain)}}},
+		}), plainStrings("o1")...)}}},
+		{"string length", fixtureColumn{element: id,
+			pages: [][]byte{dataPage(codecUncompressed, 1, encodingPlain, []byte{0xff, 0xff, 0xff, 0xff, 'o'})}}},
+		{"fixed length", fixtureColumn{element: element("order_id", typeFixed, repetitionRequired, tfield{2, int64(huge)}),
+			pages: [][]byte{dataPage(codecUncompressed, 1, encodingPlain, []byte("o1"))}}},
+		{"value count", fixtureColumn{element: id,
+			pages: [][]byte{dataPage(codecUncompressed, 1, encodingPlain, nil)}}},
+		{"definition levels length", fixtureColumn{element: element("order_id", typeByteArray, repetitionOptional),
+			pages: [][]byte{dataPage(codecUncompressed, 1, encodingPlain, []byte{0xff, 0xff, 0xff, 0x7f, 3, 1})}}},
+		{"bit-packed groups", fixtureColumn{element: element("order_id", typeByteArray, repetitionOptional),
+			pages: [][]byte{dataPage(codecUncompressed, 1, encodingPlain,
+				append(binary.LittleEndian.AppendUint32(nil, 10), binary.AppendUvarint(nil, huge)...))}}},
+		{"version 2 level lengths", fixtureColumn{element: id, pages: [][]byte{append(encodeStruct([]tfield{
+			{1, int32(pageDataV2)},
+			{2, int32(6)},
+			{3, int32(6)},
+			{8, []tfield{{1, int32(1)}, {4, int32(encodingPlain)}, {5, int64(huge)}, {6, int64(huge)}}},
+		}), plainStrings("o1")...)}}},
+		{"dictionary size", fixtureColumn{element: id, pages: [][]byte{
+			dictionaryPage(codecUncompressed, huge/8, plainStrings("TSLA")),
+			dataPage(codecUncompressed, 1, encodingRLEDictionary, []byte{1, 2, 0}),
+		}}},
+		{"dictionary bit width", fixtureColumn{element: id, pages: [][]byte{
+			dictionaryPage(codecUncompressed, 1, plainStrings("TSLA")),
+			dataPage(codecUncompressed, 1, encodingRLEDictionary, []byte{255, 2, 0}),
+		}}},
+		{"dictionary index", fixtureColumn{element: id, pages: [][]byte{
+			dictionaryPage(codecUncompressed, 1, plainStrings("TSLA")),
+			dataPage(codecUncompressed, 1, encodingRLEDictionary, []byte{1, 2, 1}),
+		}}},
+		{"snappy length", fixtureColumn{element: id, pages: [][]byte{append(encodeStruct([]tfield{
+			{1, int32(pageData)},
+			{2, int32(6)},
+			{3, int32(8)},
+			{5, []tfield{{1, int32(1)}, {2, int32(encodingPlain)}}},
+		}), 6, 0xf4, 0xff, 0xff, 0xff, 0x7f, 'o', '1')}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec := int32(codecUncompressed)
+			if tt.name == "snappy length" {
+				codec = codecSnappy
+			}
+			if _, err := readAll(buildFile(codec, 1, tt.column)); err == nil {
+				t.Error("read without an error")
+			}
+		})
+	}
+}
+
+// Corrupting any byte of a file is an error or goes unnoticed, never a panic
+func TestReadCorruptBytes(t *testing.T) {
+	for _, codec := range []int32{codecUncompressed, codecSnappy} {
+		data := ordersFile(codec)
+		for i := range data {
+			for _, b := range []byte{0, 0x7f, 0xff, data[i] ^ 0x80} {
+				corrupt := append([]byte(nil), data...)
+				corrupt[i] = b
+				func() {
+					defer func() {
+						if r := recover(); r != nil {
+							t.Fatalf("codec %d: byte %d set to %#x: panic: %v", codec, i, b, r)
+						}
+					}()
+					readAll(corrupt)
+				}()
+			}
+		}
+	}
+}
+
+func TestThriftRejectsHugeLengths(t *testing.T) {
+	for name, data := range map[string][]byte{
+		// A binary field 1 whose length is close to the maximum int
+		"binary": append([]byte{0x18}, binary.AppendUvarint(nil, math.MaxInt64-1)...),
+		// A list field 1 whose size is negative as an int
+		"list": append([]byte{0x19, 0xf5}, binary.AppendUvarint(nil, math.MaxUint64)...),
+	} {
+		if _, _, err := decodeStruct(data); err == nil {
+			t.Errorf("%s: decoded without an error", name)
+		}
+	}
+}
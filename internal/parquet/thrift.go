@@ -0,0 +1,317 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Thrift compact protocol type ids
+const (
+	ctStop   = 0
+	ctTrue   = 1
+	ctFalse  = 2
+	ctByte   = 3
+	ctI16    = 4
+	ctI32    = 5
+	ctI64    = 6
+	ctDouble = 7
+	ctBinary = 8
+	ctList   = 9
+	ctSet    = 10
+	ctMap    = 11
+	ctStruct = 12
+)
+
+// maxDepth bounds struct nesting, so corrupt metadata cannot exhaust the stack
+const maxDepth = 32
+
+// tstruct is a decoded Thrift struct keyed by field id. Values are bool,
+// int64, float64, []byte, []interface{}, or tstruct; maps are skipped.
+type tstruct map[int16]interface{}
+
+func (s tstruct) has(id int16) bool {
+	_, ok := s[id]
+	return ok
+}
+
+func (s tstruct) int(id int16) int64 {
+	v, _ := s[id].(int64)
+	return v
+}
+
+func (s tstruct) bool(id int16, def bool) bool {
+	if v, ok := s[id].(bool); ok {
+		return v
+	}
+	return def
+}
+
+func (s tstruct) str(id int16) string {
+	v, _ := s[id].([]byte)
+	return string(v)
+}
+
+func (s tstruct) list(id int16) []interface{} {
+	v, _ := s[id].([]interface{})
+	return v
+}
+
+func (s tstruct) sub(id int16) tstruct {
+	v, _ := s[id].(tstruct)
+	return v
+}
+
+// thriftReader decodes the Thrift compact protocol from a buffer
+type thriftReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+// decodeStruct decodes one struct from the start of buf, returning it and the
+// number of bytes it occupied
+func decodeStruct(buf []byte) (tstruct, int, error) {
+	r := &thriftReader{buf: buf}
+	s := r.readStruct(0)
+	if r.err != nil {
+		return nil, 0, fmt.Errorf("invalid Thrift metadata: %w", r.err)
+	}
+	return s, r.pos, nil
+}
+
+func (r *thriftReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.buf) {
+		r.fail(io.ErrUnexpectedEOF)
+		return 0
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	if r.pos >= len(r.buf) {
+		r.fail(io.ErrUnexpectedEOF)
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		r.fail(fmt.Errorf("malformed varint"))
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+// varint reads a zigzag-encoded integer
+func (r *thriftReader) varint() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) bytes(n int) []byte {
+	if n < 0 || n > len(r.buf)-r.pos {
+		r.fail(io.ErrUnexpectedEOF)
+		return nil
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *thriftReader) readStruct(depth int) tstruct {
+	if depth > maxDepth {
+		r.fail(fmt.Errorf("structs nested too deeply"))
+		return nil
+	}
+	s := make(tstruct)
+	var id int16
+	for r.err == nil {
+		header := r.byte()
+		typ := header & 0x0f
+		if typ == ctStop {
+			break
+		}
+		if delta := header >> 4; delta != 0 {
+			id += int16(delta)
+		} else {
+			id = int16(r.varint())
+		}
+
+		switch typ {
+		case ctTrue:
+			s[id] = true
+		case ctFalse:
+			s[id] = false
+		default:
+			s[id] = r.readValue(typ, depth)
+		}
+	}
+	return s
+}
+
+func (r *thriftReader) readValue(typ byte, depth int) interface{} {
+	switch typ {
+	case ctTrue, ctFalse:
+		// Booleans inside lists take a byte each
+		return r.byte() == ctTrue
+	case ctByte:
+		return int64(int8(r.byte()))
+	case ctI16, ctI32, ctI64:
+		return r.varint()
+	case ctDouble:
+		b := r.bytes(8)
+		if b == nil {
+			return nil
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	case ctBinary:
+		return r.bytes(int(r.uvarint()))
+	case ctList, ctSet:
+		header := r.byte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		// Every element takes at least a byte
+		if size < 0 || size > len(r.buf)-r.pos {
+			r.fail(io.ErrUnexpectedEOF)
+			return nil
+		}
+		list := make([]interface{}, 0, size)
+		for i := 0; i < size && r.err == nil; i++ {
+			list = append(list, r.readValue(header&0x0f, depth+1))
+		}
+		return list
+	case ctMap:
+		size := int(r.uvarint())
+		if size == 0 {
+			return nil
+		}
+		types := r.byte()
+		for i := 0; i < size && r.err == nil; i++ {
+			r.readValue(types>>4, depth+1)
+			r.readValue(types&0x0f, depth+1)
+		}
+		return nil
+	case ctStruct:
+		return r.readStruct(depth + 1)
+	default:
+		r.fail(fmt.Errorf("unknown Thrift type %d", typ))
+		return nil
+	}
+}
+
+// tfield is a field of a Thrift struct to encode. Values are bool, int32,
+// int64, string, []interface{} for lists, or []tfield for structs.
+type tfield struct {
+	id    int16
+	value interface{}
+}
+
+// encodeStruct encodes a struct in the Thrift compact protocol. Fields must
+// be in ascending id order.
+func encodeStruct(fields []tfield) []byte {
+	w := &thriftWriter{}
+	w.writeStruct(fields)
+	return w.buf
+}
+
+// thriftWriter encodes the Thrift compact protocol into a buffer
+type thriftWriter struct {
+	buf []byte
+}
+
+func (w *thriftWriter) uvarint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+// varint writes a zigzag-encoded integer
+func (w *thriftWriter) varint(v int64) {
+	w.uvarint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (w *thriftWriter) writeStruct(fields []tfield) {
+	var id int16
+	for _, f := range fields {
+		typ := thriftType(f.value)
+		if b, ok := f.value.(bool); ok && !b {
+			typ = ctFalse
+		}
+		if delta := f.id - id; delta > 0 && delta <= 15 {
+			w.buf = append(w.buf, byte(delta)<<4|typ)
+		} else {
+			w.buf = append(w.buf, typ)
+			w.varint(int64(f.id))
+		}
+		id = f.id
+
+		// Booleans are held in the field header
+		if _, ok := f.value.(bool); !ok {
+			w.writeValue(f.value)
+		}
+	}
+	w.buf = append(w.buf, ctStop)
+}
+
+func (w *thriftWriter) writeValue(v interface{}) {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			w.buf = append(w.buf, ctTrue)
+		} else {
+			w.buf = append(w.buf, ctFalse)
+		}
+	case int32:
+		w.varint(int64(v))
+	case int64:
+		w.varint(v)
+	case string:
+		w.uvarint(uint64(len(v)))
+		w.buf = append(w.buf, v...)
+	case []interface{}:
+		elem := byte(ctStruct)
+		if len(v) > 0 {
+			elem = thriftType(v[0])
+		}
+		if len(v) < 15 {
+			w.buf = append(w.buf, byte(len(v))<<4|elem)
+		} else {
+			w.buf = append(w.buf, 0xf0|elem)
+			w.uvarint(uint64(len(v)))
+		}
+		for _, e := range v {
+			w.writeValue(e)
+		}
+	case []tfield:
+		w.writeStruct(v)
+	default:
+		panic(fmt.Sprintf("parquet: cannot encode %T as Thrift", v))
+	}
+}
+
+// thriftType returns the compact protocol type of a value to encode
+func thriftType(v interface{}) byte {
+	switch v.(type) {
+	case bool:
+		return ctTrue
+	case int32:
+		return ctI32
+	case int64:
+		return ctI64
+	case string:
+		return ctBinary
+	case []interface{}:
+		return ctList
+	default:
+		return ctStruct
+	}
+}
@@ -0,0 +1,216 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Column describes a column written by a Writer
+type Column struct {
+	Name string
+	// Unit makes the column a timestamp of that precision, time.Microsecond
+	// or time.Nanosecond, rather than a string
+	Unit time.Duration
+}
+
+// Writer writes rows to a Parquet file. Every column is optional, so nil
+// values are written as nulls.
+type Writer struct {
+	w       io.Writer
+	columns []Column
+	offset  int64
+	rows    int64
+	groups  []interface{}
+	err     error
+}
+
+// NewWriter creates a writer for a file with the given columns
+func NewWriter(w io.Writer, columns []Column) *Writer {
+	return &Writer{w: w, columns: columns}
+}
+
+// write writes to the file, starting it with the magic number
+func (w *Writer) write(b []byte) error {
+	if w.offset == 0 {
+		w.writeRaw([]byte(magic))
+	}
+	w.writeRaw(b)
+	return w.err
+}
+
+func (w *Writer) writeRaw(b []byte) {
+	if w.err != nil || len(b) == 0 {
+		return
+	}
+	n, err := w.w.Write(b)
+	w.offset += int64(n)
+	if err != nil {
+		w.err = fmt.Errorf("failed to write Parquet output: %w", err)
+	}
+}
+
+// WriteRows writes rows as one row group. Each row holds a value for every
+// column: a string, a time.Time for timestamp columns, or nil.
+func (w *Writer) WriteRows(rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return w.err
+	}
+
+	if err := w.write(nil); err != nil {
+		return err
+	}
+	var chunks []interface{}
+	start := w.offset
+	for i, c := range w.columns {
+		page, err := c.encodePage(rows, i)
+		if err != nil {
+			return err
+		}
+		header := encodeStruct([]tfield{
+			{1, int32(pageData)},
+			{2, int32(len(page))},
+			{3, int32(len(page))},
+			{5, []tfield{
+				{1, int32(len(rows))},
+				{2, int32(encodingPlain)},
+				{3, int32(encodingRLE)},
+				{4, int32(encodingRLE)},
+			}},
+		})
+
+		offset := w.offset
+		if err := w.write(append(header, page...)); err != nil {
+			return err
+		}
+		size := int64(len(header) + len(page))
+
+		chunks = append(chunks, []tfield{
+			{2, offset},
+			{3, []tfield{
+				{1, int32(c.physicalType())},
+				{2, []interface{}{int32(encodingPlain), int32(encodingRLE)}},
+				{3, []interface{}{c.Name}},
+				{4, int32(codecUncompressed)},
+				{5, int64(len(rows))},
+				{6, size},
+				{7, size},
+				{9, offset},
+			}},
+		})
+	}
+
+	w.groups = append(w.groups, []tfield{
+		{1, chunks},
+		{2, w.offset - start},
+		{3, int64(len(rows))},
+	})
+	w.rows += int64(len(rows))
+	return nil
+}
+
+// Close writes the metadata that ends the file. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	schema := []interface{}{[]tfield{
+		{4, "schema"},
+		{5, int32(len(w.columns))},
+	}}
+	for _, c := range w.columns {
+		schema = append(schema, c.schemaElement())
+	}
+	groups := w.groups
+	if groups == nil {
+		groups = []interface{}{}
+	}
+	footer := encodeStruct([]tfield{
+		{1, int32(1)},
+		{2, schema},
+		{3, w.rows},
+		{4, groups},
+		{6, "order-processor"},
+	})
+
+	w.write(footer)
+	w.writeRaw(binary.LittleEndian.AppendUint32(nil, uint32(len(footer))))
+	w.writeRaw([]byte(magic))
+	return w.err
+}
+
+func (c Column) physicalType() int {
+	if c.Unit != 0 {
+		return typeInt64
+	}
+	return typeByteArray
+}
+
+// schemaElement describes the column in the file schema
+func (c Column) schemaElement() []tfield {
+	el := []tfield{
+		{1, int32(c.physicalType())},
+		{3, int32(repetitionOptional)},
+		{4, c.Name},
+	}
+	if c.Unit == 0 {
+		return append(el,
+			tfield{6, int32(convertedUTF8)},
+			tfield{10, []tfield{{1, []tfield{}}}},
+		)
+	}
+
+	unit := []tfield{{3, []tfield{}}}
+	if c.Unit == time.Microsecond {
+		el = append(el, tfield{6, int32(convertedTimestampMicros)})
+		unit = []tfield{{2, []tfield{}}}
+	}
+	return append(el, tfield{10, []tfield{
+		{8, []tfield{{1, true}, {2, unit}}},
+	}})
+}
+
+// encodePage encodes the values of column i of rows as a data page:
+// definition levels, run-length encoded, followed by the PLAIN values
+func (c Column) encodePage(rows [][]interface{}, i int) ([]byte, error) {
+	var levels, values []byte
+	for start := 0; start < len(rows); {
+		end := start + 1
+		for end < len(rows) && (rows[end][i] == nil) == (rows[start][i] == nil) {
+			end++
+		}
+		var defined byte
+		if rows[start][i] != nil {
+			defined = 1
+		}
+		levels = binary.AppendUvarint(levels, uint64(end-start)<<1)
+		levels = append(levels, defined)
+		start = end
+	}
+
+	for _, row := range rows {
+		switch v := row[i].(type) {
+		case nil:
+		case string:
+			if c.Unit != 0 {
+				return nil, fmt.Errorf("column %s: expected a time, got a string", c.Name)
+			}
+			values = binary.LittleEndian.AppendUint32(values, uint32(len(v)))
+			values = append(values, v...)
+		case time.Time:
+			if c.Unit == 0 {
+				return nil, fmt.Errorf("column %s: expected a string, got a time", c.Name)
+			}
+			ts := v.UnixMicro()
+			if c.Unit == time.Nanosecond {
+				ts = v.UnixNano()
+			}
+			values = binary.LittleEndian.AppendUint64(values, uint64(ts))
+		default:
+			return nil, fmt.Errorf("column %s: unsupported value %T", c.Name, v)
+		}
+	}
+
+	page := binary.LittleEndian.AppendUint32(nil, uint32(len(levels)))
+	page = append(page, levels...)
+	return append(page, values...), nil
+}
@@ -0,0 +1,362 @@
+// Package postgres is a minimal PostgreSQL client that streams the results
+// of read-only queries over the frontend/backend protocol (version 3).
+package postgres
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// dialTimeout bounds connecting to the server
+	dialTimeout = 10 * time.Second
+	// protocolVersion is protocol 3.0
+	protocolVersion = 3 << 16
+	// sslRequestCode asks the server to switch to TLS
+	sslRequestCode = 80877103
+	// maxMessageSize bounds a single backend message
+	maxMessageSize = 64 << 20
+)
+
+// Error is an ErrorResponse from the server
+type Error struct {
+	Severity string
+	Code     string
+	Message  string
+	Detail   string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s: %s (SQLSTATE %s)", e.Severity, e.Message, e.Code)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// Conn is a connection to a PostgreSQL server. It is not safe for
+// concurrent use.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// Dial connects to postgres://[user[:pass]@]host[:port]/database and
+// authenticates. The user and password default to PGUSER and PGPASSWORD.
+// The sslmode query parameter works as in libpq: disable, prefer (the
+// default), require, or verify-full, which also checks the server
+// certificate unless insecure is set.
+func Dial(rawURL string, insecure bool) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		return nil, fmt.Errorf("invalid PostgreSQL URL: %q", Redact(rawURL))
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "5432")
+	}
+	user := os.Getenv("PGUSER")
+	password := os.Getenv("PGPASSWORD")
+	if u.User != nil {
+		user = u.User.Username()
+		if pass, ok := u.User.Password(); ok {
+			password = pass
+		}
+	}
+	if user == "" {
+		user = "postgres"
+	}
+	database := strings.TrimPrefix(u.Path, "/")
+	if database == "" {
+		database = user
+	}
+	sslmode := u.Query().Get("sslmode")
+	switch sslmode {
+	case "":
+		sslmode = "prefer"
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		return nil, fmt.Errorf("unsupported sslmode %q", sslmode)
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	if sslmode != "disable" && sslmode != "allow" {
+		verify := strings.HasPrefix(sslmode, "verify-") && !insecure
+		conn, err = startTLS(conn, u.Hostname(), verify, sslmode != "prefer")
+		if err != nil {
+			return nil, err
+		}
+	}
+	c := &Conn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+
+	if err := c.startup(user, password, database); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// startTLS negotiates TLS on a new connection. When the server does not
+// support it, the connection continues in plain text unless TLS is required.
+func startTLS(conn net.Conn, host string, verify, required bool) (net.Conn, error) {
+	req := make([]byte, 8)
+	binary.BigEndian.PutUint32(req[0:], 8)
+	binary.BigEndian.PutUint32(req[4:], sslRequestCode)
+	if _, err := conn.Write(req); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to write to PostgreSQL: %w", err)
+	}
+	reply := make([]byte, 1)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read from PostgreSQL: %w", err)
+	}
+	if reply[0] != 'S' {
+		if required {
+			conn.Close()
+			return nil, fmt.Errorf("PostgreSQL server does not support TLS")
+		}
+		return conn, nil
+	}
+	tconn := tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: !verify})
+	if err := tconn.Handshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("PostgreSQL TLS handshake failed: %w", err)
+	}
+	return tconn, nil
+}
+
+// startup sends the startup message, authenticates, and waits for the
+// server to be ready for queries
+func (c *Conn) startup(user, password, database string) error {
+	var msg message
+	msg.int32(protocolVersion)
+	// Timestamps are requested in ISO format and UTC so they can be parsed,
+	// and the session is read-only since only queries are run
+	params := []string{
+		"user", user,
+		"database", database,
+		"application_name", "order-processor",
+		"client_encoding", "UTF8",
+		"DateStyle", "ISO",
+		"TimeZone", "UTC",
+		"default_transaction_read_only", "on",
+	}
+	for _, p := range params {
+		msg.string(p)
+	}
+	msg.byte(0)
+	if err := c.send(0, msg); err != nil {
+		return err
+	}
+
+	var sc *scram
+	for {
+		typ, body, err := c.receive()
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case 'R':
+			if len(body) < 4 {
+				return fmt.Errorf("malformed PostgreSQL authentication request")
+			}
+			code, data := binary.BigEndian.Uint32(body), body[4:]
+			switch code {
+			case 0: // AuthenticationOk
+			case 3: // AuthenticationCleartextPassword
+				err = c.password(password)
+			case 5: // AuthenticationMD5Password
+				if len(data) < 4 {
+					return fmt.Errorf("malformed PostgreSQL authentication request")
+				}
+				err = c.password("md5" + md5Hex(md5Hex(password+user)+string(data[:4])))
+			case 10: // AuthenticationSASL
+				if !hasMechanism(data, "SCRAM-SHA-256") {
+					return fmt.Errorf("PostgreSQL server offers no supported SASL mechanism")
+				}
+				sc = newSCRAM(password)
+				var m message
+				m.string("SCRAM-SHA-256")
+				first := sc.clientFirst()
+				m.int32(uint32(len(first)))
+				m.bytes([]byte(first))
+				err = c.send('p', m)
+			case 11: // AuthenticationSASLContinue
+				if sc == nil {
+					return fmt.Errorf("unexpected PostgreSQL SASL message")
+				}
+				var final string
+				if final, err = sc.clientFinal(string(data)); err == nil {
+					var m message
+					m.bytes([]byte(final))
+					err = c.send('p', m)
+				}
+			case 12: // AuthenticationSASLFinal
+				if sc == nil {
+					return fmt.Errorf("unexpected PostgreSQL SASL message")
+				}
+				err = sc.verify(string(data))
+			default:
+				return fmt.Errorf("unsupported PostgreSQL authentication method %d", code)
+			}
+			if err != nil {
+				return fmt.Errorf("PostgreSQL authentication failed: %w", err)
+			}
+		case 'E':
+			return parseError(body)
+		case 'Z':
+			return nil
+		}
+		// Parameter statuses, backend key data, and notices are ignored
+	}
+}
+
+// password sends a PasswordMessage
+func (c *Conn) password(p string) error {
+	var m message
+	m.string(p)
+	return c.send('p', m)
+}
+
+// Close terminates the session and closes the connection
+func (c *Conn) Close() error {
+	c.send('X', nil)
+	return c.conn.Close()
+}
+
+// send writes a message with the given type, or a startup message when typ
+// is 0, and flushes it
+func (c *Conn) send(typ byte, body message) error {
+	if err := c.write(typ, body); err != nil {
+		return err
+	}
+	if err := c.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write to PostgreSQL: %w", err)
+	}
+	return nil
+}
+
+// write buffers a message
+func (c *Conn) write(typ byte, body message) error {
+	if typ != 0 {
+		c.w.WriteByte(typ)
+	}
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(body)+4))
+	c.w.Write(size)
+	if _, err := c.w.Write(body); err != nil {
+		return fmt.Errorf("failed to write to PostgreSQL: %w", err)
+	}
+	return nil
+}
+
+// receive reads one backend message
+func (c *Conn) receive() (byte, []byte, error) {
+	head := make([]byte, 5)
+	if _, err := io.ReadFull(c.r, head); err != nil {
+		return 0, nil, fmt.Errorf("failed to read from PostgreSQL: %w", err)
+	}
+	size := binary.BigEndian.Uint32(head[1:])
+	if size < 4 || size > maxMessageSize {
+		return 0, nil, fmt.Errorf("malformed PostgreSQL message of %d bytes", size)
+	}
+	body := make([]byte, size-4)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, fmt.Errorf("failed to read from PostgreSQL: %w", err)
+	}
+	return head[0], body, nil
+}
+
+// parseError decodes the fields of an ErrorResponse
+func parseError(body []byte) error {
+	e := &Error{}
+	for len(body) > 1 {
+		field := body[0]
+		end := bytes.IndexByte(body[1:], 0)
+		if end < 0 {
+			break
+		}
+		value := string(body[1 : end+1])
+		body = body[end+2:]
+		switch field {
+		case 'V', 'S':
+			// The non-localized severity is preferred when present
+			if field == 'V' || e.Severity == "" {
+				e.Severity = value
+			}
+		case 'C':
+			e.Code = value
+		case 'M':
+			e.Message = value
+		case 'D':
+			e.Detail = value
+		}
+	}
+	return e
+}
+
+// hasMechanism reports whether a list of SASL mechanisms includes name
+func hasMechanism(list []byte, name string) bool {
+	for _, m := range strings.Split(string(list), "\x00") {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// Redact hides the password of a PostgreSQL URL for logging
+func Redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "REDACTED")
+	}
+	return u.String()
+}
+
+// message builds the body of a frontend message
+type message []byte
+
+func (m *message) byte(b byte) {
+	*m = append(*m, b)
+}
+
+func (m *message) int16(v uint16) {
+	*m = binary.BigEndian.AppendUint16(*m, v)
+}
+
+func (m *message) int32(v uint32) {
+	*m = binary.BigEndian.AppendUint32(*m, v)
+}
+
+func (m *message) string(s string) {
+	*m = append(append(*m, s...), 0)
+}
+
+func (m *message) bytes(b []byte) {
+	*m = append(*m, b...)
+}
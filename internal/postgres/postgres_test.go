@@ -0,0 +1,367 @@
+package postgres
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeServer is the backend end of a connection, driven by a test script
+type fakeServer struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// newFakeServer connects a client to a fake server. The script runs on the
+// server end, and the client is usable until it returns.
+func newFakeServer(t *testing.T, script func(s *fakeServer)) *Conn {
+	t.Helper()
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer server.Close()
+		script(&fakeServer{t: t, conn: server, r: bufio.NewReader(server)})
+	}()
+	t.Cleanup(func() {
+		client.Close()
+		<-done
+	})
+	return &Conn{conn: client, r: bufio.NewReader(client), w: bufio.NewWriter(client)}
+}
+
+// readStartup reads the startup message and returns its parameters
+func (s *fakeServer) readStartup() map[string]string {
+	head := make([]byte, 8)
+	if _, err := io.ReadFull(s.r, head); err != nil {
+		s.t.Errorf("failed to read startup message: %v", err)
+		return nil
+	}
+	if v := binary.BigEndian.Uint32(head[4:]); v != protocolVersion {
+		s.t.Errorf("protocol version = %#x, want %#x", v, protocolVersion)
+	}
+	body := make([]byte, binary.BigEndian.Uint32(head)-8)
+	if _, err := io.ReadFull(s.r, body); err != nil {
+		s.t.Errorf("failed to read startup message: %v", err)
+		return nil
+	}
+	if !bytes.HasSuffix(body, []byte{0, 0}) {
+		s.t.Errorf("startup message %q is not terminated", body)
+	}
+	fields := strings.Split(string(body[:len(body)-2]), "\x00")
+	params := make(map[string]string)
+	for i := 0; i+1 < len(fields); i += 2 {
+		params[fields[i]] = fields[i+1]
+	}
+	return params
+}
+
+// expect reads a frontend message and checks its type
+func (s *fakeServer) expect(typ byte) []byte {
+	head := make([]byte, 5)
+	if _, err := io.ReadFull(s.r, head); err != nil {
+		s.t.Errorf("failed to read %q message: %v", typ, err)
+		return nil
+	}
+	if head[0] != typ {
+		s.t.Errorf("message type = %q, want %q", head[0], typ)
+	}
+	body := make([]byte, binary.BigEndian.Uint32(head[1:])-4)
+	if _, err := io.ReadFull(s.r, body); err != nil {
+		s.t.Errorf("failed to read %q message: %v", typ, err)
+	}
+	return body
+}
+
+// send writes a backend message
+func (s *fakeServer) send(typ byte, body message) {
+	msg := append([]byte{typ}, binary.BigEndian.AppendUint32(nil, uint32(len(body)+4))...)
+	if _, err := s.conn.Write(append(msg, body...)); err != nil {
+		s.t.Errorf("failed to send %q message: %v", typ, err)
+	}
+}
+
+// auth sends an authentication request with its data
+func (s *fakeServer) auth(code uint32, data string) {
+	var m message
+	m.int32(code)
+	m.bytes([]byte(data))
+	s.send('R', m)
+}
+
+// ready ends the startup or a query
+func (s *fakeServer) ready() {
+	s.send('Z', message{'I'})
+}
+
+// cstring splits a NUL-terminated string off b
+func cstring(b []byte) (string, []byte) {
+	end := bytes.IndexByte(b, 0)
+	if end < 0 {
+		return string(b), nil
+	}
+	return string(b[:end]), b[end+1:]
+}
+
+func TestStartupSCRAM(t *testing.T) {
+	salt := []byte("order-processor!")
+	c := newFakeServer(t, func(s *fakeServer) {
+		params := s.readStartup()
+		for k, want := range map[string]string{"user": "alice", "database": "orders", "DateStyle": "ISO", "TimeZone": "UTC"} {
+			if params[k] != want {
+				s.t.Errorf("startup parameter %s = %q, want %q", k, params[k], want)
+			}
+		}
+
+		// SASLInitialResponse: the mechanism, then the length-prefixed
+		// client-first-message
+		s.auth(10, "SCRAM-SHA-256-PLUS\x00SCRAM-SHA-256\x00\x00")
+		mechanism, rest := cstring(s.expect('p'))
+		if mechanism != "SCRAM-SHA-256" || len(rest) < 4 {
+			s.t.Errorf("SASL mechanism = %q, want SCRAM-SHA-256", mechanism)
+			return
+		}
+		first := string(rest[4:])
+		if n := binary.BigEndian.Uint32(rest); int(n) != len(first) {
+			s.t.Errorf("client-first-message length = %d, want %d", n, len(first))
+		}
+		bare := strings.TrimPrefix(first, "n,,")
+		serverFirst := "r=" + scramAttributes(bare)["r"] + "server,s=" + base64.StdEncoding.EncodeToString(salt) + ",i=4096"
+		s.auth(11, serverFirst)
+
+		// SASLResponse: the client-final-message alone, with a proof of the
+		// password
+		final := string(s.expect('p'))
+		withoutProof, proof64, _ := strings.Cut(final, ",p=")
+		authMessage := bare + "," + serverFirst + "," + withoutProof
+		salted := pbkdf2([]byte("secret"), salt, 4096)
+		clientKey := hmacSHA256(salted, "Client Key")
+		storedKey := sha256.Sum256(clientKey)
+		signature := hmacSHA256(storedKey[:], authMessage)
+		proof, _ := base64.StdEncoding.DecodeString(proof64)
+		for i := range proof {
+			proof[i] ^= signature[i]
+		}
+		if sum := sha256.Sum256(proof); !hmac.Equal(sum[:], storedKey[:]) {
+			s.t.Errorf("client proof in %q does not prove the password", final)
+		}
+		s.auth(12, "v="+base64.StdEncoding.EncodeToString(hmacSHA256(hmacSHA256(salted, "Server Key"), authMessage)))
+
+		s.auth(0, "")
+		var status message
+		status.string("server_version")
+		status.string("16.2")
+		s.send('S', status)
+		s.send('K', message{0, 0, 0, 1, 0, 0, 0, 2})
+		s.ready()
+	})
+
+	if err := c.startup("alice", "secret", "orders"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStartupMD5(t *testing.T) {
+	c := newFakeServer(t, func(s *fakeServer) {
+		s.readStartup()
+		s.auth(5, "salt")
+		if got, want := string(s.expect('p')), "md5"+md5Hex(md5Hex("secretalice")+"salt")+"\x00"; got != want {
+			s.t.Errorf("password message = %q, want %q", got, want)
+		}
+		s.auth(0, "")
+		s.ready()
+	})
+	if err := c.startup("alice", "secret", "orders"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStartupError(t *testing.T) {
+	c := newFakeServer(t, func(s *fakeServer) {
+		s.readStartup()
+		var m message
+		for _, field := range []string{"SERROR", "VFATAL", "C28P01", "Mpassword authentication failed", "Dfor user alice"} {
+			m.string(field)
+		}
+		m.byte(0)
+		s.send('E', m)
+	})
+
+	err := c.startup("alice", "wrong", "orders")
+	var pgErr *Error
+	if !errors.As(err, &pgErr) {
+		t.Fatalf("startup() error = %v, want an *Error", err)
+	}
+	want := Error{Severity: "FATAL", Code: "28P01", Message: "password authentication failed", Detail: "for user alice"}
+	if *pgErr != want {
+		t.Errorf("error = %+v, want %+v", *pgErr, want)
+	}
+}
+
+func TestReceiveRejectsMalformedSize(t *testing.T) {
+	for _, size := range []uint32{0, 3, maxMessageSize + 1} {
+		msg := append([]byte{'D'}, binary.BigEndian.AppendUint32(nil, size)...)
+		c := &Conn{r: bufio.NewReader(bytes.NewReader(msg))}
+		if _, _, err := c.receive(); err == nil || !strings.Contains(err.Error(), "malformed") {
+			t.Errorf("size %d: receive() error = %v, want malformed", size, err)
+		}
+	}
+
+	// A message cut short is an error too
+	c := &Conn{r: bufio.NewReader(bytes.NewReader([]byte{'D', 0, 0, 0, 10, 0, 1}))}
+	if _, _, err := c.receive(); err == nil {
+		t.Error("receive() read a truncated message")
+	}
+}
+
+// rowDescription describes columns of the given names and type OIDs
+func rowDescription(names []string, oids []uint32) message {
+	var m message
+	m.int16(uint16(len(names)))
+	for i, name := range names {
+		m.string(name)
+		m.int32(0)
+		m.int16(0)
+		m.int32(oids[i])
+		m.int16(0xffff)
+		m.int32(0xffffffff)
+		m.int16(0)
+	}
+	return m
+}
+
+// dataRow holds text values, with nil for NULL
+func dataRow(values ...interface{}) message {
+	var m message
+	m.int16(uint16(len(values)))
+	for _, v := range values {
+		if v == nil {
+			m.int32(0xffffffff)
+			continue
+		}
+		m.int32(uint32(len(v.(string))))
+		m.bytes([]byte(v.(string)))
+	}
+	return m
+}
+
+// expectExecute reads an Execute of the unnamed portal and the Flush after it
+func (s *fakeServer) expectExecute(rows uint32) {
+	portal, rest := cstring(s.expect('E'))
+	if portal != "" || len(rest) != 4 || binary.BigEndian.Uint32(rest) != rows {
+		s.t.Errorf("Execute of %q for %v, want the unnamed portal for %d rows", portal, rest, rows)
+	}
+	s.expect('H')
+}
+
+func TestQueryFetchesInBatches(t *testing.T) {
+	const sql = "SELECT id, symbol, price, placed FROM orders"
+	c := newFakeServer(t, func(s *fakeServer) {
+		// Parse, Bind, and Describe of the unnamed portal, then Flush
+		name, rest := cstring(s.expect('P'))
+		if query, _ := cstring(rest); name != "" || query != sql {
+			s.t.Errorf("Parse of %q as %q, want %q unnamed", query, name, sql)
+		}
+		s.expect('B')
+		if got := s.expect('D'); !bytes.Equal(got, []byte{'P', 0}) {
+			s.t.Errorf("Describe = %q, want the unnamed portal", got)
+		}
+		s.expect('H')
+		s.send('1', nil)
+		s.send('2', nil)
+		s.send('T', rowDescription([]string{"id", "symbol", "price", "placed"}, []uint32{oidInt4, 25, oidNumeric, oidTimestamp}))
+
+		s.expectExecute(2)
+		s.send('D', dataRow("1", "TSLA", "180.50", "2024-03-01 09:30:00.5"))
+		s.send('D', dataRow("2", nil, "NaN", nil))
+		s.send('s', nil)
+		s.expectExecute(2)
+		s.send('D', dataRow("3", "AAPL", "1", nil))
+		var complete message
+		complete.string("SELECT 3")
+		s.send('C', complete)
+
+		s.expect('S')
+		s.ready()
+	})
+
+	rows, err := c.Query(sql, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(rows.Columns(), ","); got != "id,symbol,price,placed" {
+		t.Errorf("columns = %s, want id,symbol,price,placed", got)
+	}
+	var got []string
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fields []string
+		for _, col := range rows.Columns() {
+			if v, ok := row[col]; ok {
+				fields = append(fields, col+"="+stringOf(v))
+			}
+		}
+		got = append(got, strings.Join(fields, " "))
+	}
+	want := []string{
+		"id=1 symbol=TSLA price=180.50 placed=2024-03-01T09:30:00.5Z",
+		"id=2 price=NaN",
+		"id=3 symbol=AAPL price=1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("rows =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if _, err := rows.Next(); err != io.EOF {
+		t.Errorf("Next() after the last row error = %v, want io.EOF", err)
+	}
+}
+
+// stringOf formats a converted string or json.Number value
+func stringOf(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case interface{ String() string }:
+		return v.String()
+	}
+	return "?"
+}
+
+func TestQueryErrorEndsTransaction(t *testing.T) {
+	c := newFakeServer(t, func(s *fakeServer) {
+		for _, typ := range []byte{'P', 'B', 'D', 'H'} {
+			s.expect(typ)
+		}
+		var m message
+		m.string("SERROR")
+		m.string("C42P01")
+		m.string(`Mrelation "orders" does not exist`)
+		m.byte(0)
+		s.send('E', m)
+
+		// The failed transaction is ended with a Sync
+		s.expect('S')
+		s.ready()
+	})
+
+	_, err := c.Query("SELECT * FROM orders", 10)
+	var pgErr *Error
+	if !errors.As(err, &pgErr) || pgErr.Code != "42P01" {
+		t.Errorf("Query() error = %v, want SQLSTATE 42P01", err)
+	}
+}
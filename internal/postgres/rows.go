@@ -0,0 +1,256 @@
+package postgres
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Type OIDs of the columns that are converted from text
+const (
+	oidBool        = 16
+	oidInt8        = 20
+	oidInt2        = 21
+	oidInt4        = 23
+	oidOID         = 26
+	oidJSON        = 114
+	oidFloat4      = 700
+	oidFloat8      = 701
+	oidTimestamp   = 1114
+	oidTimestampTZ = 1184
+	oidNumeric     = 1700
+	oidJSONB       = 3802
+)
+
+// timestampLayouts are the ISO formats of timestamp and timestamptz values
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999Z07:00:00",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// column describes a result column
+type column struct {
+	name string
+	oid  uint32
+}
+
+// Rows streams the results of a query through an unnamed portal, fetching
+// a batch of rows at a time so the result set is never held in memory
+type Rows struct {
+	conn      *Conn
+	columns   []column
+	fetchSize int
+	done      bool
+}
+
+// Query runs a query and returns its rows, fetching fetchSize rows per round
+// trip. The query runs in its own transaction, which ends once every row has
+// been read; the connection cannot be used for anything else until then.
+func (c *Conn) Query(sql string, fetchSize int) (*Rows, error) {
+	if fetchSize < 1 {
+		fetchSize = 1
+	}
+
+	// Parse and bind an unnamed statement, with results in text format
+	var parse message
+	parse.string("")
+	parse.string(sql)
+	parse.int16(0)
+	c.write('P', parse)
+	var bind message
+	bind.string("")
+	bind.string("")
+	bind.int16(0)
+	bind.int16(0)
+	bind.int16(0)
+	c.write('B', bind)
+	describe := message{'P', 0}
+	c.write('D', describe)
+	if err := c.send('H', nil); err != nil {
+		return nil, err
+	}
+
+	// Nothing is executed until the portal is known to return rows
+	for {
+		typ, body, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case '1', '2': // ParseComplete, BindComplete
+		case 'T':
+			columns, err := parseRowDescription(body)
+			if err != nil {
+				return nil, err
+			}
+			r := &Rows{conn: c, columns: columns, fetchSize: fetchSize}
+			if err := r.execute(); err != nil {
+				return nil, err
+			}
+			return r, nil
+		case 'n':
+			return nil, c.fail(fmt.Errorf("query returns no rows"))
+		case 'E':
+			return nil, c.fail(parseError(body))
+		}
+	}
+}
+
+// execute requests the next batch of rows. Flush is used instead of Sync so
+// the portal stays open between batches.
+func (r *Rows) execute() error {
+	var exec message
+	exec.string("")
+	exec.int32(uint32(r.fetchSize))
+	r.conn.write('E', exec)
+	return r.conn.send('H', nil)
+}
+
+// Columns returns the names of the result columns
+func (r *Rows) Columns() []string {
+	names := make([]string, len(r.columns))
+	for i, c := range r.columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+// Next returns the next row, or io.EOF after the last one. Rows are keyed by
+// column name, with NULLs omitted. Numbers become json.Number, booleans
+// bool, json and jsonb values json.RawMessage, and timestamps RFC 3339
+// strings; timestamps without a time zone are taken to be UTC. Other values
+// are strings.
+func (r *Rows) Next() (map[string]interface{}, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+	for {
+		typ, body, err := r.conn.receive()
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case 'D':
+			return r.parseRow(body)
+		case 's': // PortalSuspended
+			if err := r.execute(); err != nil {
+				return nil, err
+			}
+		case 'C': // CommandComplete
+			r.done = true
+			if err := r.conn.sync(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		case 'E':
+			r.done = true
+			return nil, r.conn.fail(parseError(body))
+		}
+	}
+}
+
+// parseRow decodes a DataRow
+func (r *Rows) parseRow(body []byte) (map[string]interface{}, error) {
+	if len(body) < 2 || int(binary.BigEndian.Uint16(body)) != len(r.columns) {
+		return nil, fmt.Errorf("malformed PostgreSQL data row")
+	}
+	body = body[2:]
+	row := make(map[string]interface{}, len(r.columns))
+	for _, c := range r.columns {
+		if len(body) < 4 {
+			return nil, fmt.Errorf("malformed PostgreSQL data row")
+		}
+		n := int32(binary.BigEndian.Uint32(body))
+		body = body[4:]
+		if n < 0 {
+			continue
+		}
+		if int(n) > len(body) {
+			return nil, fmt.Errorf("malformed PostgreSQL data row")
+		}
+		row[c.name] = convert(c.oid, string(body[:n]))
+		body = body[n:]
+	}
+	return row, nil
+}
+
+// convert converts a value from its text representation
+func convert(oid uint32, v string) interface{} {
+	switch oid {
+	case oidBool:
+		return v == "t"
+	case oidInt2, oidInt4, oidInt8, oidOID:
+		return json.Number(v)
+	case oidFloat4, oidFloat8, oidNumeric:
+		// NaN and infinities have no JSON representation
+		if v == "NaN" || strings.HasSuffix(v, "Infinity") {
+			return v
+		}
+		return json.Number(v)
+	case oidJSON, oidJSONB:
+		return json.RawMessage(v)
+	case oidTimestamp, oidTimestampTZ:
+		for _, layout := range timestampLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t.UTC().Format(time.RFC3339Nano)
+			}
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// parseRowDescription decodes the columns of a RowDescription
+func parseRowDescription(body []byte) ([]column, error) {
+	if len(body) < 2 {
+		return nil, fmt.Errorf("malformed PostgreSQL row description")
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	body = body[2:]
+	columns := make([]column, 0, n)
+	for i := 0; i < n; i++ {
+		end := bytes.IndexByte(body, 0)
+		// Each name is followed by 18 bytes of column attributes
+		if end < 0 || len(body) < end+19 {
+			return nil, fmt.Errorf("malformed PostgreSQL row description")
+		}
+		columns = append(columns, column{
+			name: string(body[:end]),
+			oid:  binary.BigEndian.Uint32(body[end+7:]),
+		})
+		body = body[end+19:]
+	}
+	return columns, nil
+}
+
+// fail ends the current transaction after an error and returns err
+func (c *Conn) fail(err error) error {
+	if serr := c.sync(); serr != nil {
+		return serr
+	}
+	return err
+}
+
+// sync sends Sync, ending the query's transaction, and waits until the
+// server is ready for the next query
+func (c *Conn) sync() error {
+	if err := c.send('S', nil); err != nil {
+		return err
+	}
+	for {
+		typ, _, err := c.receive()
+		if err != nil {
+			return err
+		}
+		if typ == 'Z' {
+			return nil
+		}
+	}
+}
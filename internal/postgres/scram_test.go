@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"strings"
+	"testing"
+)
+
+// The SCRAM-SHA-256 exchange of RFC 7677, section 3
+const (
+	rfcNonce       = "rOprNGfwEbeRWgbNEkqO"
+	rfcServerFirst = "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+	rfcClientFinal = "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	rfcServerFinal = "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="
+)
+
+// rfcSCRAM returns a client in the state of the RFC example after its
+// client-first-message, which names the user where ours leaves it empty
+func rfcSCRAM() *scram {
+	return &scram{password: "pencil", nonce: rfcNonce, first: "n=user,r=" + rfcNonce}
+}
+
+func TestSCRAMTestVector(t *testing.T) {
+	s := rfcSCRAM()
+	final, err := s.clientFinal(rfcServerFirst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final != rfcClientFinal {
+		t.Errorf("client-final-message = %s\nwant %s", final, rfcClientFinal)
+	}
+	if err := s.verify(rfcServerFinal); err != nil {
+		t.Errorf("verify() error = %v", err)
+	}
+}
+
+func TestSCRAMClientFirst(t *testing.T) {
+	s := newSCRAM("pencil")
+	if got, want := s.clientFirst(), "n,,n=,r="+s.nonce; got != want {
+		t.Errorf("client-first-message = %s, want %s", got, want)
+	}
+	if other := newSCRAM("pencil"); other.nonce == s.nonce {
+		t.Error("two clients share a nonce")
+	}
+}
+
+func TestSCRAMRejectsServer(t *testing.T) {
+	for name, serverFirst := range map[string]string{
+		"foreign nonce":   strings.Replace(rfcServerFirst, "r=rOpr", "r=xOpr", 1),
+		"unchanged nonce": "r=" + rfcNonce + ",s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+		"bad salt":        strings.Replace(rfcServerFirst, "s=W22", "s=!22", 1),
+		"no iterations":   strings.TrimSuffix(rfcServerFirst, ",i=4096"),
+		"zero iterations": strings.Replace(rfcServerFirst, "i=4096", "i=0", 1),
+	} {
+		if _, err := rfcSCRAM().clientFinal(serverFirst); err == nil {
+			t.Errorf("%s: clientFinal() accepted %s", name, serverFirst)
+		}
+	}
+
+	for name, serverFinal := range map[string]string{
+		"wrong signature": "v=7rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+		"no signature":    "",
+		"error":           "e=invalid-proof",
+	} {
+		s := rfcSCRAM()
+		if _, err := s.clientFinal(rfcServerFirst); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.verify(serverFinal); err == nil {
+			t.Errorf("%s: verify() accepted %q", name, serverFinal)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package processor
+
+import (
+	"fmt"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/fauzanelka/99tech-order-processor/internal/rejects"
+)
+
+// annotateReject annotates the input line of a rejected record, with
+// sensitive fields masked. Orders skipped for their status are not problems
+// with the input.
+func (p *Processor) annotateReject(r rejects.Reject) {
+	if p.Annotate == nil || r.Code == string(codeStatusSkipped) {
+		return
+	}
+	message := r.Reason
+	switch {
+	case r.OrderID != "":
+		message = fmt.Sprintf("Order %s was rejected: %s", r.OrderID, r.Reason)
+	case r.Line > 0:
+		message = fmt.Sprintf("Line %d is not a valid order: %s", r.Line, r.Reason)
+	}
+	p.Annotate.Error(r.Line, r.Code, p.Redact.String(message))
+}
+
+// annotateFailure annotates the input line of an order that failed, with
+// sensitive fields masked
+func (p *Processor) annotateFailure(order models.Order, failure models.Failure) {
+	if p.Annotate == nil {
+		return
+	}
+	message := fmt.Sprintf("Order %s failed after %d attempts (%s): %s", order.OrderID, failure.Attempts, failure.Class, failure.Error)
+	p.Annotate.Error(order.Line, failure.Code, p.Redact.String(message))
+}
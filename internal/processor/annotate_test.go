@@ -0,0 +1,47 @@
+package processor
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/annotate"
+	"github.com/fauzanelka/99tech-order-processor/internal/redact"
+	"github.com/fauzanelka/99tech-order-processor/internal/rejects"
+)
+
+func TestAnnotationsRedact(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errors":[{"message":"unknown account=ACCT-SECRET-1"}]}`))
+	}))
+	defer srv.Close()
+
+	p := newTestProcessor(t, srv.URL, testOrder("a1"))
+	var err error
+	if p.GraphQL, err = ParseGraphQL(`query { order(id: "{{.Order.OrderID}}") { note } }`, nil); err != nil {
+		t.Fatal(err)
+	}
+	p.Redact = redact.New([]string{"account"})
+	var out bytes.Buffer
+	p.Annotate = annotate.New(&out, p.InputFile)
+
+	if err := p.Process(); err != nil {
+		t.Fatal(err)
+	}
+	p.annotateReject(rejects.Reject{Line: 2, OrderID: "a2", Code: "E_RULE", Reason: `account "ACCT-SECRET-2" is closed: {"account": "ACCT-SECRET-2"}`})
+
+	annotations := out.String()
+	if n := strings.Count(annotations, "::error "); n != 2 {
+		t.Fatalf("%d annotations were written, want 2:\n%s", n, annotations)
+	}
+	for _, secret := range []string{"ACCT-SECRET-1", `{"account": "ACCT-SECRET-2"}`} {
+		if strings.Contains(annotations, secret) {
+			t.Errorf("annotations have %s:\n%s", secret, annotations)
+		}
+	}
+	if !strings.Contains(annotations, "account=REDACTED") || !strings.Contains(annotations, `"account": "REDACTED"`) {
+		t.Errorf("annotations do not have the masked fields:\n%s", annotations)
+	}
+}
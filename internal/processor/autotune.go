@@ -0,0 +1,111 @@
+package processor
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// AutoConcurrency is the most orders processed at once when the
+	// concurrency is tuned automatically
+	AutoConcurrency = 32
+	// autoStart is the concurrency a tuned run starts at
+	autoStart = 2
+	// autoFailureRate is the share of failed requests, as one in n, above
+	// which the concurrency is halved
+	autoFailureRate = 10
+	// autoLatencySlack is the least growth in latency taken as saturation,
+	// so that jitter in fast responses does not lower the concurrency
+	autoLatencySlack = 20 * time.Millisecond
+	// autoBaselineDecay is the fraction, as one in n, of the difference to
+	// a slower round that the baseline latency moves by, so that it is not
+	// held down by one unusually fast round
+	autoBaselineDecay = 32
+)
+
+// tuner adjusts the number of orders processed at once to the requests
+// that come back, AIMD style. After every round of as many requests as the
+// current concurrency it halves the concurrency if more than a tenth of
+// them failed, lowers it by one if their average latency has grown half
+// again above the baseline, which means the API is saturating, and raises
+// it by one otherwise. All methods are safe for concurrent use.
+type tuner struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	max      int
+	inflight int
+	// The current round of requests
+	count   int
+	failed  int
+	latency time.Duration
+	// best is the baseline latency, following the fastest rounds
+	best time.Duration
+}
+
+func newTuner(max int) *tuner {
+	t := &tuner{limit: min(autoStart, max), max: max}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// acquire waits until fewer orders than the concurrency are in flight and
+// counts one more
+func (t *tuner) acquire() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.inflight >= t.limit {
+		t.cond.Wait()
+	}
+	t.inflight++
+}
+
+// release counts an order that is no longer in flight
+func (t *tuner) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.inflight--
+	t.cond.Broadcast()
+}
+
+// observe records the latency of a request and whether it failed, returning
+// the concurrency and whether it changed
+func (t *tuner) observe(latency time.Duration, failed bool) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.count++
+	t.latency += latency
+	if failed {
+		t.failed++
+	}
+	if t.count < t.limit {
+		return t.limit, false
+	}
+
+	avg := t.latency / time.Duration(t.count)
+	limit := t.limit
+	switch {
+	case t.failed*autoFailureRate > t.count:
+		limit = max(limit/2, 1)
+	case t.best > 0 && avg > t.best*3/2 && avg-t.best > autoLatencySlack:
+		limit = max(limit-1, 1)
+	case limit < t.max:
+		limit++
+	}
+	// Failed requests can come back quickly, and slow rounds are
+	// saturating, so only rounds that raised the concurrency move the
+	// baseline up
+	switch {
+	case t.failed > 0:
+	case t.best == 0 || avg < t.best:
+		t.best = avg
+	case limit > t.limit:
+		t.best += (avg - t.best) / autoBaselineDecay
+	}
+	t.count, t.failed, t.latency = 0, 0, 0
+
+	changed := limit != t.limit
+	t.limit = limit
+	t.cond.Broadcast()
+	return limit, changed
+}
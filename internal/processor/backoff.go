@@ -0,0 +1,53 @@
+package processor
+
+import (
+	"errors"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/lifecycle"
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// backoffError is returned for a request that received no response and may
+// be retried once its backoff delay has passed
+type backoffError struct {
+	// retry is the retry count of the next request
+	retry int
+	delay time.Duration
+	err   error
+}
+
+func (e *backoffError) Error() string {
+	return e.err.Error()
+}
+
+func (e *backoffError) Unwrap() error {
+	return e.err
+}
+
+// dispatch processes an order once the limits allow it, calling failed if
+// it fails. Requests that receive no response are retried once their
+// backoff has passed without holding up the orders after them, which take
+// their place in the meantime.
+func (p *Processor) dispatch(order models.Order, failed func(error)) {
+	p.limits.run(order, func() {
+		p.moveOrder(order, lifecycle.Requested)
+		p.tryLater(order, 0, failed)
+	})
+}
+
+// tryLater makes a request for an order, scheduling the next one after the
+// backoff if it receives no response
+func (p *Processor) tryLater(order models.Order, retryCount int, failed func(error)) {
+	err := p.tryOrder(order, retryCount)
+	var b *backoffError
+	if errors.As(err, &b) {
+		p.limits.after(b.delay, order, func() {
+			p.tryLater(order, b.retry, failed)
+		})
+		return
+	}
+	if err != nil {
+		failed(err)
+	}
+}
@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// spoolAt is the size past which a response body that goes to the output
+// as it is gets spooled to a temporary file rather than kept in memory
+const spoolAt = 1 << 20
+
+// readBody reads a response body, failing if it is larger than limit bytes
+// when limit is positive. With spool, a body larger than spoolAt is copied
+// to a temporary file, which is returned in place of the body, positioned
+// at its start; the caller removes it with closeSpool.
+func readBody(r io.Reader, limit int64, spool bool) ([]byte, *os.File, error) {
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	var buf bytes.Buffer
+	var n int64
+	var err error
+	if spool {
+		n, err = io.CopyN(&buf, r, spoolAt+1)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	} else {
+		n, err = io.Copy(&buf, r)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if limit > 0 && n > limit {
+		return nil, nil, tooLarge(limit)
+	}
+	if !spool || n <= spoolAt {
+		return buf.Bytes(), nil, nil
+	}
+
+	file, err := os.CreateTemp("", "order-processor-response-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to spool response body: %w", err)
+	}
+	if _, err := buf.WriteTo(file); err != nil {
+		closeSpool(file)
+		return nil, nil, fmt.Errorf("failed to spool response body: %w", err)
+	}
+	rest, err := io.Copy(file, r)
+	if err != nil {
+		closeSpool(file)
+		return nil, nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if limit > 0 && n+rest > limit {
+		closeSpool(file)
+		return nil, nil, tooLarge(limit)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		closeSpool(file)
+		return nil, nil, fmt.Errorf("failed to spool response body: %w", err)
+	}
+	return nil, file, nil
+}
+
+// tooLarge returns the error of a body larger than limit bytes, which is
+// not retried
+func tooLarge(limit int64) error {
+	return &classError{class: classSchema, code: codeTooLarge, err: fmt.Errorf("response body larger than %d bytes (--max-response-bytes)", limit)}
+}
+
+// closeSpool closes and removes a spooled body, if any
+func closeSpool(file *os.File) {
+	if file == nil {
+		return
+	}
+	file.Close()
+	os.Remove(file.Name())
+}
+
+// spools reports whether large response bodies are spooled, which they are
+// when written to the output as they are, with nothing else needing them in
+// memory. GraphQL responses are checked for errors first, and SOAP ones
+// converted to JSON.
+func (p *Processor) spools() bool {
+	return p.output != nil && p.GraphQL == nil && p.SOAP == nil && p.OutputFormat != OutputEnvelope && p.OutputTemplate == nil &&
+		p.Mask == nil && p.Publisher == nil && p.Indexer == nil && p.Cache == nil &&
+		p.Capture == nil && p.responses == nil && p.Paginate == nil && p.Transform == nil &&
+		len(p.Tee) == 0
+}
@@ -0,0 +1,68 @@
+package processor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/lifecycle"
+)
+
+// largeValue is a JSON string value that makes a response larger than spoolAt
+var largeValue = strings.Repeat("x", 2*spoolAt)
+
+func TestGraphQLLargeResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"order":{"note":"` + largeValue + `"}}}`))
+	}))
+	defer srv.Close()
+
+	p := newTestProcessor(t, srv.URL, testOrder("a1"))
+	var err error
+	if p.GraphQL, err = ParseGraphQL(`query { order(id: "{{.Order.OrderID}}") { note } }`, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Process(); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if n := stateCount(p, lifecycle.Succeeded); n != 1 {
+		t.Fatalf("succeeded orders = %d, want 1", n)
+	}
+	out, err := os.ReadFile(p.OutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), largeValue) {
+		t.Errorf("output does not have the response, %d bytes", len(out))
+	}
+}
+
+func TestSOAPLargeResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+			`<OrderResponse><Note>` + largeValue + `</Note></OrderResponse></soap:Body></soap:Envelope>`))
+	}))
+	defer srv.Close()
+
+	p := newTestProcessor(t, srv.URL, testOrder("a1"))
+	var err error
+	if p.SOAP, err = ParseSOAP(`<Envelope><Body><GetOrder>{{xml .Order.OrderID}}</GetOrder></Body></Envelope>`, "", "1.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Process(); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if n := stateCount(p, lifecycle.Succeeded); n != 1 {
+		t.Fatalf("succeeded orders = %d, want 1", n)
+	}
+	out, err := os.ReadFile(p.OutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `"Note":"`+largeValue+`"`) {
+		t.Errorf("output does not have the converted response, %d bytes", len(out))
+	}
+}
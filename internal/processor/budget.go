@@ -0,0 +1,38 @@
+package processor
+
+import "sync/atomic"
+
+// retryBudget caps the retries of a whole run, so that an API outage does
+// not multiply the runtime by the retry count. All methods are safe for
+// concurrent use and safe to call on a nil receiver, which is unlimited.
+type retryBudget struct {
+	size   int64
+	left   atomic.Int64
+	warned atomic.Bool
+}
+
+func newRetryBudget(size int) *retryBudget {
+	if size <= 0 {
+		return nil
+	}
+	b := &retryBudget{size: int64(size)}
+	b.left.Store(int64(size))
+	return b
+}
+
+// take spends a retry, reporting whether one was left
+func (b *retryBudget) take() bool {
+	return b == nil || b.left.Add(-1) >= 0
+}
+
+// retryAllowed spends a retry from the budget, logging once when it runs
+// out
+func (p *Processor) retryAllowed() bool {
+	if p.budget.take() {
+		return true
+	}
+	if p.budget.warned.CompareAndSwap(false, true) {
+		p.Logger.Warnf("Retry budget of %d retries exhausted, failing orders without retrying them", p.budget.size)
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package processor
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// canary counts the first requests of the orders processed first in a run,
+// which only goes on with the rest of the input if few enough of them
+// failed. All methods are safe to call on a nil receiver, which is no
+// canary.
+type canary struct {
+	size    int
+	started int
+	failed  atomic.Int32
+}
+
+// start counts an order about to be processed, reporting whether it is part
+// of the canary and whether it is the last of it
+func (c *canary) start() (in, last bool) {
+	if c == nil || c.started >= c.size {
+		return false, false
+	}
+	c.started++
+	return true, c.started == c.size
+}
+
+// fail records that the first request of a canary order failed
+func (c *canary) fail() {
+	if c != nil {
+		c.failed.Add(1)
+	}
+}
+
+// checkCanary waits for the canary orders to finish and returns an error if
+// more than CanaryThreshold percent of them failed, saving a checkpoint
+// first so that the run can be resumed once the API is fixed
+func (p *Processor) checkCanary(records int, retryQueue *failedOrders) error {
+	p.limits.wait()
+	failed := int(p.canary.failed.Load())
+	rate := 100 * float64(failed) / float64(p.canary.size)
+	if rate <= p.CanaryThreshold {
+		p.Logger.Infof("Canary passed: %d of %d orders failed, continuing with the rest of the input", failed, p.canary.size)
+		return nil
+	}
+	if p.Checkpoint != "" {
+		p.checkpointQueue(records, retryQueue)
+	}
+	p.logStates()
+	return fmt.Errorf("canary failed: %d of %d orders failed (%.1f%%), above the threshold of %g%%", failed, p.canary.size, rate, p.CanaryThreshold)
+}
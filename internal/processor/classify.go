@@ -0,0 +1,183 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// errorClass is the kind of failure of an order, which decides whether it is
+// retried
+type errorClass string
+
+const (
+	// classNetwork is a request that received no response, such as a DNS
+	// failure or a refused or dropped connection
+	classNetwork errorClass = "network"
+	// classTimeout is a request that timed out
+	classTimeout errorClass = "timeout"
+	classServer  errorClass = "5xx"
+	classClient  errorClass = "4xx"
+	// classSchema is a response that could not be rendered as a result
+	classSchema errorClass = "schema"
+	// classWrite is a result that could not be written to the output
+	classWrite errorClass = "write"
+	// classGraphQL is a GraphQL response with errors and no data
+	classGraphQL errorClass = "graphql"
+	// classSOAP is a SOAP client fault
+	classSOAP errorClass = "soap"
+)
+
+// classError is an error of a class that cannot be told from the error
+// itself, and of a code finer than its class, if set
+type classError struct {
+	class errorClass
+	code  errorCode
+	err   error
+}
+
+func (e *classError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classError) Unwrap() error {
+	return e.err
+}
+
+// classify returns the class of the failure of an order
+func classify(err error) errorClass {
+	var cerr *classError
+	if errors.As(err, &cerr) {
+		return cerr.class
+	}
+	var serr *statusError
+	if errors.As(err, &serr) {
+		if serr.code >= 500 {
+			return classServer
+		}
+		return classClient
+	}
+	var nerr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &nerr) && nerr.Timeout()) {
+		return classTimeout
+	}
+	return classNetwork
+}
+
+// retryable reports whether a failure may succeed if the order is retried.
+// Client errors other than 408 Request Timeout and 429 Too Many Requests,
+// failed GraphQL queries, SOAP client faults, and results that cannot be
+// rendered or written fail the same way again.
+func retryable(err error) bool {
+	switch classify(err) {
+	case classClient:
+		var serr *statusError
+		return errors.As(err, &serr) &&
+			(serr.code == http.StatusRequestTimeout || serr.code == http.StatusTooManyRequests)
+	case classSchema, classWrite, classGraphQL, classSOAP:
+		return false
+	}
+	return true
+}
+
+// failureClasses counts the orders of a run that failed after all retries
+// by class and by code. All methods are safe for concurrent use and safe to
+// call on a nil receiver, which counts nothing.
+type failureClasses struct {
+	mu     sync.Mutex
+	counts map[string]int
+	codes  map[string]int
+}
+
+func newFailureClasses() *failureClasses {
+	return &failureClasses{counts: make(map[string]int), codes: make(map[string]int)}
+}
+
+// add counts a failure of a class and code
+func (f *failureClasses) add(class errorClass, code errorCode) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counts[string(class)]++
+	f.codes[string(code)]++
+}
+
+// String formats the counts by class, largest first, such as
+// "3 4xx, 1 network", or returns "" if no orders failed
+func (f *failureClasses) String() string {
+	if f == nil {
+		return ""
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return formatCounts(f.counts)
+}
+
+// Codes formats the counts by code, largest first, such as
+// "2 E_HTTP_NOT_FOUND, 1 E_HTTP_AUTH", or returns "" if no orders failed
+func (f *failureClasses) Codes() string {
+	if f == nil {
+		return ""
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return formatCounts(f.codes)
+}
+
+// byClass returns the counts by class, or nil if no orders failed
+func (f *failureClasses) byClass() map[string]int {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return copyCounts(f.counts)
+}
+
+// byCode returns the counts by code, or nil if no orders failed
+func (f *failureClasses) byCode() map[string]int {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return copyCounts(f.codes)
+}
+
+// copyCounts copies counts, or returns nil if there are none
+func copyCounts(counts map[string]int) map[string]int {
+	if len(counts) == 0 {
+		return nil
+	}
+	out := make(map[string]int, len(counts))
+	for key, n := range counts {
+		out[key] = n
+	}
+	return out
+}
+
+// formatCounts formats counts, largest first
+func formatCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%d %s", counts[key], key)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,234 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/cluster"
+	"github.com/fauzanelka/99tech-order-processor/internal/lifecycle"
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/fauzanelka/99tech-order-processor/internal/orderfile"
+	"github.com/fauzanelka/99tech-order-processor/internal/rejects"
+)
+
+// maxLeaseFailures is the number of consecutive failed lease requests after
+// which a worker gives up on its coordinator
+const maxLeaseFailures = 5
+
+// ProcessDistributed reads the input and hands the matching orders to
+// workers connecting on ln, instead of requesting them itself. Results and
+// failures are written here as workers report them, and orders whose
+// request failed are handed out again until they run out of retries. Input
+// records are rejected and filtered here too, so workers only see orders to
+// request.
+func (p *Processor) ProcessDistributed(ln net.Listener, opts cluster.Options) (err error) {
+	defer func() { err = p.endRun(err) }()
+	reader, closeInput, err := p.openReader()
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	p.output, err = p.openOutputs(false)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer p.output.Close()
+	p.states = lifecycle.NewTracker(nil)
+	p.latency = nil
+	p.failures = newFailureClasses()
+	p.budget = newRetryBudget(p.RetryBudget)
+	p.matched = 0
+	atomic.StoreInt64(&p.rejected, 0)
+	p.startIDs()
+
+	coord := cluster.NewCoordinator(opts, p.settleTask)
+	srv := &http.Server{Handler: coord}
+	go srv.Serve(ln)
+	defer srv.Close()
+	p.Logger.Infof("Waiting for workers on %s", ln.Addr())
+
+	filter := models.NewFilter(p.Symbol, p.Side)
+	filter.Shard = p.Shard
+	filter.Sample = p.Sample
+	input, stopReading := readRecords(reader)
+	defer stopReading()
+	for {
+		order, err := next(input)
+		if err == io.EOF {
+			break
+		}
+		p.Progress.Read()
+
+		var perr *orderfile.ParseError
+		if errors.As(err, &perr) {
+			p.Logger.WithField("error_code", codeParseInput).Warnf("Line %d is not a valid order: %v", perr.Line, perr.Err)
+			p.reject(rejects.Reject{Line: perr.Line, Reason: perr.Err.Error(), Code: string(codeParseInput), Record: perr.Raw})
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error reading input file: %w", err)
+		}
+		if !p.prepare(&order) || !filter.Match(order) {
+			continue
+		}
+		take, last := p.take()
+		if take {
+			if err := p.output.check(order); err != nil {
+				return fmt.Errorf("failed to create output file: %w", err)
+			}
+			p.startOrder(order, lifecycle.Pending)
+			coord.Submit(order, p.requestID(order))
+		}
+		if last {
+			p.Logger.Infof("Reached the limit of %d orders, not reading further", p.Limit)
+			break
+		}
+	}
+
+	coord.Close()
+	p.Logger.Infof("Read all orders, waiting for workers to finish")
+	<-coord.Done()
+	// Let idle workers learn that the run is complete before stopping
+	time.Sleep(cluster.DoneGrace)
+
+	if err := p.output.Commit(); err != nil {
+		return fmt.Errorf("failed to finalize output file: %w", err)
+	}
+	p.logStates()
+	return nil
+}
+
+// settleTask handles a worker's result for an order and reports whether the
+// order should be handed out again
+func (p *Processor) settleTask(task cluster.Task, res cluster.Result) bool {
+	order := task.Order
+	attempts := task.Attempt + 1
+
+	// The coordinator only learns of a request once its result comes back
+	p.moveOrder(order, lifecycle.Requested)
+	var err error
+	switch {
+	case res.Error == "":
+		err = p.succeed(order, res.StatusCode, res.Body)
+	case res.StatusCode != 0:
+		err = &statusError{code: res.StatusCode}
+	default:
+		err = errors.New(res.Error)
+	}
+	if err == nil {
+		return false
+	}
+
+	if p.skip(order, err) {
+		return false
+	}
+	if p.canRetry(err) && attempts <= p.Retries && p.retryAllowed() {
+		p.orderLog(order).Warnf("Worker %s failed to process order %s (attempt %d), retrying: %v", res.Worker, order.OrderID, attempts, err)
+		p.moveOrder(order, lifecycle.Retrying)
+		return true
+	}
+	if p.canRetry(err) {
+		p.failureLog(order, err).Errorf("Exceeded maximum retries for order %s", order.OrderID)
+	} else {
+		p.failureLog(order, err).Errorf("Not retrying order %s after a %s failure", order.OrderID, classify(err))
+	}
+	p.failOrder(order, attempts, err)
+	return false
+}
+
+// ProcessTasks requests the orders leased from a coordinator, batch at a
+// time, and returns the responses to it until the run is complete or ctx is
+// done. Orders leased but not yet requested when ctx is done are handed
+// back to the coordinator.
+func (p *Processor) ProcessTasks(ctx context.Context, client *cluster.Client, batch int) error {
+	p.client = p.apiClient()
+	// Workers log with their own run ID, but send the request IDs the
+	// coordinator assigned
+	p.startIDs()
+
+	failures := 0
+	for {
+		tasks, err := client.Lease(ctx, batch)
+		if ctx.Err() != nil {
+			p.Logger.Infof("Stopping: %v", ctx.Err())
+			return nil
+		}
+		if errors.Is(err, cluster.ErrDone) {
+			p.Logger.Infof("Coordinator reports the run is complete")
+			return nil
+		}
+		if errors.Is(err, cluster.ErrUnauthorized) {
+			return err
+		}
+		if err != nil {
+			failures++
+			if failures >= maxLeaseFailures {
+				return fmt.Errorf("failed to lease orders: %w", err)
+			}
+			p.Logger.Warnf("Failed to lease orders, retrying: %v", err)
+			time.Sleep(time.Second * time.Duration(failures))
+			continue
+		}
+		failures = 0
+
+		for i, task := range tasks {
+			if ctx.Err() != nil {
+				p.releaseTasks(client, tasks[i:])
+				p.Logger.Infof("Stopping: %v", ctx.Err())
+				return nil
+			}
+			if err := p.processTask(client, task); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// processTask requests a leased order and returns the response
+func (p *Processor) processTask(client *cluster.Client, task cluster.Task) error {
+	order := task.Order
+	p.requestIDs.set(order.OrderID, task.RequestID)
+	p.Progress.Read()
+	p.orderInfof(order, "Processing order %s: %s %s %s at $%s",
+		order.OrderID, order.Side, order.Quantity, order.Symbol, order.Price)
+
+	res := cluster.Result{ID: task.ID}
+	var err error
+	res.StatusCode, res.Body, err = p.request(order, 0)
+	if err != nil {
+		p.orderLog(order).Warnf("Failed to process order %s: %v", order.OrderID, err)
+		res.Error = err.Error()
+		p.Progress.Failed(failureReason(err))
+	} else {
+		p.orderInfof(order, "Successfully processed order %s", order.OrderID)
+		p.Progress.Processed()
+	}
+
+	// The result is returned even when stopping, so the request is not
+	// repeated by another worker
+	err = client.Complete(context.Background(), res)
+	if errors.Is(err, cluster.ErrNotLeased) {
+		p.orderLog(order).Warnf("Order %s took longer than its lease and was handed to another worker", order.OrderID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to return order %s to the coordinator: %w", order.OrderID, err)
+	}
+	return nil
+}
+
+// releaseTasks hands back leased orders that were not requested
+func (p *Processor) releaseTasks(client *cluster.Client, tasks []cluster.Task) {
+	for _, task := range tasks {
+		if err := client.Complete(context.Background(), cluster.Result{ID: task.ID, Released: true}); err != nil {
+			p.Logger.Warnf("Failed to release order %s: %v", task.Order.OrderID, err)
+		}
+	}
+}
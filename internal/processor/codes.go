@@ -0,0 +1,131 @@
+package processor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/fauzanelka/99tech-order-processor/internal/transform"
+)
+
+// errorCode is a stable, machine-readable code for why an order failed or
+// was rejected. Codes are finer than failure classes, and unlike error
+// messages they do not change between releases, so downstream triage can
+// match on them.
+type errorCode string
+
+// Failure codes, by class
+const (
+	// network
+	codeDNS               errorCode = "E_DNS"
+	codeConnectionRefused errorCode = "E_CONNECTION_REFUSED"
+	codeConnectionReset   errorCode = "E_CONNECTION_RESET"
+	codeTLS               errorCode = "E_TLS"
+	codeNetwork           errorCode = "E_NETWORK"
+	// timeout
+	codeTimeout errorCode = "E_TIMEOUT"
+	// 5xx
+	codeHTTP5xx errorCode = "E_HTTP_5XX"
+	// 4xx
+	codeHTTPAuth        errorCode = "E_HTTP_AUTH"
+	codeHTTPNotFound    errorCode = "E_HTTP_NOT_FOUND"
+	codeHTTPRateLimited errorCode = "E_HTTP_RATE_LIMITED"
+	codeHTTP4xx         errorCode = "E_HTTP_4XX"
+	// schema
+	codeParseJSON     errorCode = "E_PARSE_JSON"
+	codeParseXML      errorCode = "E_PARSE_XML"
+	codeTooLarge      errorCode = "E_RESPONSE_TOO_LARGE"
+	codeRenderRequest errorCode = "E_RENDER_REQUEST"
+	codeRenderOutput  errorCode = "E_RENDER_OUTPUT"
+	codeTransform     errorCode = "E_TRANSFORM"
+	codePagination    errorCode = "E_PAGINATION"
+	codeSchema        errorCode = "E_SCHEMA"
+	// write, graphql, and soap
+	codeWrite     errorCode = "E_WRITE"
+	codeGraphQL   errorCode = "E_GRAPHQL"
+	codeSOAPFault errorCode = "E_SOAP_FAULT"
+)
+
+// Reject codes
+const (
+	codeParseInput    errorCode = "E_PARSE_INPUT"
+	codeNotPlain      errorCode = "E_NOT_PLAIN_DECIMAL"
+	codeNoCredentials errorCode = "E_NO_CREDENTIALS"
+	codeRuleViolation errorCode = "E_RULE_VIOLATION"
+	codeStatusSkipped errorCode = "E_STATUS_SKIPPED"
+	codePriceOutlier  errorCode = "E_PRICE_OUTLIER"
+)
+
+// classCodes are the codes of failures of each class that have no finer one
+var classCodes = map[errorClass]errorCode{
+	classNetwork: codeNetwork,
+	classTimeout: codeTimeout,
+	classServer:  codeHTTP5xx,
+	classClient:  codeHTTP4xx,
+	classSchema:  codeSchema,
+	classWrite:   codeWrite,
+	classGraphQL: codeGraphQL,
+	classSOAP:    codeSOAPFault,
+}
+
+// failureCode returns the code of the failure of an order
+func failureCode(err error) errorCode {
+	var cerr *classError
+	if errors.As(err, &cerr) && cerr.code != "" {
+		return cerr.code
+	}
+	if errors.Is(err, transform.ErrNotJSON) {
+		return codeParseJSON
+	}
+
+	class := classify(err)
+	switch class {
+	case classClient:
+		var serr *statusError
+		if errors.As(err, &serr) {
+			switch serr.code {
+			case http.StatusUnauthorized, http.StatusForbidden:
+				return codeHTTPAuth
+			case http.StatusNotFound:
+				return codeHTTPNotFound
+			case http.StatusTooManyRequests:
+				return codeHTTPRateLimited
+			}
+		}
+	case classNetwork:
+		var dnsErr *net.DNSError
+		var certErr *tls.CertificateVerificationError
+		var alert tls.AlertError
+		var recordErr tls.RecordHeaderError
+		var authErr x509.UnknownAuthorityError
+		var hostErr x509.HostnameError
+		var invalidErr x509.CertificateInvalidError
+		switch {
+		case errors.As(err, &dnsErr):
+			return codeDNS
+		case errors.Is(err, syscall.ECONNREFUSED):
+			return codeConnectionRefused
+		case errors.Is(err, syscall.ECONNRESET):
+			return codeConnectionReset
+		case errors.As(err, &certErr), errors.As(err, &alert), errors.As(err, &recordErr),
+			errors.As(err, &authErr), errors.As(err, &hostErr), errors.As(err, &invalidErr):
+			return codeTLS
+		}
+	}
+	return classCodes[class]
+}
+
+// failureLog returns the log entry for the failure of an order, with its
+// class and code
+func (p *Processor) failureLog(order models.Order, err error) *logrus.Entry {
+	return p.orderLog(order).WithFields(logrus.Fields{
+		"error_class": classify(err),
+		"error_code":  failureCode(err),
+	})
+}
@@ -0,0 +1,127 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// maxFailedInMemory is the most failed orders kept in memory; later ones
+// are spilled to a temporary file
+const maxFailedInMemory = 1000
+
+// failedOrders collects the orders whose first attempt failed, from
+// concurrent requests. Past maxFailedInMemory orders they are spilled to a
+// temporary file, so that an API outage during a long run does not hold the
+// rest of the input in memory; if the file cannot be written, they are kept
+// in memory instead. close removes the file.
+type failedOrders struct {
+	mu      sync.Mutex
+	orders  []models.Order
+	spill   *os.File
+	spilled int
+}
+
+// spilledOrder is a line of the spill file. The input line number of the
+// order is not part of its JSON, so it is kept alongside.
+type spilledOrder struct {
+	Line  int          `json:"line,omitempty"`
+	Order models.Order `json:"order"`
+}
+
+// add adds an order and returns the number of failed orders
+func (f *failedOrders) add(order models.Order) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.orders) < maxFailedInMemory || !f.spillOrder(order) {
+		f.orders = append(f.orders, order)
+	}
+	return len(f.orders) + f.spilled
+}
+
+// spillOrder appends an order to the spill file, creating it if needed. It
+// must be called with mu held.
+func (f *failedOrders) spillOrder(order models.Order) bool {
+	if f.spill == nil {
+		file, err := os.CreateTemp("", "order-processor-failed-*.jsonl")
+		if err != nil {
+			return false
+		}
+		f.spill = file
+	}
+	line, err := json.Marshal(spilledOrder{Line: order.Line, Order: order})
+	if err != nil {
+		return false
+	}
+	if _, err := f.spill.Write(append(line, '\n')); err != nil {
+		return false
+	}
+	f.spilled++
+	return true
+}
+
+// len returns the number of failed orders
+func (f *failedOrders) len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.orders) + f.spilled
+}
+
+// each calls fn with every failed order, reading spilled orders back one
+// at a time
+func (f *failedOrders) each(fn func(models.Order)) error {
+	f.mu.Lock()
+	orders := append([]models.Order(nil), f.orders...)
+	spill, spilled := f.spill, f.spilled
+	f.mu.Unlock()
+
+	for _, order := range orders {
+		fn(order)
+	}
+	if spill == nil {
+		return nil
+	}
+	file, err := os.Open(spill.Name())
+	if err != nil {
+		return fmt.Errorf("failed to read spilled failed orders: %w", err)
+	}
+	defer file.Close()
+	lines := bufio.NewScanner(file)
+	lines.Buffer(nil, 16*1024*1024)
+	for i := 0; i < spilled && lines.Scan(); i++ {
+		var spilled spilledOrder
+		if err := json.Unmarshal(lines.Bytes(), &spilled); err != nil {
+			return fmt.Errorf("failed to read spilled failed orders: %w", err)
+		}
+		spilled.Order.Line = spilled.Line
+		fn(spilled.Order)
+	}
+	if err := lines.Err(); err != nil {
+		return fmt.Errorf("failed to read spilled failed orders: %w", err)
+	}
+	return nil
+}
+
+// list returns the failed orders
+func (f *failedOrders) list() ([]models.Order, error) {
+	var orders []models.Order
+	err := f.each(func(order models.Order) {
+		orders = append(orders, order)
+	})
+	return orders, err
+}
+
+// close removes the spill file, if any
+func (f *failedOrders) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.spill != nil {
+		f.spill.Close()
+		os.Remove(f.spill.Name())
+		f.spill, f.spilled = nil, 0
+	}
+}
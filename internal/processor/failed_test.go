@@ -0,0 +1,40 @@
+package processor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+func TestFailedOrdersSpillKeepsLines(t *testing.T) {
+	const n = maxFailedInMemory + 500
+	var f failedOrders
+	defer f.close()
+	for i := 1; i <= n; i++ {
+		order := models.Order{OrderID: fmt.Sprintf("a%d", i), Symbol: "TSLA", Side: "sell", Line: i,
+			Extra: map[string]interface{}{"account": "ACCT-1"}}
+		if got := f.add(order); got != i {
+			t.Fatalf("add returned %d, want %d", got, i)
+		}
+	}
+	if f.spilled != n-maxFailedInMemory {
+		t.Fatalf("%d orders were spilled, want %d", f.spilled, n-maxFailedInMemory)
+	}
+
+	orders, err := f.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != n {
+		t.Fatalf("listed %d orders, want %d", len(orders), n)
+	}
+	for i, order := range orders {
+		if order.OrderID != fmt.Sprintf("a%d", i+1) || order.Line != i+1 {
+			t.Fatalf("order %d is %s on line %d, want a%d on line %d", i, order.OrderID, order.Line, i+1, i+1)
+		}
+		if order.Extra["account"] != "ACCT-1" {
+			t.Fatalf("order %s lost its extra fields: %v", order.OrderID, order.Extra)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package processor
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/lifecycle"
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// abort collects the terminal failures that stop a fail-fast run. All
+// methods are safe for concurrent use and safe to call on a nil receiver,
+// which never stops.
+type abort struct {
+	mu     sync.Mutex
+	orders []models.Order
+	err    error
+}
+
+// add records a terminal failure
+func (a *abort) add(order models.Order, err error) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err == nil {
+		a.err = fmt.Errorf("order %s failed after all retries: %w", order.OrderID, err)
+	}
+	a.orders = append(a.orders, order)
+}
+
+// stopped reports whether an order has failed
+func (a *abort) stopped() bool {
+	if a == nil {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err != nil
+}
+
+// failure returns the first terminal failure and every failed order
+func (a *abort) failure() ([]models.Order, error) {
+	if a == nil {
+		return nil, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]models.Order(nil), a.orders...), a.err
+}
+
+// retryLater handles an order whose first attempt failed. It is added to
+// retryQueue, to be retried once the input has been read, unless failing
+// fast, when it is retried right away so that a terminal failure stops the
+// run before later orders are requested. Failures that are not retryable,
+// or any failure without retries, fail the order at once.
+func (p *Processor) retryLater(order models.Order, err error, retryQueue *failedOrders) {
+	if !p.canRetry(err) || p.Retries == 0 {
+		if p.Retries == 0 {
+			p.failureLog(order, err).Errorf("Failed to process order %s: %v", order.OrderID, err)
+		} else {
+			p.failureLog(order, err).Errorf("Failed to process order %s, not retrying a %s failure: %v", order.OrderID, classify(err), err)
+		}
+		p.failOrder(order, 1, err)
+		if p.stops(err) {
+			p.abort.add(order, err)
+		}
+		return
+	}
+	p.moveOrder(order, lifecycle.Retrying)
+	if p.FailFast {
+		p.orderLog(order).Warnf("Failed to process order %s, retrying now: %v", order.OrderID, err)
+		p.retryOrder(order)
+		return
+	}
+	p.orderLog(order).Warnf("Failed to process order %s, adding to retry queue: %v", order.OrderID, err)
+	p.Progress.RetryQueue(retryQueue.add(order))
+}
+
+// stopRun ends a run that an order stopped, failing fast or with a
+// response mapped to abort, once the orders in flight have finished. The
+// output is left uncommitted, as with any failed run. With a checkpoint, resuming continues after the last order read and
+// retries the failed orders first, unless the retry queue already keeps
+// them.
+func (p *Processor) stopRun(records int) error {
+	failed, err := p.abort.failure()
+	if err == nil {
+		return nil
+	}
+	if p.Checkpoint != "" {
+		if p.Requeue != nil {
+			failed = nil
+		}
+		for _, order := range failed {
+			p.states.Reopen(order.OrderID, lifecycle.Failed)
+		}
+		p.saveCheckpoint(records, failed)
+	}
+	p.logStates()
+	return p.stopError(err)
+}
+
+// stopError returns the error of a run stopped by a failed order
+func (p *Processor) stopError(err error) error {
+	if p.FailFast {
+		return fmt.Errorf("stopping on the first failure (--fail-fast): %w", err)
+	}
+	return fmt.Errorf("stopping on a response mapped to abort (--on-status): %w", err)
+}
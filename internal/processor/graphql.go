@@ -0,0 +1,121 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// Protocols
+const (
+	ProtocolREST    = "rest"
+	ProtocolGraphQL = "graphql"
+	ProtocolSOAP    = "soap"
+)
+
+// graphqlName matches a GraphQL variable name
+var graphqlName = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+// GraphQL requests orders with a GraphQL query POSTed to the base URL,
+// instead of a GET of the order's URL
+type GraphQL struct {
+	// Query renders the query document of an order, executed with the
+	// order as .Order
+	Query *template.Template
+	// Variables binds the GraphQL variables of the query to order fields,
+	// as variable name to field name
+	Variables map[string]string
+}
+
+// ParseGraphQL parses a query template and variable bindings of the form
+// NAME=FIELD, such as id=order_id, where FIELD is an order field or an
+// extra input field
+func ParseGraphQL(query string, bindings []string) (*GraphQL, error) {
+	tmpl, err := template.New("graphql").Option("missingkey=zero").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GraphQL query: %w", err)
+	}
+	g := &GraphQL{Query: tmpl, Variables: make(map[string]string, len(bindings))}
+	for _, b := range bindings {
+		name, field, ok := strings.Cut(b, "=")
+		name, field = strings.TrimPrefix(strings.TrimSpace(name), "$"), strings.TrimSpace(field)
+		if !ok || !graphqlName.MatchString(name) || field == "" {
+			return nil, fmt.Errorf("invalid GraphQL variable %q: want NAME=FIELD, such as id=order_id", b)
+		}
+		g.Variables[name] = field
+	}
+	return g, nil
+}
+
+// graphqlRequest is the body of a GraphQL request
+type graphqlRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// body returns the request body for an order. Variables keep the JSON
+// types of their fields, so prices and quantities are numbers.
+func (g *GraphQL) body(order models.Order) ([]byte, error) {
+	var query bytes.Buffer
+	if err := g.Query.Execute(&query, struct{ Order models.Order }{order}); err != nil {
+		return nil, fmt.Errorf("failed to render GraphQL query: %w", err)
+	}
+	req := graphqlRequest{Query: query.String()}
+	if len(g.Variables) > 0 {
+		data, err := json.Marshal(order)
+		if err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var fields map[string]interface{}
+		if err := dec.Decode(&fields); err != nil {
+			return nil, err
+		}
+		req.Variables = make(map[string]interface{}, len(g.Variables))
+		for name, field := range g.Variables {
+			v, ok := fields[field]
+			if !ok {
+				return nil, fmt.Errorf("no %s field for GraphQL variable $%s", field, name)
+			}
+			req.Variables[name] = v
+		}
+	}
+	return json.Marshal(req)
+}
+
+// graphqlResponse is the part of a GraphQL response checked for errors
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// graphqlError returns the errors of a GraphQL response that has no data,
+// which is how GraphQL servers report failed queries with a 200 status.
+// Responses with partial data are successful.
+func graphqlError(body []byte) error {
+	var resp graphqlResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return &classError{class: classSchema, code: codeParseJSON, err: fmt.Errorf("GraphQL response is not JSON: %w", err)}
+	}
+	if len(resp.Errors) == 0 || (len(resp.Data) > 0 && string(resp.Data) != "null") {
+		return nil
+	}
+	messages := make([]string, len(resp.Errors))
+	for i, e := range resp.Errors {
+		messages[i] = e.Message
+	}
+	return &classError{class: classGraphQL, err: fmt.Errorf("GraphQL errors: %s", strings.Join(messages, "; "))}
+}
@@ -0,0 +1,104 @@
+package processor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/junit"
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/fauzanelka/99tech-order-processor/internal/rejects"
+	"github.com/fauzanelka/99tech-order-processor/internal/storage"
+)
+
+// Suites of the JUnit report: the orders processed, the input records
+// rejected before processing, such as orders that break the rules, and the
+// error a run failed with, if any
+const (
+	suiteOrders     = "orders"
+	suiteValidation = "validation"
+	suiteRun        = "run"
+)
+
+// NewJUnitReport returns a JUnit report written to path, a local path or a
+// remote URI, in which each order is a test case
+func NewJUnitReport(path string) *junit.Report {
+	return junit.New(path, suiteOrders, suiteValidation)
+}
+
+// reportPass records an order that succeeded in the JUnit report
+func (p *Processor) reportPass(order models.Order) {
+	if err := p.JUnit.Pass(suiteOrders, suiteOrders+"."+order.Symbol, order.OrderID); err != nil {
+		p.Logger.Warnf("Failed to record order %s in the JUnit report: %v", order.OrderID, err)
+	}
+}
+
+// reportFailure records an order that failed in the JUnit report, as a
+// failure of the type of its error code. Sensitive fields are masked in the
+// error, which may quote the response.
+func (p *Processor) reportFailure(order models.Order, failure models.Failure) {
+	details := fmt.Sprintf("class: %s\nattempts: %d\nrequest_id: %s\n", failure.Class, failure.Attempts, failure.RequestID)
+	if err := p.JUnit.Fail(suiteOrders, suiteOrders+"."+order.Symbol, order.OrderID, failure.Code, p.Redact.String(failure.Error), details); err != nil {
+		p.Logger.Warnf("Failed to record order %s in the JUnit report: %v", order.OrderID, err)
+	}
+}
+
+// reportSkip records an order that was skipped or held in the JUnit report
+func (p *Processor) reportSkip(order models.Order, reason string) {
+	if err := p.JUnit.Skip(suiteOrders, suiteOrders+"."+order.Symbol, order.OrderID, p.Redact.String(reason)); err != nil {
+		p.Logger.Warnf("Failed to record order %s in the JUnit report: %v", order.OrderID, err)
+	}
+}
+
+// reportReject records a rejected input record in the JUnit report, as a
+// failure of the validation suite. Sensitive fields are masked in the record
+// and reason, and the record is left out when encrypting, since the report
+// is not encrypted.
+func (p *Processor) reportReject(r rejects.Reject) {
+	// Orders skipped for their status are recorded as skipped orders
+	if r.Code == string(codeStatusSkipped) {
+		return
+	}
+	name := r.OrderID
+	switch {
+	case name != "":
+	case r.Line > 0:
+		name = fmt.Sprintf("line %d", r.Line)
+	default:
+		name = "message"
+	}
+	record := p.Redact.String(r.Record)
+	if p.Encrypt != nil {
+		record = ""
+	}
+	if err := p.JUnit.Fail(suiteValidation, suiteValidation+"."+r.Code, name, r.Code, p.Redact.String(r.Reason), record); err != nil {
+		p.Logger.Warnf("Failed to record reject in the JUnit report: %v", err)
+	}
+}
+
+// writeReport writes the JUnit report of a run, with an error of the run
+// suite if it failed, so CI fails on a run that stopped even if none of
+// its orders did
+func (p *Processor) writeReport(runErr error) error {
+	if p.JUnit == nil {
+		return nil
+	}
+	// A run that failed to start has no run ID yet
+	name := "run"
+	if run, _ := p.runID.Load().(string); run != "" {
+		name += " " + run
+	}
+	if runErr != nil {
+		if err := p.JUnit.Error(suiteRun, suiteRun, name, runErr.Error()); err != nil {
+			return err
+		}
+	}
+	started := p.started
+	if started.IsZero() {
+		started = time.Now()
+	}
+	if err := p.JUnit.Write("order-processor "+name, started); err != nil {
+		return err
+	}
+	p.Logger.Infof("Wrote JUnit report to %s", storage.Redact(p.JUnit.Path()))
+	return nil
+}
@@ -0,0 +1,48 @@
+package processor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/redact"
+)
+
+func TestJUnitReportRedacts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errors":[{"message":"unknown account=ACCT-SECRET-2"}]}`))
+	}))
+	defer srv.Close()
+
+	p := newTestProcessor(t, srv.URL,
+		testOrder("a1"),
+		`{"order_id":"a2","symbol":"TSLA","account":"ACCT-SECRET-1",`)
+	var err error
+	if p.GraphQL, err = ParseGraphQL(`query { order(id: "{{.Order.OrderID}}") { note } }`, nil); err != nil {
+		t.Fatal(err)
+	}
+	p.Redact = redact.New([]string{"account"})
+	report := filepath.Join(t.TempDir(), "report.xml")
+	p.JUnit = NewJUnitReport(report)
+	defer p.JUnit.Close()
+
+	if err := p.Process(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xml := string(data)
+	for _, secret := range []string{"ACCT-SECRET-1", "ACCT-SECRET-2"} {
+		if strings.Contains(xml, secret) {
+			t.Errorf("report has %s:\n%s", secret, xml)
+		}
+	}
+	if !strings.Contains(xml, `"account":"REDACTED"`) || !strings.Contains(xml, "account=REDACTED") {
+		t.Errorf("report does not have the masked reject and failure:\n%s", xml)
+	}
+}
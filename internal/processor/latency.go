@@ -0,0 +1,75 @@
+package processor
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/fauzanelka/99tech-order-processor/internal/histogram"
+	"github.com/fauzanelka/99tech-order-processor/internal/metrics"
+)
+
+// latencies records the latency of the API requests of a run, overall and
+// by status class, such as 2xx, or error for requests without a response.
+// All methods are safe for concurrent use and safe to call on a nil
+// receiver, which records nothing.
+type latencies struct {
+	mu      sync.Mutex
+	all     *histogram.Histogram
+	classes map[string]*histogram.Histogram
+}
+
+func newLatencies() *latencies {
+	return &latencies{all: histogram.New(), classes: make(map[string]*histogram.Histogram)}
+}
+
+// observe records the latency of a request with a status class
+func (l *latencies) observe(class string, d time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	h, ok := l.classes[class]
+	if !ok {
+		h = histogram.New()
+		l.classes[class] = h
+	}
+	l.mu.Unlock()
+	h.Observe(d)
+	l.all.Observe(d)
+}
+
+// report logs the latency percentiles and sends them as gauges in
+// milliseconds, tagged with the status class or all
+func (l *latencies) report(logger *logrus.Logger, m *metrics.Sinks) {
+	if l == nil || l.all.Count() == 0 {
+		return
+	}
+	l.mu.Lock()
+	classes := make([]string, 0, len(l.classes))
+	for class := range l.classes {
+		classes = append(classes, class)
+	}
+	l.mu.Unlock()
+	sort.Strings(classes)
+
+	logger.Infof("Request latency: %s", l.all.Summary())
+	gauges(m, "all", l.all)
+	for _, class := range classes {
+		h := l.classes[class]
+		if len(classes) > 1 {
+			logger.Infof("Request latency for %s: %s", class, h.Summary())
+		}
+		gauges(m, class, h)
+	}
+}
+
+// gauges sends the percentiles of a histogram
+func gauges(m *metrics.Sinks, class string, h *histogram.Histogram) {
+	tags := map[string]string{"status": class}
+	m.Gauge("http.latency.p50", h.Quantile(0.5).Milliseconds(), tags)
+	m.Gauge("http.latency.p90", h.Quantile(0.9).Milliseconds(), tags)
+	m.Gauge("http.latency.p99", h.Quantile(0.99).Milliseconds(), tags)
+	m.Gauge("http.latency.max", h.Max().Milliseconds(), tags)
+}
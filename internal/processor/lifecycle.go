@@ -0,0 +1,51 @@
+package processor
+
+import (
+	"github.com/fauzanelka/99tech-order-processor/internal/lifecycle"
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// startOrder records an order entering the run in state s
+func (p *Processor) startOrder(order models.Order, s lifecycle.State) {
+	p.states.Start(order.OrderID, s)
+	p.Logger.Debugf("Order %s is %s", order.OrderID, s)
+	p.reportStates("", s)
+}
+
+// moveOrder moves an order to state to
+func (p *Processor) moveOrder(order models.Order, to lifecycle.State) {
+	from, err := p.states.Move(order.OrderID, to)
+	if err != nil {
+		// Orders repeated in the input share a state while both are in flight
+		p.Logger.Debugf("Unexpected order state change: %v", err)
+	} else {
+		p.Logger.Debugf("Order %s: %s -> %s", order.OrderID, from, to)
+	}
+	p.reportStates(from, to)
+}
+
+// reportStates updates the metrics of the states an order left and entered,
+// and the state counts shown by the dashboards
+func (p *Processor) reportStates(from, to lifecycle.State) {
+	if p.states == nil {
+		return
+	}
+	counts := p.states.Counts()
+	for _, s := range []lifecycle.State{from, to} {
+		if s != "" {
+			p.Metrics.Gauge("orders.state."+string(s), int64(counts[s]), nil)
+		}
+	}
+	p.Progress.States(counts)
+}
+
+// logStates logs how many orders ended the run in each state, and the
+// latency of its requests
+func (p *Processor) logStates() {
+	p.Logger.Infof("Orders by state: %s", lifecycle.Format(p.states.Counts()))
+	if failures := p.failures.String(); failures != "" {
+		p.Logger.Infof("Failed orders by class: %s", failures)
+		p.Logger.Infof("Failed orders by code: %s", p.failures.Codes())
+	}
+	p.latency.report(p.Logger, p.Metrics)
+}
@@ -0,0 +1,131 @@
+package processor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// limiter bounds the number of orders processed at once, overall and per
+// symbol. All methods are safe to call on a nil receiver, which processes
+// orders one at a time.
+type limiter struct {
+	slots     chan struct{}
+	perSymbol int
+	// auto, if set, tunes the concurrency below the capacity of slots
+	auto    *tuner
+	mu      sync.Mutex
+	symbols map[string]chan struct{}
+	wg      sync.WaitGroup
+}
+
+// newLimiter creates a limiter for concurrency orders at once, and at most
+// perSymbol orders of the same symbol when perSymbol is positive. With auto,
+// the concurrency is tuned up to concurrency by the requests that come back.
+func newLimiter(concurrency, perSymbol int, auto bool) *limiter {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	l := &limiter{
+		slots:     make(chan struct{}, concurrency),
+		perSymbol: perSymbol,
+		symbols:   make(map[string]chan struct{}),
+	}
+	if auto {
+		l.auto = newTuner(concurrency)
+	}
+	return l
+}
+
+// run runs fn for order once the limits allow it, waiting until they do.
+// With a concurrency of 1, fn has finished when run returns; otherwise it
+// runs in the background.
+func (l *limiter) run(order models.Order, fn func()) {
+	if l == nil {
+		fn()
+		return
+	}
+	if cap(l.slots) == 1 && l.auto == nil {
+		// The slot is still taken, since orders scheduled with after may
+		// run at the same time
+		l.slots <- struct{}{}
+		defer func() { <-l.slots }()
+		fn()
+		return
+	}
+
+	// The symbol slot is taken first, so an order waiting for its symbol
+	// does not hold up orders of other symbols already in flight
+	symbol := l.symbolSlots(order.Symbol)
+	if symbol != nil {
+		symbol <- struct{}{}
+	}
+	l.slots <- struct{}{}
+	if l.auto != nil {
+		l.auto.acquire()
+	}
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		defer func() {
+			if l.auto != nil {
+				l.auto.release()
+			}
+			<-l.slots
+			if symbol != nil {
+				<-symbol
+			}
+		}()
+		fn()
+	}()
+}
+
+// symbolSlots returns the slots of a symbol, or nil if symbols are not
+// limited
+func (l *limiter) symbolSlots(symbol string) chan struct{} {
+	if l.perSymbol < 1 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	slots, ok := l.symbols[symbol]
+	if !ok {
+		slots = make(chan struct{}, l.perSymbol)
+		l.symbols[symbol] = slots
+	}
+	return slots
+}
+
+// after runs fn for order with run once delay has passed, without holding
+// a slot in the meantime. wait also waits for the orders scheduled.
+func (l *limiter) after(delay time.Duration, order models.Order, fn func()) {
+	if l == nil {
+		time.Sleep(delay)
+		fn()
+		return
+	}
+	l.wg.Add(1)
+	time.AfterFunc(delay, func() {
+		defer l.wg.Done()
+		l.run(order, fn)
+	})
+}
+
+// observe reports the latency of a request and whether it failed to a
+// tuned limiter, returning the concurrency and whether it changed
+func (l *limiter) observe(latency time.Duration, failed bool) (int, bool) {
+	if l == nil || l.auto == nil {
+		return 0, false
+	}
+	return l.auto.observe(latency, failed)
+}
+
+// wait waits for the orders in flight, and those scheduled with after, to
+// finish
+func (l *limiter) wait() {
+	if l == nil {
+		return
+	}
+	l.wg.Wait()
+}
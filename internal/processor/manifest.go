@@ -0,0 +1,181 @@
+package processor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/manifest"
+	"github.com/fauzanelka/99tech-order-processor/internal/storage"
+	"github.com/fauzanelka/99tech-order-processor/internal/version"
+)
+
+// inputDigest checksums a remote input as it is read, since it cannot be
+// read again once the run ends
+type inputDigest struct {
+	r     io.Reader
+	hash  hash.Hash
+	bytes int64
+	lines int
+	eof   bool
+}
+
+func newInputDigest(r io.Reader) *inputDigest {
+	return &inputDigest{r: r, hash: sha256.New()}
+}
+
+func (d *inputDigest) Read(b []byte) (int, error) {
+	n, err := d.r.Read(b)
+	d.hash.Write(b[:n])
+	d.bytes += int64(n)
+	d.lines += bytes.Count(b[:n], []byte{'\n'})
+	if err == io.EOF {
+		d.eof = true
+	}
+	return n, err
+}
+
+// endRun notes the problems left unannotated, writes the JUnit report and
+// manifest of a run that has ended, failed if err is set, and returns the
+// error the run ends with. A run that failed keeps its error even if they
+// cannot be written.
+func (p *Processor) endRun(err error) error {
+	p.Annotate.End()
+	if rerr := p.writeReport(err); rerr != nil {
+		if err == nil {
+			err = rerr
+		} else {
+			p.Logger.Warnf("Failed to write JUnit report: %v", rerr)
+		}
+	}
+	if merr := p.writeManifest(err); merr != nil {
+		if err != nil {
+			p.Logger.Warnf("Failed to write manifest: %v", merr)
+			return err
+		}
+		return merr
+	}
+	return err
+}
+
+// writeManifest writes the manifest of a run and the files it produced,
+// once the outputs are committed. A run that failed lists no outputs,
+// since they are not in place.
+func (p *Processor) writeManifest(runErr error) error {
+	if p.Manifest == "" {
+		return nil
+	}
+	now := time.Now().UTC()
+	m := manifest.Manifest{
+		CreatedAt: now,
+		Version:   version.String(),
+		Status:    manifest.StatusSucceeded,
+		StartedAt: p.started,
+		EndedAt:   now,
+		Config:    p.RunConfig,
+		Counts:    p.counts(),
+		Artifacts: []manifest.Artifact{},
+	}
+	m.RunID, _ = p.runID.Load().(string)
+	if m.StartedAt.IsZero() {
+		m.StartedAt = now
+	}
+	if input, err := p.describeInput(); err != nil {
+		p.Logger.Warnf("Failed to checksum input for the manifest: %v", err)
+	} else {
+		m.Input = input
+	}
+	if runErr != nil {
+		m.Status, m.Error = manifest.StatusFailed, runErr.Error()
+		if err := m.Write(p.Manifest); err != nil {
+			return err
+		}
+		p.Logger.Infof("Wrote manifest of failed run to %s", storage.Redact(p.Manifest))
+		return nil
+	}
+	if p.output != nil {
+		m.Artifacts = append(m.Artifacts, p.output.artifacts...)
+	}
+
+	if p.Rejects != nil {
+		if err := p.Rejects.Sync(); err != nil {
+			return err
+		}
+		a, err := manifest.Describe(manifest.KindRejects, p.Rejects.Path(), p.Rejects.Path(), p.Encrypt != nil)
+		if err != nil {
+			return err
+		}
+		m.Artifacts = append(m.Artifacts, a)
+	}
+	if p.Review != nil {
+		if err := p.Review.Sync(); err != nil {
+			return err
+		}
+		a, err := manifest.Describe(manifest.KindReview, p.Review.Path(), p.Review.Path(), p.Encrypt != nil)
+		if err != nil {
+			return err
+		}
+		m.Artifacts = append(m.Artifacts, a)
+	}
+	if p.Requeue != nil {
+		a, err := manifest.Describe(manifest.KindRetryQueue, p.Requeue.Path(), p.Requeue.Path(), false)
+		if err != nil {
+			return err
+		}
+		m.Artifacts = append(m.Artifacts, a)
+	}
+
+	if err := m.Write(p.Manifest); err != nil {
+		return err
+	}
+	p.Logger.Infof("Wrote manifest of %d files to %s", len(m.Artifacts), storage.Redact(p.Manifest))
+	return nil
+}
+
+// describeInput checksums the input file. Local files are read again, so
+// the checksum covers them in full even if the run stopped early; remote
+// ones are described only if they were read to the end.
+func (p *Processor) describeInput() (*manifest.Artifact, error) {
+	switch {
+	case !p.inputOpened:
+		return nil, nil
+	case p.inputDigest != nil:
+		d := p.inputDigest
+		if !d.eof {
+			return nil, nil
+		}
+		lines := d.lines
+		return &manifest.Artifact{
+			Kind:    manifest.KindInput,
+			Path:    storage.Redact(p.InputFile),
+			Bytes:   d.bytes,
+			SHA256:  hex.EncodeToString(d.hash.Sum(nil)),
+			Records: &lines,
+		}, nil
+	case storage.IsRemote(p.InputFile) || storage.IsHTTP(p.InputFile):
+		return nil, nil
+	}
+	a, err := manifest.Describe(manifest.KindInput, p.InputFile, p.InputFile, false)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// counts returns the outcomes of the orders of the run
+func (p *Processor) counts() manifest.Counts {
+	c := manifest.Counts{
+		Matched:  p.matched,
+		Rejected: int(atomic.LoadInt64(&p.rejected)),
+		States:   make(map[string]int),
+	}
+	for state, n := range p.states.Counts() {
+		c.States[string(state)] = n
+	}
+	c.FailuresByClass, c.FailuresByCode = p.failures.byClass(), p.failures.byCode()
+	return c
+}
@@ -0,0 +1,68 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/fauzanelka/99tech-order-processor/internal/orderfile"
+	"github.com/fauzanelka/99tech-order-processor/internal/outlier"
+	"github.com/fauzanelka/99tech-order-processor/internal/rejects"
+)
+
+// scanOutliers reads the whole input once to learn the prices of each
+// symbol before any order is checked for outliers
+func (p *Processor) scanOutliers() error {
+	p.outliers = outlier.NewDetector(p.Outliers)
+	if p.outliers == nil {
+		return nil
+	}
+	if p.Input != nil {
+		return fmt.Errorf("outlier detection reads the input twice and needs an input file")
+	}
+	reader, closeInput, err := p.openReader()
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	for {
+		order, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var perr *orderfile.ParseError
+		if errors.As(err, &perr) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error reading input file: %w", err)
+		}
+		p.outliers.Add(order)
+	}
+	p.Logger.Infof("Read the prices of %d symbols for outlier detection", p.outliers.Symbols())
+	return nil
+}
+
+// holdOutlier checks whether the price of an order is an outlier, records
+// it in the review file if so, and reports whether it must not be processed
+func (p *Processor) holdOutlier(order models.Order) bool {
+	reason, ok := p.outliers.Check(order)
+	if !ok {
+		return false
+	}
+	p.Metrics.Incr("orders.outliers", map[string]string{"symbol": order.Symbol, "side": order.Side})
+	record, _ := json.Marshal(order)
+	if err := p.Review.Write(rejects.Reject{OrderID: order.OrderID, Reason: reason, Code: string(codePriceOutlier), Record: string(record)}); err != nil {
+		p.Logger.Warnf("Failed to record outlier for review: %v", err)
+	}
+	if p.HoldOutliers {
+		p.Logger.WithField("error_code", codePriceOutlier).Warnf("Holding order %s for review: %s", order.OrderID, reason)
+		p.reportSkip(order, "held for review: "+reason)
+		return true
+	}
+	p.Logger.WithField("error_code", codePriceOutlier).Warnf("Order %s is an outlier: %s", order.OrderID, reason)
+	return false
+}
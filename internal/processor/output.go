@@ -0,0 +1,656 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/atomicfile"
+	"github.com/fauzanelka/99tech-order-processor/internal/encrypt"
+	"github.com/fauzanelka/99tech-order-processor/internal/manifest"
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/fauzanelka/99tech-order-processor/internal/storage"
+	"github.com/fauzanelka/99tech-order-processor/internal/transform"
+)
+
+// Supported output formats
+const (
+	// OutputRaw writes each response body as-is on its own line
+	OutputRaw = "raw"
+	// OutputEnvelope wraps each response in a models.Result JSON line
+	OutputEnvelope = "envelope"
+)
+
+// Supported output split modes
+const (
+	SplitNone   = ""
+	SplitSymbol = "symbol"
+	SplitSide   = "side"
+)
+
+// TemplateData is the value output templates are executed with
+type TemplateData struct {
+	Order      models.Order
+	StatusCode int
+	// Body is the raw response body
+	Body string
+	// Response is the response body decoded as JSON, or nil if it is not JSON
+	Response interface{}
+}
+
+// ParseOutputTemplate parses a template used to render each output line. In
+// addition to the standard functions, templates can use json to encode a
+// value as JSON.
+func ParseOutputTemplate(text string) (*template.Template, error) {
+	return template.New("output").Option("missingkey=zero").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+}
+
+// outputs holds the open output files. Without splitting there is a single
+// file; otherwise one file per symbol or side is opened on first use.
+//
+// Unless appending, results are written to partial files that only replace
+// the outputs once the run completes, so a failed run never leaves a
+// truncated output behind. When resuming, the partial files of the
+// interrupted run are continued. Remote outputs are written to a local
+// staging path and uploaded on commit. When encrypting, each file opened
+// gets its own encrypted stream. Results may be written concurrently.
+//
+// Results are buffered in memory up to bufSize bytes per file, and the
+// files are synced to disk every fsyncEvery results, if positive, as well
+// as at checkpoints and on commit.
+type outputs struct {
+	mu         sync.Mutex
+	path       string
+	remote     string
+	split      string
+	append     bool
+	resume     bool
+	force      bool
+	encrypt    *encrypt.Encrypter
+	bufSize    int
+	fsyncEvery int
+	written    int
+	files      map[string]*outputFile
+	keys       []string
+	// checked are the keys whose files were found not to exist yet
+	checked map[string]bool
+	// checksum is set to describe the files in artifacts as they are
+	// committed
+	checksum  bool
+	artifacts []manifest.Artifact
+	// tees are the extra outputs written alongside this one
+	tees []*tee
+	// tmpl, if set, is the template path is expanded from for each result,
+	// with the run started at started; the expanded paths key the files
+	tmpl    *template.Template
+	started time.Time
+	// rotation rotates files appended to in place
+	rotation Rotation
+	logger   *logrus.Logger
+}
+
+// outputFile is an open output file, the stream written to it when
+// encrypting, and the buffer in front of them when buffering. size counts
+// the bytes written to it, and started is when it was opened.
+//
+// Unencrypted files appended to in place collect whole lines in lines
+// instead, up to bufSize bytes, and write them out in one write under a
+// lock, so that other runs appending to the same file never interleave
+// partial lines with them.
+type outputFile struct {
+	file    *atomicfile.File
+	enc     *encrypt.Writer
+	buf     *bufio.Writer
+	lines   *bytes.Buffer
+	bufSize int
+	size    int64
+	started time.Time
+}
+
+// Write writes to the file, through the buffer and the stream if any
+func (f *outputFile) Write(p []byte) (int, error) {
+	f.size += int64(len(p))
+	if f.lines != nil {
+		return f.lines.Write(p)
+	}
+	if f.buf != nil {
+		return f.buf.Write(p)
+	}
+	return f.unbuffered(p)
+}
+
+// unbuffered writes to the file, through the stream when encrypting
+func (f *outputFile) unbuffered(p []byte) (int, error) {
+	if f.enc != nil {
+		return f.enc.Write(p)
+	}
+	return f.file.Write(p)
+}
+
+// endLine marks the end of a line, writing out the collected lines once
+// they fill the buffer
+func (f *outputFile) endLine() error {
+	if f.lines == nil || f.lines.Len() < f.bufSize {
+		return nil
+	}
+	return f.flush()
+}
+
+// flush writes out the buffer, if any
+func (f *outputFile) flush() error {
+	if f.lines != nil && f.lines.Len() > 0 {
+		_, err := f.file.WriteLocked(f.lines.Bytes())
+		f.lines.Reset()
+		if err != nil {
+			return fmt.Errorf("failed to write to output file: %w", err)
+		}
+		return nil
+	}
+	if f.buf == nil {
+		return nil
+	}
+	if err := f.buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write to output file: %w", err)
+	}
+	return nil
+}
+
+// Sync flushes the file to disk, writing out the buffer and sealing any
+// buffered encrypted data first
+func (f *outputFile) Sync() error {
+	if err := f.flush(); err != nil {
+		return err
+	}
+	if f.enc != nil {
+		if err := f.enc.Flush(); err != nil {
+			return err
+		}
+	}
+	return f.file.Sync()
+}
+
+// finish writes out the buffer and ends the encrypted stream, if any
+func (f *outputFile) finish() error {
+	if err := f.flush(); err != nil {
+		return err
+	}
+	if f.enc == nil {
+		return nil
+	}
+	if err := f.enc.Close(); err != nil {
+		return fmt.Errorf("failed to finish encrypted output: %w", err)
+	}
+	return nil
+}
+
+// openOutputs prepares the output files for a run, and those of its tees
+func (p *Processor) openOutputs(resume bool) (*outputs, error) {
+	if !resume || p.started.IsZero() {
+		p.started = time.Now().UTC()
+	}
+	o, err := p.newOutputs(p.OutputFile, resume)
+	if err != nil {
+		return nil, err
+	}
+	o.tees = p.openTees(resume)
+	return o, nil
+}
+
+// newOutputs prepares the output files written to path
+func (p *Processor) newOutputs(path string, resume bool) (*outputs, error) {
+	o := &outputs{
+		path:       path,
+		split:      p.OutputSplit,
+		append:     p.Append,
+		resume:     resume,
+		force:      p.Force,
+		encrypt:    p.Encrypt,
+		bufSize:    p.OutputBuffer,
+		fsyncEvery: p.FsyncEvery,
+		checksum:   p.Manifest != "",
+		files:      make(map[string]*outputFile),
+		checked:    make(map[string]bool),
+		started:    p.started,
+		rotation:   p.Rotate,
+		logger:     p.Logger,
+	}
+	if IsPathTemplate(path) {
+		tmpl, err := ParseOutputPath(path)
+		if err != nil {
+			return nil, err
+		}
+		o.tmpl = tmpl
+		return o, nil
+	}
+	if storage.IsRemote(path) {
+		if o.append {
+			return nil, fmt.Errorf("cannot append to remote output %s", storage.Redact(path))
+		}
+		o.remote = path
+		o.path = storage.StagingPath(path)
+		if err := os.MkdirAll(filepath.Dir(o.path), 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	// A single output is created up front so it exists even if nothing matches
+	if o.split == SplitNone {
+		if _, err := o.open(""); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// write appends a line to the output file for an order
+func (o *outputs) write(order models.Order, line []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	f, err := o.file(order)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write to output file: %w", err)
+	}
+	if err := f.endLine(); err != nil {
+		return err
+	}
+	o.teeAll(func(t *outputs) error { return t.write(order, line) })
+	return o.wrote()
+}
+
+// writeFrom appends a line read from r, such as a spooled response body, to
+// the output file for an order
+func (o *outputs) writeFrom(order models.Order, r io.Reader) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	f, err := o.file(order)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("failed to write to output file: %w", err)
+	}
+	if _, err := f.Write([]byte{'\n'}); err != nil {
+		return fmt.Errorf("failed to write to output file: %w", err)
+	}
+	if err := f.endLine(); err != nil {
+		return err
+	}
+	return o.wrote()
+}
+
+// wrote counts a line written, syncing the output files every fsyncEvery
+// lines. It must be called with mu held.
+func (o *outputs) wrote() error {
+	o.written++
+	if o.fsyncEvery > 0 && o.written%o.fsyncEvery == 0 {
+		return o.sync()
+	}
+	return nil
+}
+
+// key returns the key of the output file for an order
+func (o *outputs) key(order models.Order) (string, error) {
+	switch {
+	case o.tmpl != nil:
+		return o.expand(order)
+	case o.split == SplitSymbol:
+		return order.Symbol, nil
+	case o.split == SplitSide:
+		return order.Side, nil
+	}
+	return "", nil
+}
+
+// check refuses to replace an existing output file that an order would be
+// written to, so that a run stops before the order is requested rather than
+// failing each order of the file once it has been. Tees whose files exist
+// stop being written.
+func (o *outputs) check(order models.Order) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// Paths that cannot be expanded fail the order when it is written
+	key, err := o.key(order)
+	if err != nil {
+		return nil
+	}
+	if err := o.checkKey(key); err != nil {
+		return err
+	}
+	o.teeAll(func(t *outputs) error { return t.check(order) })
+	return nil
+}
+
+// checkKey refuses to replace the existing output file of a key, local or
+// remote, unless appending, resuming, or forced. It must be called with mu
+// held.
+func (o *outputs) checkKey(key string) error {
+	if o.append || o.resume || o.force || o.checked[key] {
+		return nil
+	}
+	if _, ok := o.files[key]; ok {
+		return nil
+	}
+	path, remote := o.paths(key)
+	target := path
+	if remote != "" {
+		target = remote
+	}
+	exists, err := storage.NonEmpty(context.Background(), target)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("output file %s already exists and is not empty; pass --force to replace it or --append to add to it", storage.Redact(target))
+	}
+	o.checked[key] = true
+	return nil
+}
+
+// file returns the output file for an order, opening it if needed
+func (o *outputs) file(order models.Order) (*outputFile, error) {
+	key, err := o.key(order)
+	if err != nil {
+		return nil, err
+	}
+
+	if f, ok := o.files[key]; ok {
+		if o.append && o.rotation.due(f, time.Now()) {
+			return o.rotate(key, f)
+		}
+		return f, nil
+	}
+	return o.open(key)
+}
+
+// open opens the output file for a split key
+func (o *outputs) open(key string) (*outputFile, error) {
+	path, remote := o.paths(key)
+	if o.tmpl != nil {
+		if o.append && remote != "" {
+			return nil, fmt.Errorf("cannot append to remote output %s", storage.Redact(remote))
+		}
+		if err := makeDir(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := o.checkKey(key); err != nil {
+		return nil, err
+	}
+
+	var file *atomicfile.File
+	var err error
+	if o.append {
+		file, err = atomicfile.Append(path)
+	} else {
+		file, err = atomicfile.Create(path, o.resume)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f, err := o.wrap(file)
+	if err != nil {
+		return nil, err
+	}
+
+	o.files[key] = f
+	o.keys = append(o.keys, key)
+	return f, nil
+}
+
+// writerFunc adapts a function to io.Writer
+type writerFunc func([]byte) (int, error)
+
+func (fn writerFunc) Write(p []byte) (int, error) {
+	return fn(p)
+}
+
+// wrap starts an encrypted stream on a newly opened file when encrypting,
+// and a buffer when buffering
+func (o *outputs) wrap(file *atomicfile.File) (*outputFile, error) {
+	f := &outputFile{file: file, started: time.Now()}
+	if info, err := file.Stat(); err == nil {
+		f.size = info.Size()
+	}
+	if o.encrypt != nil {
+		enc, err := o.encrypt.NewWriter(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to start encrypted output: %w", err)
+		}
+		f.enc = enc
+	}
+	if o.append && o.encrypt == nil {
+		f.lines, f.bufSize = &bytes.Buffer{}, o.bufSize
+		return f, nil
+	}
+	if o.bufSize > 0 {
+		f.buf = bufio.NewWriterSize(writerFunc(f.unbuffered), o.bufSize)
+	}
+	return f, nil
+}
+
+// Sync flushes all output files to disk
+func (o *outputs) Sync() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.sync()
+}
+
+// sync flushes all output files to disk. It must be called with mu held.
+func (o *outputs) sync() error {
+	for _, key := range o.keys {
+		if err := o.files[key].Sync(); err != nil {
+			return err
+		}
+	}
+	o.teeAll((*outputs).Sync)
+	return nil
+}
+
+// Commit moves all output files into place, uploading remote outputs
+func (o *outputs) Commit() error {
+	for _, key := range o.keys {
+		if err := o.files[key].finish(); err != nil {
+			return err
+		}
+		if err := o.files[key].file.Commit(); err != nil {
+			return err
+		}
+
+		local, remote := o.paths(key)
+		if o.checksum {
+			path := local
+			if remote != "" {
+				path = storage.Redact(remote)
+			}
+			a, err := manifest.Describe(manifest.KindOutput, local, path, o.encrypt != nil)
+			if err != nil {
+				return err
+			}
+			o.artifacts = append(o.artifacts, a)
+		}
+		if remote == "" {
+			continue
+		}
+		if err := storage.Upload(context.Background(), local, remote); err != nil {
+			return err
+		}
+		os.Remove(local)
+	}
+	o.commitTees()
+	return nil
+}
+
+// Reopen reopens the output files that are appended to in place, so that
+// files rotated by renaming them are continued in fresh ones. Partial files
+// are left alone, since they are only moved into place on commit.
+func (o *outputs) Reopen() error {
+	if !o.append {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, key := range o.keys {
+		path, _ := o.paths(key)
+		file, err := atomicfile.Append(path)
+		if err != nil {
+			return err
+		}
+		f, err := o.wrap(file)
+		if err != nil {
+			return err
+		}
+		o.files[key].finish()
+		o.files[key].file.Close()
+		o.files[key] = f
+	}
+	o.teeAll((*outputs).Reopen)
+	return nil
+}
+
+// Close closes all output files without committing them. Encrypted streams
+// are flushed but left unfinished, which marks the files as incomplete.
+func (o *outputs) Close() {
+	for _, key := range o.keys {
+		f := o.files[key]
+		f.flush()
+		if f.enc != nil {
+			f.enc.Flush()
+		}
+		o.files[key].file.Close()
+	}
+	for _, t := range o.tees {
+		if t.err == nil {
+			t.out.Close()
+		}
+	}
+}
+
+// KeyedPath inserts key before the extension of an output path or URI, so
+// that output.jsonl becomes output-<key>.jsonl
+func KeyedPath(output, key string) string {
+	if storage.IsRemote(output) {
+		return splitURI(output, key)
+	}
+	return splitPath(output, key)
+}
+
+// splitPath inserts a split key before the extension of path, so that
+// output.jsonl becomes output-TSLA.jsonl
+func splitPath(path, key string) string {
+	key = pathSegment(key)
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + key + ext
+}
+
+// splitURI applies splitPath to the path of a URI, keeping its query string
+func splitURI(uri, key string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return splitPath(uri, key)
+	}
+	u.Path = splitPath(u.Path, key)
+	u.RawPath = ""
+	return u.String()
+}
+
+// writeResult writes the response for an order to its output file
+func (p *Processor) writeResult(order models.Order, statusCode int, body []byte) error {
+	// Masked fields are replaced, and responses transformed, in every result
+	// written
+	order.Extra = p.Mask.Map(order.Extra)
+	body = p.Mask.JSON(body)
+	body, err := p.Transform.Apply(body)
+	if err != nil {
+		code := codeTransform
+		if errors.Is(err, transform.ErrNotJSON) {
+			code = codeParseJSON
+		}
+		return &classError{class: classSchema, code: code, err: err}
+	}
+
+	line, err := p.formatResult(order, statusCode, body)
+	if err != nil {
+		return &classError{class: classSchema, code: codeRenderOutput, err: err}
+	}
+
+	if err := p.output.write(order, line); err != nil {
+		return &classError{class: classWrite, err: err}
+	}
+
+	// Published results are always enveloped so consumers know the order
+	if p.Publisher != nil {
+		msg, err := json.Marshal(p.result(order, statusCode, body))
+		if err != nil {
+			return fmt.Errorf("failed to encode result: %w", err)
+		}
+		if err := p.Publisher.Result(order.Symbol, msg); err != nil {
+			p.orderLog(order).Warnf("Failed to publish result of order %s: %v", order.OrderID, err)
+		}
+	}
+
+	// Indexed results are timestamped for time-based indices and dashboards
+	if p.Indexer != nil {
+		now := time.Now().UTC()
+		doc, err := json.Marshal(indexedResult{Timestamp: now, Result: p.result(order, statusCode, body)})
+		if err != nil {
+			return fmt.Errorf("failed to encode result: %w", err)
+		}
+		if err := p.Indexer.Add(now, doc); err != nil {
+			p.Logger.Warnf("Failed to index results: %v", err)
+		}
+	}
+	return nil
+}
+
+// indexedResult is the document indexed for a result
+type indexedResult struct {
+	Timestamp time.Time `json:"@timestamp"`
+	models.Result
+}
+
+// formatResult renders the output line for a response
+func (p *Processor) formatResult(order models.Order, statusCode int, body []byte) ([]byte, error) {
+	switch {
+	case p.OutputTemplate != nil:
+		data := TemplateData{Order: order, StatusCode: statusCode, Body: string(body)}
+		if err := json.Unmarshal(body, &data.Response); err != nil {
+			data.Response = nil
+		}
+		var buf bytes.Buffer
+		if err := p.OutputTemplate.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("failed to render output template: %w", err)
+		}
+		return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+	case p.OutputFormat == OutputEnvelope:
+		line, err := json.Marshal(p.result(order, statusCode, body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode result: %w", err)
+		}
+		return line, nil
+	default:
+		return body, nil
+	}
+}
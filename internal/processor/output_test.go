@@ -0,0 +1,52 @@
+package processor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSplitOutputExists(t *testing.T) {
+	var requests int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	p := newTestProcessor(t, srv.URL, testOrder("a1"), testOrder("a2"))
+	p.OutputSplit = SplitSymbol
+	existing := splitPath(p.OutputFile, "TSLA")
+	if err := os.WriteFile(existing, []byte("earlier run\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := p.Process()
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("Process = %v, want an error that the output exists", err)
+	}
+	if n := atomic.LoadInt64(&requests); n != 0 {
+		t.Errorf("%d orders were requested, want none", n)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "earlier run\n" {
+		t.Errorf("existing output was changed to %q", data)
+	}
+
+	// Forced runs replace it
+	p = newTestProcessor(t, srv.URL, testOrder("a1"))
+	p.OutputSplit = SplitSymbol
+	p.Force = true
+	existing = splitPath(p.OutputFile, "TSLA")
+	if err := os.WriteFile(existing, []byte("earlier run\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Process(); err != nil {
+		t.Fatalf("forced Process: %v", err)
+	}
+	if data, _ := os.ReadFile(existing); !strings.Contains(string(data), `{"ok":true}`) {
+		t.Errorf("forced output = %q", data)
+	}
+}
@@ -0,0 +1,104 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/fauzanelka/99tech-order-processor/internal/storage"
+)
+
+// OutputPathData is the value output path templates are executed with
+type OutputPathData struct {
+	// Date and Hour are when the run started, in UTC, as 2006-01-02 and 15.
+	// A resumed run keeps those of the run it resumes.
+	Date string
+	Hour string
+	// Symbol and Side are those of the order a result is written for
+	Symbol string
+	Side   string
+	// OrderDate is the date of the order's timestamp in UTC, or empty if it
+	// has none
+	OrderDate string
+}
+
+// IsPathTemplate reports whether an output path is a template to be
+// expanded for each run and result, such as results/{{.Date}}/{{.Symbol}}.jsonl
+func IsPathTemplate(path string) bool {
+	return strings.Contains(path, "{{")
+}
+
+// ParseOutputPath parses an output path template, local or a storage URI
+func ParseOutputPath(path string) (*template.Template, error) {
+	tmpl, err := template.New("path").Parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output path template: %w", err)
+	}
+	if _, err := expandPath(tmpl, OutputPathData{}); err != nil {
+		return nil, fmt.Errorf("invalid output path template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// expandPath renders an output path template
+func expandPath(tmpl *template.Template, data OutputPathData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// expand returns the output path of the result for an order, which keys its
+// output file
+func (o *outputs) expand(order models.Order) (string, error) {
+	data := OutputPathData{
+		Date:   o.started.Format("2006-01-02"),
+		Hour:   o.started.Format("15"),
+		Symbol: pathSegment(order.Symbol),
+		Side:   pathSegment(order.Side),
+	}
+	if !order.Timestamp.IsZero() {
+		data.OrderDate = order.Timestamp.UTC().Format("2006-01-02")
+	}
+	path, err := expandPath(o.tmpl, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to expand output path: %w", err)
+	}
+	return path, nil
+}
+
+// paths returns the local path of the output file for a key and, if the
+// output is remote, the URI it is uploaded to
+func (o *outputs) paths(key string) (local, remote string) {
+	switch {
+	case o.tmpl != nil && storage.IsRemote(key):
+		return storage.StagingPath(key), key
+	case o.tmpl != nil:
+		return key, ""
+	case key == "":
+		return o.path, o.remote
+	case o.remote != "":
+		return splitPath(o.path, key), splitURI(o.remote, key)
+	default:
+		return splitPath(o.path, key), ""
+	}
+}
+
+// makeDir creates the directory of a local output path expanded from a
+// template, such as a new date partition
+func makeDir(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	return nil
+}
+
+// pathSegment makes a value safe to use as part of a path
+func pathSegment(s string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", string(filepath.Separator), "_").Replace(s)
+}
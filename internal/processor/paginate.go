@@ -0,0 +1,136 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// maxPages is the most pages followed for an order, guarding against an
+// API that never stops paginating
+const maxPages = 1000
+
+// Pagination describes how the next page of a paginated response is found
+type Pagination struct {
+	// NextPath is the path of the next page in a response body, as parsed
+	// by ParseJSONPath. Its value is either the URL of the next page,
+	// absolute or relative to the current one, or a cursor sent in
+	// CursorParam. A missing, null, empty, or false value ends the pages.
+	NextPath []string
+	// CursorParam is the query parameter cursors are sent in
+	CursorParam string
+}
+
+// ParseJSONPath parses a dotted path to a field of a JSON object, such as
+// .next or .meta.next_cursor
+func ParseJSONPath(s string) ([]string, error) {
+	path := strings.Split(strings.TrimPrefix(strings.TrimSpace(s), "."), ".")
+	for _, field := range path {
+		if field == "" {
+			return nil, fmt.Errorf("invalid path %q: want dotted field names such as .meta.next", s)
+		}
+	}
+	return path, nil
+}
+
+// next returns the next page value of a response body, or "" if it is the
+// last page
+func (pg *Pagination) next(body []byte) string {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return ""
+	}
+	for _, field := range pg.NextPath {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = obj[field]
+	}
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	return ""
+}
+
+// pageURL returns the URL of the page after the one at current, for an
+// order whose first page is at first
+func (pg *Pagination) pageURL(first, current, next string) (string, error) {
+	if strings.HasPrefix(next, "http://") || strings.HasPrefix(next, "https://") ||
+		strings.HasPrefix(next, "/") || strings.HasPrefix(next, "?") {
+		base, err := url.Parse(current)
+		if err != nil {
+			return "", err
+		}
+		ref, err := url.Parse(next)
+		if err != nil {
+			return "", fmt.Errorf("invalid next page URL %q: %w", next, err)
+		}
+		return base.ResolveReference(ref).String(), nil
+	}
+	u, err := url.Parse(first)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set(pg.CursorParam, next)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// followPages requests the pages after the first response to an order,
+// returning a response whose body is a JSON array of the bodies of all of
+// them. A failed page fails the order, which is then retried from its first
+// page.
+func (p *Processor) followPages(order models.Order, first response, retryCount int) (response, error) {
+	firstURL := p.orderURL(order)
+	current := firstURL
+	next := p.Paginate.next(first.body)
+	if next == "" {
+		return first, nil
+	}
+
+	pages := []json.RawMessage{pageJSON(first.body)}
+	seen := map[string]bool{}
+	for ; next != ""; next = p.Paginate.next(pages[len(pages)-1]) {
+		if seen[next] || len(pages) >= maxPages {
+			return response{}, &classError{class: classSchema, code: codePagination, err: fmt.Errorf("pagination did not end after %d pages (next %q)", len(pages), next)}
+		}
+		seen[next] = true
+		u, err := p.Paginate.pageURL(firstURL, current, next)
+		if err != nil {
+			return response{}, &classError{class: classSchema, code: codePagination, err: err}
+		}
+		p.orderLog(order).Debugf("Requesting page %d of order %s", len(pages)+1, order.OrderID)
+		r, err := p.attemptURL(order, u, retryCount)
+		if err != nil {
+			return r, err
+		}
+		pages = append(pages, pageJSON(r.body))
+		current = u
+	}
+	body, err := json.Marshal(pages)
+	if err != nil {
+		return response{}, &classError{class: classSchema, code: codePagination, err: fmt.Errorf("failed to combine pages: %w", err)}
+	}
+	return response{statusCode: first.statusCode, body: body}, nil
+}
+
+// pageJSON returns a page body as JSON, embedding one that is not JSON as a
+// JSON string
+func pageJSON(body []byte) json.RawMessage {
+	if json.Valid(body) {
+		return body
+	}
+	s, _ := json.Marshal(string(body))
+	return s
+}
@@ -0,0 +1,95 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/healthcheck"
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/fauzanelka/99tech-order-processor/internal/storage"
+)
+
+// preflightHints are what to look at when a step of the API check fails
+var preflightHints = map[string]string{
+	"dns":     "check --url and --resolve",
+	"connect": "check --url, --resolve, --ip-version, and that the API is up",
+	"tls":     "check --tls-min-version, --tls-ciphers, and the API's certificate",
+}
+
+// Preflight checks that a run can go ahead before any input is read: that
+// the output and checkpoint can be written, that the output template
+// renders, and that the API can be reached and accepts the credentials of
+// the run. The returned error lists everything found wrong.
+func (p *Processor) Preflight(ctx context.Context) error {
+	var errs []error
+	// Templated outputs are written to directories created as they are needed
+	if !storage.IsRemote(p.OutputFile) && !IsPathTemplate(p.OutputFile) {
+		errs = append(errs, checkWritable("output file", p.OutputFile, "--output"))
+	}
+	if p.Checkpoint != "" {
+		errs = append(errs, checkWritable("checkpoint", p.Checkpoint, "--checkpoint"))
+	}
+	if p.OutputTemplate != nil {
+		data := TemplateData{Order: models.Order{Extra: map[string]interface{}{}}, Response: map[string]interface{}{}}
+		if err := p.OutputTemplate.Execute(io.Discard, data); err != nil {
+			errs = append(errs, fmt.Errorf("output template cannot be rendered: %w; check --output-template", err))
+		}
+	}
+
+	if p.CredentialField == "" {
+		errs = append(errs, p.checkAPI(ctx, "", p.Headers)...)
+	} else {
+		// Each account's credentials must be accepted
+		names := make([]string, 0, len(p.Credentials))
+		for name := range p.Credentials {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			header := p.Headers.Clone()
+			for k, v := range p.Credentials[name] {
+				header[k] = v
+			}
+			errs = append(errs, p.checkAPI(ctx, fmt.Sprintf(" with the credentials for %s %q", p.CredentialField, name), header)...)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkAPI checks that the API can be reached and accepts header, returning
+// an error for each failed step
+func (p *Processor) checkAPI(ctx context.Context, with string, header http.Header) []error {
+	opts := p.clientOptions(p.Timeout)
+	opts.Socket = p.Socket
+	checker := &healthcheck.Checker{BaseURL: p.BaseURL, Options: opts, Headers: header, SigV4: p.SigV4}
+	var errs []error
+	for _, check := range checker.Run(ctx) {
+		if check.Err == nil {
+			continue
+		}
+		err := fmt.Errorf("API %s check failed%s: %w", check.Name, with, check.Err)
+		if hint, ok := preflightHints[check.Name]; ok {
+			err = fmt.Errorf("%w; %s", err, hint)
+		}
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// checkWritable checks that a file can be created next to path, returning
+// an error naming the flag to change if not
+func checkWritable(what, path, flag string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".preflight-*")
+	if err != nil {
+		return fmt.Errorf("%s %s cannot be written: %w; create its directory or change %s", what, path, err, flag)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return nil
+}
@@ -0,0 +1,99 @@
+package processor
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// RetryPriority is the order in which failed orders are retried, so that the
+// most important ones go first when retries are capped
+type RetryPriority string
+
+const (
+	// PriorityNone retries orders in the order they failed
+	PriorityNone RetryPriority = ""
+	// PriorityNotional retries the orders of the largest notional value
+	// (quantity times price) first
+	PriorityNotional RetryPriority = "notional"
+	// PriorityOldest retries the orders with the earliest timestamp first
+	PriorityOldest RetryPriority = "oldest"
+	// PriorityNewest retries the orders with the latest timestamp first
+	PriorityNewest RetryPriority = "newest"
+)
+
+// ParseRetryPriority parses a retry priority
+func ParseRetryPriority(s string) (RetryPriority, error) {
+	switch r := RetryPriority(s); r {
+	case PriorityNone, PriorityNotional, PriorityOldest, PriorityNewest:
+		return r, nil
+	}
+	return "", fmt.Errorf("unknown retry priority %q (want notional, oldest or newest)", s)
+}
+
+// sortOrders sorts n orders by the priority, keeping the order of those
+// that rank equal; order returns the i-th order and swap swaps two. By
+// timestamp, orders without one go last.
+func (r RetryPriority) sortOrders(n int, order func(i int) models.Order, swap func(i, j int)) {
+	if r == PriorityNone {
+		return
+	}
+	keys := make([]priorityKey, n)
+	for i := range keys {
+		keys[i] = r.key(order(i))
+	}
+	sort.Stable(&prioritySort{keys: keys, less: r.less, swap: swap})
+}
+
+type priorityKey struct {
+	notional *big.Rat
+	order    models.Order
+}
+
+func (r RetryPriority) key(order models.Order) priorityKey {
+	k := priorityKey{order: order}
+	if r == PriorityNotional {
+		// An order without an exact notional is retried last
+		notional, ok := order.Notional()
+		if !ok {
+			notional = new(big.Rat)
+		}
+		k.notional = notional
+	}
+	return k
+}
+
+// less reports whether the order of a is retried before that of b
+func (r RetryPriority) less(a, b priorityKey) bool {
+	switch r {
+	case PriorityNotional:
+		return a.notional.Cmp(b.notional) > 0
+	case PriorityOldest, PriorityNewest:
+		ta, tb := a.order.Timestamp, b.order.Timestamp
+		if ta.IsZero() || tb.IsZero() {
+			return !ta.IsZero() && tb.IsZero()
+		}
+		if r == PriorityOldest {
+			return ta.Before(tb)
+		}
+		return ta.After(tb)
+	}
+	return false
+}
+
+// prioritySort sorts orders by their keys, swapping the orders with the keys
+type prioritySort struct {
+	keys []priorityKey
+	less func(a, b priorityKey) bool
+	swap func(i, j int)
+}
+
+func (s *prioritySort) Len() int           { return len(s.keys) }
+func (s *prioritySort) Less(i, j int) bool { return s.less(s.keys[i], s.keys[j]) }
+
+func (s *prioritySort) Swap(i, j int) {
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	s.swap(i, j)
+}
@@ -1,181 +1,1142 @@
 package processor
 
 import (
-	"bufio"
-	"crypto/tls"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strings"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/fauzanelka/99tech-order-processor/internal/amqp"
+	"github.com/fauzanelka/99tech-order-processor/internal/annotate"
+	"github.com/fauzanelka/99tech-order-processor/internal/audit"
+	"github.com/fauzanelka/99tech-order-processor/internal/aws"
+	"github.com/fauzanelka/99tech-order-processor/internal/capture"
+	"github.com/fauzanelka/99tech-order-processor/internal/checkpoint"
+	"github.com/fauzanelka/99tech-order-processor/internal/elastic"
+	"github.com/fauzanelka/99tech-order-processor/internal/encrypt"
+	"github.com/fauzanelka/99tech-order-processor/internal/enrich"
+	"github.com/fauzanelka/99tech-order-processor/internal/httpcache"
+	"github.com/fauzanelka/99tech-order-processor/internal/httpclient"
+	"github.com/fauzanelka/99tech-order-processor/internal/junit"
+	"github.com/fauzanelka/99tech-order-processor/internal/lifecycle"
+	"github.com/fauzanelka/99tech-order-processor/internal/mask"
+	"github.com/fauzanelka/99tech-order-processor/internal/metrics"
 	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/fauzanelka/99tech-order-processor/internal/orderfile"
+	"github.com/fauzanelka/99tech-order-processor/internal/outlier"
+	"github.com/fauzanelka/99tech-order-processor/internal/progress"
+	"github.com/fauzanelka/99tech-order-processor/internal/ratelimit"
+	"github.com/fauzanelka/99tech-order-processor/internal/redact"
+	"github.com/fauzanelka/99tech-order-processor/internal/rejects"
+	"github.com/fauzanelka/99tech-order-processor/internal/retryqueue"
+	"github.com/fauzanelka/99tech-order-processor/internal/rules"
+	"github.com/fauzanelka/99tech-order-processor/internal/sentry"
+	"github.com/fauzanelka/99tech-order-processor/internal/storage"
+	"github.com/fauzanelka/99tech-order-processor/internal/tracecontext"
+	"github.com/fauzanelka/99tech-order-processor/internal/transform"
 )
 
 // Processor handles the processing of order data
 type Processor struct {
-	InputFile    string
-	OutputFile   string
-	Symbol       string
-	Side         string
-	Retries      int
-	Timeout      time.Duration
-	Insecure     bool
-	BaseURL      string
-	Logger       *logrus.Logger
-	client       *http.Client
-	outputWriter *os.File
+	InputFile       string
+	// Input, if set, is read instead of InputFile, which then only
+	// identifies the input in checkpoints
+	Input           orderfile.Reader
+	InputFormat     string
+	OutputFile      string
+	// Force, if set, lets runs replace output files that already exist and
+	// are not empty, which they otherwise refuse to
+	Force           bool
+	// Tee lists extra outputs written with the same results as OutputFile,
+	// each failing on its own
+	Tee             []string
+	Symbol          string
+	Side            string
+	Shard           models.Shard
+	// Sample, if set, limits the run to a reproducible percentage of the
+	// orders matching the filters
+	Sample          models.Sample
+	// Skip and Limit, if positive, bound the run to a slice of the orders
+	// matching the filters: the first Skip are passed over, and reading
+	// stops once Limit more have been processed
+	Skip            int
+	Limit           int
+	// Canary, if positive, is the number of orders processed first, after
+	// which the run only goes on if at most CanaryThreshold percent of
+	// their first requests failed
+	Canary          int
+	CanaryThreshold float64
+	// Concurrency is the number of orders processed at once, of which at
+	// most MaxPerSymbol, if positive, have the same symbol
+	Concurrency     int
+	MaxPerSymbol    int
+	// AutoConcurrency tunes the number of orders processed at once, up to
+	// Concurrency, by the latency and failures of requests
+	AutoConcurrency bool
+	RateLimit       *ratelimit.Limiter
+	// ReuseResponses reuses the first successful response for an order ID
+	// for its later occurrences in the same run, instead of requesting it
+	// again
+	ReuseResponses  bool
+	// Cache, if set, keeps responses with validators across runs and
+	// revalidates them with conditional requests
+	Cache           *httpcache.Cache
+	Retries         int
+	// RetryBudget, if positive, caps the retries of the whole run; once it
+	// is spent, orders that fail are not retried
+	RetryBudget     int
+	// RetryPriority is the order in which failed orders are retried, both
+	// those queued by earlier runs and those failing in this one
+	RetryPriority   RetryPriority
+	// StatusActions maps the status codes of non-2xx responses to what is
+	// done with their orders
+	StatusActions   StatusActions
+	// FailFast stops the run on the first order that fails after all
+	// retries, retrying each failed order right away rather than once the
+	// input has been read
+	FailFast        bool
+	Timeout         time.Duration
+	// Timeouts limits the dial, TLS handshake, and response header phases of
+	// requests, for input downloads as well as API requests
+	Timeouts        httpclient.Timeouts
+	// MaxResponseBytes, if positive, is the largest response body read;
+	// orders with larger ones fail without being retried
+	MaxResponseBytes int64
+	Insecure        bool
+	// Resolve maps host:port addresses to the addresses connected to
+	// instead, as parsed by httpclient.ParseResolve
+	Resolve         map[string]string
+	// IPVersion, if 4 or 6, connects over that IP version only
+	IPVersion       int
+	// TLSMinVersion and TLSCipherSuites restrict the TLS connections of
+	// API requests and input downloads, as in httpclient.Options
+	TLSMinVersion   uint16
+	TLSCipherSuites []uint16
+	// Socket, if set, is the Unix domain socket API requests are sent
+	// over; input downloads still use the network
+	Socket          string
+	BaseURL         string
+	Headers         http.Header
+	// CredentialField, if set, is the order field whose value selects the
+	// headers in Credentials, such as the Authorization of an account,
+	// that requests for the order are sent with on top of Headers; "*"
+	// matches other values
+	CredentialField string
+	Credentials     map[string]http.Header
+	// SigV4, if set, signs API requests for AWS IAM authentication
+	SigV4           *aws.RequestSigner
+	// Trace, if set, is the trace context API requests are sent in
+	Trace           *tracecontext.Context
+	Logger          *logrus.Logger
+	Sentry          *sentry.Client
+	// SLA, if enabled, fails a run whose requests breached it once its
+	// output is in place
+	SLA             SLA
+	Metrics         *metrics.Sinks
+	Audit           *audit.Log
+	// Redact, if set, masks sensitive fields in audit records and error
+	// reports; the output keeps them
+	Redact          *redact.Redactor
+	// Mask, if set, anonymizes fields of the results written
+	Mask            *mask.Masker
+	// Transform, if set, reshapes the responses of the results written
+	Transform       *transform.Pipeline
+	// Encrypt, if set, encrypts the output files
+	Encrypt         *encrypt.Encrypter
+	// Manifest, if set, is where the description of a run and the
+	// checksums of the files it produced are written once it ends
+	Manifest        string
+	// RunConfig is the configuration of the run recorded in the manifest,
+	// with secrets redacted
+	RunConfig       map[string]string
+	// JUnit, if set, is the JUnit XML report each order of a run is a test
+	// case of, written once it ends
+	JUnit           *junit.Report
+	// Annotate, if set, annotates the input lines of rejected records and
+	// failed orders for GitHub Actions
+	Annotate        *annotate.Annotator
+	Capture         *capture.Recorder
+	// GraphQL or SOAP, if set, request orders with a GraphQL query or a
+	// SOAP envelope instead
+	GraphQL         *GraphQL
+	SOAP            *SOAP
+	// Paginate, if set, follows the next pages of responses, combining
+	// them into one result per order
+	Paginate        *Pagination
+	OutputFormat    string
+	Append          bool
+	OutputSplit     string
+	// OutputBuffer is the size in bytes of the buffer in front of each
+	// output file, or 0 to write every result straight through
+	OutputBuffer    int
+	// FsyncEvery, if positive, syncs the output files to disk every
+	// FsyncEvery results
+	FsyncEvery      int
+	// Rotate rotates the output files appended to in place by size or time
+	Rotate          Rotation
+	OutputTemplate  *template.Template
+	StrictDecimals  bool
+	// Rules, if set, are business rules orders must satisfy to be processed
+	Rules           *rules.Set
+	ReaderOptions   orderfile.Options
+	Rejects         *rejects.Writer
+	// Outliers, if enabled, flags orders whose price is far from the median
+	// of their symbol in the input; they are recorded in Review, if set,
+	// and only processed if HoldOutliers is false
+	Outliers        outlier.Config
+	Review          *rejects.Writer
+	HoldOutliers    bool
+	// Requeue, if set, keeps the orders that fail after all retries for
+	// later runs, which retry them first
+	Requeue         *retryqueue.Queue
+	Enrich          *enrich.Table
+	Publisher       *amqp.Publisher
+	Indexer         *elastic.Indexer
+	Progress        *progress.Tracker
+	// LogOrders logs the progress of each order at info level rather than
+	// debug, which at millions of orders dominates the logs
+	LogOrders       bool
+	Checkpoint      string
+	CheckpointEvery int
+	client          *http.Client
+	output          *outputs
+	limits          *limiter
+	responses       *responseCache
+	states          *lifecycle.Tracker
+	latency         *latencies
+	budget          *retryBudget
+	// failures counts the orders failed after all retries by class
+	failures        *failureClasses
+	abort           *abort
+	// runID is the ID of the current run, and requestIDs those of its
+	// orders
+	runID           atomic.Value
+	requestIDs      *requestIDs
+	matched         int
+	rejected        int64
+	// inputOpened is whether the run opened the input file, and
+	// inputDigest checksums a remote one for the manifest
+	inputOpened     bool
+	inputDigest     *inputDigest
+	// started is when the run started, or the run it resumes did
+	started         time.Time
+	canary          *canary
+	outliers        *outlier.Detector
+	reopen          int32
 }
 
 // NewProcessor creates a new processor with the given configuration
 func NewProcessor(inputFile, outputFile, symbol, side, baseURL string, retries int, timeout time.Duration, insecure bool, logger *logrus.Logger) *Processor {
 	return &Processor{
-		InputFile:  inputFile,
-		OutputFile: outputFile,
-		Symbol:     symbol,
-		Side:       side,
-		Retries:    retries,
-		Timeout:    timeout,
-		Insecure:   insecure,
-		BaseURL:    baseURL,
-		Logger:     logger,
+		InputFile:   inputFile,
+		InputFormat: orderfile.Detect(inputFile),
+		OutputFile:  outputFile,
+		Symbol:      symbol,
+		Side:        side,
+		Retries:     retries,
+		Timeout:     timeout,
+		Insecure:    insecure,
+		BaseURL:     baseURL,
+		Logger:      logger,
 	}
 }
 
 // Process reads the input file and processes each order
-func (p *Processor) Process() error {
+func (p *Processor) Process() (err error) {
+	defer func() { err = p.endRun(err) }()
+
 	// Setup HTTP client
-	p.client = &http.Client{
-		Timeout: p.Timeout,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: p.Insecure,
-			},
-		},
-	}
+	p.client = p.apiClient()
 
 	// Open input file
-	file, err := os.Open(p.InputFile)
+	reader, closeInput, err := p.openReader()
 	if err != nil {
-		return fmt.Errorf("failed to open input file: %w", err)
+		return err
+	}
+	defer closeInput()
+	if err := p.scanOutliers(); err != nil {
+		return err
 	}
-	defer file.Close()
 
-	// Open output file
-	p.outputWriter, err = os.Create(p.OutputFile)
+	// Resume from checkpoint
+	state, err := p.loadCheckpoint()
+	if err != nil {
+		return err
+	}
+	retryQueue := &failedOrders{}
+	defer retryQueue.close()
+	skip := 0
+	if state != nil {
+		skip = state.Records
+		retryQueue.orders = state.RetryQueue
+		p.Progress.RetryQueue(len(state.RetryQueue))
+		p.Logger.Infof("Resuming from checkpoint: skipping %d records, %d orders awaiting retry", skip, len(state.RetryQueue))
+		p.started = state.StartedAt
+	}
+
+	// Open output file, appending to it when resuming
+	p.output, err = p.openOutputs(state != nil)
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %w", err)
 	}
-	defer p.outputWriter.Close()
+	defer p.output.Close()
 
-	// Process file line by line
-	scanner := bufio.NewScanner(file)
-	lineNum := 0
-	var retryQueue []models.Order
+	filter := models.NewFilter(p.Symbol, p.Side)
+	filter.Shard = p.Shard
+	filter.Sample = p.Sample
+	p.startRun()
+	if state != nil {
+		p.matched = state.Matched
+		p.states = lifecycle.NewTracker(state.States)
+		for _, order := range state.RetryQueue {
+			p.startOrder(order, lifecycle.Retrying)
+		}
+	}
+
+	// Orders that failed in earlier runs go first. A resumed run already
+	// processed them before its first checkpoint.
+	queued := p.Requeue.Take()
+	if state == nil {
+		if err := p.processQueued(queued, retryQueue); err != nil {
+			return err
+		}
+	}
 
-	for scanner.Scan() {
-		lineNum++
-		line := scanner.Text()
+	// Process file record by record, parsing ahead of the requests
+	input, stopReading := readRecords(reader)
+	defer stopReading()
+	records := 0
+	for !p.abort.stopped() {
+		order, err := next(input)
+		if err == io.EOF {
+			break
+		}
+		records++
+		if records <= skip {
+			continue
+		}
+		p.Progress.Read()
+		p.reopenOutputs()
+		if p.Checkpoint != "" && p.CheckpointEvery > 0 && records%p.CheckpointEvery == 0 {
+			// The checkpoint may only cover orders that have finished
+			p.limits.wait()
+			p.checkpointQueue(records-1, retryQueue)
+		}
 
-		// Skip empty lines
-		if strings.TrimSpace(line) == "" {
+		var perr *orderfile.ParseError
+		if errors.As(err, &perr) {
+			p.Logger.WithField("error_code", codeParseInput).Warnf("Line %d is not a valid order: %v", perr.Line, perr.Err)
+			p.reject(rejects.Reject{Line: perr.Line, Reason: perr.Err.Error(), Code: string(codeParseInput), Record: perr.Raw})
 			continue
 		}
+		if err != nil {
+			return fmt.Errorf("error reading input file: %w", err)
+		}
 
-		// Parse JSON
-		var order models.Order
-		if err := json.Unmarshal([]byte(line), &order); err != nil {
-			p.Logger.Warnf("Line %d is not valid JSON: %v", lineNum, err)
+		if !p.prepare(&order) {
 			continue
 		}
 
 		// Filter by symbol and side
-		if order.Symbol == p.Symbol && order.Side == p.Side {
-			p.Logger.Infof("Processing order %s: %s %.2f %s at $%.2f", 
+		if !filter.Match(order) {
+			continue
+		}
+		take, last := p.take()
+		if take && !p.holdOutlier(order) {
+			if err := p.checkOutput(order); err != nil {
+				return err
+			}
+			p.orderInfof(order, "Processing order %s: %s %s %s at $%s", 
 				order.OrderID, order.Side, order.Quantity, order.Symbol, order.Price)
 			
-			if err := p.processOrder(order, 0); err != nil {
-				p.Logger.Warnf("Failed to process order %s, adding to retry queue: %v", order.OrderID, err)
-				retryQueue = append(retryQueue, order)
+			inCanary, lastCanary := p.canary.start()
+			p.startOrder(order, lifecycle.Pending)
+			p.dispatch(order, func(err error) {
+				if inCanary {
+					p.canary.fail()
+				}
+				p.retryLater(order, err, retryQueue)
+			})
+			if lastCanary {
+				if err := p.checkCanary(records, retryQueue); err != nil {
+					return err
+				}
 			}
 		}
+		if last {
+			p.Logger.Infof("Reached the limit of %d orders, not reading further", p.Limit)
+			break
+		}
 	}
-
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading input file: %w", err)
+	p.limits.wait()
+	if err := p.stopRun(records); err != nil {
+		return err
 	}
 
 	// Process retry queue
-	p.processRetryQueue(retryQueue)
+	if p.Checkpoint != "" {
+		p.checkpointQueue(records, retryQueue)
+	}
+	if err := p.processRetryQueue(retryQueue); err != nil {
+		return err
+	}
 
-	return nil
+	if err := p.output.Commit(); err != nil {
+		return fmt.Errorf("failed to finalize output file: %w", err)
+	}
+	if err := p.Requeue.Commit(); err != nil {
+		p.Logger.Warnf("Failed to update retry queue: %v", err)
+	}
+	p.logStates()
+	if p.Checkpoint != "" {
+		if err := checkpoint.Remove(p.Checkpoint); err != nil {
+			p.Logger.Warnf("Failed to remove checkpoint: %v", err)
+		}
+	}
+	return p.checkSLA()
+}
+
+// clientOptions returns the options of HTTP clients for API requests and
+// input downloads
+func (p *Processor) clientOptions(timeout time.Duration) httpclient.Options {
+	return httpclient.Options{
+		Timeout:      timeout,
+		Timeouts:     p.Timeouts,
+		Insecure:     p.Insecure,
+		Resolve:      p.Resolve,
+		IPVersion:    p.IPVersion,
+		MinVersion:   p.TLSMinVersion,
+		CipherSuites: p.TLSCipherSuites,
+	}
+}
+
+// apiClient creates the HTTP client for API requests
+func (p *Processor) apiClient() *http.Client {
+	opts := p.clientOptions(p.Timeout)
+	opts.Socket = p.Socket
+	return httpclient.New(opts)
+}
+
+// openReader opens the input for reading orders. The returned function
+// closes it.
+func (p *Processor) openReader() (orderfile.Reader, func(), error) {
+	if p.Input != nil {
+		return p.Input, func() {}, nil
+	}
+	file, err := p.openInput(context.Background())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+	// Local files are counted as they are read to estimate the time left,
+	// except in the formats that are read in place, and remote ones are
+	// checksummed for the manifest
+	var input io.Reader = file
+	p.inputOpened, p.inputDigest = true, nil
+	if f, ok := file.(*os.File); ok && p.InputFormat != orderfile.Parquet && p.InputFormat != orderfile.XLSX {
+		if info, err := f.Stat(); err == nil {
+			input = p.Progress.Input(f, info.Size())
+		}
+	} else if !ok && p.Manifest != "" {
+		p.inputDigest = newInputDigest(file)
+		input = p.inputDigest
+	}
+	reader, err := orderfile.NewReader(p.InputFormat, input, p.ReaderOptions)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return reader, func() { file.Close() }, nil
+}
+
+// openInput opens the input file. HTTP(S) inputs are fetched with the same
+// headers and TLS settings as API requests.
+func (p *Processor) openInput(ctx context.Context) (io.ReadCloser, error) {
+	if storage.IsHTTP(p.InputFile) {
+		client := httpclient.New(p.clientOptions(0))
+		return storage.Fetch(ctx, client, p.InputFile, p.Headers)
+	}
+	return storage.Open(ctx, p.InputFile)
+}
+
+// ReopenOutputs asks for the output files appended to in place to be
+// reopened before the next record is processed, after they have been
+// rotated. It is safe to call from another goroutine.
+func (p *Processor) ReopenOutputs() {
+	atomic.StoreInt32(&p.reopen, 1)
+}
+
+// reopenOutputs reopens the output files if it has been asked for
+func (p *Processor) reopenOutputs() {
+	if !atomic.CompareAndSwapInt32(&p.reopen, 1, 0) {
+		return
+	}
+	if err := p.output.Reopen(); err != nil {
+		p.Logger.Warnf("Failed to reopen output files: %v", err)
+		return
+	}
+	p.Logger.Infof("Reopened output files")
+}
+
+// prepare checks a decoded order and joins its lookup columns. It reports
+// false if the order was rejected.
+func (p *Processor) prepare(order *models.Order) bool {
+	// Reject decimals that are not written out exactly when strict
+	if p.StrictDecimals && (!order.Price.Plain() || !order.Quantity.Plain()) {
+		reason := fmt.Sprintf("price %s and quantity %s must be plain decimals", order.Price, order.Quantity)
+		p.Logger.WithField("error_code", codeNotPlain).Warnf("Skipping order %s: %s", order.OrderID, reason)
+		p.reject(rejects.Reject{Line: order.Line, OrderID: order.OrderID, Reason: reason, Code: string(codeNotPlain)})
+		return false
+	}
+
+	// Join lookup columns so they are available to the filter and templates
+	if p.Enrich != nil && !p.Enrich.Apply(order) {
+		p.Logger.Debugf("No lookup row for order %s", order.OrderID)
+	}
+
+	// Reject orders that no credentials are routed to, rather than request
+	// them with the wrong ones
+	if _, ok := p.credentials(*order); p.CredentialField != "" && !ok {
+		reason := fmt.Sprintf("no %s field to route credentials by", p.CredentialField)
+		if value, ok := order.Field(p.CredentialField); ok {
+			reason = fmt.Sprintf("no credentials for %s %q", p.CredentialField, value)
+		}
+		p.Logger.WithField("error_code", codeNoCredentials).Warnf("Skipping order %s: %s", order.OrderID, reason)
+		p.reject(rejects.Reject{Line: order.Line, OrderID: order.OrderID, Reason: reason, Code: string(codeNoCredentials)})
+		return false
+	}
+
+	// Reject orders that break business rules before they are requested
+	if reasons := p.Rules.Check(*order, time.Now()); len(reasons) > 0 {
+		reason := strings.Join(reasons, "; ")
+		p.Logger.WithField("error_code", codeRuleViolation).Warnf("Skipping order %s: %s", order.OrderID, reason)
+		p.reject(rejects.Reject{Line: order.Line, OrderID: order.OrderID, Reason: reason, Code: string(codeRuleViolation)})
+		return false
+	}
+	return true
+}
+
+// credentials returns the headers routed to an order by its
+// CredentialField, if any
+func (p *Processor) credentials(order models.Order) (http.Header, bool) {
+	if p.CredentialField == "" {
+		return nil, false
+	}
+	if value, ok := order.Field(p.CredentialField); ok {
+		if creds, ok := p.Credentials[value]; ok {
+			return creds, true
+		}
+	}
+	creds, ok := p.Credentials["*"]
+	return creds, ok
+}
+
+// reject records a rejected input record in the rejects file
+func (p *Processor) reject(r rejects.Reject) {
+	atomic.AddInt64(&p.rejected, 1)
+	p.Progress.Rejected()
+	if err := p.Rejects.Write(r); err != nil {
+		p.Logger.Warnf("Failed to record reject: %v", err)
+	}
+	p.reportReject(r)
+	p.annotateReject(r)
+}
+
+// loadCheckpoint loads the checkpoint for this run, if one is configured and
+// exists
+func (p *Processor) loadCheckpoint() (*checkpoint.State, error) {
+	if p.Checkpoint == "" {
+		return nil, nil
+	}
+
+	state, err := checkpoint.Load(p.Checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	if state != nil && state.Input != p.InputFile {
+		return nil, fmt.Errorf("checkpoint %s belongs to input %s, not %s", p.Checkpoint, state.Input, p.InputFile)
+	}
+	return state, nil
+}
+
+// saveCheckpoint records that the first records input records have been
+// handled. The output file is synced first so the checkpoint never claims
+// progress that a crash could lose.
+func (p *Processor) saveCheckpoint(records int, retryQueue []models.Order) {
+	if err := p.output.Sync(); err != nil {
+		p.Logger.Warnf("Failed to sync output file, checkpoint not saved: %v", err)
+		return
+	}
+
+	err := checkpoint.Save(p.Checkpoint, checkpoint.State{
+		Input:      p.InputFile,
+		Records:    records,
+		RetryQueue: retryQueue,
+		Matched:    p.matched,
+		States:     p.states.Counts(),
+		StartedAt:  p.started,
+	})
+	if err != nil {
+		p.Logger.Warnf("Failed to save checkpoint: %v", err)
+	}
+}
+
+// checkpointQueue saves a checkpoint with the orders in retryQueue
+func (p *Processor) checkpointQueue(records int, retryQueue *failedOrders) {
+	queue, err := retryQueue.list()
+	if err != nil {
+		p.Logger.Warnf("Failed to save checkpoint: %v", err)
+		return
+	}
+	p.saveCheckpoint(records, queue)
 }
 
-// processOrder processes a single order with retries
+// processOrder processes a single order with retries, waiting out the
+// backoff of requests that receive no response
 func (p *Processor) processOrder(order models.Order, retryCount int) error {
-	url := fmt.Sprintf("%s/%s", strings.TrimRight(p.BaseURL, "/"), order.OrderID)
+	for {
+		err := p.tryOrder(order, retryCount)
+		var b *backoffError
+		if !errors.As(err, &b) {
+			return err
+		}
+		time.Sleep(b.delay)
+		retryCount = b.retry
+	}
+}
+
+// tryOrder processes a single order with one request, returning a
+// *backoffError if the request received no response and may be retried
+func (p *Processor) tryOrder(order models.Order, retryCount int) error {
+	if r, ok := p.responses.get(order.OrderID); ok {
+		p.orderInfof(order, "Reusing the response for repeated order %s", order.OrderID)
+		return p.succeed(order, r.statusCode, r.body)
+	}
+
+	r, err := p.attempt(order, retryCount)
+	if p.skip(order, err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if r.spool != nil {
+		// Spooled bodies are copied to the output as they are
+		defer closeSpool(r.spool)
+		if err := p.output.writeFrom(order, r.spool); err != nil {
+			return &classError{class: classWrite, err: err}
+		}
+		p.succeeded(order)
+		return nil
+	}
+	p.responses.put(order.OrderID, r)
+	return p.succeed(order, r.statusCode, r.body)
+}
+
+// request requests an order from the API, retrying requests that receive
+// no response. A non-2XX response is returned with its body and a
+// *statusError.
+func (p *Processor) request(order models.Order, retryCount int) (int, []byte, error) {
+	for {
+		r, err := p.attempt(order, retryCount)
+		var b *backoffError
+		if !errors.As(err, &b) {
+			return r.statusCode, r.body, err
+		}
+		time.Sleep(b.delay)
+		retryCount = b.retry
+	}
+}
+
+// attempt makes one request for an order, as request does, but returns a
+// *backoffError instead of waiting to retry a request that received no
+// response. A large successful body may be spooled, when the output takes
+// it as it is. With Paginate, the rest of the pages of the response are
+// requested too.
+func (p *Processor) attempt(order models.Order, retryCount int) (response, error) {
+	r, err := p.attemptURL(order, p.orderURL(order), retryCount)
+	if err != nil || p.Paginate == nil || r.spool != nil || r.statusCode < 200 || r.statusCode >= 300 {
+		return r, err
+	}
+	return p.followPages(order, r, retryCount)
+}
+
+// attemptURL makes one request for an order to url, as attempt does
+func (p *Processor) attemptURL(order models.Order, url string, retryCount int) (response, error) {
+	p.Progress.Begin(order.OrderID)
+	defer p.Progress.End(order.OrderID)
 	
-	resp, err := p.client.Get(url)
+	reqBody, err := p.requestBody(order)
+	if err != nil {
+		return response{}, &classError{class: classSchema, code: codeRenderRequest, err: err}
+	}
+	req, err := http.NewRequest(p.method(), url, bytes.NewReader(reqBody))
+	if err != nil {
+		return response{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	switch {
+	case p.GraphQL != nil:
+		req.Header.Set("Content-Type", "application/json")
+	case p.SOAP != nil:
+		p.SOAP.setHeaders(req.Header)
+	}
+	if id := p.requestID(order); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+	p.Trace.Inject(req.Header)
+	for k, v := range p.Headers {
+		req.Header[k] = v
+	}
+	if creds, ok := p.credentials(order); ok {
+		for k, v := range creds {
+			req.Header[k] = v
+		}
+	}
+	cached, err := p.Cache.Get(url)
 	if err != nil {
-		if retryCount < p.Retries {
+		p.orderLog(order).Warnf("Failed to read cached response for order %s: %v", order.OrderID, err)
+	}
+	httpcache.SetConditional(req, cached)
+
+	p.RateLimit.Wait()
+	// Signed after waiting, so the signature is not stale
+	if err := p.SigV4.Sign(context.Background(), req, reqBody); err != nil {
+		return response{}, fmt.Errorf("failed to sign request: %w", err)
+	}
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	if err == nil {
+		if rate, backedOff := p.RateLimit.Observe(resp.StatusCode); backedOff {
+			p.Logger.Warnf("API responded %d, slowing down to %.1f requests/s", resp.StatusCode, rate)
+		}
+	}
+	var body []byte
+	var spool *os.File
+	if err == nil {
+		defer resp.Body.Close()
+		ok := resp.StatusCode >= 200 && resp.StatusCode < 300
+		body, spool, err = readBody(resp.Body, p.MaxResponseBytes, ok && p.spools())
+	}
+	latency := time.Since(start)
+	status := statusTag(resp, err)
+	p.Metrics.Timing("http.latency", latency, map[string]string{
+		"symbol": order.Symbol,
+		"status": status,
+	})
+	p.latency.observe(status, latency)
+	failed := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	if limit, changed := p.limits.observe(latency, failed); changed {
+		p.Logger.Debugf("Adjusted concurrency to %d", limit)
+	}
+	p.audit(order, url, start, latency, retryCount+1, resp, err)
+	p.Capture.Record(req, reqBody, resp, body, start, latency, err)
+	if err != nil {
+		// Only requests that received no response are retried inline
+		if resp != nil {
+			return response{statusCode: resp.StatusCode}, err
+		}
+		if retryCount < p.Retries && p.retryAllowed() {
 			p.Logger.Debugf("Current retry count: %d, Max retries: %d", retryCount, p.Retries)
-			p.Logger.Warnf("Request failed for order %s (retry %d/%d): %v", 
+			p.orderLog(order).Warnf("Request failed for order %s (retry %d/%d): %v", 
 				order.OrderID, retryCount+1, p.Retries, err)
-			time.Sleep(time.Second * time.Duration(retryCount+1)) // Exponential backoff
-			return p.processOrder(order, retryCount+1)
+			return response{}, &backoffError{
+				retry: retryCount + 1,
+				delay: time.Second * time.Duration(retryCount+1), // Exponential backoff
+				err:   err,
+			}
 		}
-		return err
+		return response{}, err
+	}
+
+	// An unchanged response is taken from the cache
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		p.orderLog(order).Debugf("Response for order %s has not changed, using the cached one", order.OrderID)
+		return response{statusCode: cached.StatusCode, body: cached.Body}, nil
 	}
-	defer resp.Body.Close()
 
-	// Check if response is successful (2XX)
+	// Check if response is successful (2XX), or mapped to be
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("received non-2XX response: %d", resp.StatusCode)
+		serr := &statusError{code: resp.StatusCode}
+		var ferr error = serr
+		if p.SOAP != nil {
+			// A fault decides whether the order is retried
+			_, ferr = soapResponse(body, serr)
+		}
+		switch r, _ := p.StatusActions.rule(resp.StatusCode); r.Action {
+		case ActionSuccess:
+			return response{statusCode: resp.StatusCode, body: body}, nil
+		case ActionRetry:
+			if retryCount < p.Retries && p.retryAllowed() {
+				delay := retryAfter(resp, time.Second*time.Duration(retryCount+1))
+				p.orderLog(order).Warnf("API responded %d for order %s, retrying in %s (retry %d/%d)",
+					resp.StatusCode, order.OrderID, delay, retryCount+1, p.Retries)
+				return response{}, &backoffError{retry: retryCount + 1, delay: delay, err: ferr}
+			}
+		}
+		return response{statusCode: resp.StatusCode, body: body}, ferr
+	}
+	switch {
+	case p.GraphQL != nil:
+		if err := graphqlError(body); err != nil {
+			return response{statusCode: resp.StatusCode, body: body}, err
+		}
+	case p.SOAP != nil:
+		if body, err = soapResponse(body, nil); err != nil {
+			return response{statusCode: resp.StatusCode}, err
+		}
+	}
+	if err := p.Cache.Put(url, resp, body); err != nil {
+		p.orderLog(order).Warnf("Failed to cache response for order %s: %v", order.OrderID, err)
+	}
+	return response{statusCode: resp.StatusCode, body: body, spool: spool}, nil
+}
+
+// succeed writes the response for a successfully processed order
+func (p *Processor) succeed(order models.Order, statusCode int, body []byte) error {
+	if err := p.writeResult(order, statusCode, body); err != nil {
+		return err
 	}
+	p.succeeded(order)
+	return nil
+}
+
+// succeeded records an order whose result was written
+func (p *Processor) succeeded(order models.Order) {
+	p.moveOrder(order, lifecycle.Succeeded)
+	p.reportPass(order)
+	p.orderInfof(order, "Successfully processed order %s", order.OrderID)
+	p.Metrics.Incr("orders.processed", map[string]string{"symbol": order.Symbol, "side": order.Side})
+	p.Progress.Processed()
+}
 
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
+// startRun resets the state kept for the duration of a run
+func (p *Processor) startRun() {
+	p.startIDs()
+	p.limits = newLimiter(p.Concurrency, p.MaxPerSymbol, p.AutoConcurrency)
+	p.abort = nil
+	p.matched = 0
+	atomic.StoreInt64(&p.rejected, 0)
+	p.canary = nil
+	if p.Canary > 0 {
+		p.canary = &canary{size: p.Canary}
+	}
+	if p.FailFast || p.StatusActions.Has(ActionAbort) {
+		p.abort = &abort{}
+	}
+	p.states = lifecycle.NewTracker(nil)
+	p.latency = newLatencies()
+	p.failures = newFailureClasses()
+	p.budget = newRetryBudget(p.RetryBudget)
+	p.responses = nil
+	if p.ReuseResponses {
+		p.responses = newResponseCache()
+	}
+}
+
+// take counts an order matching the filters toward Skip and Limit, and
+// reports whether it is processed and whether it is the last one to be
+func (p *Processor) take() (take, last bool) {
+	p.matched++
+	if p.matched <= p.Skip {
+		return false, false
+	}
+	if p.Limit > 0 && p.matched > p.Skip+p.Limit {
+		return false, true
+	}
+	return true, p.Limit > 0 && p.matched == p.Skip+p.Limit
+}
+
+// ProcessQueued retries only the orders in the retry queue
+func (p *Processor) ProcessQueued() (err error) {
+	defer func() { err = p.endRun(err) }()
+	p.client = p.apiClient()
+
+	p.output, err = p.openOutputs(false)
 	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
+		return fmt.Errorf("failed to create output file: %w", err)
 	}
+	defer p.output.Close()
 
-	// Write response to output file
-	if _, err := fmt.Fprintf(p.outputWriter, "%s\n", string(body)); err != nil {
-		return fmt.Errorf("failed to write to output file: %w", err)
+	p.startRun()
+	retryQueue := &failedOrders{}
+	defer retryQueue.close()
+	if err := p.processQueued(p.Requeue.Take(), retryQueue); err != nil {
+		return err
+	}
+	if _, err := p.abort.failure(); err != nil {
+		p.logStates()
+		return p.stopError(err)
+	}
+	if err := p.processRetryQueue(retryQueue); err != nil {
+		return err
 	}
 
-	p.Logger.Infof("Successfully processed order %s", order.OrderID)
+	if err := p.output.Commit(); err != nil {
+		return fmt.Errorf("failed to finalize output file: %w", err)
+	}
+	if err := p.Requeue.Commit(); err != nil {
+		return fmt.Errorf("failed to update retry queue: %w", err)
+	}
+	p.logStates()
+	return p.checkSLA()
+}
+
+// processQueued processes orders that failed in earlier runs once each,
+// adding those that failed again to retryQueue
+func (p *Processor) processQueued(queued []models.Failure, retryQueue *failedOrders) error {
+	if len(queued) == 0 {
+		return nil
+	}
+	p.Logger.Infof("Retrying %d orders that failed in earlier runs", len(queued))
+	p.RetryPriority.sortOrders(len(queued), func(i int) models.Order { return queued[i].Order }, func(i, j int) {
+		queued[i], queued[j] = queued[j], queued[i]
+	})
+
+	for _, f := range queued {
+		if p.abort.stopped() {
+			break
+		}
+		p.Progress.Read()
+		order := f.Order
+		if err := p.checkOutput(order); err != nil {
+			return err
+		}
+		p.orderInfof(order, "Processing queued order %s (last error: %s)", order.OrderID, f.Error)
+		p.startOrder(order, lifecycle.Pending)
+		p.dispatch(order, func(err error) {
+			p.retryLater(order, err, retryQueue)
+		})
+	}
+	p.limits.wait()
+	return nil
+}
+
+// checkOutput stops the run before an order is requested if its output
+// file cannot be written, waiting for the orders in flight
+func (p *Processor) checkOutput(order models.Order) error {
+	if err := p.output.check(order); err != nil {
+		p.limits.wait()
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
 	return nil
 }
 
 // processRetryQueue processes the queue of failed orders
-func (p *Processor) processRetryQueue(queue []models.Order) {
-	if len(queue) == 0 {
-		return
+func (p *Processor) processRetryQueue(queue *failedOrders) error {
+	n := queue.len()
+	if n == 0 {
+		return nil
 	}
 
-	p.Logger.Infof("Processing retry queue with %d orders", len(queue))
+	p.Logger.Infof("Processing retry queue with %d orders", n)
 	
-	for _, order := range queue {
-		retryAttempts := 0
-		for retryAttempts < p.Retries {
-			p.Logger.Infof("Retry attempt %d/%d for order %s", retryAttempts+1, p.Retries, order.OrderID)
-			
-			if err := p.processOrder(order, retryAttempts); err != nil {
-				p.Logger.Warnf("Retry failed for order %s: %v", order.OrderID, err)
-				retryAttempts++
-				// Continue to next retry attempt
-			} else {
-				// Success, break out of retry loop
-				break
+	i := 0
+	retry := func(order models.Order) {
+		p.Progress.RetryQueue(n - i)
+		i++
+		p.limits.run(order, func() {
+			p.retryOrder(order)
+		})
+	}
+	var err error
+	if p.RetryPriority == PriorityNone {
+		err = queue.each(retry)
+	} else {
+		// Sorting reads any spilled orders back into memory
+		var orders []models.Order
+		orders, err = queue.list()
+		p.RetryPriority.sortOrders(len(orders), func(i int) models.Order { return orders[i] }, func(i, j int) {
+			orders[i], orders[j] = orders[j], orders[i]
+		})
+		for _, order := range orders {
+			retry(order)
+		}
+	}
+	p.limits.wait()
+	p.Progress.RetryQueue(0)
+	return err
+}
+
+// retryOrder retries a failed order until it succeeds or runs out of
+// retries
+func (p *Processor) retryOrder(order models.Order) {
+	retryAttempts := 0
+	lastErr := fmt.Errorf("no retry attempts configured")
+	exhausted, terminal := false, false
+	for retryAttempts < p.Retries {
+		if !p.retryAllowed() {
+			exhausted = true
+			if retryAttempts == 0 {
+				lastErr = errors.New("retry budget exhausted")
 			}
+			break
 		}
+		p.orderInfof(order, "Retry attempt %d/%d for order %s", retryAttempts+1, p.Retries, order.OrderID)
 		
-		if retryAttempts >= p.Retries {
-			p.Logger.Errorf("Exceeded maximum retries for order %s", order.OrderID)
+		p.moveOrder(order, lifecycle.Requested)
+		if err := p.processOrder(order, retryAttempts); err != nil {
+			p.orderLog(order).Warnf("Retry failed for order %s: %v", order.OrderID, err)
+			lastErr = err
+			retryAttempts++
+			if !p.canRetry(err) {
+				terminal = true
+				break
+			}
+			if retryAttempts < p.Retries {
+				p.moveOrder(order, lifecycle.Retrying)
+			}
+			// Continue to next retry attempt
+		} else {
+			// Success, break out of retry loop
+			break
+		}
+	}
+	
+	if exhausted || terminal || retryAttempts >= p.Retries {
+		switch {
+		case exhausted:
+			p.failureLog(order, lastErr).Errorf("No retries left in the budget for order %s", order.OrderID)
+		case terminal:
+			p.failureLog(order, lastErr).Errorf("Not retrying order %s after a %s failure", order.OrderID, classify(lastErr))
+		default:
+			p.failureLog(order, lastErr).Errorf("Exceeded maximum retries for order %s", order.OrderID)
+		}
+		p.failOrder(order, retryAttempts, lastErr)
+		if p.stops(lastErr) {
+			p.abort.add(order, lastErr)
+		}
+	}
+}
+
+// orderURL builds the API URL for the given order, which is the base URL
+// itself for GraphQL and SOAP
+func (p *Processor) orderURL(order models.Order) string {
+	if p.GraphQL != nil || p.SOAP != nil {
+		return p.BaseURL
+	}
+	return fmt.Sprintf("%s/%s", strings.TrimRight(p.BaseURL, "/"), order.OrderID)
+}
+
+// method returns the HTTP method of API requests
+func (p *Processor) method() string {
+	if p.GraphQL != nil || p.SOAP != nil {
+		return http.MethodPost
+	}
+	return http.MethodGet
+}
+
+// requestBody returns the body of the API requests for an order, if any
+func (p *Processor) requestBody(order models.Order) ([]byte, error) {
+	switch {
+	case p.GraphQL != nil:
+		return p.GraphQL.body(order)
+	case p.SOAP != nil:
+		return p.SOAP.body(order)
+	}
+	return nil, nil
+}
+
+// failOrder records a terminal order failure in metrics and, when it is
+// configured, reports it to Sentry
+func (p *Processor) failOrder(order models.Order, attempts int, err error) {
+	class, code := classify(err), failureCode(err)
+	p.Metrics.Incr("orders.failed", map[string]string{"symbol": order.Symbol, "side": order.Side, "class": string(class), "code": string(code)})
+	p.Progress.Failed(failureReason(err))
+	p.failures.add(class, code)
+
+	// Orders kept in the retry queue for a later run are dead-lettered
+	final := lifecycle.Failed
+	failure := models.Failure{Order: order, RequestID: p.requestID(order), Error: err.Error(), Class: string(class), Code: string(code), Attempts: attempts}
+	if qerr := p.Requeue.Add(failure); qerr != nil {
+		p.orderLog(order).Warnf("Failed to queue order %s for the next run: %v", order.OrderID, qerr)
+	} else if p.Requeue != nil {
+		final = lifecycle.DeadLettered
+	}
+	p.moveOrder(order, final)
+	p.reportFailure(order, failure)
+	p.annotateFailure(order, failure)
+
+	if p.Publisher != nil {
+		body, _ := json.Marshal(failure)
+		if perr := p.Publisher.Failure(order.Symbol, body); perr != nil {
+			p.orderLog(order).Warnf("Failed to publish failure of order %s: %v", order.OrderID, perr)
 		}
 	}
-} 
\ No newline at end of file
+
+	if p.Sentry == nil {
+		return
+	}
+
+	tags := map[string]string{
+		"order_id": order.OrderID,
+		"symbol":   order.Symbol,
+		"side":     order.Side,
+		"class":    string(class),
+		"code":     string(code),
+	}
+	extra := map[string]interface{}{
+		"request_id": p.requestID(order),
+		"url":      p.Redact.String(p.orderURL(order)),
+		"attempts": attempts,
+	}
+	if serr := p.Sentry.CaptureError(err, sentry.LevelError, tags, extra); serr != nil {
+		p.orderLog(order).Warnf("Failed to report order %s to Sentry: %v", order.OrderID, serr)
+	}
+}
+
+// audit appends the outcome of a request to the audit log
+func (p *Processor) audit(order models.Order, url string, start time.Time, latency time.Duration, attempt int, resp *http.Response, err error) {
+	rec := audit.Record{
+		Timestamp: start.UTC(),
+		OrderID:   order.OrderID,
+		RequestID: p.requestID(order),
+		URL:       p.Redact.String(url),
+		Method:    p.method(),
+		LatencyMs: latency.Milliseconds(),
+		Attempt:   attempt,
+		Extra:     p.Redact.Map(order.Extra),
+	}
+	if err != nil {
+		rec.Error = p.Redact.String(err.Error())
+	} else {
+		rec.StatusCode = resp.StatusCode
+	}
+
+	if werr := p.Audit.Write(rec); werr != nil {
+		p.orderLog(order).Warnf("Failed to audit request for order %s: %v", order.OrderID, werr)
+	}
+}
+
+// statusError reports a non-2XX API response
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("received non-2XX response: %d", e.code)
+}
+
+// failureReason summarizes why an order failed, for progress breakdowns
+func failureReason(err error) string {
+	var serr *statusError
+	if errors.As(err, &serr) {
+		return fmt.Sprintf("HTTP %d", serr.code)
+	}
+	return "request error"
+}
+
+// statusTag returns the metric tag value describing the outcome of a request
+func statusTag(resp *http.Response, err error) string {
+	if err != nil {
+		return "error"
+	}
+	return fmt.Sprintf("%dxx", resp.StatusCode/100)
+}
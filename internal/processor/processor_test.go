@@ -0,0 +1,38 @@
+package processor
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/lifecycle"
+)
+
+// newTestProcessor returns a processor of TSLA sell orders requested from
+// url, reading the JSONL records given and writing to a temporary directory
+func newTestProcessor(t *testing.T, url string, records ...string) *Processor {
+	t.Helper()
+	dir := t.TempDir()
+	input := filepath.Join(dir, "orders.jsonl")
+	if err := os.WriteFile(input, []byte(strings.Join(records, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return NewProcessor(input, filepath.Join(dir, "output.txt"), "TSLA", "sell", url, 0, 5*time.Second, false, logger)
+}
+
+// testOrder returns a JSONL record of a TSLA sell order
+func testOrder(id string) string {
+	return `{"order_id":"` + id + `","symbol":"TSLA","side":"sell","quantity":1,"price":2}`
+}
+
+// stateCount returns the number of orders of the last run in a state
+func stateCount(p *Processor, s lifecycle.State) int {
+	return p.states.Counts()[s]
+}
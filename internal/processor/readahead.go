@@ -0,0 +1,64 @@
+package processor
+
+import (
+	"errors"
+	"io"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/fauzanelka/99tech-order-processor/internal/orderfile"
+)
+
+// readAhead is the most input records parsed ahead of the order being
+// handled, so that parsing overlaps with requests without reading the
+// whole input into memory
+const readAhead = 64
+
+// record is the result of reading one input record
+type record struct {
+	order models.Order
+	err   error
+}
+
+// readRecords reads records from reader in the background into a channel
+// holding at most readAhead of them, ending with io.EOF or the first error
+// that is not a ParseError. stop ends reading early; it must be called once
+// the records are no longer read, and waits for the background read to
+// return.
+func readRecords(reader orderfile.Reader) (records <-chan record, stop func()) {
+	out := make(chan record, readAhead)
+	done := make(chan struct{})
+	go func() {
+		defer close(out)
+		for {
+			order, err := reader.Read()
+			select {
+			case out <- record{order: order, err: err}:
+			case <-done:
+				return
+			}
+			var perr *orderfile.ParseError
+			if err != nil && !errors.As(err, &perr) {
+				return
+			}
+		}
+	}()
+
+	stopped := false
+	return out, func() {
+		if !stopped {
+			stopped = true
+			close(done)
+			for range out {
+			}
+		}
+	}
+}
+
+// next returns the next record, or io.EOF once there are no more
+func next(records <-chan record) (models.Order, error) {
+	rec, ok := <-records
+	if !ok {
+		return models.Order{}, io.EOF
+	}
+	return rec.order, rec.err
+}
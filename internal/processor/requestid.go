@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader is the header the request ID of an order is sent in
+const RequestIDHeader = "X-Request-ID"
+
+// newRunID returns a random ID for a run
+func newRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate run ID: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestIDs hands out the request IDs of the orders of a run, which are
+// the run ID and a sequence number, such as 3f9a1c0e5b7d2468-42. Retries of
+// an order, and orders repeated in the input, share its request ID. All
+// methods are safe for concurrent use and safe to call on a nil receiver,
+// which has no IDs.
+type requestIDs struct {
+	run  string
+	mu   sync.Mutex
+	ids  map[string]string
+	next int
+}
+
+func newRequestIDs(run string) *requestIDs {
+	return &requestIDs{run: run, ids: make(map[string]string)}
+}
+
+// get returns the request ID of an order, assigning the next one if it has
+// none yet
+func (r *requestIDs) get(orderID string) string {
+	if r == nil {
+		return ""
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id, ok := r.ids[orderID]
+	if !ok {
+		r.next++
+		id = fmt.Sprintf("%s-%d", r.run, r.next)
+		r.ids[orderID] = id
+	}
+	return id
+}
+
+// set gives an order a request ID assigned elsewhere, such as by the
+// coordinator of a distributed run
+func (r *requestIDs) set(orderID, id string) {
+	if r == nil || id == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids[orderID] = id
+}
+
+// startIDs gives the processor a new run ID and forgets the request IDs of
+// the previous run. The run ID is added to every log line from then on.
+func (p *Processor) startIDs() {
+	run := newRunID()
+	p.requestIDs = newRequestIDs(run)
+	if p.runID.Swap(run) == nil {
+		p.Logger.AddHook(&runHook{run: &p.runID})
+	}
+}
+
+// requestID returns the request ID of an order
+func (p *Processor) requestID(order models.Order) string {
+	return p.requestIDs.get(order.OrderID)
+}
+
+// orderLog returns the logger for lines about an order, which carry its
+// request ID
+func (p *Processor) orderLog(order models.Order) *logrus.Entry {
+	return p.Logger.WithField("request_id", p.requestID(order))
+}
+
+// orderInfof logs the progress of an order, at info level with LogOrders
+// and debug level otherwise
+func (p *Processor) orderInfof(order models.Order, format string, args ...interface{}) {
+	level := logrus.DebugLevel
+	if p.LogOrders {
+		level = logrus.InfoLevel
+	}
+	p.orderLog(order).Logf(level, format, args...)
+}
+
+// result returns the enveloped result for a response to an order
+func (p *Processor) result(order models.Order, statusCode int, body []byte) models.Result {
+	r := models.NewResult(order, statusCode, body)
+	r.RunID, _ = p.runID.Load().(string)
+	r.RequestID = p.requestID(order)
+	return r
+}
+
+// runHook adds the current run ID to log lines
+type runHook struct {
+	run *atomic.Value
+}
+
+func (h *runHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *runHook) Fire(entry *logrus.Entry) error {
+	if run, ok := h.run.Load().(string); ok {
+		entry.Data["run_id"] = run
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package processor
+
+import (
+	"os"
+	"sync"
+)
+
+// response is an API response, as made and as kept for reuse
+type response struct {
+	statusCode int
+	body       []byte
+	// spool, if set, holds a body too large to keep in memory in place of
+	// body
+	spool *os.File
+}
+
+// responseCache keeps the first successful response for each order ID
+// during a run. All methods are safe for concurrent use and safe to call on
+// a nil receiver, which keeps nothing.
+type responseCache struct {
+	mu        sync.Mutex
+	responses map[string]response
+}
+
+func newResponseCache() *responseCache {
+	return &responseCache{responses: make(map[string]response)}
+}
+
+// get returns the response kept for orderID, if any
+func (c *responseCache) get(orderID string) (response, bool) {
+	if c == nil {
+		return response{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.responses[orderID]
+	return r, ok
+}
+
+// put keeps the response for orderID, unless one is kept already
+func (c *responseCache) put(orderID string, r response) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.responses[orderID]; !ok {
+		c.responses[orderID] = r
+	}
+}
@@ -0,0 +1,143 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/atomicfile"
+)
+
+// Rotated file naming
+const (
+	// RotateSequential names rotated files output-1.jsonl, output-2.jsonl,
+	// and so on
+	RotateSequential = "sequential"
+	// RotateTimestamp names rotated files by when they were started, such
+	// as output-20261016T090000Z.jsonl
+	RotateTimestamp = "timestamp"
+)
+
+// rotateStamp is the layout of the timestamps of rotated files
+const rotateStamp = "20060102T150405Z"
+
+// sizeUnits are the multipliers of the size suffixes rotation accepts
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10},
+	{"GB", 1e9}, {"MB", 1e6}, {"KB", 1e3}, {"B", 1},
+}
+
+// Rotation rotates output files appended to in place, by size or by time:
+// the file is renamed and a fresh one started at its path. The zero value
+// never rotates.
+type Rotation struct {
+	// Size, if positive, rotates a file once this many bytes have been
+	// written to it
+	Size int64
+	// Interval, if positive, rotates files at each multiple of it, such as
+	// on the hour for 1h
+	Interval time.Duration
+	// Naming is how rotated files are named, RotateSequential or
+	// RotateTimestamp
+	Naming string
+}
+
+// ParseRotation parses when to rotate, a size such as 500MB or an interval
+// such as 1h, and how to name rotated files
+func ParseRotation(s, naming string) (Rotation, error) {
+	r := Rotation{Naming: naming}
+	if naming != RotateSequential && naming != RotateTimestamp {
+		return r, fmt.Errorf("unknown rotated file naming %q: must be %s or %s", naming, RotateSequential, RotateTimestamp)
+	}
+	s = strings.TrimSpace(s)
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < time.Second {
+			return r, fmt.Errorf("invalid rotation %q: the interval must be at least 1s", s)
+		}
+		r.Interval = d
+		return r, nil
+	}
+	for _, unit := range sizeUnits {
+		if n, ok := strings.CutSuffix(s, unit.suffix); ok {
+			v, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+			if err != nil || v <= 0 {
+				break
+			}
+			r.Size = int64(v * float64(unit.bytes))
+			return r, nil
+		}
+	}
+	return r, fmt.Errorf("invalid rotation %q: want a size such as 500MB or an interval such as 1h", s)
+}
+
+// due reports whether a file must be rotated before more is written to it
+func (r Rotation) due(f *outputFile, now time.Time) bool {
+	if r.Size > 0 && f.size >= r.Size {
+		return true
+	}
+	return r.Interval > 0 && !now.Truncate(r.Interval).Equal(f.started.Truncate(r.Interval))
+}
+
+// rotate renames the output file for a key out of the way and starts a fresh
+// one at its path. It must be called with mu held.
+func (o *outputs) rotate(key string, f *outputFile) (*outputFile, error) {
+	path, _ := o.paths(key)
+	if err := f.finish(); err != nil {
+		return nil, err
+	}
+	if err := f.file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close output file: %w", err)
+	}
+	// Files rotated by time are named by the start of their interval
+	started := f.started
+	if o.rotation.Interval > 0 {
+		started = started.Truncate(o.rotation.Interval)
+	}
+	rotated, rerr := o.rotatedPath(path, started)
+	if rerr == nil {
+		rerr = os.Rename(path, rotated)
+	}
+
+	// A file that cannot be rotated is continued, so no results are lost
+	file, err := atomicfile.Append(path)
+	if err != nil {
+		return nil, err
+	}
+	nf, err := o.wrap(file)
+	if err != nil {
+		return nil, err
+	}
+	o.files[key] = nf
+	if rerr != nil {
+		o.logger.Warnf("Failed to rotate output file %s, continuing it: %v", path, rerr)
+	} else {
+		o.logger.Infof("Rotated output file %s to %s", path, rotated)
+	}
+	return nf, nil
+}
+
+// rotatedPath returns an unused path to rotate the file at path, started at
+// started, to
+func (o *outputs) rotatedPath(path string, started time.Time) (string, error) {
+	for n := 1; n < 1e6; n++ {
+		var rotated string
+		switch {
+		case o.rotation.Naming == RotateTimestamp && n == 1:
+			rotated = splitPath(path, started.UTC().Format(rotateStamp))
+		case o.rotation.Naming == RotateTimestamp:
+			rotated = splitPath(path, started.UTC().Format(rotateStamp)+"-"+strconv.Itoa(n))
+		default:
+			rotated = splitPath(path, strconv.Itoa(n))
+		}
+		if _, err := os.Stat(rotated); errors.Is(err, os.ErrNotExist) {
+			return rotated, nil
+		}
+	}
+	return "", fmt.Errorf("no unused name to rotate output file %s to", path)
+}
@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/sentry"
+)
+
+// SLA is the thresholds the API requests of a run must stay within. A zero
+// threshold is not checked.
+type SLA struct {
+	// MaxErrorRate is the highest percentage of requests, counting retries,
+	// that may fail without a 2xx or 3xx response
+	MaxErrorRate float64
+	// MaxP99 is the highest 99th percentile request latency
+	MaxP99 time.Duration
+}
+
+// Enabled reports whether any threshold is set
+func (s SLA) Enabled() bool {
+	return s.MaxErrorRate > 0 || s.MaxP99 > 0
+}
+
+// errorRate returns the percentage of requests that failed
+func (l *latencies) errorRate() float64 {
+	total := l.all.Count()
+	if total == 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ok := l.classes["2xx"].Count() + l.classes["3xx"].Count()
+	return 100 * float64(total-ok) / float64(total)
+}
+
+// checkSLA returns an error if the requests of the run breached the SLA,
+// reporting it to Sentry
+func (p *Processor) checkSLA() error {
+	if !p.SLA.Enabled() || p.latency == nil || p.latency.all.Count() == 0 {
+		return nil
+	}
+	var breaches []string
+	rate := p.latency.errorRate()
+	if p.SLA.MaxErrorRate > 0 && rate > p.SLA.MaxErrorRate {
+		breaches = append(breaches, fmt.Sprintf("error rate %.1f%% above %g%%", rate, p.SLA.MaxErrorRate))
+	}
+	p99 := p.latency.all.Quantile(0.99)
+	if p.SLA.MaxP99 > 0 && p99 > p.SLA.MaxP99 {
+		breaches = append(breaches, fmt.Sprintf("p99 latency %s above %s", p99.Round(100*time.Microsecond), p.SLA.MaxP99))
+	}
+	if len(breaches) == 0 {
+		return nil
+	}
+
+	err := fmt.Errorf("SLA breached: %s", strings.Join(breaches, ", "))
+	if p.Sentry == nil {
+		return err
+	}
+	extra := map[string]interface{}{
+		"requests":       p.latency.all.Count(),
+		"error_rate":     rate,
+		"p99_ms":         p99.Milliseconds(),
+		"max_error_rate": p.SLA.MaxErrorRate,
+		"max_p99_ms":     p.SLA.MaxP99.Milliseconds(),
+	}
+	if serr := p.Sentry.CaptureError(err, sentry.LevelError, map[string]string{"alert": "sla"}, extra); serr != nil {
+		p.Logger.Warnf("Failed to report SLA breach to Sentry: %v", serr)
+	}
+	return err
+}
@@ -0,0 +1,210 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// SOAP requests orders with a SOAP envelope POSTed to the base URL, instead
+// of a GET of the order's URL. Responses are XML; the content of their SOAP
+// Body is converted to JSON as the result.
+type SOAP struct {
+	// Envelope renders the request envelope of an order, executed with the
+	// order as .Order
+	Envelope *template.Template
+	// Action, if set, is the SOAP action of the requests
+	Action string
+	// Version is the SOAP version, 1.1 or 1.2, which decides how the action
+	// and content type are sent
+	Version string
+}
+
+// ParseSOAP parses a request envelope template for a SOAP version of 1.1 or
+// 1.2. In addition to the standard functions, the template can use xml to
+// escape a value for XML text or attributes.
+func ParseSOAP(envelope, action, version string) (*SOAP, error) {
+	if version != "1.1" && version != "1.2" {
+		return nil, fmt.Errorf("unknown SOAP version %q: must be 1.1 or 1.2", version)
+	}
+	tmpl, err := template.New("soap").Option("missingkey=zero").Funcs(template.FuncMap{
+		"xml": func(v interface{}) (string, error) {
+			var buf bytes.Buffer
+			err := xml.EscapeText(&buf, []byte(fmt.Sprint(v)))
+			return buf.String(), err
+		},
+	}).Parse(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SOAP envelope: %w", err)
+	}
+	return &SOAP{Envelope: tmpl, Action: action, Version: version}, nil
+}
+
+// body returns the request envelope for an order
+func (s *SOAP) body(order models.Order) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := s.Envelope.Execute(&buf, struct{ Order models.Order }{order}); err != nil {
+		return nil, fmt.Errorf("failed to render SOAP envelope: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// setHeaders sets the content type and action of a request
+func (s *SOAP) setHeaders(h http.Header) {
+	if s.Version == "1.2" {
+		contentType := "application/soap+xml; charset=utf-8"
+		if s.Action != "" {
+			contentType += fmt.Sprintf("; action=%q", s.Action)
+		}
+		h.Set("Content-Type", contentType)
+		return
+	}
+	h.Set("Content-Type", "text/xml; charset=utf-8")
+	if s.Action != "" {
+		h.Set("SOAPAction", fmt.Sprintf("%q", s.Action))
+	}
+}
+
+// soapResponse handles the body of a response to a SOAP request. A
+// successful response returns the content of its SOAP Body as JSON. A fault
+// returns an error: client (or sender) faults are not retried, while other
+// faults are retried like server errors. serr is the status error of a
+// non-2XX response, which a fault is wrapped around, or nil.
+func soapResponse(body []byte, serr *statusError) ([]byte, error) {
+	content, err := soapBody(body)
+	if err != nil {
+		if serr != nil {
+			return nil, serr
+		}
+		return nil, &classError{class: classSchema, code: codeParseXML, err: fmt.Errorf("invalid SOAP response: %w", err)}
+	}
+
+	if fault, ok := content["Fault"].(map[string]interface{}); ok {
+		code, reason := faultDetails(fault)
+		err := fmt.Errorf("SOAP fault %s: %s", code, reason)
+		if serr != nil {
+			err = fmt.Errorf("%w (%w)", err, serr)
+		}
+		switch local := code[strings.LastIndex(code, ":")+1:]; {
+		case local == "Client" || local == "Sender":
+			return nil, &classError{class: classSOAP, err: err}
+		case serr == nil:
+			return nil, &classError{class: classServer, code: codeSOAPFault, err: err}
+		}
+		return nil, err
+	}
+	if serr != nil {
+		return nil, serr
+	}
+	out, err := json.Marshal(content)
+	if err != nil {
+		return nil, &classError{class: classSchema, code: codeParseXML, err: fmt.Errorf("failed to convert SOAP response: %w", err)}
+	}
+	return out, nil
+}
+
+// soapBody returns the content of the SOAP Body of a response, converted
+// by xmlValue
+func soapBody(body []byte) (map[string]interface{}, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil, errors.New("no SOAP Body")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "Body" {
+			v, err := xmlValue(dec, start)
+			if err != nil {
+				return nil, err
+			}
+			content, ok := v.(map[string]interface{})
+			if !ok {
+				content = map[string]interface{}{}
+			}
+			return content, nil
+		}
+	}
+}
+
+// faultDetails returns the code and reason of a SOAP 1.1 or 1.2 fault
+func faultDetails(fault map[string]interface{}) (code, reason string) {
+	if s, ok := fault["faultcode"].(string); ok {
+		code = s
+	}
+	if s, ok := fault["faultstring"].(string); ok {
+		reason = s
+	}
+	// SOAP 1.2 nests them as Code/Value and Reason/Text
+	if c, ok := fault["Code"].(map[string]interface{}); ok {
+		code, _ = c["Value"].(string)
+	}
+	if r, ok := fault["Reason"].(map[string]interface{}); ok {
+		reason, _ = r["Text"].(string)
+		if t, ok := r["Text"].(map[string]interface{}); ok {
+			reason, _ = t["#text"].(string)
+		}
+	}
+	if code == "" {
+		code = "unknown"
+	}
+	return code, reason
+}
+
+// xmlValue converts the element opened by start to a JSON value, naming
+// elements and attributes by their local names. An element with only text
+// is a string; otherwise it is an object of its attributes, prefixed with @,
+// its child elements, which are arrays when repeated, and its text, as
+// #text.
+func xmlValue(dec *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	obj := make(map[string]interface{})
+	for _, attr := range start.Attr {
+		if attr.Name.Space != "xmlns" && attr.Name.Local != "xmlns" {
+			obj["@"+attr.Name.Local] = attr.Value
+		}
+	}
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			child, err := xmlValue(dec, tok)
+			if err != nil {
+				return nil, err
+			}
+			name := tok.Name.Local
+			switch prev := obj[name].(type) {
+			case nil:
+				obj[name] = child
+			case []interface{}:
+				obj[name] = append(prev, child)
+			default:
+				obj[name] = []interface{}{prev, child}
+			}
+		case xml.CharData:
+			text.Write(tok)
+		case xml.EndElement:
+			s := strings.TrimSpace(text.String())
+			if len(obj) == 0 {
+				return s, nil
+			}
+			if s != "" {
+				obj["#text"] = s
+			}
+			return obj, nil
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/lifecycle"
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/fauzanelka/99tech-order-processor/internal/orderfile"
+	"github.com/fauzanelka/99tech-order-processor/internal/rejects"
+	"github.com/fauzanelka/99tech-order-processor/internal/source"
+)
+
+// ProcessSource processes orders received from src until ctx is done. Each
+// message is acknowledged once its result has been written, and returned to
+// the source for redelivery when its request fails. Messages that are not
+// valid orders or do not match the filter are acknowledged and dropped. Up
+// to Concurrency messages are processed at once, within the same limits as
+// the orders of a file.
+func (p *Processor) ProcessSource(ctx context.Context, src source.Source) error {
+	p.client = p.apiClient()
+
+	// A continuous run has no end at which to commit the output, so results
+	// are always appended in place
+	p.Append = true
+	var err error
+	p.output, err = p.openOutputs(false)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer p.output.Close()
+	p.states = lifecycle.NewTracker(nil)
+	p.latency = newLatencies()
+	p.failures = newFailureClasses()
+	p.limits = newLimiter(p.Concurrency, p.MaxPerSymbol, p.AutoConcurrency)
+	p.startIDs()
+
+	// The first error settling a message stops the run once the messages in
+	// flight have finished
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var mu sync.Mutex
+	var failed error
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failed == nil {
+			failed = err
+			cancel()
+		}
+	}
+	stopped := func() error {
+		p.limits.wait()
+		mu.Lock()
+		defer mu.Unlock()
+		return failed
+	}
+
+	filter := models.NewFilter(p.Symbol, p.Side)
+	for {
+		msg, err := src.Receive(ctx)
+		if ctx.Err() != nil {
+			if err := stopped(); err != nil {
+				return err
+			}
+			p.Logger.Infof("Stopping: %v", ctx.Err())
+			return nil
+		}
+		if err != nil {
+			stopped()
+			return fmt.Errorf("failed to receive order: %w", err)
+		}
+
+		order, ok, err := p.receiveMessage(src, msg, filter)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		p.limits.run(order, func() {
+			if err := p.processMessage(src, msg, order); err != nil {
+				fail(err)
+			}
+		})
+	}
+}
+
+// receiveMessage decodes a message into an order, acknowledging messages
+// that are not valid orders or do not match the filter. It reports false
+// for those.
+func (p *Processor) receiveMessage(src source.Source, msg *source.Message, filter models.Filter) (models.Order, bool, error) {
+	p.Progress.Read()
+	p.reopenOutputs()
+	order, err := orderfile.Decode(msg.Data, p.ReaderOptions)
+	if err != nil {
+		p.Logger.WithField("error_code", codeParseInput).Warnf("Message %s is not a valid order: %v", msg.ID, err)
+		p.reject(rejects.Reject{Reason: err.Error(), Code: string(codeParseInput), Record: string(msg.Data)})
+		return order, false, src.Ack(msg)
+	}
+	if !p.prepare(&order) || !filter.Match(order) {
+		return order, false, src.Ack(msg)
+	}
+
+	p.orderInfof(order, "Processing order %s: %s %s %s at $%s",
+		order.OrderID, order.Side, order.Quantity, order.Symbol, order.Price)
+	// Redelivered orders failed before, here or in another consumer
+	if msg.Attempt > 1 {
+		p.startOrder(order, lifecycle.Retrying)
+	} else {
+		p.startOrder(order, lifecycle.Pending)
+	}
+	return order, true, nil
+}
+
+// processMessage requests the order of a message and settles it
+func (p *Processor) processMessage(src source.Source, msg *source.Message, order models.Order) error {
+	p.moveOrder(order, lifecycle.Requested)
+	if err := p.processOrder(order, 0); err != nil {
+		// Failures that are not retryable are not returned to the source
+		if !p.canRetry(err) {
+			p.failureLog(order, err).Errorf("Failed to process order %s, not retrying a %s failure: %v", order.OrderID, classify(err), err)
+			p.failOrder(order, msg.Attempt, err)
+			return src.Ack(msg)
+		}
+		p.orderLog(order).Warnf("Failed to process order %s (delivery %d), returning it to the source: %v", order.OrderID, msg.Attempt, err)
+		if msg.Attempt > p.Retries {
+			p.failureLog(order, err).Errorf("Exceeded maximum retries for order %s", order.OrderID)
+			p.failOrder(order, msg.Attempt, err)
+		} else {
+			p.moveOrder(order, lifecycle.Retrying)
+		}
+		return src.Nak(msg)
+	}
+
+	// The result must be durable before the source forgets the message
+	if err := p.output.Sync(); err != nil {
+		src.Nak(msg)
+		return fmt.Errorf("failed to sync output file: %w", err)
+	}
+	return src.Ack(msg)
+}
@@ -0,0 +1,118 @@
+package processor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/lifecycle"
+	"github.com/fauzanelka/99tech-order-processor/internal/source"
+)
+
+// testSource delivers a fixed list of messages, then cancels the run once
+// every message is settled
+type testSource struct {
+	msgs   chan *source.Message
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	pending int
+	acked   []string
+}
+
+func newTestSource(cancel context.CancelFunc, records ...string) *testSource {
+	s := &testSource{msgs: make(chan *source.Message, len(records)), cancel: cancel, pending: len(records)}
+	for i, record := range records {
+		s.msgs <- &source.Message{ID: strconv.Itoa(i + 1), Data: []byte(record), Attempt: 1}
+	}
+	return s
+}
+
+func (s *testSource) Receive(ctx context.Context) (*source.Message, error) {
+	select {
+	case msg := <-s.msgs:
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *testSource) Ack(msg *source.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acked = append(s.acked, msg.ID)
+	return s.settle()
+}
+
+func (s *testSource) Nak(msg *source.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.settle()
+}
+
+func (s *testSource) settle() error {
+	if s.pending--; s.pending == 0 {
+		s.cancel()
+	}
+	return nil
+}
+
+func (s *testSource) Close() error {
+	return nil
+}
+
+func TestProcessSourceConcurrently(t *testing.T) {
+	const concurrency = 4
+	var mu sync.Mutex
+	inFlight, most := 0, 0
+	full := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > most {
+			most = inFlight
+		}
+		if inFlight == concurrency {
+			close(full)
+		}
+		mu.Unlock()
+
+		// Hold each request until as many are in flight as are allowed
+		select {
+		case <-full:
+		case <-time.After(time.Second):
+		}
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	var records []string
+	for i := 0; i < 2*concurrency; i++ {
+		records = append(records, testOrder("a"+strconv.Itoa(i)))
+	}
+	p := newTestProcessor(t, srv.URL)
+	p.Concurrency = concurrency
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	src := newTestSource(cancel, records...)
+
+	if err := p.ProcessSource(ctx, src); err != nil {
+		t.Fatal(err)
+	}
+	if most != concurrency {
+		t.Errorf("at most %d requests in flight, want %d", most, concurrency)
+	}
+	if len(src.acked) != len(records) {
+		t.Errorf("acked %d messages, want %d", len(src.acked), len(records))
+	}
+	if n := stateCount(p, lifecycle.Succeeded); n != len(records) {
+		t.Errorf("succeeded orders = %d, want %d", n, len(records))
+	}
+}
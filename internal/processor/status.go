@@ -0,0 +1,168 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/lifecycle"
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+	"github.com/fauzanelka/99tech-order-processor/internal/rejects"
+)
+
+// StatusAction is what is done with an order whose request got a non-2xx
+// response
+type StatusAction string
+
+const (
+	// ActionRetry retries the request, after the delay in a Retry-After
+	// header if there is one
+	ActionRetry StatusAction = "retry"
+	// ActionSkip ends the order as skipped, noting it in the rejects file
+	ActionSkip StatusAction = "skip"
+	// ActionDeadLetter fails the order without retrying it
+	ActionDeadLetter StatusAction = "dead-letter"
+	// ActionAbort fails the order and stops the run, as --fail-fast does
+	ActionAbort StatusAction = "abort"
+	// ActionSuccess writes the response as the result of the order
+	ActionSuccess StatusAction = "success"
+)
+
+// StatusRule maps a range of status codes to an action
+type StatusRule struct {
+	Min, Max int
+	Action   StatusAction
+	// Note is recorded with skipped orders
+	Note string
+}
+
+// StatusActions maps status codes to actions. The first rule matching a
+// status code applies; codes without a rule are handled by their failure
+// class.
+type StatusActions []StatusRule
+
+// ParseStatusRule parses a rule such as 404=skip:not listed, 500-503=retry,
+// or 4xx=dead-letter
+func ParseStatusRule(s string) (StatusRule, error) {
+	codes, action, ok := strings.Cut(s, "=")
+	if !ok {
+		return StatusRule{}, fmt.Errorf("invalid status rule %q: want CODES=ACTION", s)
+	}
+	var r StatusRule
+	action, r.Note, _ = strings.Cut(action, ":")
+	switch r.Action = StatusAction(strings.TrimSpace(action)); r.Action {
+	case ActionRetry, ActionSkip, ActionDeadLetter, ActionAbort, ActionSuccess:
+	default:
+		return StatusRule{}, fmt.Errorf("invalid status rule %q: unknown action %q (want retry, skip, dead-letter, abort or success)", s, action)
+	}
+	if r.Note != "" && r.Action != ActionSkip {
+		return StatusRule{}, fmt.Errorf("invalid status rule %q: only skip takes a note", s)
+	}
+
+	codes = strings.TrimSpace(codes)
+	var err error
+	switch low, high, isRange := strings.Cut(codes, "-"); {
+	case len(codes) == 3 && strings.HasSuffix(codes, "xx"):
+		var class int
+		class, err = strconv.Atoi(codes[:1])
+		r.Min, r.Max = class*100, class*100+99
+	case isRange:
+		if r.Min, err = strconv.Atoi(low); err == nil {
+			r.Max, err = strconv.Atoi(high)
+		}
+	default:
+		r.Min, err = strconv.Atoi(codes)
+		r.Max = r.Min
+	}
+	if err != nil || r.Min < 100 || r.Max > 599 || r.Min > r.Max {
+		return StatusRule{}, fmt.Errorf("invalid status rule %q: codes must be a status code, a range such as 500-503, or a class such as 5xx", s)
+	}
+	if r.Min < 300 && r.Max >= 200 {
+		return StatusRule{}, fmt.Errorf("invalid status rule %q: 2xx responses are always successful", s)
+	}
+	return r, nil
+}
+
+// rule returns the rule for a status code, if any
+func (a StatusActions) rule(code int) (StatusRule, bool) {
+	for _, r := range a {
+		if code >= r.Min && code <= r.Max {
+			return r, true
+		}
+	}
+	return StatusRule{}, false
+}
+
+// Has reports whether any rule has an action
+func (a StatusActions) Has(action StatusAction) bool {
+	for _, r := range a {
+		if r.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+// statusRule returns the rule for the response of a failed request, if any
+func (p *Processor) statusRule(err error) (StatusRule, bool) {
+	var serr *statusError
+	if !errors.As(err, &serr) {
+		return StatusRule{}, false
+	}
+	return p.StatusActions.rule(serr.code)
+}
+
+// canRetry reports whether a failed order is retried, by the action for its
+// status code or else by its failure class
+func (p *Processor) canRetry(err error) bool {
+	if r, ok := p.statusRule(err); ok {
+		return r.Action == ActionRetry
+	}
+	return retryable(err)
+}
+
+// stops reports whether a failed order stops the run
+func (p *Processor) stops(err error) bool {
+	r, ok := p.statusRule(err)
+	return p.FailFast || (ok && r.Action == ActionAbort)
+}
+
+// skip ends an order as skipped if the action for the status code of its
+// failure is skip, reporting whether it did
+func (p *Processor) skip(order models.Order, err error) bool {
+	r, ok := p.statusRule(err)
+	if !ok || r.Action != ActionSkip {
+		return false
+	}
+	var serr *statusError
+	errors.As(err, &serr)
+	reason := fmt.Sprintf("skipped after HTTP %d", serr.code)
+	if r.Note != "" {
+		reason += ": " + r.Note
+	}
+	p.orderLog(order).WithField("error_code", codeStatusSkipped).Warnf("Skipping order %s: %s", order.OrderID, reason)
+	p.reject(rejects.Reject{OrderID: order.OrderID, Reason: reason, Code: string(codeStatusSkipped)})
+	p.moveOrder(order, lifecycle.Skipped)
+	p.reportSkip(order, reason)
+	p.Metrics.Incr("orders.skipped", map[string]string{"symbol": order.Symbol, "side": order.Side})
+	return true
+}
+
+// retryAfter returns the delay asked for by the Retry-After header of a
+// response, in seconds or as a date, or fallback if there is none
+func retryAfter(resp *http.Response, fallback time.Duration) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return fallback
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return fallback
+}
@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/storage"
+)
+
+// tee is an extra output written alongside the main one, with the same
+// results. A tee that fails is logged and no longer written, without
+// failing the orders or the run, so a flaky destination never costs the
+// results written elsewhere.
+type tee struct {
+	out    *outputs
+	name   string
+	logger *logrus.Logger
+	// err is why the tee failed, or nil while it is written
+	err error
+}
+
+// openTees prepares the outputs of the tees of a run, leaving out those
+// that cannot be opened
+func (p *Processor) openTees(resume bool) []*tee {
+	var tees []*tee
+	for _, path := range p.Tee {
+		name := storage.Redact(path)
+		out, err := p.newOutputs(path, resume)
+		if err != nil {
+			p.Logger.Warnf("Tee output %s cannot be opened and will not be written: %v", name, err)
+			continue
+		}
+		tees = append(tees, &tee{out: out, name: name, logger: p.Logger})
+	}
+	return tees
+}
+
+// fail stops writing a tee after an error, leaving its files uncommitted
+func (t *tee) fail(err error) {
+	t.err = err
+	t.out.Close()
+	t.logger.Warnf("Tee output %s failed and will no longer be written: %v", t.name, err)
+}
+
+// teeAll calls fn with the outputs of each tee still being written, failing
+// those it returns an error for
+func (o *outputs) teeAll(fn func(*outputs) error) {
+	for _, t := range o.tees {
+		if t.err != nil {
+			continue
+		}
+		if err := fn(t.out); err != nil {
+			t.fail(err)
+		}
+	}
+}
+
+// commitTees moves the files of the tees still being written into place,
+// adding them to the artifacts of the run, and reports those that failed
+func (o *outputs) commitTees() {
+	for _, t := range o.tees {
+		if t.err != nil {
+			t.logger.Warnf("Tee output %s is incomplete: %v", t.name, t.err)
+		}
+	}
+	o.teeAll(func(t *outputs) error {
+		if err := t.Commit(); err != nil {
+			return err
+		}
+		o.artifacts = append(o.artifacts, t.artifacts...)
+		return nil
+	})
+}
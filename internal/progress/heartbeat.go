@@ -0,0 +1,108 @@
+package progress
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Heartbeat logs a line of progress at an interval, so long runs can be
+// followed without a line per order. Stop is safe to call on a nil receiver.
+type Heartbeat struct {
+	tracker  *Tracker
+	logger   *logrus.Logger
+	interval time.Duration
+	stop     chan struct{}
+	done     sync.WaitGroup
+	once     sync.Once
+
+	// last is the snapshot of the previous heartbeat
+	last Snapshot
+	at   time.Time
+}
+
+// StartHeartbeat logs the progress tracked by tracker every interval until
+// stopped
+func StartHeartbeat(tracker *Tracker, logger *logrus.Logger, interval time.Duration) *Heartbeat {
+	h := &Heartbeat{
+		tracker:  tracker,
+		logger:   logger,
+		interval: interval,
+		stop:     make(chan struct{}),
+		at:       time.Now(),
+	}
+	h.done.Add(1)
+	go h.run()
+	return h
+}
+
+// Stop stops logging progress
+func (h *Heartbeat) Stop() {
+	if h == nil {
+		return
+	}
+	h.once.Do(func() {
+		close(h.stop)
+		h.done.Wait()
+	})
+}
+
+func (h *Heartbeat) run() {
+	defer h.done.Done()
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case now := <-ticker.C:
+			h.beat(now)
+		}
+	}
+}
+
+// beat logs the progress since the run started, unless nothing has happened
+// since the last heartbeat, such as between scheduled runs
+func (h *Heartbeat) beat(now time.Time) {
+	s := h.tracker.Snapshot()
+	done, lastDone := s.Processed+s.Failed, h.last.Processed+h.last.Failed
+	idle := s.Read == h.last.Read && done == lastDone && s.Rejected == h.last.Rejected && len(s.InFlight) == 0
+	rate := float64(done-lastDone) / now.Sub(h.at).Seconds()
+	h.last, h.at = s, now
+	if idle {
+		return
+	}
+
+	fields := logrus.Fields{
+		"read":      s.Read,
+		"processed": s.Processed,
+		"failed":    s.Failed,
+		"rejected":  s.Rejected,
+		"in_flight": len(s.InFlight),
+		"rate":      math.Round(rate*10) / 10,
+	}
+	msg := "Progress: %d processed, %d failed, %.1f orders/s"
+	args := []interface{}{s.Processed, s.Failed, rate}
+	if eta, ok := s.ETA(now); ok {
+		fields["percent"] = int(100 * s.InputRead / s.InputSize)
+		fields["eta"] = eta.String()
+		msg += ", %d%% of input read, ETA %s"
+		args = append(args, fields["percent"], eta)
+	}
+	h.logger.WithFields(fields).Infof(msg, args...)
+}
+
+// ETA estimates the time left to read the rest of the input at the pace it
+// has been read so far. It reports false if the size of the input is not
+// known, or it has not been read enough to tell or been read in full, when
+// the orders left are only those parsed ahead and being retried.
+func (s Snapshot) ETA(now time.Time) (time.Duration, bool) {
+	if s.InputSize <= 0 || s.InputRead <= 0 || s.InputRead >= s.InputSize {
+		return 0, false
+	}
+	elapsed := now.Sub(s.InputStarted)
+	left := time.Duration(float64(elapsed) * float64(s.InputSize-s.InputRead) / float64(s.InputRead))
+	return left.Round(time.Second), true
+}
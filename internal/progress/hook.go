@@ -0,0 +1,18 @@
+package progress
+
+import "github.com/sirupsen/logrus"
+
+// LogHook records the warnings and errors logged during a run as the
+// tracker's recent errors
+type LogHook struct {
+	Tracker *Tracker
+}
+
+func (h LogHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel}
+}
+
+func (h LogHook) Fire(e *logrus.Entry) error {
+	h.Tracker.Error(e.Message)
+	return nil
+}
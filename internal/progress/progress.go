@@ -0,0 +1,206 @@
+// Package progress tracks the progress of a run for live displays.
+package progress
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/lifecycle"
+)
+
+// maxErrors is the number of recent errors kept
+const maxErrors = 10
+
+// Tracker counts the outcomes of a run as it happens. All methods are safe
+// for concurrent use and safe to call on a nil receiver, which disables
+// tracking.
+type Tracker struct {
+	mu         sync.Mutex
+	started    time.Time
+	read       int
+	processed  int
+	failed     int
+	rejected   int
+	retryQueue int
+	states     map[lifecycle.State]int
+	failures   map[string]int
+	inFlight   map[string]time.Time
+	errors     []Error
+	// input is the size of the input and how much of it has been read, for
+	// estimating the time left
+	inputSize    int64
+	inputRead    int64
+	inputStarted time.Time
+}
+
+// Error is a recent error message
+type Error struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// InFlight is an order whose request is in progress
+type InFlight struct {
+	OrderID string    `json:"order_id"`
+	Since   time.Time `json:"since"`
+}
+
+// Snapshot is the state of a run at a point in time
+type Snapshot struct {
+	Started    time.Time `json:"started"`
+	Read       int       `json:"read"`
+	Processed  int       `json:"processed"`
+	Failed     int       `json:"failed"`
+	Rejected   int       `json:"rejected"`
+	RetryQueue int       `json:"retry_queue"`
+	// InputSize is the size in bytes of the input being read, if known, and
+	// InputRead how much of it has been read since InputStarted
+	InputSize    int64     `json:"input_size,omitempty"`
+	InputRead    int64     `json:"input_read,omitempty"`
+	InputStarted time.Time `json:"input_started,omitempty"`
+	// States counts orders by lifecycle state
+	States map[lifecycle.State]int `json:"states,omitempty"`
+	// Failures counts failed orders by reason
+	Failures map[string]int `json:"failures"`
+	// InFlight is ordered from the longest running
+	InFlight []InFlight `json:"in_flight"`
+	// Errors is ordered from the oldest
+	Errors []Error `json:"errors"`
+}
+
+// NewTracker creates a tracker for a run starting now
+func NewTracker() *Tracker {
+	return &Tracker{
+		started:  time.Now(),
+		failures: make(map[string]int),
+		inFlight: make(map[string]time.Time),
+	}
+}
+
+// Read counts an input record
+func (t *Tracker) Read() {
+	t.update(func() { t.read++ })
+}
+
+// Processed counts a successfully processed order
+func (t *Tracker) Processed() {
+	t.update(func() { t.processed++ })
+}
+
+// Failed counts an order that failed after all retries, for a short reason
+// such as "HTTP 503"
+func (t *Tracker) Failed(reason string) {
+	t.update(func() {
+		t.failed++
+		t.failures[reason]++
+	})
+}
+
+// Rejected counts a rejected input record
+func (t *Tracker) Rejected() {
+	t.update(func() { t.rejected++ })
+}
+
+// RetryQueue records the number of orders awaiting retry
+func (t *Tracker) RetryQueue(n int) {
+	t.update(func() { t.retryQueue = n })
+}
+
+// States records the number of orders in each lifecycle state
+func (t *Tracker) States(counts map[lifecycle.State]int) {
+	t.update(func() { t.states = counts })
+}
+
+// Begin records that the request for an order has started
+func (t *Tracker) Begin(orderID string) {
+	t.update(func() { t.inFlight[orderID] = time.Now() })
+}
+
+// End records that the request for an order has finished
+func (t *Tracker) End(orderID string) {
+	t.update(func() { delete(t.inFlight, orderID) })
+}
+
+// Input starts counting the reading of an input of size bytes, returning r
+// counting the bytes read from it. A size of zero or less is unknown.
+func (t *Tracker) Input(r io.Reader, size int64) io.Reader {
+	if t == nil || size <= 0 {
+		return r
+	}
+	t.update(func() {
+		t.inputSize = size
+		t.inputRead = 0
+		t.inputStarted = time.Now()
+	})
+	return &countingReader{r: r, t: t}
+}
+
+// countingReader counts the bytes read from an input
+type countingReader struct {
+	r io.Reader
+	t *Tracker
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.t.update(func() { c.t.inputRead += int64(n) })
+	return n, err
+}
+
+// Error records an error message, keeping only the most recent ones
+func (t *Tracker) Error(msg string) {
+	t.update(func() {
+		t.errors = append(t.errors, Error{Time: time.Now(), Message: msg})
+		if len(t.errors) > maxErrors {
+			t.errors = t.errors[len(t.errors)-maxErrors:]
+		}
+	})
+}
+
+func (t *Tracker) update(f func()) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f()
+}
+
+// Snapshot returns the current state of the run
+func (t *Tracker) Snapshot() Snapshot {
+	if t == nil {
+		return Snapshot{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := Snapshot{
+		Started:      t.started,
+		Read:         t.read,
+		Processed:    t.processed,
+		Failed:       t.failed,
+		Rejected:     t.rejected,
+		RetryQueue:   t.retryQueue,
+		InputSize:    t.inputSize,
+		InputRead:    t.inputRead,
+		InputStarted: t.inputStarted,
+		Failures:     make(map[string]int, len(t.failures)),
+		States:       make(map[lifecycle.State]int, len(t.states)),
+		Errors:       append([]Error(nil), t.errors...),
+	}
+	for reason, n := range t.failures {
+		s.Failures[reason] = n
+	}
+	for state, n := range t.states {
+		s.States[state] = n
+	}
+	for id, since := range t.inFlight {
+		s.InFlight = append(s.InFlight, InFlight{OrderID: id, Since: since})
+	}
+	sort.Slice(s.InFlight, func(i, j int) bool {
+		return s.InFlight[i].Since.Before(s.InFlight[j].Since)
+	})
+	return s
+}
@@ -0,0 +1,99 @@
+// Package ratelimit spaces out API requests to a maximum rate, optionally
+// adapting the rate to the responses the API sends back.
+package ratelimit
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// minRate is the lowest rate an adaptive limiter backs off to, in
+	// requests per second
+	minRate = 0.1
+	// decreaseFactor scales the rate down when the API pushes back
+	decreaseFactor = 0.5
+	// increaseSteps is the number of seconds without pushback an adaptive
+	// limiter takes to ramp from its lowest rate back up to the maximum
+	increaseSteps = 20
+	// cooldown is the shortest time between two adjustments, so that one
+	// burst of throttled responses to requests already in flight only
+	// backs off once
+	cooldown = time.Second
+)
+
+// Limiter spaces out requests to a rate in requests per second. An
+// adaptive limiter halves its rate when the API responds 429 Too Many
+// Requests or 503 Service Unavailable, and adds back a twentieth of the
+// maximum rate for every second without one, AIMD style. All methods are
+// safe for concurrent use and safe to call on a nil receiver, which does not
+// limit requests.
+type Limiter struct {
+	mu       sync.Mutex
+	max      float64
+	rate     float64
+	adaptive bool
+	// next is the earliest time the next request may start
+	next time.Time
+	// adjusted is the time of the last change of rate
+	adjusted time.Time
+}
+
+// New creates a limiter for rate requests per second. An adaptive limiter
+// starts at rate and never exceeds it.
+func New(rate float64, adaptive bool) *Limiter {
+	return &Limiter{max: rate, rate: rate, adaptive: adaptive, adjusted: time.Now()}
+}
+
+// Wait blocks until the next request may start
+func (l *Limiter) Wait() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	start := l.next
+	l.next = l.next.Add(time.Duration(float64(time.Second) / l.rate))
+	l.mu.Unlock()
+
+	time.Sleep(time.Until(start))
+}
+
+// Observe adapts the rate to a response status. It returns the new rate
+// and whether the limiter backed off.
+func (l *Limiter) Observe(statusCode int) (rate float64, backedOff bool) {
+	if l == nil {
+		return 0, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.adaptive {
+		return l.rate, false
+	}
+
+	now := time.Now()
+	if now.Sub(l.adjusted) < cooldown {
+		return l.rate, false
+	}
+	switch {
+	case statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable:
+		l.rate = max(l.rate*decreaseFactor, minRate)
+		l.adjusted = now
+		// The next request waits a full interval at the new rate
+		if next := now.Add(time.Duration(float64(time.Second) / l.rate)); next.After(l.next) {
+			l.next = next
+		}
+		return l.rate, true
+	case l.rate < l.max:
+		steps := float64(now.Sub(l.adjusted)) / float64(time.Second)
+		l.rate = min(l.rate+steps*l.max/increaseSteps, l.max)
+		l.adjusted = now
+	default:
+		l.adjusted = now
+	}
+	return l.rate, false
+}
@@ -0,0 +1,107 @@
+// Package redact masks the values of sensitive fields, such as account
+// numbers and client IDs, in text written to logs and diagnostics.
+package redact
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Mask replaces the values of sensitive fields
+const Mask = "REDACTED"
+
+// Redactor masks the values of a set of field names, matched without regard
+// to case. All methods are safe to call on a nil receiver, which masks
+// nothing.
+type Redactor struct {
+	fields map[string]bool
+	// jsonValue matches "field": value in JSON
+	jsonValue *regexp.Regexp
+	// pairValue matches field=value in log fields and query strings
+	pairValue *regexp.Regexp
+}
+
+// New creates a redactor for fields, or returns nil if there are none
+func New(fields []string) *Redactor {
+	r := &Redactor{fields: make(map[string]bool)}
+	var names []string
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			r.fields[strings.ToLower(f)] = true
+			names = append(names, regexp.QuoteMeta(f))
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	alt := strings.Join(names, "|")
+	r.jsonValue = regexp.MustCompile(`(?i)("(?:` + alt + `)"\s*:\s*)("(?:[^"\\]|\\.)*"|[-+0-9.eE]+|true|false)`)
+	r.pairValue = regexp.MustCompile(`(?i)(\b(?:` + alt + `)=)("(?:[^"\\]|\\.)*"|[^\s&"]+)`)
+	return r
+}
+
+// Sensitive reports whether name is a sensitive field
+func (r *Redactor) Sensitive(name string) bool {
+	return r != nil && r.fields[strings.ToLower(name)]
+}
+
+// String masks the values of sensitive fields in s, whether it holds JSON
+// or field=value pairs
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	s = r.jsonValue.ReplaceAllString(s, `${1}"`+Mask+`"`)
+	return r.pairValue.ReplaceAllString(s, "${1}"+Mask)
+}
+
+// Map returns a copy of m with the values of sensitive fields masked,
+// including in nested maps
+func (r *Redactor) Map(m map[string]interface{}) map[string]interface{} {
+	if r == nil || m == nil {
+		return m
+	}
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if r.Sensitive(k) {
+			out[k] = Mask
+		} else if nested, ok := v.(map[string]interface{}); ok {
+			out[k] = r.Map(nested)
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Hook masks sensitive fields in log messages and fields
+type Hook struct {
+	Redactor *Redactor
+}
+
+// Levels returns all log levels
+func (h Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire masks the entry before it is formatted
+func (h Hook) Fire(entry *logrus.Entry) error {
+	entry.Message = h.Redactor.String(entry.Message)
+	for k, v := range entry.Data {
+		if h.Redactor.Sensitive(k) {
+			entry.Data[k] = Mask
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			entry.Data[k] = h.Redactor.String(v)
+		case error:
+			entry.Data[k] = h.Redactor.String(v.Error())
+		case map[string]interface{}:
+			entry.Data[k] = h.Redactor.Map(v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+// Package redis is a minimal Redis client speaking RESP2 over a single
+// connection.
+package redis
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// dialTimeout bounds connecting to the server
+	dialTimeout = 10 * time.Second
+	// maxBulkLen is the server's own limit on the size of a bulk string
+	maxBulkLen = 512 << 20
+)
+
+// Error is an error reply from the server
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Conn is a connection to a Redis server. Commands are serialized, so it is
+// safe for concurrent use.
+type Conn struct {
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Dial connects to redis://[user:pass@]host:port/db (or rediss:// for TLS),
+// authenticating and selecting the database when given
+func Dial(rawURL string, insecure bool) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "redis" && u.Scheme != "rediss") {
+		return nil, fmt.Errorf("invalid Redis URL: %q", rawURL)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	if u.Scheme == "rediss" {
+		conn = tls.Client(conn, &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: insecure})
+	}
+	return newConn(conn, u)
+}
+
+// newConn authenticates and selects the database of the URL, closing conn
+// if that fails
+func newConn(conn net.Conn, u *url.URL) (*Conn, error) {
+	c := &Conn{conn: conn, r: bufio.NewReader(conn)}
+
+	if u.User != nil {
+		args := []string{"AUTH"}
+		if pass, ok := u.User.Password(); ok {
+			if name := u.User.Username(); name != "" {
+				args = append(args, name)
+			}
+			args = append(args, pass)
+		} else {
+			args = append(args, u.User.Username())
+		}
+		if _, err := c.Do(args...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("Redis authentication failed: %w", err)
+		}
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if _, err := strconv.Atoi(db); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("invalid Redis database %q", db)
+		}
+		if _, err := c.Do("SELECT", db); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to select Redis database %s: %w", db, err)
+		}
+	}
+	return c, nil
+}
+
+// Do sends a command and returns its reply. Replies are decoded as string
+// (simple and bulk strings), int64, nil, []interface{}, or an Error, which
+// is returned as the error.
+func (c *Conn) Do(args ...string) (interface{}, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, fmt.Errorf("failed to write to Redis: %w", err)
+	}
+	reply, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := reply.(Error); ok {
+		return nil, e
+	}
+	return reply, nil
+}
+
+// Close closes the connection
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// read decodes one reply
+func (c *Conn) read() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from Redis: %w", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("malformed Redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed Redis integer: %q", line)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n > maxBulkLen {
+			return nil, fmt.Errorf("malformed Redis bulk string: %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, fmt.Errorf("failed to read from Redis: %w", err)
+		}
+		if string(buf[n:]) != "\r\n" {
+			return nil, fmt.Errorf("malformed Redis bulk string: not %d bytes", n)
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("malformed Redis array: %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		// The length is not trusted until the items arrive
+		items := make([]interface{}, 0, min(n, 1024))
+		for i := 0; i < n; i++ {
+			item, err := c.read()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unknown Redis reply type: %q", line)
+	}
+}
@@ -0,0 +1,155 @@
+// Package rejects records input records that were rejected before processing.
+package rejects
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/encrypt"
+)
+
+// Reject describes a rejected input record
+type Reject struct {
+	Line    int    `json:"line,omitempty"`
+	OrderID string `json:"order_id,omitempty"`
+	Reason  string `json:"reason"`
+	Code    string `json:"code,omitempty"`
+	Record  string `json:"record,omitempty"`
+}
+
+// Writer appends rejects to a JSONL file, encrypting them if it has an
+// encrypter. All methods are safe to call on a nil receiver, which discards
+// rejects.
+type Writer struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	encrypt *encrypt.Encrypter
+	enc     *encrypt.Writer
+}
+
+// Create creates the rejects file at path, truncating any existing file.
+// If e is not nil, rejects are encrypted with it.
+func Create(path string, e *encrypt.Encrypter) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rejects file: %w", err)
+	}
+	w := &Writer{path: path, file: file, encrypt: e}
+	if err := w.start(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// start starts an encrypted stream on the file when encrypting
+func (w *Writer) start() error {
+	if w.encrypt == nil {
+		return nil
+	}
+	enc, err := w.encrypt.NewWriter(w.file)
+	if err != nil {
+		return fmt.Errorf("failed to start encrypted rejects file: %w", err)
+	}
+	w.enc = enc
+	return nil
+}
+
+// finish ends the encrypted stream, if any
+func (w *Writer) finish() error {
+	if w.enc == nil {
+		return nil
+	}
+	return w.enc.Close()
+}
+
+// Write appends a reject to the file
+func (w *Writer) Write(r Reject) error {
+	if w == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode reject: %w", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.encrypt != nil && w.enc == nil {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+	if w.enc != nil {
+		// Each reject is sealed as it is written, so none are lost in a crash
+		if _, err := w.enc.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write reject: %w", err)
+		}
+		if err := w.enc.Flush(); err != nil {
+			return fmt.Errorf("failed to write reject: %w", err)
+		}
+		return nil
+	}
+	if _, err := w.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write reject: %w", err)
+	}
+	return nil
+}
+
+// Path returns the path of the rejects file
+func (w *Writer) Path() string {
+	return w.path
+}
+
+// Sync ends any encrypted stream, so that the file is complete as it
+// stands, and flushes the file to disk. Later rejects start a new stream.
+func (w *Writer) Sync() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.finish(); err != nil {
+		return fmt.Errorf("failed to finish encrypted rejects file: %w", err)
+	}
+	w.enc = nil
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync rejects file: %w", err)
+	}
+	return nil
+}
+
+// Reopen closes the rejects file and opens its path again for appending, so
+// that a file rotated by renaming it is continued in a fresh file
+func (w *Writer) Reopen() error {
+	if w == nil {
+		return nil
+	}
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to reopen rejects file: %w", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.finish()
+	w.file.Close()
+	w.file = file
+	return w.start()
+}
+
+// Close ends any encrypted stream and closes the rejects file
+func (w *Writer) Close() error {
+	if w == nil {
+		return nil
+	}
+	if err := w.finish(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("failed to finish encrypted rejects file: %w", err)
+	}
+	return w.file.Close()
+}
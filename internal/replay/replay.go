@@ -0,0 +1,235 @@
+// Package replay re-sends requests recorded in a HAR capture or audit log.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/fauzanelka/99tech-order-processor/internal/audit"
+	"github.com/fauzanelka/99tech-order-processor/internal/capture"
+)
+
+// Request is a recorded request to be replayed
+type Request struct {
+	Timestamp time.Time
+	Method    string
+	URL       string
+	Headers   http.Header
+	// Redacted names the headers recorded with redacted values, which are
+	// not replayed unless the Replayer is configured with them
+	Redacted []string
+	Body     []byte
+	// Altered, if set, is why Body is not the body that was sent, such as
+	// truncation at capture time; the request is not replayed
+	Altered        string
+	OriginalStatus int
+}
+
+// Summary describes the outcome of a replay
+type Summary struct {
+	Sent     int
+	Failed   int
+	Mismatch int
+	// Skipped counts requests whose recorded body was altered
+	Skipped int
+}
+
+// Load reads recorded requests from a HAR capture or a JSONL audit log,
+// ordered by their original timestamps
+func Load(path string) ([]Request, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replay file: %w", err)
+	}
+
+	var requests []Request
+	var har capture.HAR
+	if err := json.Unmarshal(data, &har); err == nil && har.Log.Version != "" {
+		requests = fromHAR(har)
+	} else {
+		requests, err = fromAudit(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].Timestamp.Before(requests[j].Timestamp)
+	})
+	return requests, nil
+}
+
+// fromHAR converts HAR entries to requests
+func fromHAR(har capture.HAR) []Request {
+	requests := make([]Request, 0, len(har.Log.Entries))
+	for _, e := range har.Log.Entries {
+		headers := http.Header{}
+		var redacted []string
+		for _, h := range e.Request.Headers {
+			// Redacted values cannot be replayed meaningfully
+			if h.Value == capture.Redacted {
+				redacted = append(redacted, http.CanonicalHeaderKey(h.Name))
+				continue
+			}
+			headers.Add(h.Name, h.Value)
+		}
+		var body []byte
+		var altered string
+		if pd := e.Request.PostData; pd != nil {
+			body = []byte(pd.Text)
+			switch {
+			case pd.Truncated:
+				altered = "its body was truncated in the capture"
+			case pd.Redacted:
+				altered = "its body had fields redacted in the capture"
+			}
+		}
+		requests = append(requests, Request{
+			Timestamp:      e.StartedDateTime,
+			Method:         e.Request.Method,
+			URL:            e.Request.URL,
+			Headers:        headers,
+			Redacted:       redacted,
+			Body:           body,
+			Altered:        altered,
+			OriginalStatus: e.Response.Status,
+		})
+	}
+	return requests
+}
+
+// fromAudit converts audit log lines to requests. Audit records have no
+// request bodies, so requests that send one are refused rather than
+// replayed empty.
+func fromAudit(data []byte) ([]Request, error) {
+	var requests []Request
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var rec audit.Record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return nil, fmt.Errorf("line %d is not a valid audit record: %w", lineNum, err)
+		}
+		if rec.Method != "" && rec.Method != http.MethodGet && rec.Method != http.MethodHead {
+			return nil, fmt.Errorf("line %d is a %s request, whose body the audit log does not record; replay a --capture of the run instead", lineNum, rec.Method)
+		}
+		requests = append(requests, Request{
+			Timestamp:      rec.Timestamp,
+			Method:         rec.Method,
+			URL:            rec.URL,
+			Headers:        http.Header{},
+			OriginalStatus: rec.StatusCode,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading replay file: %w", err)
+	}
+	return requests, nil
+}
+
+// Replayer sends recorded requests to a target
+type Replayer struct {
+	Target *url.URL
+	Speed  float64
+	// Headers, such as the Authorization header, are set on every request,
+	// replacing the recorded values and restoring redacted ones
+	Headers http.Header
+	Client  *http.Client
+	Logger  *logrus.Logger
+}
+
+// Run replays the requests in order. When Speed is positive the original
+// gaps between requests are preserved, divided by Speed; otherwise requests
+// are sent back to back. Requests whose recorded body was altered are
+// skipped rather than sent with the wrong body.
+func (r *Replayer) Run(requests []Request) Summary {
+	var summary Summary
+	var prev time.Time
+	warned := make(map[string]bool)
+
+	for i, rr := range requests {
+		for _, name := range rr.Redacted {
+			if r.Headers.Get(name) == "" && !warned[name] {
+				warned[name] = true
+				r.Logger.Warnf("Header %s was redacted in the capture and is not replayed; pass it with --header or --auth-token", name)
+			}
+		}
+		if r.Speed > 0 && i > 0 {
+			if gap := rr.Timestamp.Sub(prev); gap > 0 {
+				time.Sleep(time.Duration(float64(gap) / r.Speed))
+			}
+		}
+		prev = rr.Timestamp
+
+		if rr.Altered != "" {
+			summary.Skipped++
+			r.Logger.Warnf("Skipping %s %s: %s", rr.Method, rr.URL, rr.Altered)
+			continue
+		}
+		status, err := r.send(rr)
+		summary.Sent++
+		if err != nil {
+			summary.Failed++
+			r.Logger.Warnf("Replay of %s %s failed: %v", rr.Method, rr.URL, err)
+			continue
+		}
+
+		if rr.OriginalStatus != 0 && status != rr.OriginalStatus {
+			summary.Mismatch++
+			r.Logger.Warnf("Replay of %s %s returned %d, originally %d", rr.Method, rr.URL, status, rr.OriginalStatus)
+		} else {
+			r.Logger.Infof("Replayed %s %s: %d", rr.Method, rr.URL, status)
+		}
+	}
+	return summary
+}
+
+// send issues a single request against the target and returns its status
+func (r *Replayer) send(rr Request) (int, error) {
+	u, err := url.Parse(rr.URL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid recorded URL: %w", err)
+	}
+	u.Scheme = r.Target.Scheme
+	u.Host = r.Target.Host
+
+	method := rr.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(rr.Body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range rr.Headers {
+		req.Header[name] = values
+	}
+	for name, values := range r.Headers {
+		req.Header[name] = values
+	}
+
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,108 @@
+package replay
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// writeFile writes a replay source to a temporary file
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReplayRestoresRedactedHeaders(t *testing.T) {
+	var auth []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	path := writeFile(t, "capture.har", `{"log":{"version":"1.2","entries":[{
+		"startedDateTime":"2026-01-02T03:04:05Z",
+		"request":{"method":"GET","url":"https://api.example.com/orders/a1","headers":[{"name":"Authorization","value":"REDACTED"}]},
+		"response":{"status":200}}]}}`)
+	requests, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, _ := url.Parse(srv.URL)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	r := &Replayer{Target: target, Client: srv.Client(), Logger: logger}
+
+	if summary := r.Run(requests); summary.Mismatch != 1 {
+		t.Errorf("unauthenticated replay: %+v, want a mismatch", summary)
+	}
+	r.Headers = http.Header{"Authorization": {"Bearer secret"}}
+	if summary := r.Run(requests); summary.Mismatch != 0 || summary.Failed != 0 {
+		t.Errorf("authenticated replay: %+v, want no mismatches", summary)
+	}
+	if len(auth) != 2 || auth[0] != "" || auth[1] != "Bearer secret" {
+		t.Errorf("Authorization headers sent = %q", auth)
+	}
+}
+
+func TestLoadRefusesAuditRequestsWithBodies(t *testing.T) {
+	get := `{"timestamp":"2026-01-02T03:04:05Z","order_id":"a1","url":"https://api.example.com/orders/a1","method":"GET","status_code":200}`
+	post := `{"timestamp":"2026-01-02T03:04:06Z","order_id":"a2","url":"https://api.example.com/graphql","method":"POST","status_code":200}`
+
+	requests, err := Load(writeFile(t, "get.jsonl", get+"\n"))
+	if err != nil || len(requests) != 1 {
+		t.Fatalf("Load of GET requests = %d requests, %v", len(requests), err)
+	}
+	if _, err := Load(writeFile(t, "post.jsonl", get+"\n"+post+"\n")); err == nil || !strings.Contains(err.Error(), "line 2 is a POST request") {
+		t.Errorf("Load of POST requests = %v, want it refused", err)
+	}
+}
+
+func TestReplaySkipsAlteredBodies(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+	}))
+	defer srv.Close()
+
+	path := writeFile(t, "capture.har", `{"log":{"version":"1.2","entries":[
+		{"startedDateTime":"2026-01-02T03:04:05Z",
+		 "request":{"method":"POST","url":"https://api.example.com/graphql","headers":[],"postData":{"mimeType":"application/json","text":"{\"id\":\"a1\"}"}},
+		 "response":{"status":200}},
+		{"startedDateTime":"2026-01-02T03:04:06Z",
+		 "request":{"method":"POST","url":"https://api.example.com/graphql","headers":[],"postData":{"mimeType":"application/json","text":"{\"id\"","comment":"body truncated from 11 bytes","_truncated":true}},
+		 "response":{"status":200}},
+		{"startedDateTime":"2026-01-02T03:04:07Z",
+		 "request":{"method":"POST","url":"https://api.example.com/graphql","headers":[],"postData":{"mimeType":"application/json","text":"{\"account\":\"REDACTED\"}","_redacted":true}},
+		 "response":{"status":200}}]}}`)
+	requests, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, _ := url.Parse(srv.URL)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	r := &Replayer{Target: target, Client: srv.Client(), Logger: logger}
+
+	summary := r.Run(requests)
+	if summary.Sent != 1 || summary.Skipped != 2 || summary.Failed != 0 || summary.Mismatch != 0 {
+		t.Errorf("summary = %+v, want 1 sent and 2 skipped", summary)
+	}
+	if len(bodies) != 1 || bodies[0] != `{"id":"a1"}` {
+		t.Errorf("bodies sent = %q, want only the whole one", bodies)
+	}
+}
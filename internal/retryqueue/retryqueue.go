@@ -0,0 +1,177 @@
+// Package retryqueue keeps orders that failed after all retries in a file,
+// so that later runs can try them again.
+package retryqueue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/atomicfile"
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// Queue is a JSONL file of failed orders. Failures are synced to the file
+// as they are added, so none are lost if the process crashes. All methods
+// are safe for concurrent use and safe to call on a nil receiver, which
+// disables the queue.
+type Queue struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	entries []models.Failure
+	// taken is the number of leading entries handed out by Take
+	taken int
+}
+
+// Open opens the queue at path, creating it if it does not exist
+func Open(path string) (*Queue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read retry queue: %w", err)
+	}
+
+	q := &Queue{path: path}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var f models.Failure
+		if err := json.Unmarshal(scanner.Bytes(), &f); err != nil {
+			return nil, fmt.Errorf("invalid retry queue entry on line %d: %w", line, err)
+		}
+		q.entries = append(q.entries, f)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read retry queue: %w", err)
+	}
+
+	if q.file, err = openAppend(path); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func openAppend(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open retry queue: %w", err)
+	}
+	return file, nil
+}
+
+// Path returns the path of the queue file
+func (q *Queue) Path() string {
+	return q.path
+}
+
+// Len returns the number of queued orders
+func (q *Queue) Len() int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// Take returns the queued orders for retrying. They stay in the file until
+// Commit, so they are retried again if the run does not get that far.
+func (q *Queue) Take() []models.Failure {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.taken = len(q.entries)
+	return append([]models.Failure(nil), q.entries...)
+}
+
+// Add queues a failed order. An order that is already queued, and was not
+// handed out by Take, is replaced, so each order is queued at most once.
+func (q *Queue) Add(f models.Failure) error {
+	if q == nil {
+		return nil
+	}
+	line, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("failed to encode retry queue entry: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := q.taken; i < len(q.entries); i++ {
+		if q.entries[i].Order.OrderID == f.Order.OrderID {
+			entries := append(q.entries[:i:i], q.entries[i+1:]...)
+			return q.rewrite(append(entries, f))
+		}
+	}
+	if _, err := q.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write retry queue: %w", err)
+	}
+	if err := q.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync retry queue: %w", err)
+	}
+	q.entries = append(q.entries, f)
+	return nil
+}
+
+// Commit removes the orders handed out by Take from the file, once they
+// have been retried. Orders that failed again were added back by then.
+func (q *Queue) Commit() error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.taken == 0 {
+		return nil
+	}
+	rest := append([]models.Failure(nil), q.entries[q.taken:]...)
+	q.taken = 0
+	return q.rewrite(rest)
+}
+
+// rewrite replaces the file with entries. It must be called with mu held.
+func (q *Queue) rewrite(entries []models.Failure) error {
+	var buf bytes.Buffer
+	for _, f := range entries {
+		line, err := json.Marshal(f)
+		if err != nil {
+			return fmt.Errorf("failed to encode retry queue entry: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := atomicfile.WriteFile(q.path, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to rewrite retry queue: %w", err)
+	}
+
+	// Later failures are appended to the new file
+	file, err := openAppend(q.path)
+	if err != nil {
+		return err
+	}
+	q.file.Close()
+	q.file = file
+	q.entries = entries
+	return nil
+}
+
+// Close closes the queue file
+func (q *Queue) Close() error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.file.Close()
+}
@@ -0,0 +1,267 @@
+// Package rules checks orders against business rules declared in a JSON
+// file, such as a positive quantity, a price band per symbol, or a
+// timestamp that is not in the future:
+//
+//	{
+//	  "rules": [
+//	    {"name": "positive quantity", "field": "quantity", "op": ">", "value": 0},
+//	    {"name": "TSLA price band", "symbols": ["TSLA"], "field": "price", "op": "between", "value": [100, 400]},
+//	    {"name": "not in the future", "field": "timestamp", "op": "<=", "value": "now+5m"}
+//	  ]
+//	}
+//
+// Fields are quantity, price, notional (quantity times price), and
+// timestamp. Numbers are compared exactly; times are RFC 3339 or "now",
+// optionally followed by a signed duration.
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// Fields rules can check
+const (
+	FieldQuantity  = "quantity"
+	FieldPrice     = "price"
+	FieldNotional  = "notional"
+	FieldTimestamp = "timestamp"
+)
+
+// Comparison operators
+const (
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpEqual        = "=="
+	OpNotEqual     = "!="
+	OpBetween      = "between"
+)
+
+// Rule is a condition orders must satisfy
+type Rule struct {
+	// Name identifies the rule in reject reasons
+	Name string `json:"name"`
+	// Symbols and Sides, if set, limit the rule to orders with these
+	// symbols and sides
+	Symbols []string `json:"symbols"`
+	Sides   []string `json:"sides"`
+	Field   string   `json:"field"`
+	Op      string   `json:"op"`
+	// Value is a number, or a time for the timestamp field, or for between
+	// a pair of them, the inclusive bounds
+	Value json.RawMessage `json:"value"`
+
+	// bounds holds the compared numbers, or times as Unix nanoseconds;
+	// where relative is set, the bound is an offset from now
+	bounds   []*big.Rat
+	relative []bool
+}
+
+// Set is a set of rules. All methods are safe to call on a nil receiver,
+// which has no rules.
+type Set struct {
+	Rules []*Rule `json:"rules"`
+}
+
+// Load reads and compiles a rules file
+func Load(path string) (*Set, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse compiles rules from JSON
+func Parse(data []byte) (*Set, error) {
+	var s Set
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("invalid rules file: %w", err)
+	}
+	for i, r := range s.Rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("invalid rule %q: %w", r.Name, err)
+		}
+	}
+	return &s, nil
+}
+
+// Len returns the number of rules
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.Rules)
+}
+
+// Check returns the reasons an order violates rules, comparing times with
+// now, or nil if it satisfies them all
+func (s *Set) Check(order models.Order, now time.Time) []string {
+	if s == nil {
+		return nil
+	}
+	var reasons []string
+	for _, r := range s.Rules {
+		if reason, ok := r.check(order, now); !ok {
+			reasons = append(reasons, reason)
+		}
+	}
+	return reasons
+}
+
+// compile parses the field, operator, and value of a rule
+func (r *Rule) compile() error {
+	switch r.Field {
+	case FieldQuantity, FieldPrice, FieldNotional, FieldTimestamp:
+	default:
+		return fmt.Errorf("unknown field %q: must be %s, %s, %s, or %s", r.Field, FieldQuantity, FieldPrice, FieldNotional, FieldTimestamp)
+	}
+
+	var values []json.RawMessage
+	switch r.Op {
+	case OpGreater, OpGreaterEqual, OpLess, OpLessEqual, OpEqual, OpNotEqual:
+		values = []json.RawMessage{r.Value}
+	case OpBetween:
+		if err := json.Unmarshal(r.Value, &values); err != nil || len(values) != 2 {
+			return fmt.Errorf("between needs a [min, max] value")
+		}
+	default:
+		return fmt.Errorf("unknown op %q: must be >, >=, <, <=, ==, !=, or between", r.Op)
+	}
+
+	for _, v := range values {
+		bound, relative, err := r.parseValue(v)
+		if err != nil {
+			return err
+		}
+		r.bounds = append(r.bounds, bound)
+		r.relative = append(r.relative, relative)
+	}
+	return nil
+}
+
+// parseValue parses a compared value. Times are returned as Unix
+// nanoseconds, or as nanoseconds from now if relative.
+func (r *Rule) parseValue(v json.RawMessage) (bound *big.Rat, relative bool, err error) {
+	if len(v) == 0 {
+		return nil, false, fmt.Errorf("value is required")
+	}
+	if r.Field != FieldTimestamp {
+		var d models.Decimal
+		if err := json.Unmarshal(v, &d); err != nil {
+			return nil, false, fmt.Errorf("value %s is not a number", v)
+		}
+		n, ok := d.Rat()
+		if !ok {
+			return nil, false, fmt.Errorf("value %s is not a number", v)
+		}
+		return n, false, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(v, &s); err != nil {
+		return nil, false, fmt.Errorf("value %s is not a time", v)
+	}
+	if rest, ok := strings.CutPrefix(s, "now"); ok {
+		var offset time.Duration
+		if rest != "" {
+			offset, err = time.ParseDuration(rest)
+			if err != nil || (rest[0] != '+' && rest[0] != '-') {
+				return nil, false, fmt.Errorf("invalid time %q: must be now followed by a signed duration, such as now-24h", s)
+			}
+		}
+		return big.NewRat(int64(offset), 1), true, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid time %q: must be RFC 3339 or now", s)
+	}
+	return big.NewRat(t.UnixNano(), 1), false, nil
+}
+
+// check checks an order against the rule, returning the reason if it is
+// violated
+func (r *Rule) check(order models.Order, now time.Time) (string, bool) {
+	if (len(r.Symbols) > 0 && !contains(r.Symbols, order.Symbol)) || (len(r.Sides) > 0 && !contains(r.Sides, order.Side)) {
+		return "", true
+	}
+
+	var value *big.Rat
+	var text string
+	exact := true
+	switch r.Field {
+	case FieldQuantity:
+		value, exact = order.Quantity.Rat()
+		text = order.Quantity.String()
+	case FieldPrice:
+		value, exact = order.Price.Rat()
+		text = order.Price.String()
+	case FieldNotional:
+		if value, exact = order.Notional(); exact {
+			text = strings.TrimSuffix(strings.TrimRight(value.FloatString(20), "0"), ".")
+		}
+	case FieldTimestamp:
+		// An order without a timestamp cannot satisfy a rule on it
+		if order.Timestamp.IsZero() {
+			return fmt.Sprintf("%s: timestamp is missing", r.Name), false
+		}
+		value, text = big.NewRat(order.Timestamp.UnixNano(), 1), order.Timestamp.Format(time.RFC3339)
+	}
+	// Nor can an order whose value is not an exact number
+	if !exact {
+		return fmt.Sprintf("%s: %s is not an exact number", r.Name, r.Field), false
+	}
+
+	bounds := make([]*big.Rat, len(r.bounds))
+	for i, b := range r.bounds {
+		bounds[i] = b
+		if r.relative[i] {
+			bounds[i] = new(big.Rat).Add(b, big.NewRat(now.UnixNano(), 1))
+		}
+	}
+
+	var ok bool
+	switch r.Op {
+	case OpGreater:
+		ok = value.Cmp(bounds[0]) > 0
+	case OpGreaterEqual:
+		ok = value.Cmp(bounds[0]) >= 0
+	case OpLess:
+		ok = value.Cmp(bounds[0]) < 0
+	case OpLessEqual:
+		ok = value.Cmp(bounds[0]) <= 0
+	case OpEqual:
+		ok = value.Cmp(bounds[0]) == 0
+	case OpNotEqual:
+		ok = value.Cmp(bounds[0]) != 0
+	case OpBetween:
+		ok = value.Cmp(bounds[0]) >= 0 && value.Cmp(bounds[1]) <= 0
+	}
+	if ok {
+		return "", true
+	}
+	return fmt.Sprintf("%s: %s %s must be %s %s", r.Name, r.Field, text, r.Op, r.Value), false
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
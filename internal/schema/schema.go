@@ -0,0 +1,372 @@
+// Package schema validates input records against a JSON Schema.
+//
+// The commonly used subset of draft 7 is supported: type, enum, const,
+// properties, required, additionalProperties, items, minItems, maxItems,
+// minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf,
+// minLength, maxLength, pattern, format (date-time), allOf, anyOf, oneOf,
+// and not. Other keywords are ignored.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Schema is a compiled JSON Schema
+type Schema struct {
+	Type                 typeList           `json:"type"`
+	Enum                 []interface{}      `json:"enum"`
+	Const                *interface{}       `json:"const"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *additional        `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	Minimum              *json.Number       `json:"minimum"`
+	Maximum              *json.Number       `json:"maximum"`
+	ExclusiveMinimum     *json.Number       `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *json.Number       `json:"exclusiveMaximum"`
+	MultipleOf           *json.Number       `json:"multipleOf"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Pattern              string             `json:"pattern"`
+	Format               string             `json:"format"`
+	AllOf                []*Schema          `json:"allOf"`
+	AnyOf                []*Schema          `json:"anyOf"`
+	OneOf                []*Schema          `json:"oneOf"`
+	Not                  *Schema            `json:"not"`
+
+	pattern *regexp.Regexp
+}
+
+// typeList accepts either a single type name or a list of them
+type typeList []string
+
+func (t *typeList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = typeList{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings")
+	}
+	*t = list
+	return nil
+}
+
+// additional is additionalProperties, which is a boolean or a schema
+type additional struct {
+	allowed bool
+	schema  *Schema
+}
+
+func (a *additional) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.allowed); err == nil {
+		return nil
+	}
+	a.allowed = true
+	return json.Unmarshal(data, &a.schema)
+}
+
+// ValidationError lists every violation found in a record
+type ValidationError struct {
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Violations, "; ")
+}
+
+// Load reads and compiles the schema at path
+func Load(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var s Schema
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %w", path, err)
+	}
+	if err := s.compile(); err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// compile prepares regular expressions throughout the schema
+func (s *Schema) compile() error {
+	if s == nil {
+		return nil
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+
+	children := []*Schema{s.Items, s.Not}
+	for _, p := range s.Properties {
+		children = append(children, p)
+	}
+	if s.AdditionalProperties != nil {
+		children = append(children, s.AdditionalProperties.schema)
+	}
+	children = append(children, s.AllOf...)
+	children = append(children, s.AnyOf...)
+	children = append(children, s.OneOf...)
+	for _, c := range children {
+		if err := c.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks a decoded JSON value against the schema. Numbers must be
+// decoded as json.Number. It returns a *ValidationError describing every
+// violation, or nil if the value is valid.
+func (s *Schema) Validate(v interface{}) error {
+	var violations []string
+	s.validate("", v, &violations)
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// validate appends the violations of v at path to out
+func (s *Schema) validate(path string, v interface{}, out *[]string) {
+	fail := func(format string, args ...interface{}) {
+		at := path
+		if at == "" {
+			at = "record"
+		}
+		*out = append(*out, at+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(s.Type) > 0 && !s.matchesType(v) {
+		fail("must be of type %s, got %s", strings.Join(s.Type, " or "), typeOf(v))
+		return
+	}
+	if s.Const != nil && !equal(v, *s.Const) {
+		fail("must be %s", encode(*s.Const))
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if equal(v, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %s", encode(s.Enum))
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		s.validateObject(path, v, out, fail)
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, out)
+			}
+		}
+	case json.Number:
+		s.validateNumber(v, fail)
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("must be at most %d characters", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match pattern %q", s.Pattern)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+				fail("must be an RFC 3339 date-time")
+			}
+		}
+	}
+
+	for _, sub := range s.AllOf {
+		sub.validate(path, v, out)
+	}
+	if len(s.AnyOf) > 0 && countValid(s.AnyOf, v) == 0 {
+		fail("must match at least one schema in anyOf")
+	}
+	if len(s.OneOf) > 0 {
+		if n := countValid(s.OneOf, v); n != 1 {
+			fail("must match exactly one schema in oneOf, matched %d", n)
+		}
+	}
+	if s.Not != nil && s.Not.Validate(v) == nil {
+		fail("must not match the schema in not")
+	}
+}
+
+// validateObject checks object keywords
+func (s *Schema) validateObject(path string, v map[string]interface{}, out *[]string, fail func(string, ...interface{})) {
+	for _, name := range s.Required {
+		if _, ok := v[name]; !ok {
+			*out = append(*out, join(path, name)+": is required")
+		}
+	}
+
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if prop, ok := s.Properties[name]; ok {
+			prop.validate(join(path, name), v[name], out)
+			continue
+		}
+		if s.AdditionalProperties == nil {
+			continue
+		}
+		if !s.AdditionalProperties.allowed {
+			*out = append(*out, join(path, name)+": is not allowed")
+		} else if s.AdditionalProperties.schema != nil {
+			s.AdditionalProperties.schema.validate(join(path, name), v[name], out)
+		}
+	}
+}
+
+// validateNumber checks numeric keywords using exact arithmetic
+func (s *Schema) validateNumber(v json.Number, fail func(string, ...interface{})) {
+	n, ok := new(big.Rat).SetString(v.String())
+	if !ok {
+		return
+	}
+	cmp := func(limit *json.Number) (int, bool) {
+		if limit == nil {
+			return 0, false
+		}
+		l, ok := new(big.Rat).SetString(limit.String())
+		if !ok {
+			return 0, false
+		}
+		return n.Cmp(l), true
+	}
+
+	if c, ok := cmp(s.Minimum); ok && c < 0 {
+		fail("must be >= %s", s.Minimum)
+	}
+	if c, ok := cmp(s.Maximum); ok && c > 0 {
+		fail("must be <= %s", s.Maximum)
+	}
+	if c, ok := cmp(s.ExclusiveMinimum); ok && c <= 0 {
+		fail("must be > %s", s.ExclusiveMinimum)
+	}
+	if c, ok := cmp(s.ExclusiveMaximum); ok && c >= 0 {
+		fail("must be < %s", s.ExclusiveMaximum)
+	}
+	if s.MultipleOf != nil {
+		if m, ok := new(big.Rat).SetString(s.MultipleOf.String()); ok && m.Sign() != 0 {
+			if !new(big.Rat).Quo(n, m).IsInt() {
+				fail("must be a multiple of %s", s.MultipleOf)
+			}
+		}
+	}
+}
+
+// matchesType reports whether v is one of the schema's types
+func (s *Schema) matchesType(v interface{}) bool {
+	actual := typeOf(v)
+	for _, t := range s.Type {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the JSON Schema type name of a decoded value
+func typeOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if r, ok := new(big.Rat).SetString(v.String()); ok && r.IsInt() {
+			return "integer"
+		}
+		return "number"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// countValid returns how many of the schemas v is valid against
+func countValid(schemas []*Schema, v interface{}) int {
+	n := 0
+	for _, s := range schemas {
+		if s.Validate(v) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// equal compares decoded JSON values, treating numbers by value
+func equal(a, b interface{}) bool {
+	an, aok := a.(json.Number)
+	bn, bok := b.(json.Number)
+	if aok && bok {
+		ar, ok1 := new(big.Rat).SetString(an.String())
+		br, ok2 := new(big.Rat).SetString(bn.String())
+		return ok1 && ok2 && ar.Cmp(br) == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// join appends a property name to a path
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// encode renders a value for an error message
+func encode(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,136 @@
+// Package sentry implements a minimal client for reporting events to Sentry
+// through its HTTP store endpoint.
+package sentry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Level is the severity of a reported event
+type Level string
+
+const (
+	LevelError Level = "error"
+	LevelFatal Level = "fatal"
+)
+
+// Client sends events to a single Sentry project
+type Client struct {
+	endpoint   string
+	publicKey  string
+	serverName string
+	httpClient *http.Client
+}
+
+// event is the subset of the Sentry event payload used by this client
+type event struct {
+	EventID    string                 `json:"event_id"`
+	Timestamp  string                 `json:"timestamp"`
+	Level      Level                  `json:"level"`
+	Platform   string                 `json:"platform"`
+	Logger     string                 `json:"logger"`
+	ServerName string                 `json:"server_name,omitempty"`
+	Message    string                 `json:"message,omitempty"`
+	Exception  []exception            `json:"exception,omitempty"`
+	Tags       map[string]string      `json:"tags,omitempty"`
+	Extra      map[string]interface{} `json:"extra,omitempty"`
+}
+
+type exception struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// New creates a client from a DSN of the form https://<key>@<host>/<project>
+func New(dsn string) (*Client, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sentry DSN: %w", err)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("invalid sentry DSN: missing public key")
+	}
+
+	path := strings.Trim(u.Path, "/")
+	idx := strings.LastIndex(path, "/")
+	prefix, project := "", path
+	if idx >= 0 {
+		prefix, project = "/"+path[:idx], path[idx+1:]
+	}
+	if project == "" {
+		return nil, fmt.Errorf("invalid sentry DSN: missing project ID")
+	}
+
+	hostname, _ := os.Hostname()
+	return &Client{
+		endpoint:   fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, project),
+		publicKey:  u.User.Username(),
+		serverName: hostname,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}, nil
+}
+
+// CaptureError reports an error with the given tags and extra context
+func (c *Client) CaptureError(err error, level Level, tags map[string]string, extra map[string]interface{}) error {
+	return c.send(event{
+		Level:     level,
+		Exception: []exception{{Type: fmt.Sprintf("%T", err), Value: err.Error()}},
+		Tags:      tags,
+		Extra:     extra,
+	})
+}
+
+// CapturePanic reports a recovered panic value along with its stack trace
+func (c *Client) CapturePanic(value interface{}, stack []byte) error {
+	return c.send(event{
+		Level:     LevelFatal,
+		Exception: []exception{{Type: "panic", Value: fmt.Sprint(value)}},
+		Extra:     map[string]interface{}{"stacktrace": string(stack)},
+	})
+}
+
+// send fills in the common event fields and posts the event to Sentry
+func (c *Client) send(ev event) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Errorf("failed to generate event ID: %w", err)
+	}
+	ev.EventID = hex.EncodeToString(id)
+	ev.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	ev.Platform = "go"
+	ev.Logger = "order-processor"
+	ev.ServerName = c.serverName
+
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to encode sentry event: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create sentry request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf(
+		"Sentry sentry_version=7, sentry_client=order-processor/1.0, sentry_key=%s", c.publicKey))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send sentry event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("sentry rejected event: %d", resp.StatusCode)
+	}
+	return nil
+}
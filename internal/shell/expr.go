@@ -0,0 +1,174 @@
+package shell
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// operators in the order they are looked for in a term, so that >= is not
+// taken for >
+var operators = []string{">=", "<=", "!=", "=", ">", "<", "~"}
+
+// term is one field comparison of an expression
+type term struct {
+	field  string
+	op     string
+	values []string
+	// numbers and times hold the parsed values of numeric and timestamp
+	// fields
+	numbers []*big.Rat
+	times   []time.Time
+}
+
+// Expr is a filter expression: whitespace-separated terms such as
+// symbol=TSLA,AAPL price>200 account~ACME, all of which must match
+type Expr []term
+
+// Parse parses a filter expression. Each term is a field, an operator (=,
+// !=, >, >=, <, <=, or ~ for contains), and a value; = and != take a
+// comma-separated list of values. quantity, price, and notional (quantity
+// times price) are compared as numbers, timestamp as a time, and other
+// order or extra fields as text.
+func Parse(s string) (Expr, error) {
+	var expr Expr
+	for _, text := range strings.Fields(s) {
+		t, err := parseTerm(text)
+		if err != nil {
+			return nil, err
+		}
+		expr = append(expr, t)
+	}
+	if len(expr) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	return expr, nil
+}
+
+func parseTerm(text string) (term, error) {
+	for _, op := range operators {
+		field, value, ok := strings.Cut(text, op)
+		if !ok {
+			continue
+		}
+		if field == "" {
+			return term{}, fmt.Errorf("invalid term %q: missing field", text)
+		}
+		t := term{field: field, op: op, values: []string{value}}
+		if op == "=" || op == "!=" {
+			t.values = strings.Split(value, ",")
+		}
+		for _, v := range t.values {
+			switch field {
+			case "quantity", "price", "notional":
+				d, err := models.NewDecimal(v)
+				if err != nil {
+					return term{}, fmt.Errorf("invalid term %q: %s is not a number", text, v)
+				}
+				n, ok := d.Rat()
+				if !ok {
+					return term{}, fmt.Errorf("invalid term %q: %s is not a number", text, v)
+				}
+				t.numbers = append(t.numbers, n)
+			case "timestamp":
+				ts, err := models.ParseTimestamp(v)
+				if err != nil {
+					return term{}, fmt.Errorf("invalid term %q: %w", text, err)
+				}
+				t.times = append(t.times, ts)
+			}
+		}
+		if op == "~" && (t.numbers != nil || t.times != nil) {
+			return term{}, fmt.Errorf("invalid term %q: ~ only applies to text fields", text)
+		}
+		return t, nil
+	}
+	return term{}, fmt.Errorf("invalid term %q: expected field, operator (=, !=, >, >=, <, <=, ~), and value", text)
+}
+
+// Match reports whether an order matches every term
+func (e Expr) Match(order models.Order) bool {
+	for _, t := range e {
+		if !t.match(order) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t term) match(order models.Order) bool {
+	var cmps []int
+	switch {
+	case t.numbers != nil:
+		var value *big.Rat
+		var ok bool
+		switch t.field {
+		case "quantity":
+			value, ok = order.Quantity.Rat()
+		case "price":
+			value, ok = order.Price.Rat()
+		default:
+			value, ok = order.Notional()
+		}
+		// A value without an exact number matches no comparison
+		if !ok {
+			return false
+		}
+		for _, n := range t.numbers {
+			cmps = append(cmps, value.Cmp(n))
+		}
+	case t.times != nil:
+		for _, ts := range t.times {
+			cmps = append(cmps, order.Timestamp.Compare(ts))
+		}
+	default:
+		value, ok := order.Field(t.field)
+		if !ok {
+			// A missing field only matches !=
+			return t.op == "!="
+		}
+		if t.op == "~" {
+			return strings.Contains(strings.ToLower(value), strings.ToLower(t.values[0]))
+		}
+		for _, v := range t.values {
+			cmps = append(cmps, strings.Compare(value, v))
+		}
+	}
+
+	switch t.op {
+	case "=":
+		for _, c := range cmps {
+			if c == 0 {
+				return true
+			}
+		}
+		return false
+	case "!=":
+		for _, c := range cmps {
+			if c == 0 {
+				return false
+			}
+		}
+		return true
+	case ">":
+		return cmps[0] > 0
+	case ">=":
+		return cmps[0] >= 0
+	case "<":
+		return cmps[0] < 0
+	default:
+		return cmps[0] <= 0
+	}
+}
+
+// String writes the expression back as text
+func (e Expr) String() string {
+	parts := make([]string, len(e))
+	for i, t := range e {
+		parts[i] = t.field + t.op + strings.Join(t.values, ",")
+	}
+	return strings.Join(parts, " ")
+}
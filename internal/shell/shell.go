@@ -0,0 +1,154 @@
+// Package shell is an interactive prompt for exploring the orders of an
+// input loaded once: narrowing them down with filter expressions, previewing
+// and totaling the matches, and processing the current selection.
+package shell
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/aggregate"
+	"github.com/fauzanelka/99tech-order-processor/internal/models"
+)
+
+// defaultShow is the number of orders show prints without a count
+const defaultShow = 10
+
+const help = `Commands:
+  filter <expr>   Narrow the selection to orders matching every term, e.g.
+                  filter symbol=TSLA,AAPL side=sell price>200 account~acme
+                  Operators: = != > >= < <= ~ (contains); = and != take
+                  comma-separated values
+  reset           Select all orders again
+  count           Print the number of selected orders
+  show [n]        Print the first n selected orders (default 10)
+  stats           Total the selected orders by symbol and side
+  process         Process the selected orders, after confirmation
+  help            Print this help
+  quit            Leave the shell
+`
+
+// Shell holds the loaded orders and the current selection
+type Shell struct {
+	orders    []models.Order
+	selection []models.Order
+	filters   []Expr
+	process   func([]models.Order) error
+}
+
+// New creates a shell over orders, with all of them selected. process is
+// called with the selection by the process command.
+func New(orders []models.Order, process func([]models.Order) error) *Shell {
+	return &Shell{orders: orders, selection: orders, process: process}
+}
+
+// Run reads commands from in and writes their output to out until quit or
+// the end of in
+func (s *Shell) Run(in io.Reader, out io.Writer) error {
+	lines := bufio.NewScanner(in)
+	fmt.Fprintf(out, "Loaded %d orders. Type help for commands.\n", len(s.orders))
+	for {
+		fmt.Fprint(out, s.prompt())
+		if !lines.Scan() {
+			fmt.Fprintln(out)
+			return lines.Err()
+		}
+		cmd, args, _ := strings.Cut(strings.TrimSpace(lines.Text()), " ")
+		args = strings.TrimSpace(args)
+		switch cmd {
+		case "":
+		case "help", "?":
+			fmt.Fprint(out, help)
+		case "quit", "exit":
+			return nil
+		case "filter", "where":
+			expr, err := Parse(args)
+			if err != nil {
+				fmt.Fprintf(out, "Error: %v\n", err)
+				continue
+			}
+			var matched []models.Order
+			for _, order := range s.selection {
+				if expr.Match(order) {
+					matched = append(matched, order)
+				}
+			}
+			s.selection = matched
+			s.filters = append(s.filters, expr)
+			fmt.Fprintf(out, "%d orders selected\n", len(s.selection))
+		case "reset":
+			s.selection, s.filters = s.orders, nil
+			fmt.Fprintf(out, "%d orders selected\n", len(s.selection))
+		case "count":
+			fmt.Fprintf(out, "%d orders selected\n", len(s.selection))
+		case "show":
+			n := defaultShow
+			if args != "" {
+				var err error
+				if n, err = strconv.Atoi(args); err != nil || n < 1 {
+					fmt.Fprintf(out, "Error: invalid count %q\n", args)
+					continue
+				}
+			}
+			s.show(out, n)
+		case "stats":
+			agg, _ := aggregate.New([]string{aggregate.BySymbol, aggregate.BySide})
+			for _, order := range s.selection {
+				agg.Add(order)
+			}
+			if err := agg.Write(out, aggregate.FormatCSV); err != nil {
+				fmt.Fprintf(out, "Error: %v\n", err)
+			}
+		case "process":
+			if len(s.selection) == 0 {
+				fmt.Fprintln(out, "No orders selected")
+				continue
+			}
+			fmt.Fprintf(out, "Process %d orders? [y/N] ", len(s.selection))
+			if !lines.Scan() {
+				fmt.Fprintln(out)
+				return lines.Err()
+			}
+			if answer := strings.ToLower(strings.TrimSpace(lines.Text())); answer != "y" && answer != "yes" {
+				fmt.Fprintln(out, "Cancelled")
+				continue
+			}
+			if err := s.process(s.selection); err != nil {
+				fmt.Fprintf(out, "Error: %v\n", err)
+			}
+		default:
+			fmt.Fprintf(out, "Unknown command %q; type help for commands\n", cmd)
+		}
+	}
+}
+
+// prompt shows the filters applied to the selection
+func (s *Shell) prompt() string {
+	if len(s.filters) == 0 {
+		return "orders> "
+	}
+	parts := make([]string, len(s.filters))
+	for i, f := range s.filters {
+		parts[i] = f.String()
+	}
+	return fmt.Sprintf("orders[%s]> ", strings.Join(parts, " "))
+}
+
+// show prints the first n selected orders as JSON lines
+func (s *Shell) show(out io.Writer, n int) {
+	for _, order := range s.selection[:min(n, len(s.selection))] {
+		line, err := json.Marshal(order)
+		if err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+			return
+		}
+		fmt.Fprintf(out, "%s\n", line)
+	}
+	if more := len(s.selection) - n; more > 0 {
+		fmt.Fprintf(out, "... %d more\n", more)
+	}
+}
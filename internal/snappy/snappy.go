@@ -0,0 +1,78 @@
+// Package snappy decodes Snappy-compressed blocks, as used by Parquet pages
+// and Avro container files.
+package snappy
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Decode decodes a raw (unframed) Snappy block
+func Decode(src []byte) ([]byte, error) {
+	n, k := binary.Uvarint(src)
+	if k <= 0 || n > uint64(len(src))*256 {
+		return nil, fmt.Errorf("invalid snappy header")
+	}
+	dst := make([]byte, 0, n)
+	s := k
+	for s < len(src) {
+		tag := src[s]
+		var length, offset int
+		switch tag & 3 {
+		case 0:
+			// Literal, with its length in the tag or the following 1-4 bytes
+			length = int(tag >> 2)
+			s++
+			if length >= 60 {
+				extra := length - 59
+				if s+extra > len(src) {
+					return nil, fmt.Errorf("corrupt snappy data")
+				}
+				length = 0
+				for i := 0; i < extra; i++ {
+					length |= int(src[s+i]) << (8 * i)
+				}
+				s += extra
+			}
+			length++
+			if length <= 0 || s+length > len(src) {
+				return nil, fmt.Errorf("corrupt snappy data")
+			}
+			dst = append(dst, src[s:s+length]...)
+			s += length
+			continue
+		case 1:
+			if s+2 > len(src) {
+				return nil, fmt.Errorf("corrupt snappy data")
+			}
+			length = 4 + int(tag>>2)&7
+			offset = int(tag&0xe0)<<3 | int(src[s+1])
+			s += 2
+		case 2:
+			if s+3 > len(src) {
+				return nil, fmt.Errorf("corrupt snappy data")
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[s+1:]))
+			s += 3
+		case 3:
+			if s+5 > len(src) {
+				return nil, fmt.Errorf("corrupt snappy data")
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[s+1:]))
+			s += 5
+		}
+		// Copies may overlap their own output, so they go byte by byte
+		if offset <= 0 || offset > len(dst) || uint64(len(dst)+length) > n {
+			return nil, fmt.Errorf("corrupt snappy data")
+		}
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+	if uint64(len(dst)) != n {
+		return nil, fmt.Errorf("corrupt snappy data")
+	}
+	return dst, nil
+}
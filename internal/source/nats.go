@@ -0,0 +1,481 @@
+package source
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// natsPullWait is how long a pull request waits for a message
+	natsPullWait = 5 * time.Second
+	// natsProgressEvery is how often in-flight messages are reported as in
+	// progress, well within the default 30s ack wait
+	natsProgressEvery = 10 * time.Second
+	// natsRequestTimeout bounds JetStream API requests
+	natsRequestTimeout = 10 * time.Second
+	// natsMaxPayload bounds a message, well above the server's own limit
+	natsMaxPayload = 64 << 20
+)
+
+// NATSOptions configures a JetStream source
+type NATSOptions struct {
+	// URL is nats://[user:pass@|token@]host:port; tls:// requires TLS
+	URL string
+	// Stream is the JetStream stream holding the order events
+	Stream string
+	// Consumer is the durable pull consumer, created if it does not exist
+	Consumer string
+	// Subject filters the stream to matching subjects when non-empty
+	Subject string
+	// MaxDeliver limits deliveries of each message when positive
+	MaxDeliver int
+	// Insecure skips TLS certificate verification
+	Insecure bool
+}
+
+// NATS receives orders from a JetStream durable pull consumer. Messages are
+// acknowledged with +ACK and returned with -NAK.
+type NATS struct {
+	opts  NATSOptions
+	conn  net.Conn
+	inbox string
+
+	mu   sync.Mutex // guards writes to conn and seq
+	seq  int
+	msgs chan natsMsg
+
+	dead    chan struct{}
+	deadErr error
+	once    sync.Once
+}
+
+// natsMsg is a message delivered to a subscription
+type natsMsg struct {
+	sid    string
+	reply  string
+	status string
+	data   []byte
+}
+
+// natsPending tracks an unsettled message
+type natsPending struct {
+	reply string
+	stop  chan struct{}
+}
+
+// DialNATS connects to the server and ensures the consumer exists
+func DialNATS(opts NATSOptions) (*NATS, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid NATS URL: %q", opts.URL)
+	}
+	if opts.Stream == "" || opts.Consumer == "" {
+		return nil, fmt.Errorf("NATS stream and consumer are required")
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, natsRequestTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	n, err := handshake(conn, u, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := n.createConsumer(); err != nil {
+		n.Close()
+		return nil, err
+	}
+	return n, nil
+}
+
+// handshake exchanges INFO and CONNECT, upgrading to TLS when required, and
+// starts reading messages
+func handshake(conn net.Conn, u *url.URL, opts NATSOptions) (*NATS, error) {
+	conn.SetDeadline(time.Now().Add(natsRequestTimeout))
+	r := bufio.NewReader(conn)
+	line, err := readLine(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NATS server info: %w", err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return nil, fmt.Errorf("unexpected NATS greeting: %q", line)
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+		Headers     bool `json:"headers"`
+	}
+	if err := json.Unmarshal([]byte(line[5:]), &info); err != nil {
+		return nil, fmt.Errorf("invalid NATS server info: %w", err)
+	}
+	if !info.Headers {
+		return nil, fmt.Errorf("NATS server does not support headers, which JetStream requires")
+	}
+
+	if info.TLSRequired || u.Scheme == "tls" {
+		tconn := tls.Client(conn, &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: opts.Insecure})
+		if err := tconn.Handshake(); err != nil {
+			return nil, fmt.Errorf("NATS TLS handshake failed: %w", err)
+		}
+		conn = tconn
+		r = bufio.NewReader(conn)
+	}
+
+	connect := map[string]interface{}{
+		"verbose":       false,
+		"pedantic":      false,
+		"name":          "order-processor",
+		"lang":          "go",
+		"protocol":      1,
+		"headers":       true,
+		"no_responders": true,
+	}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			connect["user"] = u.User.Username()
+			connect["pass"] = pass
+		} else {
+			connect["auth_token"] = u.User.Username()
+		}
+	}
+	payload, _ := json.Marshal(connect)
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", payload); err != nil {
+		return nil, fmt.Errorf("failed to send NATS connect: %w", err)
+	}
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+		}
+		if line == "PONG" {
+			break
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			return nil, fmt.Errorf("NATS rejected connection: %s", strings.TrimSpace(line[4:]))
+		}
+	}
+	conn.SetDeadline(time.Time{})
+
+	n := &NATS{
+		opts:  opts,
+		conn:  conn,
+		inbox: "_INBOX." + randomToken(),
+		msgs:  make(chan natsMsg, 16),
+		dead:  make(chan struct{}),
+	}
+	go n.readLoop(r)
+	return n, nil
+}
+
+// createConsumer creates the durable pull consumer, which is a no-op when it
+// already exists with the same configuration
+func (n *NATS) createConsumer() error {
+	config := map[string]interface{}{
+		"durable_name":   n.opts.Consumer,
+		"ack_policy":     "explicit",
+		"deliver_policy": "all",
+	}
+	if n.opts.Subject != "" {
+		config["filter_subject"] = n.opts.Subject
+	}
+	if n.opts.MaxDeliver > 0 {
+		config["max_deliver"] = n.opts.MaxDeliver
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"stream_name": n.opts.Stream,
+		"config":      config,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsRequestTimeout)
+	defer cancel()
+	m, err := n.request(ctx, "$JS.API.CONSUMER.DURABLE.CREATE."+n.opts.Stream+"."+n.opts.Consumer, payload)
+	if err != nil {
+		return fmt.Errorf("failed to create NATS consumer: %w", err)
+	}
+	if m.status == "503" {
+		return fmt.Errorf("failed to create NATS consumer: JetStream is not enabled")
+	}
+
+	var resp struct {
+		Error *struct {
+			Code        int    `json:"code"`
+			Description string `json:"description"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(m.data, &resp); err != nil {
+		return fmt.Errorf("invalid JetStream response: %w", err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("failed to create NATS consumer: %s (%d)", resp.Error.Description, resp.Error.Code)
+	}
+	return nil
+}
+
+// Receive pulls the next message from the consumer
+func (n *NATS) Receive(ctx context.Context) (*Message, error) {
+	subject := "$JS.API.CONSUMER.MSG.NEXT." + n.opts.Stream + "." + n.opts.Consumer
+	payload := []byte(fmt.Sprintf(`{"batch":1,"expires":%d}`, natsPullWait.Nanoseconds()))
+	for {
+		wait, cancel := context.WithTimeout(ctx, natsPullWait+natsRequestTimeout)
+		m, err := n.request(wait, subject, payload)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				continue
+			}
+			return nil, err
+		}
+
+		switch m.status {
+		case "":
+		case "404", "408", "100":
+			// No messages before the request expired
+			continue
+		case "503":
+			return nil, fmt.Errorf("JetStream is not available")
+		default:
+			return nil, fmt.Errorf("NATS pull failed with status %s", m.status)
+		}
+
+		pending := &natsPending{reply: m.reply, stop: make(chan struct{})}
+		go n.progress(pending)
+		id, attempt := parseAckSubject(m.reply)
+		return &Message{ID: id, Data: m.data, Attempt: attempt, ack: pending}, nil
+	}
+}
+
+// progress tells the server the message is still being worked on, so it is
+// not redelivered while a slow request is in flight
+func (n *NATS) progress(p *natsPending) {
+	ticker := time.NewTicker(natsProgressEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-n.dead:
+			return
+		case <-ticker.C:
+			n.publish(p.reply, []byte("+WPI"))
+		}
+	}
+}
+
+// Ack acknowledges a message
+func (n *NATS) Ack(msg *Message) error {
+	return n.settle(msg, "+ACK")
+}
+
+// Nak asks the server to redeliver a message
+func (n *NATS) Nak(msg *Message) error {
+	return n.settle(msg, "-NAK")
+}
+
+func (n *NATS) settle(msg *Message, ack string) error {
+	p := msg.ack.(*natsPending)
+	close(p.stop)
+	if err := n.publish(p.reply, []byte(ack)); err != nil {
+		return fmt.Errorf("failed to settle NATS message %s: %w", msg.ID, err)
+	}
+	return nil
+}
+
+// Close closes the connection
+func (n *NATS) Close() error {
+	n.fail(io.EOF)
+	return n.conn.Close()
+}
+
+// request publishes payload to subject and waits for the reply. Each request
+// uses its own inbox subscription, since JetStream delivers messages under
+// their original subject.
+func (n *NATS) request(ctx context.Context, subject string, payload []byte) (natsMsg, error) {
+	n.mu.Lock()
+	n.seq++
+	sid := strconv.Itoa(n.seq)
+	n.mu.Unlock()
+	reply := n.inbox + "." + sid
+
+	if err := n.write(fmt.Sprintf("SUB %s %s\r\n", reply, sid)); err != nil {
+		return natsMsg{}, err
+	}
+	defer n.write(fmt.Sprintf("UNSUB %s\r\n", sid))
+	if err := n.publishReply(subject, reply, payload); err != nil {
+		return natsMsg{}, err
+	}
+	for {
+		select {
+		case m := <-n.msgs:
+			// Replies to earlier, abandoned requests are dropped; JetStream
+			// redelivers any message they carried once its ack wait expires
+			if m.sid == sid {
+				return m, nil
+			}
+		case <-n.dead:
+			return natsMsg{}, fmt.Errorf("NATS connection lost: %w", n.deadErr)
+		case <-ctx.Done():
+			return natsMsg{}, ctx.Err()
+		}
+	}
+}
+
+func (n *NATS) publish(subject string, payload []byte) error {
+	return n.publishReply(subject, "", payload)
+}
+
+func (n *NATS) publishReply(subject, reply string, payload []byte) error {
+	cmd := "PUB " + subject
+	if reply != "" {
+		cmd += " " + reply
+	}
+	return n.write(fmt.Sprintf("%s %d\r\n%s\r\n", cmd, len(payload), payload))
+}
+
+func (n *NATS) write(s string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, err := io.WriteString(n.conn, s); err != nil {
+		return fmt.Errorf("failed to write to NATS: %w", err)
+	}
+	return nil
+}
+
+// readLoop reads protocol messages until the connection fails
+func (n *NATS) readLoop(r *bufio.Reader) {
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			n.fail(err)
+			return
+		}
+
+		switch {
+		case line == "PING":
+			n.write("PONG\r\n")
+		case strings.HasPrefix(line, "-ERR"):
+			n.fail(fmt.Errorf("server error: %s", strings.TrimSpace(line[4:])))
+			return
+		case strings.HasPrefix(line, "MSG "), strings.HasPrefix(line, "HMSG "):
+			m, err := readMsg(r, line)
+			if err != nil {
+				n.fail(err)
+				return
+			}
+			select {
+			case n.msgs <- m:
+			case <-n.dead:
+				return
+			}
+		}
+	}
+}
+
+// fail records the first connection error and wakes all waiters
+func (n *NATS) fail(err error) {
+	n.once.Do(func() {
+		n.deadErr = err
+		close(n.dead)
+	})
+}
+
+// readMsg reads the payload of a MSG or HMSG line
+func readMsg(r *bufio.Reader, line string) (natsMsg, error) {
+	headers := strings.HasPrefix(line, "HMSG ")
+	args := strings.Fields(line)[1:]
+
+	// MSG <subject> <sid> [reply] <size>
+	// HMSG <subject> <sid> [reply] <header size> <total size>
+	want := 3
+	if headers {
+		want = 4
+	}
+	if len(args) != want && len(args) != want+1 {
+		return natsMsg{}, fmt.Errorf("malformed message line: %q", line)
+	}
+	m := natsMsg{sid: args[1]}
+	if len(args) == want+1 {
+		m.reply = args[2]
+	}
+	total, err := strconv.Atoi(args[len(args)-1])
+	if err != nil || total < 0 || total > natsMaxPayload {
+		return natsMsg{}, fmt.Errorf("malformed message line: %q", line)
+	}
+	hdrLen := 0
+	if headers {
+		if hdrLen, err = strconv.Atoi(args[len(args)-2]); err != nil || hdrLen < 0 || hdrLen > total {
+			return natsMsg{}, fmt.Errorf("malformed message line: %q", line)
+		}
+	}
+
+	buf := make([]byte, total+2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return natsMsg{}, err
+	}
+	if string(buf[total:]) != "\r\n" {
+		return natsMsg{}, fmt.Errorf("malformed message: payload is not %d bytes", total)
+	}
+	if headers {
+		m.status = parseStatus(string(buf[:hdrLen]))
+	}
+	m.data = buf[hdrLen:total]
+	return m, nil
+}
+
+// parseStatus returns the status code from a header block such as
+// "NATS/1.0 404 No Messages"
+func parseStatus(header string) string {
+	first := strings.SplitN(header, "\r\n", 2)[0]
+	fields := strings.Fields(first)
+	if len(fields) < 2 {
+		return ""
+	}
+	return fields[1]
+}
+
+// parseAckSubject extracts the stream sequence and delivery count from a
+// JetStream ack subject. Both the original layout
+// $JS.ACK.<stream>.<consumer>.<delivered>.<sseq>.<cseq>.<ts>.<pending> and
+// the one with domain and account hash tokens are handled.
+func parseAckSubject(subject string) (string, int) {
+	tokens := strings.Split(subject, ".")
+	offset := 4
+	if len(tokens) >= 12 {
+		offset = 6
+	}
+	if len(tokens) < offset+2 {
+		return subject, 0
+	}
+	delivered, _ := strconv.Atoi(tokens[offset])
+	return tokens[offset+1], delivered
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func randomToken() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
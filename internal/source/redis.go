@@ -0,0 +1,193 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/redis"
+)
+
+// redisBlock is how long each XREADGROUP waits for new entries
+const redisBlock = 2 * time.Second
+
+// RedisOptions configures a Redis Streams source
+type RedisOptions struct {
+	// URL is redis://[user:pass@]host:port/db, or rediss:// for TLS
+	URL string
+	// Stream is the stream key
+	Stream string
+	// Group is the consumer group, created at the start of the stream if it
+	// does not exist
+	Group string
+	// Consumer names this instance within the group and must be unique
+	Consumer string
+	// Field is the entry field holding the JSON order. Entries without it
+	// are decoded from all their fields.
+	Field string
+	// ClaimIdle is how long an entry must be pending before it is claimed
+	// for redelivery, whether it was returned or its consumer died
+	ClaimIdle time.Duration
+	// MaxDeliver is the delivery attempt after which a failed entry is
+	// acknowledged instead of being left for redelivery
+	MaxDeliver int
+	// Insecure skips TLS certificate verification
+	Insecure bool
+}
+
+// Redis receives orders from a stream through a consumer group. Entries are
+// acknowledged with XACK; returned entries stay pending and are claimed with
+// XAUTOCLAIM once they have been idle for ClaimIdle.
+type Redis struct {
+	opts   RedisOptions
+	conn   *redis.Conn
+	cursor string
+}
+
+// DialRedis connects to the server and ensures the consumer group exists
+func DialRedis(opts RedisOptions) (*Redis, error) {
+	if opts.Stream == "" || opts.Group == "" || opts.Consumer == "" {
+		return nil, fmt.Errorf("Redis stream, group, and consumer are required")
+	}
+	conn, err := redis.Dial(opts.URL, opts.Insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.Do("XGROUP", "CREATE", opts.Stream, opts.Group, "0", "MKSTREAM")
+	var rerr redis.Error
+	if err != nil && !(errors.As(err, &rerr) && strings.HasPrefix(string(rerr), "BUSYGROUP")) {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create Redis consumer group: %w", err)
+	}
+	return &Redis{opts: opts, conn: conn, cursor: "0-0"}, nil
+}
+
+// Receive returns the next entry, preferring pending entries that are due
+// for redelivery over new ones
+func (r *Redis) Receive(ctx context.Context) (*Message, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		msg, err := r.claim()
+		if err != nil || msg != nil {
+			return msg, err
+		}
+
+		reply, err := r.conn.Do("XREADGROUP", "GROUP", r.opts.Group, r.opts.Consumer,
+			"COUNT", "1", "BLOCK", strconv.FormatInt(redisBlock.Milliseconds(), 10),
+			"STREAMS", r.opts.Stream, ">")
+		if err != nil {
+			return nil, fmt.Errorf("XREADGROUP failed: %w", err)
+		}
+		// [[stream, [[id, fields]]]], or nil when the block expired
+		streams, _ := reply.([]interface{})
+		if len(streams) == 0 {
+			continue
+		}
+		stream, _ := streams[0].([]interface{})
+		if len(stream) < 2 {
+			return nil, fmt.Errorf("malformed XREADGROUP reply")
+		}
+		entries, _ := stream[1].([]interface{})
+		if len(entries) == 0 {
+			continue
+		}
+		return r.message(entries[0], 1)
+	}
+}
+
+// claim takes over one pending entry that has been idle for ClaimIdle
+func (r *Redis) claim() (*Message, error) {
+	reply, err := r.conn.Do("XAUTOCLAIM", r.opts.Stream, r.opts.Group, r.opts.Consumer,
+		strconv.FormatInt(r.opts.ClaimIdle.Milliseconds(), 10), r.cursor, "COUNT", "1")
+	if err != nil {
+		return nil, fmt.Errorf("XAUTOCLAIM failed: %w", err)
+	}
+	// [next cursor, [[id, fields]], ...]
+	parts, _ := reply.([]interface{})
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("malformed XAUTOCLAIM reply")
+	}
+	r.cursor, _ = parts[0].(string)
+	entries, _ := parts[1].([]interface{})
+	if len(entries) == 0 || entries[0] == nil {
+		return nil, nil
+	}
+
+	entry, _ := entries[0].([]interface{})
+	if len(entry) == 0 {
+		return nil, fmt.Errorf("malformed XAUTOCLAIM reply")
+	}
+	id, _ := entry[0].(string)
+	return r.message(entries[0], r.deliveries(id))
+}
+
+// deliveries returns how many times a pending entry has been delivered
+func (r *Redis) deliveries(id string) int {
+	reply, err := r.conn.Do("XPENDING", r.opts.Stream, r.opts.Group, id, id, "1")
+	if err != nil {
+		return 0
+	}
+	// [[id, consumer, idle, deliveries]]
+	list, _ := reply.([]interface{})
+	if len(list) == 0 {
+		return 0
+	}
+	info, _ := list[0].([]interface{})
+	if len(info) < 4 {
+		return 0
+	}
+	n, _ := info[3].(int64)
+	return int(n)
+}
+
+// message converts a stream entry into a message
+func (r *Redis) message(raw interface{}, attempt int) (*Message, error) {
+	entry, _ := raw.([]interface{})
+	if len(entry) < 2 {
+		return nil, fmt.Errorf("malformed stream entry")
+	}
+	id, _ := entry[0].(string)
+	list, _ := entry[1].([]interface{})
+
+	fields := make(map[string]string, len(list)/2)
+	for i := 0; i+1 < len(list); i += 2 {
+		k, _ := list[i].(string)
+		v, _ := list[i+1].(string)
+		fields[k] = v
+	}
+	data := []byte(fields[r.opts.Field])
+	if _, ok := fields[r.opts.Field]; !ok {
+		data, _ = json.Marshal(fields)
+	}
+	return &Message{ID: id, Data: data, Attempt: attempt, ack: id}, nil
+}
+
+// Ack acknowledges an entry
+func (r *Redis) Ack(msg *Message) error {
+	if _, err := r.conn.Do("XACK", r.opts.Stream, r.opts.Group, msg.ack.(string)); err != nil {
+		return fmt.Errorf("failed to ack Redis entry %s: %w", msg.ID, err)
+	}
+	return nil
+}
+
+// Nak leaves an entry pending so it is claimed again after ClaimIdle, or
+// acknowledges it once it has been delivered MaxDeliver times
+func (r *Redis) Nak(msg *Message) error {
+	if r.opts.MaxDeliver > 0 && msg.Attempt >= r.opts.MaxDeliver {
+		return r.Ack(msg)
+	}
+	return nil
+}
+
+// Close closes the connection
+func (r *Redis) Close() error {
+	return r.conn.Close()
+}
@@ -0,0 +1,32 @@
+// Package source receives order records from message brokers, as an
+// alternative to reading them from a file.
+package source
+
+import "context"
+
+// Message is a single order record received from a source
+type Message struct {
+	// ID identifies the message in logs
+	ID string
+	// Data is the raw JSON order record
+	Data []byte
+	// Attempt is the delivery attempt, starting at 1, when the broker
+	// reports it
+	Attempt int
+
+	// ack holds source-specific state needed to acknowledge the message
+	ack interface{}
+}
+
+// Source delivers order records one at a time. Every message returned by
+// Receive must be settled with exactly one call to Ack or Nak.
+type Source interface {
+	// Receive blocks until a message is available or ctx is done
+	Receive(ctx context.Context) (*Message, error)
+	// Ack marks a message as handled so it is not delivered again
+	Ack(msg *Message) error
+	// Nak returns a message to the broker for redelivery
+	Nak(msg *Message) error
+	// Close releases the connection to the broker
+	Close() error
+}
@@ -0,0 +1,217 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/aws"
+	"github.com/fauzanelka/99tech-order-processor/internal/httpclient"
+)
+
+// sqsWaitSeconds is the long-poll duration of each receive
+const sqsWaitSeconds = 20
+
+// SQSOptions configures an SQS source
+type SQSOptions struct {
+	// QueueURL is the queue URL, e.g.
+	// https://sqs.us-east-1.amazonaws.com/123456789012/orders
+	QueueURL string
+	// Region overrides the region taken from the environment or queue URL
+	Region string
+	// Visibility is how long a received message stays hidden from other
+	// consumers. It is extended while the message is being processed.
+	Visibility time.Duration
+	// Insecure skips TLS certificate verification
+	Insecure bool
+}
+
+// SQS receives orders from an SQS queue. Messages are deleted once handled
+// and made visible again when returned, so the queue's redrive policy moves
+// repeatedly failing messages to its dead-letter queue.
+type SQS struct {
+	opts     SQSOptions
+	endpoint string
+	signer   *aws.Signer
+	client   *http.Client
+}
+
+// sqsPending tracks an unsettled message
+type sqsPending struct {
+	receipt string
+	stop    chan struct{}
+}
+
+// NewSQS creates an SQS source using the standard AWS credentials
+func NewSQS(opts SQSOptions) (*SQS, error) {
+	u, err := url.Parse(opts.QueueURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid SQS queue URL: %q", opts.QueueURL)
+	}
+	if opts.Visibility < 2*time.Second {
+		return nil, fmt.Errorf("SQS visibility timeout must be at least 2s")
+	}
+	region := opts.Region
+	if region == "" {
+		region = aws.Region()
+	}
+	if region == "" {
+		// sqs.<region>.amazonaws.com
+		if parts := strings.Split(u.Hostname(), "."); len(parts) >= 3 && parts[0] == "sqs" {
+			region = parts[1]
+		}
+	}
+	if region == "" {
+		return nil, fmt.Errorf("cannot determine the SQS region; set AWS_REGION")
+	}
+	creds, err := aws.LoadCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQS{
+		opts:     opts,
+		endpoint: u.Scheme + "://" + u.Host + "/",
+		signer:   &aws.Signer{Credentials: creds, Region: region, Service: "sqs"},
+		client: httpclient.New(httpclient.Options{
+			Timeout:  (sqsWaitSeconds + 10) * time.Second,
+			Insecure: opts.Insecure,
+		}),
+	}, nil
+}
+
+// Receive long-polls the queue for the next message
+func (s *SQS) Receive(ctx context.Context) (*Message, error) {
+	for {
+		var resp struct {
+			Messages []struct {
+				MessageID     string            `json:"MessageId"`
+				ReceiptHandle string            `json:"ReceiptHandle"`
+				Body          string            `json:"Body"`
+				Attributes    map[string]string `json:"Attributes"`
+			} `json:"Messages"`
+		}
+		err := s.call(ctx, "ReceiveMessage", map[string]interface{}{
+			"QueueUrl":            s.opts.QueueURL,
+			"MaxNumberOfMessages": 1,
+			"WaitTimeSeconds":     sqsWaitSeconds,
+			"VisibilityTimeout":   int(s.opts.Visibility / time.Second),
+			"AttributeNames":      []string{"ApproximateReceiveCount"},
+		}, &resp)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Messages) == 0 {
+			continue
+		}
+
+		m := resp.Messages[0]
+		attempt, _ := strconv.Atoi(m.Attributes["ApproximateReceiveCount"])
+		pending := &sqsPending{receipt: m.ReceiptHandle, stop: make(chan struct{})}
+		go s.extend(pending)
+		return &Message{ID: m.MessageID, Data: []byte(m.Body), Attempt: attempt, ack: pending}, nil
+	}
+}
+
+// extend keeps a message hidden while it is being processed, renewing its
+// visibility timeout halfway through each period
+func (s *SQS) extend(p *sqsPending) {
+	ticker := time.NewTicker(s.opts.Visibility / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			s.setVisibility(p.receipt, s.opts.Visibility)
+		}
+	}
+}
+
+// Ack deletes a message from the queue
+func (s *SQS) Ack(msg *Message) error {
+	p := msg.ack.(*sqsPending)
+	close(p.stop)
+	err := s.call(context.Background(), "DeleteMessage", map[string]interface{}{
+		"QueueUrl":      s.opts.QueueURL,
+		"ReceiptHandle": p.receipt,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete SQS message %s: %w", msg.ID, err)
+	}
+	return nil
+}
+
+// Nak makes a message visible again immediately
+func (s *SQS) Nak(msg *Message) error {
+	p := msg.ack.(*sqsPending)
+	close(p.stop)
+	if err := s.setVisibility(p.receipt, 0); err != nil {
+		return fmt.Errorf("failed to return SQS message %s: %w", msg.ID, err)
+	}
+	return nil
+}
+
+// Close is a no-op, since SQS is accessed over plain HTTP requests
+func (s *SQS) Close() error {
+	return nil
+}
+
+func (s *SQS) setVisibility(receipt string, d time.Duration) error {
+	return s.call(context.Background(), "ChangeMessageVisibility", map[string]interface{}{
+		"QueueUrl":          s.opts.QueueURL,
+		"ReceiptHandle":     receipt,
+		"VisibilityTimeout": int(d / time.Second),
+	}, nil)
+}
+
+// call invokes an SQS action using the AWS JSON protocol
+func (s *SQS) call(ctx context.Context, action string, input interface{}, output interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	s.signer.Sign(req, body, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("SQS %s failed: %w", action, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("SQS %s failed: %w", action, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &apiErr)
+		if apiErr.Type != "" {
+			return fmt.Errorf("SQS %s failed: %s: %s", action, apiErr.Type, apiErr.Message)
+		}
+		return fmt.Errorf("SQS %s failed with status %d", action, resp.StatusCode)
+	}
+	if output == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, output); err != nil {
+		return fmt.Errorf("invalid SQS %s response: %w", action, err)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	azureBlobSuffix = ".blob.core.windows.net"
+	azureResource   = "https://storage.azure.com/"
+	azureVersion    = "2021-08-06"
+	azureIMDS       = "http://169.254.169.254/metadata/identity/oauth2/token"
+)
+
+// azure accesses Azure Blob Storage. Requests are authorized with a SAS
+// token, taken from the URL or AZURE_STORAGE_SAS_TOKEN, or otherwise with a
+// managed identity token.
+type azure struct {
+	client *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func newAzure() (backend, error) {
+	return &azure{client: &http.Client{}}, nil
+}
+
+// isAzureURL reports whether u is an https blob URL
+func isAzureURL(u *url.URL) bool {
+	return u.Scheme == "https" && strings.HasSuffix(u.Hostname(), azureBlobSuffix)
+}
+
+func (a *azure) open(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	req, err := a.request(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", Redact(u.String()), err)
+	}
+	return resp.Body, nil
+}
+
+func (a *azure) upload(ctx context.Context, u *url.URL, r io.Reader, size int64) error {
+	req, err := a.request(ctx, http.MethodPut, u, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	resp, err := a.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (a *azure) size(ctx context.Context, u *url.URL) (int64, error) {
+	req, err := a.request(ctx, http.MethodHead, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := a.do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+// request builds an authorized request for the blob addressed by u, which is
+// az://container/blob or an https blob URL
+func (a *azure) request(ctx context.Context, method string, u *url.URL, body io.Reader) (*http.Request, error) {
+	target := *u
+	if u.Scheme == "az" {
+		endpoint := os.Getenv("AZURE_STORAGE_BLOB_ENDPOINT")
+		if endpoint == "" {
+			account := os.Getenv("AZURE_STORAGE_ACCOUNT")
+			if account == "" {
+				return nil, fmt.Errorf("AZURE_STORAGE_ACCOUNT must be set to use az:// URIs")
+			}
+			endpoint = "https://" + account + azureBlobSuffix
+		}
+		base, err := url.Parse(strings.TrimRight(endpoint, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid AZURE_STORAGE_BLOB_ENDPOINT: %w", err)
+		}
+		target = *base
+		target.Path = base.Path + "/" + u.Host + u.Path
+		target.RawQuery = u.RawQuery
+	}
+
+	bearer := false
+	if target.Query().Get("sig") == "" {
+		if sas := strings.TrimPrefix(os.Getenv("AZURE_STORAGE_SAS_TOKEN"), "?"); sas != "" {
+			if target.RawQuery != "" {
+				target.RawQuery += "&"
+			}
+			target.RawQuery += sas
+		} else {
+			bearer = true
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-ms-version", azureVersion)
+	if bearer {
+		token, err := a.managedIdentityToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// do sends a request, turning error statuses into errors
+func (a *azure) do(req *http.Request) (*http.Response, error) {
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s", Redact(err.Error()))
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, errNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		code := resp.Header.Get("x-ms-error-code")
+		if code == "" {
+			code = http.StatusText(resp.StatusCode)
+		}
+		return nil, fmt.Errorf("Azure returned status %d: %s", resp.StatusCode, code)
+	}
+	return resp, nil
+}
+
+// managedIdentityToken returns a cached storage token from the App Service
+// identity endpoint (IDENTITY_ENDPOINT) or the instance metadata service
+func (a *azure) managedIdentityToken(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Now().Before(a.expiry) {
+		return a.token, nil
+	}
+
+	query := url.Values{"resource": {azureResource}}
+	if id := os.Getenv("AZURE_CLIENT_ID"); id != "" {
+		query.Set("client_id", id)
+	}
+	endpoint := azureIMDS
+	header, value := "Metadata", "true"
+	if e := os.Getenv("IDENTITY_ENDPOINT"); e != "" {
+		endpoint = e
+		header, value = "X-IDENTITY-HEADER", os.Getenv("IDENTITY_HEADER")
+		query.Set("api-version", "2019-08-01")
+	} else {
+		query.Set("api-version", "2018-02-01")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(header, value)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("no SAS token given and no managed identity is available: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("failed to obtain managed identity token: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	// expires_in is a string in these responses
+	var token struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresIn   json.Number `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("invalid managed identity token response")
+	}
+	seconds, _ := strconv.Atoi(token.ExpiresIn.String())
+	a.token = token.AccessToken
+	a.expiry = time.Now().Add(time.Duration(seconds)*time.Second - time.Minute)
+	return a.token, nil
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// IsHTTP reports whether path is an HTTP(S) URL other than an Azure blob URL
+func IsHTTP(path string) bool {
+	u, err := url.Parse(path)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && !isAzureURL(u)
+}
+
+// Fetch downloads a file over HTTP(S), sending header with the request. The
+// body is streamed, so client should not have an overall timeout.
+func Fetch(ctx context.Context, client *http.Client, uri string, header http.Header) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %w", uri, err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", uri, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch %s: status %d", uri, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,174 @@
+// Package storage reads and writes files that may live on local disk or in
+// cloud object storage, addressed by URIs such as gs://bucket/object or
+// az://container/blob.
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// backend reads and writes objects for one URI scheme
+type backend interface {
+	open(ctx context.Context, u *url.URL) (io.ReadCloser, error)
+	upload(ctx context.Context, u *url.URL, r io.Reader, size int64) error
+	// size returns the size of an object, or errNotFound if there is none
+	size(ctx context.Context, u *url.URL) (int64, error)
+}
+
+// errNotFound is returned by backends for objects that do not exist
+var errNotFound = errors.New("object not found")
+
+// backends creates the backend for each supported scheme
+var backends = map[string]func() (backend, error){
+	"gs": newGCS,
+	"az": newAzure,
+}
+
+var (
+	mu      sync.Mutex
+	created = make(map[string]backend)
+)
+
+// IsRemote reports whether path is a URI handled by a storage backend
+func IsRemote(path string) bool {
+	u, err := url.Parse(path)
+	if err != nil {
+		return false
+	}
+	_, ok := backends[scheme(u)]
+	return ok
+}
+
+// scheme returns the backend scheme of u. Azure blob URLs are accepted in
+// their https form as well as az://.
+func scheme(u *url.URL) string {
+	if isAzureURL(u) {
+		return "az"
+	}
+	return u.Scheme
+}
+
+// Redact hides the signature of a SAS URL so it can be logged
+func Redact(uri string) string {
+	i := strings.Index(uri, "sig=")
+	if i < 0 {
+		return uri
+	}
+	end := strings.IndexAny(uri[i:], "& ")
+	if end < 0 {
+		return uri[:i] + "sig=REDACTED"
+	}
+	return uri[:i] + "sig=REDACTED" + uri[i+end:]
+}
+
+// Open opens a local file or remote object for reading
+func Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	if !IsRemote(path) {
+		return os.Open(path)
+	}
+	u, b, err := resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	return b.open(ctx, u)
+}
+
+// NonEmpty reports whether a local file or remote object exists and has
+// content, such as an output that a run would replace
+func NonEmpty(ctx context.Context, path string) (bool, error) {
+	if !IsRemote(path) {
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return info.Size() > 0, nil
+	}
+	u, b, err := resolve(path)
+	if err != nil {
+		return false, err
+	}
+	size, err := b.size(ctx, u)
+	if errors.Is(err, errNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check %s: %w", Redact(path), err)
+	}
+	return size > 0, nil
+}
+
+// Upload copies a local file to a remote object
+func Upload(ctx context.Context, localPath, uri string) error {
+	u, b, err := resolve(uri)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := b.upload(ctx, u, f, info.Size()); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", Redact(uri), err)
+	}
+	return nil
+}
+
+// StagingPath returns the local path where a remote output is written before
+// it is uploaded. The path is stable for a URI, so an interrupted run can be
+// resumed.
+func StagingPath(uri string) string {
+	sum := sha256.Sum256([]byte(uri))
+	u, _ := url.Parse(uri)
+	name := "output"
+	if u != nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		name = path.Base(u.Path)
+	}
+	return filepath.Join(os.TempDir(), "order-processor", hex.EncodeToString(sum[:8]), name)
+}
+
+// resolve parses a URI and returns its backend, creating it on first use
+func resolve(uri string) (*url.URL, backend, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid storage URI %q: %w", Redact(uri), err)
+	}
+	if u.Host == "" || len(u.Path) <= 1 {
+		return nil, nil, fmt.Errorf("invalid storage URI %q: expected %s://<bucket>/<object>", Redact(uri), u.Scheme)
+	}
+
+	s := scheme(u)
+	mu.Lock()
+	defer mu.Unlock()
+	if b, ok := created[s]; ok {
+		return u, b, nil
+	}
+	newBackend, ok := backends[s]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported storage scheme %q", u.Scheme)
+	}
+	b, err := newBackend()
+	if err != nil {
+		return nil, nil, err
+	}
+	created[s] = b
+	return u, b, nil
+}
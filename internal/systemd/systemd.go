@@ -0,0 +1,63 @@
+// Package systemd implements the sd_notify protocol, so the processor can
+// run as a Type=notify service with a watchdog.
+package systemd
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notify sends a state update, such as READY=1, to the service manager. It
+// does nothing when the process is not run by systemd with NOTIFY_SOCKET set.
+func Notify(state string) error {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil
+	}
+	// Abstract sockets are written with a leading @
+	if path[0] == '@' {
+		path = "\x00" + path[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// WatchdogInterval returns the watchdog timeout configured with WatchdogSec,
+// or 0 when the watchdog is not enabled for this process
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Watchdog pings the service manager at half the watchdog timeout until ctx
+// is done. It returns immediately when the watchdog is not enabled.
+func Watchdog(ctx context.Context) {
+	interval := WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			Notify("WATCHDOG=1")
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Package tracecontext propagates a W3C Trace Context
+// (https://www.w3.org/TR/trace-context/) to outbound requests, so the spans
+// of the services they reach join the trace of the job that started the
+// processor.
+package tracecontext
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// ParentHeader and StateHeader are the headers of a trace context
+	ParentHeader = "traceparent"
+	StateHeader  = "tracestate"
+)
+
+// Context is the trace context requests are sent in. All methods are safe
+// to call on a nil receiver, which sends no trace context.
+type Context struct {
+	traceID string
+	flags   string
+	state   string
+}
+
+// Parse parses a traceparent, such as
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01, and the
+// tracestate that came with it, which may be empty
+func Parse(parent, state string) (*Context, error) {
+	parts := strings.Split(strings.TrimSpace(parent), "-")
+	if len(parts) < 4 || !isHex(parts[0], 2) || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return nil, fmt.Errorf("invalid traceparent %q: want 00-<trace-id>-<parent-id>-<flags>", parent)
+	}
+	traceID, parentID, flags := parts[1], parts[2], parts[3]
+	if !isHex(traceID, 32) || traceID == strings.Repeat("0", 32) {
+		return nil, fmt.Errorf("invalid traceparent %q: trace ID must be 32 lowercase hex digits, not all zero", parent)
+	}
+	if !isHex(parentID, 16) || parentID == strings.Repeat("0", 16) {
+		return nil, fmt.Errorf("invalid traceparent %q: parent ID must be 16 lowercase hex digits, not all zero", parent)
+	}
+	if !isHex(flags, 2) {
+		return nil, fmt.Errorf("invalid traceparent %q: flags must be 2 lowercase hex digits", parent)
+	}
+	return &Context{traceID: traceID, flags: flags, state: strings.TrimSpace(state)}, nil
+}
+
+// TraceID returns the ID of the trace, or "" for a nil context
+func (c *Context) TraceID() string {
+	if c == nil {
+		return ""
+	}
+	return c.traceID
+}
+
+// Inject sets the trace context headers of a request, with a new span ID
+// for the request
+func (c *Context) Inject(h http.Header) {
+	if c == nil {
+		return
+	}
+	h.Set(ParentHeader, fmt.Sprintf("00-%s-%s-%s", c.traceID, newSpanID(), c.flags))
+	if c.state != "" {
+		h.Set(StateHeader, c.state)
+	}
+}
+
+// newSpanID returns a random span ID
+func newSpanID() string {
+	b := make([]byte, 8)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			panic(fmt.Sprintf("failed to generate span ID: %v", err))
+		}
+		if id := hex.EncodeToString(b); id != strings.Repeat("0", 16) {
+			return id
+		}
+	}
+}
+
+// isHex reports whether s is n lowercase hex digits
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,358 @@
+// Package transform reshapes JSON responses before they are written, with a
+// pipeline of jq-style steps or Go templates, such as:
+//
+//	.data | del(.links, .meta) | flatten
+//	{id: .order_id, state: .status.code}
+//	{"id": {{json .order_id}}, "filled": {{if eq .status "filled"}}true{{else}}false{{end}}}
+//
+// The jq-style steps are a path (.a.b), object construction ({name: .path},
+// or {name} for {name: .name}), del(.path, ...), rename(.path, "name"), and
+// flatten or flatten("sep"), chained with |. A step with {{ is a Go template
+// executed with the value as ., which must render JSON.
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// ErrNotJSON is the error for a response that is not JSON, which cannot be
+// transformed
+var ErrNotJSON = errors.New("response is not JSON")
+
+// filter is a single transformation of a decoded JSON value
+type filter func(v interface{}) (interface{}, error)
+
+// step is a transformation as it was given, for error messages
+type step struct {
+	expr    string
+	filters []filter
+}
+
+// Pipeline applies its steps to a response in order. All methods are safe to
+// call on a nil receiver, which leaves responses unchanged.
+type Pipeline struct {
+	steps []step
+}
+
+// New parses the steps of a pipeline, or returns nil if there are none. A
+// step of the form @FILE is read from FILE.
+func New(exprs []string) (*Pipeline, error) {
+	p := &Pipeline{}
+	for _, expr := range exprs {
+		if path, ok := strings.CutPrefix(strings.TrimSpace(expr), "@"); ok {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read transform: %w", err)
+			}
+			expr = string(data)
+		}
+		expr = strings.TrimSpace(expr)
+		if expr == "" {
+			continue
+		}
+		s := step{expr: expr}
+		if strings.Contains(expr, "{{") {
+			f, err := parseTemplate(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid transform %q: %w", expr, err)
+			}
+			s.filters = []filter{f}
+		} else {
+			for _, part := range splitTop(expr, '|') {
+				f, err := parseFilter(strings.TrimSpace(part))
+				if err != nil {
+					return nil, fmt.Errorf("invalid transform %q: %w", expr, err)
+				}
+				s.filters = append(s.filters, f)
+			}
+		}
+		p.steps = append(p.steps, s)
+	}
+	if len(p.steps) == 0 {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// Len returns the number of steps
+func (p *Pipeline) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.steps)
+}
+
+// Apply returns body transformed by the steps. A body that is not JSON
+// cannot be transformed and is an error.
+func (p *Pipeline) Apply(body []byte) ([]byte, error) {
+	if p == nil {
+		return body, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotJSON, err)
+	}
+	for _, s := range p.steps {
+		for _, f := range s.filters {
+			var err error
+			if v, err = f(v); err != nil {
+				return nil, fmt.Errorf("transform %q failed: %w", s.expr, err)
+			}
+		}
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transformed response: %w", err)
+	}
+	return out, nil
+}
+
+// parseTemplate parses a Go template step. In addition to the standard
+// functions, it can use json to encode a value as JSON.
+func parseTemplate(text string) (filter, error) {
+	tmpl, err := template.New("transform").Option("missingkey=zero").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return func(v interface{}) (interface{}, error) {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, v); err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(&buf)
+		dec.UseNumber()
+		var out interface{}
+		if err := dec.Decode(&out); err != nil {
+			return nil, fmt.Errorf("template output is not JSON: %w", err)
+		}
+		return out, nil
+	}, nil
+}
+
+// parseFilter parses a jq-style step
+func parseFilter(expr string) (filter, error) {
+	switch {
+	case strings.HasPrefix(expr, "."):
+		path, err := parsePath(expr)
+		if err != nil {
+			return nil, err
+		}
+		return func(v interface{}) (interface{}, error) { return get(v, path) }, nil
+	case strings.HasPrefix(expr, "{") && strings.HasSuffix(expr, "}"):
+		return parseObject(expr[1 : len(expr)-1])
+	}
+
+	name, args, ok := strings.Cut(expr, "(")
+	if ok {
+		if !strings.HasSuffix(args, ")") {
+			return nil, fmt.Errorf("missing ) in %q", expr)
+		}
+		args = args[:len(args)-1]
+	}
+	switch name {
+	case "del":
+		var paths [][]string
+		for _, arg := range splitTop(args, ',') {
+			path, err := parsePath(strings.TrimSpace(arg))
+			if err != nil {
+				return nil, err
+			}
+			if len(path) == 0 {
+				return nil, errors.New("del needs a field path, such as del(.meta)")
+			}
+			paths = append(paths, path)
+		}
+		return func(v interface{}) (interface{}, error) {
+			for _, path := range paths {
+				if parent, ok := lookup(v, path[:len(path)-1]).(map[string]interface{}); ok {
+					delete(parent, path[len(path)-1])
+				}
+			}
+			return v, nil
+		}, nil
+	case "rename":
+		parts := splitTop(args, ',')
+		if len(parts) != 2 {
+			return nil, errors.New(`rename needs a field path and a name, such as rename(.state, "status")`)
+		}
+		path, err := parsePath(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, err
+		}
+		to, err := strconv.Unquote(strings.TrimSpace(parts[1]))
+		if err != nil || len(path) == 0 {
+			return nil, errors.New(`rename needs a field path and a name, such as rename(.state, "status")`)
+		}
+		return func(v interface{}) (interface{}, error) {
+			parent, ok := lookup(v, path[:len(path)-1]).(map[string]interface{})
+			if !ok {
+				return v, nil
+			}
+			if val, ok := parent[path[len(path)-1]]; ok {
+				delete(parent, path[len(path)-1])
+				parent[to] = val
+			}
+			return v, nil
+		}, nil
+	case "flatten":
+		sep := "."
+		if strings.TrimSpace(args) != "" {
+			s, err := strconv.Unquote(strings.TrimSpace(args))
+			if err != nil {
+				return nil, errors.New(`flatten takes a quoted separator, such as flatten("_")`)
+			}
+			sep = s
+		}
+		return func(v interface{}) (interface{}, error) {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return v, nil
+			}
+			out := make(map[string]interface{})
+			flatten(out, "", sep, obj)
+			return out, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown step %q: want a path, {...}, del, rename, flatten, or a template", expr)
+}
+
+// parseObject parses the fields of an object construction
+func parseObject(body string) (filter, error) {
+	type field struct {
+		name string
+		path []string
+	}
+	var fields []field
+	for _, entry := range splitTop(body, ',') {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(entry, ":")
+		key = strings.TrimSpace(key)
+		if name, err := strconv.Unquote(key); err == nil {
+			key = name
+		}
+		if key == "" {
+			return nil, fmt.Errorf("invalid object field %q", entry)
+		}
+		path := []string{key}
+		if ok {
+			var err error
+			if path, err = parsePath(strings.TrimSpace(value)); err != nil {
+				return nil, err
+			}
+		}
+		fields = append(fields, field{name: key, path: path})
+	}
+	return func(v interface{}) (interface{}, error) {
+		out := make(map[string]interface{}, len(fields))
+		for _, f := range fields {
+			val, err := get(v, f.path)
+			if err != nil {
+				return nil, err
+			}
+			out[f.name] = val
+		}
+		return out, nil
+	}, nil
+}
+
+// parsePath parses a path such as .data.order, or . for the whole value
+func parsePath(s string) ([]string, error) {
+	if !strings.HasPrefix(s, ".") {
+		return nil, fmt.Errorf("invalid path %q: want dotted field names such as .data.order", s)
+	}
+	if s == "." {
+		return nil, nil
+	}
+	path := strings.Split(s[1:], ".")
+	for _, field := range path {
+		if field == "" || strings.ContainsAny(field, " ()[]{}|,:\"") {
+			return nil, fmt.Errorf("invalid path %q: want dotted field names such as .data.order", s)
+		}
+	}
+	return path, nil
+}
+
+// get returns the value at path, or nil if a field on the way is missing.
+// Indexing a value that is not an object is an error.
+func get(v interface{}, path []string) (interface{}, error) {
+	for i, field := range path {
+		switch obj := v.(type) {
+		case nil:
+			return nil, nil
+		case map[string]interface{}:
+			v = obj[field]
+		default:
+			return nil, fmt.Errorf("cannot get .%s of %s, which is not an object", field, "."+strings.Join(path[:i], "."))
+		}
+	}
+	return v, nil
+}
+
+// lookup returns the value at path, or nil if there is none
+func lookup(v interface{}, path []string) interface{} {
+	v, err := get(v, path)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+// flatten adds the fields of obj to out, with the fields of nested objects
+// named by their paths joined with sep
+func flatten(out map[string]interface{}, prefix, sep string, obj map[string]interface{}) {
+	for k, v := range obj {
+		if prefix != "" {
+			k = prefix + sep + k
+		}
+		if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+			flatten(out, k, sep, nested)
+			continue
+		}
+		out[k] = v
+	}
+}
+
+// splitTop splits s on sep where it is not inside quotes, parentheses, or
+// braces
+func splitTop(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case inQuote:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inQuote = false
+			}
+		case c == '"':
+			inQuote = true
+		case c == '(' || c == '{':
+			depth++
+		case c == ')' || c == '}':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
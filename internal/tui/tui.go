@@ -0,0 +1,177 @@
+// Package tui renders a live terminal dashboard of a run's progress.
+package tui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/fauzanelka/99tech-order-processor/internal/lifecycle"
+	"github.com/fauzanelka/99tech-order-processor/internal/progress"
+)
+
+const (
+	// refreshInterval is how often the dashboard is redrawn
+	refreshInterval = 500 * time.Millisecond
+	// rateWindow is the period the current rate is averaged over
+	rateWindow = 10 * time.Second
+	// maxInFlight is the number of in-flight orders listed
+	maxInFlight = 5
+	// lineWidth is the width long lines are truncated to
+	lineWidth = 100
+)
+
+// ANSI escape sequences
+const (
+	enterScreen = "\x1b[?1049h\x1b[?25l"
+	leaveScreen = "\x1b[?25h\x1b[?1049l"
+	clearScreen = "\x1b[H\x1b[2J"
+	bold        = "\x1b[1m"
+	red         = "\x1b[31m"
+	reset       = "\x1b[0m"
+)
+
+// sample is the processed count at a point in time
+type sample struct {
+	at        time.Time
+	processed int
+}
+
+// Dashboard redraws the progress of a run on a terminal. While it runs, log
+// output is suppressed; warnings and errors recorded by the tracker's log
+// hook are shown on the dashboard instead.
+type Dashboard struct {
+	out     io.Writer
+	title   string
+	tracker *progress.Tracker
+	logger  *logrus.Logger
+	logOut  io.Writer
+	samples []sample
+	stop    chan struct{}
+	done    sync.WaitGroup
+	once    sync.Once
+}
+
+// IsTerminal reports whether f is a terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Start takes over the terminal and draws the dashboard until Stop is called
+func Start(out io.Writer, title string, tracker *progress.Tracker, logger *logrus.Logger) *Dashboard {
+	d := &Dashboard{
+		out:     out,
+		title:   title,
+		tracker: tracker,
+		logger:  logger,
+		logOut:  logger.Out,
+		stop:    make(chan struct{}),
+	}
+	logger.SetOutput(io.Discard)
+
+	fmt.Fprint(out, enterScreen)
+	d.done.Add(1)
+	go d.run()
+	return d
+}
+
+// Stop restores the terminal and log output, then prints a final summary.
+// Only the first call has any effect.
+func (d *Dashboard) Stop() {
+	if d == nil {
+		return
+	}
+	d.once.Do(d.shutdown)
+}
+
+func (d *Dashboard) shutdown() {
+	close(d.stop)
+	d.done.Wait()
+	fmt.Fprint(d.out, leaveScreen)
+	d.logger.SetOutput(d.logOut)
+
+	s := d.tracker.Snapshot()
+	fmt.Fprintf(d.out, "Read %d, processed %d, failed %d, rejected %d in %s\n",
+		s.Read, s.Processed, s.Failed, s.Rejected, time.Since(s.Started).Round(time.Second))
+	if len(s.States) > 0 {
+		fmt.Fprintf(d.out, "Orders by state: %s\n", lifecycle.Format(s.States))
+	}
+}
+
+func (d *Dashboard) run() {
+	defer d.done.Done()
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+	for {
+		d.draw()
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// draw renders the dashboard in a single write so it does not flicker
+func (d *Dashboard) draw() {
+	s := d.tracker.Snapshot()
+	now := time.Now()
+
+	var b strings.Builder
+	b.WriteString(clearScreen)
+	fmt.Fprintf(&b, "%s%s%s  (running %s)\n\n", bold, d.title, reset, now.Sub(s.Started).Round(time.Second))
+	fmt.Fprintf(&b, "  Read        %8d\n", s.Read)
+	fmt.Fprintf(&b, "  Processed   %8d\n", s.Processed)
+	fmt.Fprintf(&b, "  Failed      %8d\n", s.Failed)
+	fmt.Fprintf(&b, "  Rejected    %8d\n", s.Rejected)
+	fmt.Fprintf(&b, "  Retry queue %8d\n", s.RetryQueue)
+	fmt.Fprintf(&b, "  Rate        %8.1f orders/s\n", d.rate(now, s.Processed))
+	if len(s.States) > 0 {
+		fmt.Fprintf(&b, "  States      %s\n", lifecycle.Format(s.States))
+	}
+	b.WriteString("\n")
+
+	fmt.Fprintf(&b, "%sIn flight (%d)%s\n", bold, len(s.InFlight), reset)
+	for i, f := range s.InFlight {
+		if i == maxInFlight {
+			fmt.Fprintf(&b, "  ... and %d more\n", len(s.InFlight)-maxInFlight)
+			break
+		}
+		fmt.Fprintf(&b, "  %-30s %s\n", truncate(f.OrderID, 30), now.Sub(f.Since).Round(100*time.Millisecond))
+	}
+
+	fmt.Fprintf(&b, "\n%sRecent errors%s\n", bold, reset)
+	for _, e := range s.Errors {
+		fmt.Fprintf(&b, "  %s %s%s%s\n", e.Time.Format("15:04:05"), red, truncate(e.Message, lineWidth), reset)
+	}
+	b.WriteString("\nPress Ctrl+C to stop\n")
+	io.WriteString(d.out, b.String())
+}
+
+// rate returns the orders processed per second over the rate window
+func (d *Dashboard) rate(now time.Time, processed int) float64 {
+	d.samples = append(d.samples, sample{at: now, processed: processed})
+	for len(d.samples) > 1 && now.Sub(d.samples[0].at) > rateWindow {
+		d.samples = d.samples[1:]
+	}
+	first := d.samples[0]
+	elapsed := now.Sub(first.at).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(processed-first.processed) / elapsed
+}
+
+// truncate shortens s to at most n characters
+func truncate(s string, n int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,143 @@
+// Package vault reads secrets from HashiCorp Vault, so that they need not be
+// passed in flags or environment variables.
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Prefix marks a flag value as a reference to a Vault secret
+const Prefix = "vault:"
+
+// IsRef reports whether value is a reference to a Vault secret
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Client reads secrets with a Vault token
+type Client struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+// New creates a client for the Vault server at addr
+func New(addr, token string, client *http.Client) (*Client, error) {
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid Vault address: %q", addr)
+	}
+	if token == "" {
+		return nil, errors.New("Vault token is required")
+	}
+	return &Client{addr: strings.TrimRight(addr, "/"), token: token, client: client}, nil
+}
+
+// Read returns the secret named by ref, of the form vault:path#field, such as
+// vault:secret/data/order-api#token. Both KV version 1 and version 2 paths
+// are supported; the field may be left out of secrets with a single field.
+func (c *Client) Read(ctx context.Context, ref string) (string, error) {
+	path, field, _ := strings.Cut(strings.TrimPrefix(ref, Prefix), "#")
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "", fmt.Errorf("invalid Vault reference %q: expected vault:path#field", ref)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, path, &secret); err != nil {
+		return "", fmt.Errorf("failed to read %s from Vault: %w", path, err)
+	}
+	data := secret.Data
+	// KV version 2 nests the fields with the secret's metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+
+	if field == "" {
+		if len(data) != 1 {
+			return "", fmt.Errorf("invalid Vault reference %q: %s has %d fields, name one with #field", ref, path, len(data))
+		}
+		for _, v := range data {
+			return fieldString(ref, v)
+		}
+	}
+	v, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("Vault secret %s has no field %q", path, field)
+	}
+	return fieldString(ref, v)
+}
+
+func fieldString(ref string, v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case float64, bool:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("Vault secret %q is not a string", ref)
+	}
+}
+
+// RenewSelf renews the client's token and returns its new lease duration,
+// or 0 if the token is not renewable
+func (c *Client) RenewSelf(ctx context.Context) (time.Duration, error) {
+	var secret struct {
+		Auth struct {
+			LeaseDuration int  `json:"lease_duration"`
+			Renewable     bool `json:"renewable"`
+		} `json:"auth"`
+	}
+	if err := c.do(ctx, http.MethodPost, "auth/token/renew-self", &secret); err != nil {
+		return 0, fmt.Errorf("failed to renew Vault token: %w", err)
+	}
+	if !secret.Auth.Renewable {
+		return 0, nil
+	}
+	return time.Duration(secret.Auth.LeaseDuration) * time.Second, nil
+}
+
+// do sends a request to the Vault API and decodes the response into v
+func (c *Client) do(ctx context.Context, method, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.addr+"/v1/"+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", c.token)
+	req.Header.Set("X-Vault-Request", "true")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(body, &vaultErr) == nil && len(vaultErr.Errors) > 0 {
+			return fmt.Errorf("status %d: %s", resp.StatusCode, strings.Join(vaultErr.Errors, "; "))
+		}
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
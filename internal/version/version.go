@@ -0,0 +1,26 @@
+// Package version reports the version of the order processor.
+package version
+
+import "runtime/debug"
+
+// Version is the release version, set when building with
+// -ldflags "-X github.com/fauzanelka/99tech-order-processor/internal/version.Version=1.2.3"
+var Version = ""
+
+// String returns the release version, or else the module version of a
+// binary built with go install, or dev
+func String() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
+
+// UserAgent returns the default User-Agent of HTTP requests, such as
+// order-processor/1.2.3
+func UserAgent() string {
+	return "order-processor/" + String()
+}
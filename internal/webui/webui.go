@@ -0,0 +1,200 @@
+// Package webui serves a small web dashboard showing the progress of jobs.
+package webui
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fauzanelka/99tech-order-processor/internal/lifecycle"
+	"github.com/fauzanelka/99tech-order-processor/internal/progress"
+)
+
+// Job is a unit of work shown on the dashboard
+type Job struct {
+	Name    string
+	Input   string
+	Output  string
+	Tracker *progress.Tracker
+	// Files are local files offered for download, by label, such as the
+	// output and rejects files. Files that do not exist yet are not listed.
+	Files map[string]string
+}
+
+// Server serves the dashboard for a fixed list of jobs
+type Server struct {
+	jobs []*Job
+	mux  *http.ServeMux
+}
+
+// New creates a dashboard server for jobs
+func New(jobs ...*Job) *Server {
+	s := &Server{jobs: jobs, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/", s.index)
+	s.mux.HandleFunc("/api/jobs", s.api)
+	s.mux.HandleFunc("/files/", s.file)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// jobView is a job as shown on the dashboard
+type jobView struct {
+	ID       int               `json:"id"`
+	Name     string            `json:"name"`
+	Input    string            `json:"input"`
+	Output   string            `json:"output"`
+	Progress progress.Snapshot `json:"progress"`
+	Failures []failureView     `json:"-"`
+	States   []stateView       `json:"-"`
+	Files    []string          `json:"files"`
+	Elapsed  time.Duration     `json:"-"`
+}
+
+// stateView is a row of a job's order states
+type stateView struct {
+	State lifecycle.State
+	Count int
+}
+
+// failureView is a row of a job's failure breakdown
+type failureView struct {
+	Reason string
+	Count  int
+}
+
+func (s *Server) views() []jobView {
+	views := make([]jobView, len(s.jobs))
+	for i, job := range s.jobs {
+		v := jobView{
+			ID:       i,
+			Name:     job.Name,
+			Input:    job.Input,
+			Output:   job.Output,
+			Progress: job.Tracker.Snapshot(),
+		}
+		v.Elapsed = time.Since(v.Progress.Started).Round(time.Second)
+		for reason, n := range v.Progress.Failures {
+			v.Failures = append(v.Failures, failureView{Reason: reason, Count: n})
+		}
+		sort.Slice(v.Failures, func(a, b int) bool {
+			if v.Failures[a].Count != v.Failures[b].Count {
+				return v.Failures[a].Count > v.Failures[b].Count
+			}
+			return v.Failures[a].Reason < v.Failures[b].Reason
+		})
+		if len(v.Progress.States) > 0 {
+			for _, state := range lifecycle.States {
+				v.States = append(v.States, stateView{State: state, Count: v.Progress.States[state]})
+			}
+		}
+		for label, path := range job.Files {
+			if _, err := os.Stat(path); err == nil {
+				v.Files = append(v.Files, label)
+			}
+		}
+		sort.Strings(v.Files)
+		views[i] = v
+	}
+	return views
+}
+
+func (s *Server) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	page.Execute(w, s.views())
+}
+
+func (s *Server) api(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.views())
+}
+
+// file serves /files/<job>/<label> as a download
+func (s *Server) file(w http.ResponseWriter, r *http.Request) {
+	id, label, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/files/"), "/")
+	i, err := strconv.Atoi(id)
+	if err != nil || i < 0 || i >= len(s.jobs) {
+		http.NotFound(w, r)
+		return
+	}
+	path, ok := s.jobs[i].Files[label]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(info.Name()))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+var page = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="2">
+<title>Order processor</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: 0.5em 0 1.5em; }
+th, td { text-align: left; padding: 0.25em 1em 0.25em 0; }
+td.n { text-align: right; font-variant-numeric: tabular-nums; }
+.job { border-top: 1px solid #ccc; padding-top: 1em; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Order processor</h1>
+<table>
+<tr><th>Job</th><th>Read</th><th>Processed</th><th>Failed</th><th>Rejected</th><th>Retry queue</th><th>Running</th></tr>
+{{range .}}<tr><td><a href="#job-{{.ID}}">{{.Name}}</a></td><td class="n">{{.Progress.Read}}</td><td class="n">{{.Progress.Processed}}</td><td class="n">{{.Progress.Failed}}</td><td class="n">{{.Progress.Rejected}}</td><td class="n">{{.Progress.RetryQueue}}</td><td>{{.Elapsed}}</td></tr>
+{{end}}</table>
+{{range .}}
+<div class="job" id="job-{{.ID}}">
+<h2>{{.Name}}</h2>
+<p>Input: {{.Input}}<br>Output: {{.Output}}</p>
+{{if .States}}<h3>Order states</h3>
+<table>
+{{range .States}}<tr><td>{{.State}}</td><td class="n">{{.Count}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Failures}}<h3>Failures</h3>
+<table>
+{{range .Failures}}<tr><td>{{.Reason}}</td><td class="n">{{.Count}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Progress.InFlight}}<h3>In flight</h3>
+<table>
+{{range .Progress.InFlight}}<tr><td>{{.OrderID}}</td><td>since {{.Since.Format "15:04:05"}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Progress.Errors}}<h3>Recent errors</h3>
+<table>
+{{range .Progress.Errors}}<tr><td>{{.Time.Format "15:04:05"}}</td><td class="error">{{.Message}}</td></tr>
+{{end}}</table>{{end}}
+{{$id := .ID}}{{if .Files}}<h3>Downloads</h3>
+<ul>
+{{range .Files}}<li><a href="/files/{{$id}}/{{.}}">{{.}}</a></li>
+{{end}}</ul>{{end}}
+</div>
+{{end}}
+</body>
+</html>
+`))